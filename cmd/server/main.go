@@ -11,6 +11,7 @@ import (
 	"tg-channel-repost-bot/internal/bot"
 	"tg-channel-repost-bot/internal/database"
 	"tg-channel-repost-bot/internal/scheduler"
+	"tg-channel-repost-bot/internal/server"
 	"tg-channel-repost-bot/internal/services"
 	"tg-channel-repost-bot/pkg/config"
 )
@@ -52,12 +53,13 @@ func main() {
 
 	// Create services
 	messageService := services.NewMessageService(api, repo, cfg)
+	mirrorService := services.NewMirrorService(repo, messageService)
 
 	// Create scheduler
 	sched := scheduler.New(repo, messageService, &cfg.Scheduler)
 
 	// Create bot
-	telegramBot, err := bot.New(cfg, repo, messageService)
+	telegramBot, err := bot.New(cfg, repo, messageService, mirrorService)
 	if err != nil {
 		log.Fatalf("Failed to create bot: %v", err)
 	}
@@ -66,6 +68,13 @@ func main() {
 	sched.Start()
 	defer sched.Stop()
 
+	// Start the redirect server of tracked button links
+	if cfg.Server.TracksClicks() {
+		redirectServer := server.New(repo, &cfg.Server)
+		redirectServer.Start()
+		defer redirectServer.Stop()
+	}
+
 	// Start bot in a goroutine
 	go func() {
 		if err := telegramBot.Start(); err != nil {
@@ -0,0 +1,289 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// variantModeNames maps A/B test variant modes to their display names
+var variantModeNames = map[models.VariantMode]string{
+	models.VariantModeSplit:     "按频道拆分",
+	models.VariantModeAlternate: "按周期轮换",
+}
+
+// describeVariants returns a short summary of a group's A/B test
+func describeVariants(group *models.ChannelGroup) string {
+	if !group.HasVariants() {
+		return "未进行"
+	}
+	return "进行中（" + variantModeNames[group.VariantMode] + "）"
+}
+
+// handleABTestAction handles the A/B test action of a group
+func (b *Bot) handleABTestAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "ab_test_")
+	if groupID == 0 {
+		return
+	}
+
+	b.showABTest(chatID, groupID)
+}
+
+// showABTest shows the A/B test of a group with the metrics of both variants
+func (b *Bot) showABTest(chatID int64, groupID int64) {
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	text := fmt.Sprintf("🧪 *A/B 测试：%s*\n\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdown, group.Name))
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+
+	if !group.HasVariants() {
+		text += "当前未进行 A/B 测试。\n\n" +
+			"设置 B 版本模板后开始测试，A 版本为当前组模板：\n" +
+			"• 按频道拆分：编号为奇数的频道发送 B 版本，其余发送 A 版本\n" +
+			"• 按周期轮换：每次重发所有频道在 A、B 版本之间切换\n\n" +
+			"B 版本创建时沿用 A 版本的按钮，可单独修改。设置了单独模板的频道不参与测试。"
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ 设置B版本模板", fmt.Sprintf("ab_variant_%d", groupID)),
+		))
+	} else {
+		text += fmt.Sprintf("分配方式：%s\n\n", variantModeNames[group.VariantMode])
+		for _, variant := range []struct {
+			name       string
+			templateID int64
+		}{
+			{models.VariantA, group.MessageID},
+			{models.VariantB, group.VariantTemplateID},
+		} {
+			stats, err := b.repo.GetVariantStats(groupID, variant.name, variant.templateID)
+			if err != nil {
+				log.Printf("Failed to load stats of variant %s for group %d: %v", variant.name, groupID, err)
+				text += fmt.Sprintf("*%s 版本*：加载统计失败\n\n", variant.name)
+				continue
+			}
+			text += fmt.Sprintf("*%s 版本*\n发送成功 %d · 失败 %d\n点击 %d · 投票 %d\n", variant.name, stats.Sent, stats.Failed, stats.Clicks, stats.Votes)
+			if stats.Sent > 0 {
+				text += fmt.Sprintf("平均每次发送：点击 %.2f · 投票 %.2f\n",
+					float64(stats.Clicks)/float64(stats.Sent), float64(stats.Votes)/float64(stats.Sent))
+			}
+			text += "\n"
+		}
+		text += "选出效果更好的版本后点击采用，该版本将成为组模板并结束测试。"
+
+		otherMode := models.VariantModeAlternate
+		if group.VariantMode == models.VariantModeAlternate {
+			otherMode = models.VariantModeSplit
+		}
+		keyboard = append(keyboard,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✏️ 修改B版本模板", fmt.Sprintf("ab_variant_%d", groupID)),
+				tgbotapi.NewInlineKeyboardButtonData("🔘 修改B版本按钮", fmt.Sprintf("ab_buttons_%d", groupID)),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🔀 改为"+variantModeNames[otherMode], fmt.Sprintf("ab_mode_%d", groupID)),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🏆 采用A版本", fmt.Sprintf("ab_promote_A_%d", groupID)),
+				tgbotapi.NewInlineKeyboardButtonData("🏆 采用B版本", fmt.Sprintf("ab_promote_B_%d", groupID)),
+			),
+		)
+	}
+
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回编辑选项", fmt.Sprintf("edit_group_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleABVariantAction asks for the content of variant B
+func (b *Bot) handleABVariantAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "ab_variant_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "edit_variant_template", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	msg := tgbotapi.NewMessage(chatID, "✏️ *设置B版本模板*\n\n"+
+		"请发送B版本的模板内容（文字消息或图片消息，支持格式化）：")
+	msg.ParseMode = "Markdown"
+	b.api.Send(msg)
+}
+
+// handleEditVariantTemplate saves the content of variant B from a message, starting the test when
+// the group has no variant yet
+func (b *Bot) handleEditVariantTemplate(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	messageType, content, mediaURL, entitiesJSON, ok := b.extractTemplateContent(message)
+	if !ok {
+		b.sendMessage(chatID, "❌ 请发送文字消息或图片消息作为模板内容")
+		return
+	}
+
+	if group.HasVariants() {
+		err = b.repo.UpdateMessageTemplateComplete(group.VariantTemplateID, content, string(messageType), mediaURL, entitiesJSON)
+	} else {
+		buttons := models.InlineKeyboard{}
+		if original, err := b.repo.GetMessageTemplate(group.MessageID); err == nil {
+			buttons = original.Buttons
+		}
+		template := &models.MessageTemplate{
+			Title:       fmt.Sprintf("%s B版本", group.Name),
+			Content:     content,
+			MessageType: messageType,
+			MediaURL:    mediaURL,
+			Buttons:     buttons,
+			Entities:    entitiesJSON,
+		}
+		err = b.repo.CreateMessageTemplate(template)
+		if err == nil {
+			err = b.repo.UpdateChannelGroupVariant(groupID, template.ID, group.VariantMode)
+		}
+	}
+
+	if err != nil {
+		b.sendMessage(chatID, "❌ 保存B版本模板失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, "✅ B版本模板已保存")
+	b.warnIfSplit(chatID, messageType, content)
+
+	b.showABTest(chatID, groupID)
+}
+
+// handleABButtonsAction asks for the buttons of variant B
+func (b *Bot) handleABButtonsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "ab_buttons_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "edit_variant_buttons", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	b.sendMessage(chatID, "🔘 *设置B版本按钮*\n\n请输入B版本的按钮，一行一个，输入 `无` 清除按钮：\n\n**格式：**\n`按钮文字|链接URL`\n"+buttonTypesHelp)
+}
+
+// handleEditVariantButtons saves the buttons of variant B
+func (b *Bot) handleEditVariantButtons(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil || !group.HasVariants() {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 该组没有进行中的 A/B 测试")
+		return
+	}
+
+	buttons := models.InlineKeyboard{}
+	if strings.TrimSpace(input) != "无" {
+		buttonRows, err := b.parseBatchButtons(input, "single")
+		if err != nil {
+			b.sendMessage(chatID, "❌ "+err.Error())
+			return
+		}
+		buttons = models.InlineKeyboard(buttonRows)
+	}
+
+	if err := b.repo.UpdateMessageTemplateButtons(group.VariantTemplateID, buttons); err != nil {
+		b.sendMessage(chatID, "❌ 保存按钮失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, fmt.Sprintf("✅ 已保存 %d 行B版本按钮", len(buttons)))
+	b.showABTest(chatID, groupID)
+}
+
+// handleABModeAction switches how the variants of a group's A/B test are assigned
+func (b *Bot) handleABModeAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "ab_mode_")
+	if groupID == 0 {
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	mode := models.VariantModeAlternate
+	if group.VariantMode == models.VariantModeAlternate {
+		mode = models.VariantModeSplit
+	}
+	if err := b.repo.UpdateChannelGroupVariant(groupID, group.VariantTemplateID, mode); err != nil {
+		b.sendMessage(chatID, "❌ 切换分配方式失败："+err.Error())
+		return
+	}
+
+	b.showABTest(chatID, groupID)
+}
+
+// handleABPromoteAction ends a group's A/B test keeping the chosen variant: ab_promote_{A|B}_{groupID}.
+// The chosen variant becomes the group template and the other template is deleted.
+func (b *Bot) handleABPromoteAction(chatID int64, data string) {
+	parts := strings.Split(data, "_")
+	if len(parts) != 4 || (parts[2] != models.VariantA && parts[2] != models.VariantB) {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil || !group.HasVariants() {
+		b.sendMessage(chatID, "❌ 该组没有进行中的 A/B 测试")
+		return
+	}
+
+	discarded := group.VariantTemplateID
+	if parts[2] == models.VariantB {
+		discarded = group.MessageID
+		if err := b.repo.UpdateChannelGroupMessageID(groupID, group.VariantTemplateID); err != nil {
+			b.sendMessage(chatID, "❌ 采用B版本失败："+err.Error())
+			return
+		}
+	}
+
+	if err := b.repo.UpdateChannelGroupVariant(groupID, 0, group.VariantMode); err != nil {
+		b.sendMessage(chatID, "❌ 结束测试失败："+err.Error())
+		return
+	}
+	if err := b.repo.DeleteMessageTemplate(discarded); err != nil {
+		log.Printf("Failed to delete discarded variant template %d: %v", discarded, err)
+	}
+
+	b.sendMessage(chatID, fmt.Sprintf("🏆 已采用%s版本作为组模板，A/B 测试已结束", parts[2]))
+	b.showABTest(chatID, groupID)
+}
@@ -14,6 +14,8 @@ import (
 	"tg-channel-repost-bot/internal/models"
 	"tg-channel-repost-bot/internal/services"
 	"tg-channel-repost-bot/pkg/config"
+	"tg-channel-repost-bot/pkg/entityutil"
+	"tg-channel-repost-bot/pkg/markup"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -29,6 +31,7 @@ type Bot struct {
 	api        *tgbotapi.BotAPI
 	repo       *database.Repository
 	service    *services.MessageService
+	mirror     *services.MirrorService
 	config     *config.Config
 	updates    tgbotapi.UpdatesChannel
 	userStates map[int64]*UserState
@@ -42,7 +45,7 @@ type Bot struct {
 }
 
 // New creates a new bot instance
-func New(cfg *config.Config, repo *database.Repository, service *services.MessageService) (*Bot, error) {
+func New(cfg *config.Config, repo *database.Repository, service *services.MessageService, mirror *services.MirrorService) (*Bot, error) {
 	api, err := tgbotapi.NewBotAPI(cfg.Telegram.BotToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot API: %w", err)
@@ -56,6 +59,7 @@ func New(cfg *config.Config, repo *database.Repository, service *services.Messag
 		api:            api,
 		repo:           repo,
 		service:        service,
+		mirror:         mirror,
 		config:         cfg,
 		userStates:     make(map[int64]*UserState),
 		operationLocks: make(map[int64]*sync.Mutex),
@@ -250,6 +254,15 @@ func (b *Bot) handleUpdate(update tgbotapi.Update) {
 	} else if update.CallbackQuery != nil {
 		log.Printf("DEBUG: Processing callback query update with data='%s'", update.CallbackQuery.Data)
 		b.handleCallbackQuery(update.CallbackQuery)
+	} else if update.ChannelPost != nil {
+		log.Printf("DEBUG: Processing channel post update from chat %d", update.ChannelPost.Chat.ID)
+		b.handleChannelPost(update.ChannelPost)
+	} else if update.Poll != nil {
+		log.Printf("DEBUG: Processing poll update for poll %s", update.Poll.ID)
+		b.service.RecordPollUpdate(update.Poll)
+	} else if update.MyChatMember != nil {
+		log.Printf("DEBUG: Processing my_chat_member update for chat %d", update.MyChatMember.Chat.ID)
+		b.handleMyChatMember(update.MyChatMember)
 	} else {
 		log.Printf("DEBUG: Unknown update type")
 	}
@@ -285,6 +298,8 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 		b.sendMainMenu(message.Chat.ID)
 	case "help":
 		b.sendHelp(message.Chat.ID)
+	case "template":
+		b.handleTemplateCommand(message.Chat.ID)
 	default:
 		b.sendMessage(message.Chat.ID, "未知命令。使用 /start 查看可用选项。")
 	}
@@ -310,6 +325,46 @@ func (b *Bot) handleTextMessage(message *tgbotapi.Message) {
 			b.handleInputPushMessageWithEntities(chatID, message, userState)
 			return
 		}
+		// Special handling for add_mirror_source state to accept forwarded channel posts
+		if userState.State == "add_mirror_source" {
+			b.handleAddMirrorSource(chatID, message, userState)
+			return
+		}
+		// Special handling for edit_channel_template state to preserve entities
+		if userState.State == "edit_channel_template" {
+			b.handleEditChannelTemplate(chatID, message, userState)
+			return
+		}
+		// Special handling for edit_variant_template state to preserve entities
+		if userState.State == "edit_variant_template" {
+			b.handleEditVariantTemplate(chatID, message, userState)
+			return
+		}
+		// Special handling for author_template state to accept uploaded template files
+		if userState.State == "author_template" {
+			b.handleAuthorTemplate(chatID, message, userState)
+			return
+		}
+		// Special handling for channel imports to accept uploaded channel files
+		if userState.State == "import_channels" || userState.State == "confirm_channel_import" {
+			b.handleImportChannels(chatID, message, userState)
+			return
+		}
+		// Special handling for edit_group_footer state to preserve entities
+		if userState.State == "edit_group_footer" {
+			b.handleEditGroupFooter(chatID, message, userState)
+			return
+		}
+		// Special handling for edit_translation state to preserve entities
+		if userState.State == "edit_translation" {
+			b.handleEditTranslation(chatID, message, userState)
+			return
+		}
+		// Special handling for edit_poll_template state to accept poll messages
+		if userState.State == "edit_poll_template" {
+			b.handleEditPollTemplate(chatID, message, userState)
+			return
+		}
 		// Special handling for edit_group_template state to preserve entities
 		if userState.State == "edit_group_template" {
 			log.Printf("DEBUG: Calling handleEditGroupTemplateWithEntities for user %d", chatID)
@@ -326,6 +381,16 @@ func (b *Bot) handleTextMessage(message *tgbotapi.Message) {
 
 // handleCallbackQuery handles callback queries from inline keyboards
 func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
+	// Buttons of published messages are pressed by channel subscribers and answered on their own
+	if strings.HasPrefix(query.Data, models.ButtonCallbackPrefix) {
+		b.handleButtonCallback(query)
+		return
+	}
+	if strings.HasPrefix(query.Data, models.VoteCallbackPrefix) {
+		b.handleVoteCallback(query)
+		return
+	}
+
 	// Acknowledge the callback query
 	callback := tgbotapi.NewCallback(query.ID, "")
 	b.api.Request(callback)
@@ -348,9 +413,189 @@ func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	case data == "view_records":
 		log.Printf("DEBUG: Matched view_records")
 		b.sendRecordsMenu(chatID)
+	case data == "records_votes":
+		log.Printf("DEBUG: Matched records_votes")
+		b.showVoteStats(chatID)
+	case data == "records_clicks":
+		log.Printf("DEBUG: Matched records_clicks")
+		b.showClickStats(chatID)
+	case data == "records_polls":
+		log.Printf("DEBUG: Matched records_polls")
+		b.showPollResults(chatID)
 	case data == "settings":
 		log.Printf("DEBUG: Matched settings")
 		b.sendSettingsMenu(chatID)
+	case data == "mirror_rules":
+		log.Printf("DEBUG: Matched mirror_rules")
+		b.showMirrorRules(chatID)
+	case data == "mirror_add":
+		log.Printf("DEBUG: Matched mirror_add")
+		b.handleMirrorAddAction(chatID)
+	case strings.HasPrefix(data, "mirror_target_"):
+		log.Printf("DEBUG: Matched mirror_target_ prefix")
+		b.handleMirrorTargetAction(chatID, data)
+	case strings.HasPrefix(data, "mirror_rule_"):
+		log.Printf("DEBUG: Matched mirror_rule_ prefix")
+		b.handleMirrorRuleAction(chatID, data)
+	case strings.HasPrefix(data, "mirror_toggle_"):
+		log.Printf("DEBUG: Matched mirror_toggle_ prefix")
+		b.handleMirrorToggleAction(chatID, data)
+	case strings.HasPrefix(data, "mirror_filters_"):
+		log.Printf("DEBUG: Matched mirror_filters_ prefix")
+		b.handleMirrorFiltersAction(chatID, data)
+	case strings.HasPrefix(data, "mirror_delete_"):
+		log.Printf("DEBUG: Matched mirror_delete_ prefix")
+		b.handleMirrorDeleteAction(chatID, data)
+	case strings.HasPrefix(data, "mirror_confirm_delete_"):
+		log.Printf("DEBUG: Matched mirror_confirm_delete_ prefix")
+		b.handleMirrorConfirmDeleteAction(chatID, data)
+	case strings.HasPrefix(data, "author_template_"):
+		log.Printf("DEBUG: Matched author_template_ prefix")
+		b.handleAuthorTemplateAction(chatID, data)
+	case strings.HasPrefix(data, "author_format_"):
+		log.Printf("DEBUG: Matched author_format_ prefix")
+		b.handleAuthorFormatAction(chatID, data)
+	case strings.HasPrefix(data, "send_options_"):
+		log.Printf("DEBUG: Matched send_options_ prefix")
+		b.handleSendOptionsAction(chatID, data)
+	case strings.HasPrefix(data, "send_opt_"):
+		log.Printf("DEBUG: Matched send_opt_ prefix")
+		b.handleSendOptionToggleAction(chatID, data)
+	case strings.HasPrefix(data, "push_options_"):
+		log.Printf("DEBUG: Matched push_options_ prefix")
+		b.handlePushOptionsAction(chatID, data)
+	case strings.HasPrefix(data, "push_opt_"):
+		log.Printf("DEBUG: Matched push_opt_ prefix")
+		b.handlePushOptionAction(chatID, data)
+	case strings.HasPrefix(data, "translations_"):
+		log.Printf("DEBUG: Matched translations_ prefix")
+		b.handleTranslationsAction(chatID, data)
+	case strings.HasPrefix(data, "tr_add_"):
+		log.Printf("DEBUG: Matched tr_add_ prefix")
+		b.handleTranslationAddAction(chatID, data)
+	case strings.HasPrefix(data, "tr_edit_"):
+		log.Printf("DEBUG: Matched tr_edit_ prefix")
+		b.handleTranslationEditAction(chatID, data)
+	case strings.HasPrefix(data, "tr_buttons_"):
+		log.Printf("DEBUG: Matched tr_buttons_ prefix")
+		b.handleTranslationButtonsAction(chatID, data)
+	case strings.HasPrefix(data, "tr_delete_"):
+		log.Printf("DEBUG: Matched tr_delete_ prefix")
+		b.handleTranslationDeleteAction(chatID, data)
+	case strings.HasPrefix(data, "poll_template_"):
+		log.Printf("DEBUG: Matched poll_template_ prefix")
+		b.handlePollTemplateAction(chatID, data)
+	case data == "cleanup_groups":
+		log.Printf("DEBUG: Matched cleanup_groups")
+		b.showGroupSelectionForCleanup(chatID)
+	case strings.HasPrefix(data, "cleanup_all_"):
+		log.Printf("DEBUG: Matched cleanup_all_ prefix")
+		b.handleCleanupAllAction(chatID, data)
+	case strings.HasPrefix(data, "cleanup_days_"):
+		log.Printf("DEBUG: Matched cleanup_days_ prefix")
+		b.handleCleanupDaysAction(chatID, data)
+	case strings.HasPrefix(data, "cleanup_range_"):
+		log.Printf("DEBUG: Matched cleanup_range_ prefix")
+		b.handleCleanupRangeAction(chatID, data)
+	case strings.HasPrefix(data, "cleanup_run_"):
+		log.Printf("DEBUG: Matched cleanup_run_ prefix")
+		b.handleCleanupRunAction(chatID, data)
+	case strings.HasPrefix(data, "cleanup_"):
+		log.Printf("DEBUG: Matched cleanup_ prefix")
+		b.handleCleanupAction(chatID, data)
+	case strings.HasPrefix(data, "known_add_"):
+		log.Printf("DEBUG: Matched known_add_ prefix")
+		b.handleKnownAddAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_channels_"):
+		log.Printf("DEBUG: Matched bulk_channels_ prefix")
+		b.handleBulkChannelsAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_sel_"):
+		log.Printf("DEBUG: Matched bulk_sel_ prefix")
+		b.handleBulkSelectAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_all_"):
+		log.Printf("DEBUG: Matched bulk_all_ prefix")
+		b.handleBulkSelectAllAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_none_"):
+		log.Printf("DEBUG: Matched bulk_none_ prefix")
+		b.handleBulkSelectAllAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_on_"):
+		log.Printf("DEBUG: Matched bulk_on_ prefix")
+		b.handleBulkStatusAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_off_"):
+		log.Printf("DEBUG: Matched bulk_off_ prefix")
+		b.handleBulkStatusAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_move_"):
+		log.Printf("DEBUG: Matched bulk_move_ prefix")
+		b.handleBulkTargetAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_copy_"):
+		log.Printf("DEBUG: Matched bulk_copy_ prefix")
+		b.handleBulkTargetAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_show_"):
+		log.Printf("DEBUG: Matched bulk_show_ prefix")
+		b.handleBulkShowAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_to_"):
+		log.Printf("DEBUG: Matched bulk_to_ prefix")
+		b.handleBulkTransferAction(chatID, data)
+	case strings.HasPrefix(data, "bulk_done_"):
+		log.Printf("DEBUG: Matched bulk_done_ prefix")
+		b.handleBulkDoneAction(chatID, data)
+	case strings.HasPrefix(data, "import_channels_"):
+		log.Printf("DEBUG: Matched import_channels_ prefix")
+		b.handleImportChannelsAction(chatID, data)
+	case strings.HasPrefix(data, "import_confirm_"):
+		log.Printf("DEBUG: Matched import_confirm_ prefix")
+		b.handleImportConfirmAction(chatID, data)
+	case strings.HasPrefix(data, "import_cancel_"):
+		log.Printf("DEBUG: Matched import_cancel_ prefix")
+		b.handleImportCancelAction(chatID, data)
+	case strings.HasPrefix(data, "export_channels_"):
+		log.Printf("DEBUG: Matched export_channels_ prefix")
+		b.handleExportChannelsAction(chatID, data)
+	case strings.HasPrefix(data, "tag_rule_"):
+		log.Printf("DEBUG: Matched tag_rule_ prefix")
+		b.handleTagRuleAction(chatID, data)
+	case strings.HasPrefix(data, "check_channels_"):
+		log.Printf("DEBUG: Matched check_channels_ prefix")
+		b.handleCheckChannelsAction(chatID, data)
+	case strings.HasPrefix(data, "ab_test_"):
+		log.Printf("DEBUG: Matched ab_test_ prefix")
+		b.handleABTestAction(chatID, data)
+	case strings.HasPrefix(data, "ab_variant_"):
+		log.Printf("DEBUG: Matched ab_variant_ prefix")
+		b.handleABVariantAction(chatID, data)
+	case strings.HasPrefix(data, "ab_buttons_"):
+		log.Printf("DEBUG: Matched ab_buttons_ prefix")
+		b.handleABButtonsAction(chatID, data)
+	case strings.HasPrefix(data, "ab_mode_"):
+		log.Printf("DEBUG: Matched ab_mode_ prefix")
+		b.handleABModeAction(chatID, data)
+	case strings.HasPrefix(data, "ab_promote_"):
+		log.Printf("DEBUG: Matched ab_promote_ prefix")
+		b.handleABPromoteAction(chatID, data)
+	case strings.HasPrefix(data, "footer_settings_"):
+		log.Printf("DEBUG: Matched footer_settings_ prefix")
+		b.handleFooterSettingsAction(chatID, data)
+	case strings.HasPrefix(data, "footer_text_"):
+		log.Printf("DEBUG: Matched footer_text_ prefix")
+		b.handleFooterTextAction(chatID, data)
+	case strings.HasPrefix(data, "footer_buttons_"):
+		log.Printf("DEBUG: Matched footer_buttons_ prefix")
+		b.handleFooterButtonsAction(chatID, data)
+	case strings.HasPrefix(data, "footer_clear_"):
+		log.Printf("DEBUG: Matched footer_clear_ prefix")
+		b.handleFooterClearAction(chatID, data)
+	case strings.HasPrefix(data, "rewrite_rules_"):
+		log.Printf("DEBUG: Matched rewrite_rules_ prefix")
+		b.handleRewriteRulesAction(chatID, data)
+	case strings.HasPrefix(data, "rewrite_add_"):
+		log.Printf("DEBUG: Matched rewrite_add_ prefix")
+		b.handleRewriteAddAction(chatID, data)
+	case strings.HasPrefix(data, "rewrite_type_"):
+		log.Printf("DEBUG: Matched rewrite_type_ prefix")
+		b.handleRewriteTypeAction(chatID, data)
+	case strings.HasPrefix(data, "rewrite_del_"):
+		log.Printf("DEBUG: Matched rewrite_del_ prefix")
+		b.handleRewriteDeleteAction(chatID, data)
 	case strings.HasPrefix(data, "group_layout_single_"):
 		log.Printf("DEBUG: Matched group_layout_single_ prefix")
 		b.handleGroupLayoutChoice(chatID, data, "single")
@@ -375,6 +620,24 @@ func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	case strings.HasPrefix(data, "confirm_delete_channel_"):
 		log.Printf("DEBUG: Matched confirm_delete_channel_ prefix")
 		b.handleConfirmDeleteChannelAction(chatID, data)
+	case strings.HasPrefix(data, "channel_settings_"):
+		log.Printf("DEBUG: Matched channel_settings_ prefix")
+		b.handleChannelSettingsAction(chatID, data)
+	case strings.HasPrefix(data, "channel_template_"):
+		log.Printf("DEBUG: Matched channel_template_ prefix")
+		b.handleChannelTemplateAction(chatID, data)
+	case strings.HasPrefix(data, "channel_buttons_"):
+		log.Printf("DEBUG: Matched channel_buttons_ prefix")
+		b.handleChannelButtonsAction(chatID, data)
+	case strings.HasPrefix(data, "channel_tags_"):
+		log.Printf("DEBUG: Matched channel_tags_ prefix")
+		b.handleChannelTagsAction(chatID, data)
+	case strings.HasPrefix(data, "channel_language_"):
+		log.Printf("DEBUG: Matched channel_language_ prefix")
+		b.handleChannelLanguageAction(chatID, data)
+	case strings.HasPrefix(data, "channel_reset_"):
+		log.Printf("DEBUG: Matched channel_reset_ prefix")
+		b.handleChannelResetAction(chatID, data)
 	case strings.HasPrefix(data, "delete_channel_"):
 		log.Printf("DEBUG: Matched delete_channel_ prefix")
 		b.handleDeleteChannelAction(chatID, data)
@@ -399,6 +662,9 @@ func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	case strings.HasPrefix(data, "custom_repost_"):
 		log.Printf("DEBUG: Matched custom_repost_ prefix")
 		b.handleCustomRepostAction(chatID, data)
+	case data == "forward_buttons":
+		log.Printf("DEBUG: Matched forward_buttons")
+		b.handleForwardButtonsAction(chatID)
 	case strings.HasPrefix(data, "forward_"):
 		log.Printf("DEBUG: Matched forward_ prefix")
 		b.handleForwardAction(chatID, data)
@@ -432,6 +698,12 @@ func (b *Bot) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	case strings.HasPrefix(data, "toggle_pin_"):
 		log.Printf("DEBUG: Matched toggle_pin_ prefix")
 		b.handleTogglePinAction(chatID, data)
+	case strings.HasPrefix(data, "apply_live_"):
+		log.Printf("DEBUG: Matched apply_live_ prefix")
+		b.handleApplyLiveAction(chatID, data)
+	case strings.HasPrefix(data, "toggle_repost_mode_"):
+		log.Printf("DEBUG: Matched toggle_repost_mode_ prefix")
+		b.handleToggleRepostModeAction(chatID, data)
 	case strings.HasPrefix(data, "manage_buttons_"):
 		log.Printf("DEBUG: Matched manage_buttons_ prefix")
 		b.handleManageButtonsAction(chatID, data)
@@ -580,6 +852,15 @@ func (b *Bot) sendRecordsMenu(chatID int64) {
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("📋 最近记录", "records_recent"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗳️ 投票统计", "records_votes"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🖱️ 点击统计", "records_clicks"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 投票结果", "records_polls"),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "main_menu"),
 		),
@@ -603,6 +884,9 @@ func (b *Bot) sendSettingsMenu(chatID int64) {
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("⏰ 定时设置", "settings_schedule"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🪞 频道镜像", "mirror_rules"),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "main_menu"),
 		),
@@ -631,6 +915,7 @@ func (b *Bot) sendHelp(chatID int64) {
 *命令：*
 /start - 显示主菜单
 /help - 显示此帮助信息
+/template - 使用 MarkdownV2 或 HTML 编写消息模板
 
 使用内联键盘按钮浏览机器人的功能。`
 
@@ -722,6 +1007,11 @@ func (b *Bot) showGroupDetails(chatID int64, groupID int64) {
 	text += fmt.Sprintf("频率: %d 分钟\n", group.Frequency)
 	text += fmt.Sprintf("状态: %s\n", map[bool]string{true: "🟢 活跃", false: "🔴 非活跃"}[group.IsActive])
 	text += fmt.Sprintf("自动置顶: %s\n", map[bool]string{true: "📌 启用", false: "📌 禁用"}[group.AutoPin])
+	text += fmt.Sprintf("重发方式: %s\n", map[bool]string{true: "✏️ 原地编辑", false: "🔄 删除重发"}[group.RepostMode == models.RepostModeEdit])
+	text += fmt.Sprintf("发送选项: %s\n", describeSendOptions(group.SendOptions))
+	text += fmt.Sprintf("A/B 测试: %s\n", describeVariants(group))
+	text += fmt.Sprintf("标签规则: %s\n", describeTagRule(group))
+	text += fmt.Sprintf("页脚: %s\n", map[bool]string{true: "✅ 已设置", false: "❌ 未设置"}[group.FooterText != "" || len(group.FooterButtons) > 0])
 	text += fmt.Sprintf("频道数: %d\n\n", len(channels))
 
 	if len(channels) > 0 {
@@ -771,6 +1061,14 @@ func (b *Bot) showGroupEditOptions(chatID int64, groupID int64) {
 		pinAction = "disable"
 	}
 
+	// Determine repost mode button text and target mode
+	repostModeText := "✏️ 切换为原地编辑"
+	repostModeTarget := models.RepostModeEdit
+	if group.RepostMode == models.RepostModeEdit {
+		repostModeText = "🔄 切换为删除重发"
+		repostModeTarget = models.RepostModeDelete
+	}
+
 	text := fmt.Sprintf("✏️ *编辑频道组: %s*\n\n请选择要编辑的内容：", group.Name)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -789,15 +1087,33 @@ func (b *Bot) showGroupEditOptions(chatID int64, groupID int64) {
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔘 按钮管理", fmt.Sprintf("manage_buttons_%d", groupID)),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📎 页脚设置", fmt.Sprintf("footer_settings_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📨 发送选项", fmt.Sprintf("send_options_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🧪 A/B 测试", fmt.Sprintf("ab_test_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🌐 多语言模板", fmt.Sprintf("translations_%d", groupID)),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("📢 管理频道", fmt.Sprintf("manage_channels_%d", groupID)),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✂️ 内容改写规则", fmt.Sprintf("rewrite_rules_%d", groupID)),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(statusText, fmt.Sprintf("toggle_status_%s_%d", statusAction, groupID)),
 		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(pinText, fmt.Sprintf("toggle_pin_%s_%d", pinAction, groupID)),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(repostModeText, fmt.Sprintf("toggle_repost_mode_%s_%d", repostModeTarget, groupID)),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔙 返回组详情", fmt.Sprintf("group_%d", groupID)),
 		),
@@ -924,6 +1240,150 @@ func (b *Bot) handleTogglePinAction(chatID int64, data string) {
 	b.showGroupDetails(chatID, groupID)
 }
 
+// askApplyToPublished asks whether a template change should also be applied to already published messages
+func (b *Bot) askApplyToPublished(chatID int64, groupID int64, backData string) {
+	text := "📡 *应用到已发布消息*\n\n模板修改将在下次发送时生效。是否立即更新各频道中已发布的消息？"
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📡 应用到已发布消息", fmt.Sprintf("apply_live_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏭️ 暂不应用", backData),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = keyboard
+	b.api.Send(msg)
+}
+
+// warnIfSplit tells the user when template content exceeds Telegram's length limits and will be
+// sent as several messages
+func (b *Bot) warnIfSplit(chatID int64, messageType models.MessageType, content string) {
+	template := &models.MessageTemplate{Content: content, MessageType: messageType}
+	count := services.MessageCount(template)
+	if count == 1 {
+		return
+	}
+
+	if messageType == models.MessageTypePhoto {
+		b.sendMessage(chatID, fmt.Sprintf("⚠️ 说明文字超过 %d 字符，发送时超出部分将作为 %d 条文字消息跟在图片后发送", services.MaxCaptionLength, count-1))
+	} else {
+		b.sendMessage(chatID, fmt.Sprintf("⚠️ 内容超过 %d 字符，发送时将自动拆分为 %d 条消息", services.MaxTextLength, count))
+	}
+}
+
+// handleApplyLiveAction edits all published messages of a group to match its current template
+func (b *Bot) handleApplyLiveAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "apply_live_")
+	if groupID == 0 {
+		return
+	}
+
+	// Get operation lock for this group to prevent concurrent operations
+	lock := b.getOperationLock(groupID)
+	if !lock.TryLock() {
+		b.sendMessage(chatID, "⚠️ 该频道组正在处理其他操作，请稍后再试。")
+		return
+	}
+	defer func() {
+		lock.Unlock()
+		// Clean up the lock after operation completes
+		go func() {
+			time.Sleep(1 * time.Second)
+			b.cleanupOperationLock(groupID)
+		}()
+	}()
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载组信息失败："+err.Error())
+		return
+	}
+
+	b.sendMessage(chatID, "⏳ 正在更新已发布的消息...")
+
+	results, err := b.service.ApplyTemplateToPublished(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 更新已发布消息失败："+err.Error())
+		return
+	}
+
+	text := fmt.Sprintf("📡 应用到已发布消息\n\n📋 频道组：%s\n\n", group.Name)
+	if len(results) == 0 {
+		text += "该组没有绑定的频道。"
+	}
+	for _, result := range results {
+		name := result.Channel.ChannelName
+		if name == "" {
+			name = result.Channel.ChannelID
+		}
+
+		switch {
+		case result.Edited == 0 && result.Failed == 0:
+			text += fmt.Sprintf("⚪ %s：暂无已发布消息\n", name)
+		case result.Failed == 0:
+			text += fmt.Sprintf("✅ %s：已更新 %d 条\n", name, result.Edited)
+		default:
+			text += fmt.Sprintf("❌ %s：已更新 %d 条，失败 %d 条（%v）\n", name, result.Edited, result.Failed, result.LastErr)
+		}
+	}
+
+	b.sendMessage(chatID, text)
+
+	// Return to group details
+	b.showGroupDetails(chatID, groupID)
+}
+
+// handleToggleRepostModeAction handles switching a group between delete+send and edit-in-place reposts
+func (b *Bot) handleToggleRepostModeAction(chatID int64, data string) {
+	// Parse data: toggle_repost_mode_edit_123 or toggle_repost_mode_delete_123
+	parts := strings.Split(data, "_")
+	if len(parts) != 5 {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	mode := models.RepostMode(parts[3])
+	if mode != models.RepostModeEdit && mode != models.RepostModeDelete {
+		b.sendMessage(chatID, "❌ 无效的重发方式")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载组信息失败："+err.Error())
+		return
+	}
+
+	if err := b.repo.UpdateChannelGroupRepostMode(groupID, mode); err != nil {
+		b.sendMessage(chatID, "❌ 更新重发方式失败："+err.Error())
+		return
+	}
+
+	var confirmMsg string
+	if mode == models.RepostModeEdit {
+		confirmMsg = fmt.Sprintf("✅ 频道组 *%s* 已切换为原地编辑\n\n✏️ 重发时将直接编辑上一条消息，保留位置、浏览量和表情回应；编辑失败时自动改为删除重发", group.Name)
+	} else {
+		confirmMsg = fmt.Sprintf("✅ 频道组 *%s* 已切换为删除重发\n\n🔄 重发时将删除上一条消息并发送新消息", group.Name)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, confirmMsg)
+	msg.ParseMode = "Markdown"
+	b.api.Send(msg)
+
+	// Return to group details
+	b.showGroupDetails(chatID, groupID)
+}
+
 // Edit Group Action Handlers
 
 // handleEditNameAction handles edit name action
@@ -979,11 +1439,21 @@ func (b *Bot) handleEditTemplateAction(chatID int64, data string) {
 	templateMsg := "💬 *编辑消息模板*\n\n" +
 		"📝 **支持的消息类型：**\n" +
 		"• 📄 文字消息（支持格式化）\n" +
-		"• 📸 图片消息（图片+说明文字）\n\n" +
-		"请发送新的模板内容："
+		"• 📸 图片消息（图片+说明文字）\n" +
+		"• 📊 投票/测验（发送或转发投票，或点击下方按钮用文字编写）\n\n" +
+		"请发送新的模板内容，或选择使用 MarkdownV2 / HTML 编写："
 
 	msg := tgbotapi.NewMessage(chatID, templateMsg)
 	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✍️ MarkdownV2", fmt.Sprintf("author_format_%s_%d", markup.FormatMarkdownV2, groupID)),
+			tgbotapi.NewInlineKeyboardButtonData("🏷️ HTML", fmt.Sprintf("author_format_%s_%d", markup.FormatHTML, groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 投票/测验", fmt.Sprintf("poll_template_%d", groupID)),
+		),
+	)
 	b.api.Send(msg)
 }
 
@@ -1032,6 +1502,7 @@ func (b *Bot) showChannelManagement(chatID int64, groupID int64) {
 		return
 	}
 
+	b.service.RefreshTaggedChannels(group)
 	channels, err := b.repo.GetChannelsByGroupID(groupID)
 	if err != nil {
 		b.sendMessage(chatID, "加载频道列表时出错。")
@@ -1039,24 +1510,47 @@ func (b *Bot) showChannelManagement(chatID int64, groupID int64) {
 	}
 
 	text := fmt.Sprintf("📢 *管理频道: %s*\n\n", group.Name)
+	if group.HasTagRule() {
+		text += tgbotapi.EscapeText(tgbotapi.ModeMarkdown, "🏷️ 标签规则："+describeTagRule(group)) + "\n\n"
+	}
 
 	var keyboard [][]tgbotapi.InlineKeyboardButton
 
 	if len(channels) == 0 {
 		text += "该组暂无频道。"
 	} else {
-		text += "当前频道列表：\n"
+		text += "当前频道列表（✏️ 表示有单独模板/按钮，🏷️ 表示按标签规则加入，⚠️ 表示机器人权限异常）：\n"
 		for _, channel := range channels {
 			status := "🟢"
 			if !channel.IsActive {
 				status = "🔴"
 			}
-			text += fmt.Sprintf("%s %s (%s)\n", status, channel.ChannelName, channel.ChannelID)
+			problems := channel.Health.Problems()
+			if len(problems) > 0 {
+				status = "⚠️"
+			}
+			override := ""
+			if channel.HasOverrides() {
+				override = " ✏️"
+			}
+			if channel.Language != "" {
+				override += " 🌐" + channel.Language
+			}
+			if channel.TagMatched {
+				override += " 🏷️"
+			}
+			text += fmt.Sprintf("%s %s (%s)%s\n", status, channel.ChannelName, channel.ChannelID, override)
+			if len(problems) > 0 {
+				text += "    " + tgbotapi.EscapeText(tgbotapi.ModeMarkdown, strings.Join(problems, "、")) + "\n"
+			}
 
-			// Add delete button for each channel
+			// Add settings and delete buttons for each channel
+			settingsButtonText := fmt.Sprintf("⚙️ %s", channel.ChannelName)
+			settingsButtonData := fmt.Sprintf("channel_settings_%d_%d", groupID, channel.ID)
 			deleteButtonText := fmt.Sprintf("🗑️ 删除 %s", channel.ChannelName)
 			deleteButtonData := fmt.Sprintf("delete_channel_%d_%d", groupID, channel.ID)
 			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(settingsButtonText, settingsButtonData),
 				tgbotapi.NewInlineKeyboardButtonData(deleteButtonText, deleteButtonData),
 			))
 		}
@@ -1065,6 +1559,15 @@ func (b *Bot) showChannelManagement(chatID int64, groupID int64) {
 	// Add management buttons
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("➕ 添加频道", fmt.Sprintf("add_channel_%d", groupID)),
+		tgbotapi.NewInlineKeyboardButtonData("🩺 检查权限", fmt.Sprintf("check_channels_%d", groupID)),
+	))
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🏷️ 标签规则", fmt.Sprintf("tag_rule_%d", groupID)),
+		tgbotapi.NewInlineKeyboardButtonData("☑️ 批量操作", fmt.Sprintf("bulk_channels_%d", groupID)),
+	))
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📥 导入频道", fmt.Sprintf("import_channels_%d", groupID)),
+		tgbotapi.NewInlineKeyboardButtonData("📤 导出频道", fmt.Sprintf("export_channels_%d", groupID)),
 	))
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("🔙 返回编辑选项", fmt.Sprintf("edit_group_%d", groupID)),
@@ -1145,15 +1648,12 @@ func (b *Bot) cleanupUserOperation(chatID int64) {
 	delete(b.userOperations, chatID)
 }
 
-// adjustEntitiesForPreview adjusts entity offsets for preview messages
-func (b *Bot) adjustEntitiesForPreview(entities []tgbotapi.MessageEntity, prefixLength int) []tgbotapi.MessageEntity {
-	adjustedEntities := make([]tgbotapi.MessageEntity, len(entities))
-	for i, entity := range entities {
-		adjustedEntity := entity
-		adjustedEntity.Offset = entity.Offset + prefixLength
-		adjustedEntities[i] = adjustedEntity
+// adjustEntitiesForPreview moves entity offsets past the prefix put in front of the content in preview messages
+func (b *Bot) adjustEntitiesForPreview(entities []tgbotapi.MessageEntity, prefix string) []tgbotapi.MessageEntity {
+	adjustedEntities := entityutil.Shift(entities, entityutil.UTF16Len(prefix))
+	for i, entity := range adjustedEntities {
 		log.Printf("Adjusted entity %d: original offset=%d, new offset=%d, length=%d, type=%s",
-			i, entity.Offset, adjustedEntity.Offset, adjustedEntity.Length, adjustedEntity.Type)
+			i, entities[i].Offset, entity.Offset, entity.Length, entity.Type)
 	}
 	return adjustedEntities
 }
@@ -1189,10 +1689,38 @@ func (b *Bot) handleUserInput(chatID int64, input string, userState *UserState)
 		b.handleEditGroupTemplate(chatID, input, userState)
 	case "add_buttons":
 		b.handleAddButtons(chatID, input, userState)
+	case "edit_channel_language":
+		b.handleEditChannelLanguage(chatID, input, userState)
+	case "edit_channel_tags":
+		b.handleEditChannelTags(chatID, input, userState)
+	case "edit_tag_rule":
+		b.handleEditTagRule(chatID, input, userState)
+	case "bulk_channels":
+		b.sendMessage(chatID, "请点击按钮选择频道，完成后点击 \"✅ 完成\"。")
+	case "cleanup_days":
+		b.handleCleanupDays(chatID, input, userState)
+	case "cleanup_range":
+		b.handleCleanupRange(chatID, input, userState)
+	case "add_translation_language":
+		b.handleAddTranslationLanguage(chatID, input, userState)
+	case "edit_translation_buttons":
+		b.handleEditTranslationButtons(chatID, input, userState)
+	case "edit_variant_buttons":
+		b.handleEditVariantButtons(chatID, input, userState)
 	case "add_single_button":
 		b.handleAddSingleButton(chatID, input, userState)
 	case "add_push_buttons":
 		b.handleAddPushButtons(chatID, input, userState)
+	case "edit_channel_buttons":
+		b.handleEditChannelButtons(chatID, input, userState)
+	case "edit_group_footer_buttons":
+		b.handleEditGroupFooterButtons(chatID, input, userState)
+	case "add_rewrite_rule":
+		b.handleAddRewriteRule(chatID, input, userState)
+	case "edit_mirror_filters":
+		b.handleEditMirrorFilters(chatID, input, userState)
+	case "forward_buttons":
+		b.handleForwardButtons(chatID, input, userState)
 	case "waiting_forward":
 		// This state is handled in handleTextMessage for forwarded messages
 		b.sendMessage(chatID, "请转发一条消息给我，而不是发送文字。")
@@ -1446,6 +1974,9 @@ func (b *Bot) showGroupSelectionForDelete(chatID int64) {
 		}
 	}
 
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🧹 清理历史消息", "cleanup_groups"),
+	))
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "send_messages"),
 	))
@@ -1516,6 +2047,7 @@ func (b *Bot) handleRepostAction(chatID int64, data string) {
 	}
 
 	// Get channels for this group
+	b.service.RefreshTaggedChannels(group)
 	channels, err := b.repo.GetChannelsByGroupID(groupID)
 	if err != nil {
 		b.sendMessage(chatID, "加载频道列表时出错。")
@@ -1527,6 +2059,8 @@ func (b *Bot) handleRepostAction(chatID int64, data string) {
 		return
 	}
 
+	b.service.StartRepostCycle(group)
+
 	// Send messages to all channels (repost - delete previous first) with rate limiting
 	successCount := 0
 	for i, channel := range channels {
@@ -1537,26 +2071,24 @@ func (b *Bot) handleRepostAction(chatID int64, data string) {
 				log.Printf("Rate limiting: waiting 400ms before sending template repost to channel %s", channel.ChannelID)
 			}
 
-			// Delete previous message if exists (repost behavior)
-			if channel.LastMessageID != "" {
-				err := b.service.DeleteMessage(channel.ChannelID, channel.LastMessageID)
-				if err != nil {
-					log.Printf("Failed to delete previous message from channel %s: %v", channel.ChannelID, err)
-				} else {
-					log.Printf("Successfully deleted previous message %s from channel %s", channel.LastMessageID, channel.ChannelID)
-				}
+			// Resolve per-channel template overrides
+			channelTemplate, err := b.service.ResolveTemplate(group, &channel)
+			if err != nil {
+				log.Printf("Failed to resolve template for channel %s: %v", channel.ChannelID, err)
+				continue
 			}
 
-			// Send new message
-			messageID, err := b.service.SendMessage(channel.ChannelID, template)
+			// Replace previous message (edit in place or delete and send, depending on repost mode)
+			sent, edited, err := b.service.ReplaceRepost(group, &channel, channelTemplate)
 			if err != nil {
 				log.Printf("Failed to send message to channel %s: %v", channel.ChannelID, err)
 			} else {
 				successCount++
-				log.Printf("Successfully sent new message %s to channel %s", messageID, channel.ChannelID)
+				messageID := sent.MessageID
+				log.Printf("Successfully reposted message %s to channel %s (edited: %v)", messageID, channel.ChannelID, edited)
 
-				// Pin message if auto pin is enabled
-				if group.AutoPin {
+				// Pin message if auto pin is enabled (an edited message keeps its pinned state)
+				if group.AutoPin && !edited {
 					log.Printf("Auto pin is enabled for group %s, attempting to pin message %s", group.Name, messageID)
 					if err := b.service.PinMessage(channel.ChannelID, messageID); err != nil {
 						log.Printf("Failed to pin message %s in channel %s: %v", messageID, channel.ChannelID, err)
@@ -1566,8 +2098,10 @@ func (b *Bot) handleRepostAction(chatID int64, data string) {
 					}
 				}
 
+				b.service.RecordPublished(groupID, channel.ChannelID, models.PublishKindRepost, sent.IDs())
+
 				// Update last message ID in database
-				if err := b.repo.UpdateChannelLastMessageID(channel.ChannelID, messageID); err != nil {
+				if err := b.repo.UpdateChannelLastMessageID(channel.ID, messageID, sent.PartIDs); err != nil {
 					log.Printf("Failed to update last message ID for channel %s: %v", channel.ChannelID, err)
 				} else {
 					log.Printf("Successfully updated last message ID to %s for channel %s", messageID, channel.ChannelID)
@@ -1653,13 +2187,20 @@ func (b *Bot) handleDeleteAction(chatID int64, data string) {
 	successCount := 0
 	for _, channel := range channels {
 		if channel.IsActive && channel.LastMessageID != "" {
+			b.service.ClosePoll(channel.ChannelID, channel.LastMessageID)
 			err := b.service.DeleteMessage(channel.ChannelID, channel.LastMessageID)
 			if err != nil {
 				log.Printf("Failed to delete message from channel %s: %v", channel.ChannelID, err)
 			} else {
 				successCount++
+				// Delete the follow-up parts of a split message
+				for _, partID := range channel.LastMessageParts {
+					if err := b.service.DeleteMessage(channel.ChannelID, partID); err != nil {
+						log.Printf("Failed to delete message part %s from channel %s: %v", partID, channel.ChannelID, err)
+					}
+				}
 				// Clear last message ID in database
-				if err := b.repo.UpdateChannelLastMessageID(channel.ChannelID, ""); err != nil {
+				if err := b.repo.UpdateChannelLastMessageID(channel.ID, "", nil); err != nil {
 					log.Printf("Failed to clear last message ID for channel %s: %v", channel.ChannelID, err)
 				}
 			}
@@ -1698,6 +2239,7 @@ func (b *Bot) handlePushMessage(chatID int64, input string, userState *UserState
 	}
 
 	// Get channels for this group
+	b.service.RefreshTaggedChannels(group)
 	channels, err := b.repo.GetChannelsByGroupID(groupID)
 	if err != nil {
 		b.clearState(chatID)
@@ -1711,40 +2253,46 @@ func (b *Bot) handlePushMessage(chatID int64, input string, userState *UserState
 		return
 	}
 
-	messageContent := strings.TrimSpace(input)
+	// Check if we have entities stored in user state to preserve formatting
+	var messageEntities []tgbotapi.MessageEntity
+	if userState.Data["entities"] != nil {
+		messageEntities = userState.Data["entities"].([]tgbotapi.MessageEntity)
+	}
+	messageContent, messageEntities := entityutil.TrimSpace(input, messageEntities)
 
 	// Send messages to all channels
 	successCount := 0
 	for _, channel := range channels {
 		if channel.IsActive {
-			var messageID string
+			var sent models.SentMessage
 			var err error
 
-			// Check if we have entities stored in user state
-			if userState.Data["entities"] != nil {
-				// Send with entities to preserve formatting
-				entities := userState.Data["entities"].([]tgbotapi.MessageEntity)
-				log.Printf("Sending push message with %d entities to channel %s", len(entities), channel.ChannelID)
-				messageID, err = b.service.SendMessageWithEntities(channel.ChannelID, messageContent, entities)
-			} else {
-				// Create temporary message template for fallback
-				template := &models.MessageTemplate{
-					Title:       "临时推送消息",
-					Content:     messageContent,
-					MessageType: models.MessageTypeText,
-					MediaURL:    "",
-					Buttons:     models.InlineKeyboard{},
-				}
-				log.Printf("Sending push message without entities to channel %s", channel.ChannelID)
-				messageID, err = b.service.SendMessage(channel.ChannelID, template)
+			// Create temporary message template
+			template := &models.MessageTemplate{
+				Title:       "临时推送消息",
+				Content:     messageContent,
+				MessageType: models.MessageTypeText,
+				MediaURL:    "",
+				Buttons:     models.InlineKeyboard{},
+				Options:     b.sendOptionsFor(group, userState.Data),
 			}
 
+			entities := messageEntities
+			log.Printf("Sending push message with %d entities to channel %s", len(entities), channel.ChannelID)
+
+			// Append the group footer and send
+			template, entities = b.service.ApplyFooter(group, template, entities)
+			template = b.service.TrackButtons(group, channel.ChannelID, template)
+			sent, err = b.service.SendTemplate(channel.ChannelID, template, entities)
+
 			if err != nil {
 				log.Printf("Failed to send push message to channel %s: %v", channel.ChannelID, err)
 			} else {
 				successCount++
+				b.service.RecordPublished(groupID, channel.ChannelID, models.PublishKindPush, sent.IDs())
+
 				// Update last message ID in database
-				if err := b.repo.UpdateChannelLastMessageID(channel.ChannelID, messageID); err != nil {
+				if err := b.repo.UpdateChannelLastMessageID(channel.ID, sent.MessageID, sent.PartIDs); err != nil {
 					log.Printf("Failed to update last message ID for channel %s: %v", channel.ChannelID, err)
 				}
 			}
@@ -1804,12 +2352,14 @@ func (b *Bot) handleInputPushMessageWithEntities(chatID int64, message *tgbotapi
 	var messageContent string
 	var messageType string
 	var mediaURL string
+	var entities []tgbotapi.MessageEntity
 
 	// Check message type and extract content
 	if message.Photo != nil && len(message.Photo) > 0 {
 		// Photo message
 		messageType = "photo"
 		messageContent = message.Caption
+		entities = message.CaptionEntities
 		// Get the largest photo size
 		photo := message.Photo[len(message.Photo)-1]
 		mediaURL = photo.FileID
@@ -1817,7 +2367,7 @@ func (b *Bot) handleInputPushMessageWithEntities(chatID int64, message *tgbotapi
 	} else if message.Text != "" {
 		// Text message
 		messageType = "text"
-		messageContent = strings.TrimSpace(message.Text)
+		messageContent, entities = entityutil.TrimSpace(message.Text, message.Entities)
 		mediaURL = ""
 	} else {
 		b.sendMessage(chatID, "❌ 请发送文字消息或图片消息")
@@ -1832,12 +2382,9 @@ func (b *Bot) handleInputPushMessageWithEntities(chatID int64, message *tgbotapi
 	}
 
 	// Store entities if they exist (for preserving formatting like links)
-	if messageType == "photo" && message.CaptionEntities != nil && len(message.CaptionEntities) > 0 {
-		log.Printf("Storing %d caption entities for photo push message", len(message.CaptionEntities))
-		messageData["entities"] = message.CaptionEntities
-	} else if messageType == "text" && message.Entities != nil && len(message.Entities) > 0 {
-		log.Printf("Storing %d text entities for push message", len(message.Entities))
-		messageData["entities"] = message.Entities
+	if len(entities) > 0 {
+		log.Printf("Storing %d %s entities for push message", len(entities), messageType)
+		messageData["entities"] = entities
 	} else {
 		log.Printf("No entities found in push message")
 	}
@@ -1871,7 +2418,7 @@ func (b *Bot) handleAddChannelCallback(chatID int64, data string) {
 		"groupID": groupID,
 	})
 
-	b.sendMessage(chatID, "📢 *添加频道到组*\n\n请输入频道信息，支持批量添加：\n\n**单个频道格式：**\n`频道名称|频道ID`\n例如：`精品频道A|@channel1` 或 `测试频道|-1001234567890`\n\n**批量添加（一行一个）：**\n```\n精品频道A|@channel1\n测试频道B|@channel2\n备用频道|-1001234567890\n主频道|-1009876543210\n```\n\n**注意：** 如果只输入频道ID（不含|），将使用频道ID作为名称\n\n请输入：")
+	b.sendMessage(chatID, "📢 *添加频道到组*\n\n请输入频道信息，支持批量添加：\n\n**单个频道格式：**\n`频道名称|频道ID`\n例如：`精品频道A|@channel1` 或 `测试频道|-1001234567890`\n\n**批量添加（一行一个）：**\n```\n精品频道A|@channel1\n测试频道B|@channel2\n备用频道|-1001234567890\n主频道|-1009876543210\n```\n\n**注意：** @用户名会自动转换为数字ID保存；如果只输入频道ID（不含|），将使用频道标题作为名称\n\n请输入：")
 }
 
 // handleAddChannelToGroup handles adding channel(s) to group (supports batch)
@@ -1952,9 +2499,19 @@ func (b *Bot) handleAddChannelToGroup(chatID int64, input string, userState *Use
 	var failedChannels []string
 
 	for _, info := range channelInfos {
+		// Store @username channels by their numeric ID, which deleting and pinning messages need
+		channelID, title, err := b.service.ResolveChannel(info.ID)
+		if err != nil {
+			failedChannels = append(failedChannels, fmt.Sprintf("%s (无法获取频道信息：%s)", info.Name, err.Error()))
+			continue
+		}
+		if info.Name == info.ID && title != "" {
+			info.Name = title
+		}
+
 		// Create channel
 		channel := &models.Channel{
-			ChannelID:     info.ID,
+			ChannelID:     channelID,
 			ChannelName:   info.Name,
 			GroupID:       groupID,
 			LastMessageID: "",
@@ -2051,104 +2608,399 @@ func (b *Bot) handleDeleteChannelAction(chatID int64, data string) {
 		return
 	}
 
-	// Get group details
-	group, err := b.repo.GetChannelGroup(groupID)
+	// Get group details
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	// Show confirmation dialog
+	text := fmt.Sprintf("🗑️ *确认删除频道*\n\n"+
+		"📋 频道组：%s\n"+
+		"📢 频道：%s (%s)\n\n"+
+		"⚠️ 此操作不可撤销，确定要删除这个频道吗？",
+		group.Name,
+		targetChannel.ChannelName,
+		targetChannel.ChannelID)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 确认删除", fmt.Sprintf("confirm_delete_channel_%d_%d", groupID, channelID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", fmt.Sprintf("manage_channels_%d", groupID)),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = keyboard
+	b.api.Send(msg)
+}
+
+// handleConfirmDeleteChannelAction handles confirm delete channel action
+func (b *Bot) handleConfirmDeleteChannelAction(chatID int64, data string) {
+	// Parse callback data: confirm_delete_channel_{groupID}_{channelID}
+	parts := strings.Split(data, "_")
+	if len(parts) != 5 {
+		b.sendMessage(chatID, "无效的删除操作。")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "无效的组ID。")
+		return
+	}
+
+	channelID, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "无效的频道ID。")
+		return
+	}
+
+	// Get channel details before deletion
+	channels, err := b.repo.GetChannelsByGroupID(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载频道信息时出错。")
+		return
+	}
+
+	var targetChannel *models.Channel
+	for _, channel := range channels {
+		if channel.ID == channelID {
+			targetChannel = &channel
+			break
+		}
+	}
+
+	if targetChannel == nil {
+		b.sendMessage(chatID, "未找到指定的频道。")
+		return
+	}
+
+	// Get group details
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	// Delete the channel from database
+	err = b.repo.DeleteChannel(channelID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 删除频道失败："+err.Error())
+		return
+	}
+
+	// Send success message
+	successMsg := fmt.Sprintf("✅ *频道删除成功*\n\n"+
+		"📋 频道组：%s\n"+
+		"📢 已删除频道：%s (%s)",
+		group.Name,
+		targetChannel.ChannelName,
+		targetChannel.ChannelID)
+
+	msg := tgbotapi.NewMessage(chatID, successMsg)
+	msg.ParseMode = "Markdown"
+	b.api.Send(msg)
+
+	// Return to channel management
+	b.showChannelManagement(chatID, groupID)
+}
+
+// parseChannelActionData parses callback data of the form {prefix}{groupID}_{channelID}
+func (b *Bot) parseChannelActionData(data, prefix string) (int64, int64, error) {
+	parts := strings.Split(strings.TrimPrefix(data, prefix), "_")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid channel action: %s", data)
+	}
+
+	groupID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid group ID: %w", err)
+	}
+
+	channelID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid channel ID: %w", err)
+	}
+
+	return groupID, channelID, nil
+}
+
+// handleChannelSettingsAction handles channel settings action
+func (b *Bot) handleChannelSettingsAction(chatID int64, data string) {
+	groupID, channelID, err := b.parseChannelActionData(data, "channel_settings_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的频道操作。")
+		return
+	}
+
+	b.showChannelSettings(chatID, groupID, channelID)
+}
+
+// showChannelSettings shows the per-channel template and button overrides
+func (b *Bot) showChannelSettings(chatID int64, groupID int64, channelID int64) {
+	channel, err := b.repo.GetChannel(channelID)
+	if err != nil || channel.GroupID != groupID {
+		b.sendMessage(chatID, "未找到指定的频道。")
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	text := fmt.Sprintf("⚙️ 频道设置: %s (%s)\n\n📋 频道组：%s\n\n", channel.ChannelName, channel.ChannelID, group.Name)
+
+	if channel.TemplateID != 0 {
+		template, err := b.repo.GetMessageTemplate(channel.TemplateID)
+		if err != nil {
+			text += "💬 模板：单独模板（加载失败，发送时使用组模板）\n"
+		} else {
+			text += fmt.Sprintf("💬 模板：单独模板（%s）\n%s\n\n", template.MessageType, template.Content)
+		}
+	} else {
+		text += "💬 模板：使用组模板\n"
+	}
+
+	if len(channel.Buttons) > 0 {
+		text += "🔘 按钮：单独按钮\n"
+		for _, row := range channel.Buttons {
+			for _, button := range row {
+				text += fmt.Sprintf("%s|%s\n", button.Text, formatButtonAction(button))
+			}
+		}
+	} else {
+		text += "🔘 按钮：使用模板按钮\n"
+	}
+	text += fmt.Sprintf("🌐 语言：%s\n", describeLanguage(channel.Language))
+	text += fmt.Sprintf("🏷️ 标签：%s\n", describeTags(channel.Tags))
+	if channel.TagMatched {
+		text += fmt.Sprintf("📎 按标签规则加入（%s）\n", describeTagRule(group))
+	}
+	text += describeChannelHealth(channel.Health)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💬 设置单独模板", fmt.Sprintf("channel_template_%d_%d", groupID, channelID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔘 设置单独按钮", fmt.Sprintf("channel_buttons_%d_%d", groupID, channelID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🌐 设置语言", fmt.Sprintf("channel_language_%d_%d", groupID, channelID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🏷️ 设置标签", fmt.Sprintf("channel_tags_%d_%d", groupID, channelID)),
+		),
+	)
+
+	if channel.HasOverrides() {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("♻️ 恢复使用组模板", fmt.Sprintf("channel_reset_%d_%d", groupID, channelID)),
+		))
+	}
+
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回频道管理", fmt.Sprintf("manage_channels_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = keyboard
+	b.api.Send(msg)
+}
+
+// handleChannelTemplateAction handles set channel template override action
+func (b *Bot) handleChannelTemplateAction(chatID int64, data string) {
+	groupID, channelID, err := b.parseChannelActionData(data, "channel_template_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的频道操作。")
+		return
+	}
+
+	b.setState(chatID, "edit_channel_template", map[string]interface{}{
+		"groupID":   groupID,
+		"channelID": channelID,
+	})
+
+	templateMsg := "💬 *设置频道单独模板*\n\n" +
+		"该频道将使用此模板代替组模板发送。\n\n" +
+		"📝 **支持的消息类型：**\n" +
+		"• 📄 文字消息（支持格式化）\n" +
+		"• 📸 图片消息（图片+说明文字）\n\n" +
+		"请发送模板内容："
+
+	msg := tgbotapi.NewMessage(chatID, templateMsg)
+	msg.ParseMode = "Markdown"
+	b.api.Send(msg)
+}
+
+// handleEditChannelTemplate saves a channel template override from a message, preserving entities
+func (b *Bot) handleEditChannelTemplate(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	channelID := userState.Data["channelID"].(int64)
+
+	channel, err := b.repo.GetChannel(channelID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 加载频道信息失败："+err.Error())
+		return
+	}
+	if channel.GroupID != groupID {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "未找到指定的频道。")
+		return
+	}
+
+	messageType, content, mediaURL, entitiesJSON, ok := b.extractTemplateContent(message)
+	if !ok {
+		b.sendMessage(chatID, "❌ 请发送文字消息或图片消息作为模板内容")
+		return
+	}
+
+	if channel.TemplateID != 0 {
+		err = b.repo.UpdateMessageTemplateComplete(channel.TemplateID, content, string(messageType), mediaURL, entitiesJSON)
+	} else {
+		template := &models.MessageTemplate{
+			Title:       fmt.Sprintf("%s 频道模板", channel.ChannelName),
+			Content:     content,
+			MessageType: messageType,
+			MediaURL:    mediaURL,
+			Buttons:     models.InlineKeyboard{},
+			Entities:    entitiesJSON,
+		}
+		err = b.repo.CreateMessageTemplate(template)
+		if err == nil {
+			err = b.repo.UpdateChannelTemplateID(channelID, template.ID)
+		}
+	}
+
+	if err != nil {
+		b.sendMessage(chatID, "❌ 保存频道模板失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, fmt.Sprintf("✅ 频道 %s 的单独模板已更新", channel.ChannelName))
+	b.warnIfSplit(chatID, messageType, content)
+
+	b.showChannelSettings(chatID, groupID, channelID)
+}
+
+// extractTemplateContent extracts template type, content, media and serialized entities from a message
+func (b *Bot) extractTemplateContent(message *tgbotapi.Message) (models.MessageType, string, string, string, bool) {
+	var messageType models.MessageType
+	var content, mediaURL string
+	var entities []tgbotapi.MessageEntity
+
+	if message.Photo != nil && len(message.Photo) > 0 {
+		messageType = models.MessageTypePhoto
+		content = message.Caption
+		// Get the largest photo size
+		mediaURL = message.Photo[len(message.Photo)-1].FileID
+		entities = message.CaptionEntities
+	} else if message.Text != "" {
+		messageType = models.MessageTypeText
+		content = message.Text
+		entities = message.Entities
+	} else {
+		return "", "", "", "", false
+	}
+
+	var entitiesJSON string
+	entities = entityutil.Repair(content, entities)
+	if len(entities) > 0 {
+		entitiesBytes, err := json.Marshal(entities)
+		if err != nil {
+			log.Printf("Failed to serialize template entities: %v", err)
+		} else {
+			entitiesJSON = string(entitiesBytes)
+		}
+	}
+
+	return messageType, content, mediaURL, entitiesJSON, true
+}
+
+// handleChannelButtonsAction handles set channel buttons override action
+func (b *Bot) handleChannelButtonsAction(chatID int64, data string) {
+	groupID, channelID, err := b.parseChannelActionData(data, "channel_buttons_")
 	if err != nil {
-		b.sendMessage(chatID, "加载组详情时出错。")
+		b.sendMessage(chatID, "无效的频道操作。")
 		return
 	}
 
-	// Show confirmation dialog
-	text := fmt.Sprintf("🗑️ *确认删除频道*\n\n"+
-		"📋 频道组：%s\n"+
-		"📢 频道：%s (%s)\n\n"+
-		"⚠️ 此操作不可撤销，确定要删除这个频道吗？",
-		group.Name,
-		targetChannel.ChannelName,
-		targetChannel.ChannelID)
-
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✅ 确认删除", fmt.Sprintf("confirm_delete_channel_%d_%d", groupID, channelID)),
-			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", fmt.Sprintf("manage_channels_%d", groupID)),
-		),
-	)
+	b.setState(chatID, "edit_channel_buttons", map[string]interface{}{
+		"groupID":   groupID,
+		"channelID": channelID,
+	})
 
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = keyboard
-	b.api.Send(msg)
+	b.sendMessage(chatID, "🔘 *设置频道单独按钮*\n\n该频道将使用这些按钮代替模板按钮，一行一个按钮：\n\n**格式：**\n`按钮文字|链接URL`\n"+buttonTypesHelp+"\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n```")
 }
 
-// handleConfirmDeleteChannelAction handles confirm delete channel action
-func (b *Bot) handleConfirmDeleteChannelAction(chatID int64, data string) {
-	// Parse callback data: confirm_delete_channel_{groupID}_{channelID}
-	parts := strings.Split(data, "_")
-	if len(parts) != 5 {
-		b.sendMessage(chatID, "无效的删除操作。")
+// handleEditChannelButtons saves channel button overrides
+func (b *Bot) handleEditChannelButtons(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	channelID := userState.Data["channelID"].(int64)
+
+	channel, err := b.repo.GetChannel(channelID)
+	if err != nil || channel.GroupID != groupID {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "未找到指定的频道。")
 		return
 	}
 
-	groupID, err := strconv.ParseInt(parts[3], 10, 64)
+	buttonRows, err := b.parseBatchButtons(input, "single")
 	if err != nil {
-		b.sendMessage(chatID, "无效的组ID。")
+		b.sendMessage(chatID, "❌ "+err.Error()+"\n\n**格式示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n```")
 		return
 	}
 
-	channelID, err := strconv.ParseInt(parts[4], 10, 64)
-	if err != nil {
-		b.sendMessage(chatID, "无效的频道ID。")
+	if err := b.repo.UpdateChannelButtons(channelID, models.InlineKeyboard(buttonRows)); err != nil {
+		b.sendMessage(chatID, "❌ 保存按钮失败："+err.Error())
 		return
 	}
 
-	// Get channel details before deletion
-	channels, err := b.repo.GetChannelsByGroupID(groupID)
+	b.clearState(chatID)
+	b.sendMessage(chatID, fmt.Sprintf("✅ 已保存 %d 个频道单独按钮", len(buttonRows)))
+
+	b.showChannelSettings(chatID, groupID, channelID)
+}
+
+// handleChannelResetAction removes the template and button overrides of a channel
+func (b *Bot) handleChannelResetAction(chatID int64, data string) {
+	groupID, channelID, err := b.parseChannelActionData(data, "channel_reset_")
 	if err != nil {
-		b.sendMessage(chatID, "加载频道信息时出错。")
+		b.sendMessage(chatID, "无效的频道操作。")
 		return
 	}
 
-	var targetChannel *models.Channel
-	for _, channel := range channels {
-		if channel.ID == channelID {
-			targetChannel = &channel
-			break
-		}
-	}
-
-	if targetChannel == nil {
+	channel, err := b.repo.GetChannel(channelID)
+	if err != nil || channel.GroupID != groupID {
 		b.sendMessage(chatID, "未找到指定的频道。")
 		return
 	}
 
-	// Get group details
-	group, err := b.repo.GetChannelGroup(groupID)
-	if err != nil {
-		b.sendMessage(chatID, "加载组详情时出错。")
+	if err := b.repo.UpdateChannelTemplateID(channelID, 0); err != nil {
+		b.sendMessage(chatID, "❌ 恢复失败："+err.Error())
 		return
 	}
+	if channel.TemplateID != 0 {
+		if err := b.repo.DeleteMessageTemplate(channel.TemplateID); err != nil {
+			log.Printf("Failed to delete override template %d: %v", channel.TemplateID, err)
+		}
+	}
 
-	// Delete the channel from database
-	err = b.repo.DeleteChannel(channelID)
-	if err != nil {
-		b.sendMessage(chatID, "❌ 删除频道失败："+err.Error())
+	if err := b.repo.UpdateChannelButtons(channelID, models.InlineKeyboard{}); err != nil {
+		b.sendMessage(chatID, "❌ 恢复失败："+err.Error())
 		return
 	}
 
-	// Send success message
-	successMsg := fmt.Sprintf("✅ *频道删除成功*\n\n"+
-		"📋 频道组：%s\n"+
-		"📢 已删除频道：%s (%s)",
-		group.Name,
-		targetChannel.ChannelName,
-		targetChannel.ChannelID)
-
-	msg := tgbotapi.NewMessage(chatID, successMsg)
-	msg.ParseMode = "Markdown"
-	b.api.Send(msg)
-
-	// Return to channel management
-	b.showChannelManagement(chatID, groupID)
+	b.sendMessage(chatID, fmt.Sprintf("✅ 频道 %s 已恢复使用组模板和按钮", channel.ChannelName))
+	b.showChannelSettings(chatID, groupID, channelID)
 }
 
 // Message Handling Functions
@@ -2191,7 +3043,7 @@ func (b *Bot) handleMessageForSending(chatID int64, message *tgbotapi.Message) {
 	if message.Entities != nil && len(message.Entities) > 0 {
 		// Adjust entity offsets for preview prefix
 		previewPrefix := "📝 消息预览\n\n"
-		adjustedEntities := b.adjustEntitiesForPreview(message.Entities, len([]byte(previewPrefix)))
+		adjustedEntities := b.adjustEntitiesForPreview(message.Entities, previewPrefix)
 		msg.Entities = adjustedEntities
 	}
 	msg.DisableWebPagePreview = true
@@ -2272,6 +3124,13 @@ func (b *Bot) showGroupSelectionForCustomPush(chatID int64, messageContent strin
 		))
 	}
 
+	b.stateMutex.RLock()
+	userState, exists := b.userStates[chatID]
+	b.stateMutex.RUnlock()
+	if exists {
+		keyboard = append(keyboard, pushOptionsRow(userState.Data, "push"))
+	}
+
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "main_menu"),
 	))
@@ -2310,6 +3169,13 @@ func (b *Bot) showGroupSelectionForCustomRepost(chatID int64, messageContent str
 		))
 	}
 
+	b.stateMutex.RLock()
+	userState, exists := b.userStates[chatID]
+	b.stateMutex.RUnlock()
+	if exists {
+		keyboard = append(keyboard, pushOptionsRow(userState.Data, "repost"))
+	}
+
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "main_menu"),
 	))
@@ -2427,6 +3293,7 @@ func (b *Bot) executeCustomPush(chatID int64, groupID int64, messageContent stri
 	}
 
 	// Get channels for this group
+	b.service.RefreshTaggedChannels(group)
 	channels, err := b.repo.GetChannelsByGroupID(groupID)
 	if err != nil {
 		b.clearState(chatID)
@@ -2475,6 +3342,7 @@ func (b *Bot) executeCustomPush(chatID int64, groupID int64, messageContent stri
 		MessageType: templateMessageType,
 		MediaURL:    mediaURL,
 		Buttons:     models.InlineKeyboard{},
+		Options:     b.sendOptionsFor(group, userState.Data),
 	}
 
 	// Check if we have push buttons in user state
@@ -2494,7 +3362,7 @@ func (b *Bot) executeCustomPush(chatID int64, groupID int64, messageContent stri
 				log.Printf("Rate limiting: waiting 300ms before sending push to channel %s", channel.ChannelID)
 			}
 
-			var messageID string
+			var sent models.SentMessage
 			var err error
 
 			// Check if we have entities stored in user state
@@ -2504,15 +3372,19 @@ func (b *Bot) executeCustomPush(chatID int64, groupID int64, messageContent stri
 				log.Printf("Using %d entities for push message", len(entities))
 			}
 
-			// Send with complete template (entities and buttons)
-			messageID, err = b.service.SendMessageWithTemplate(channel.ChannelID, template, entities)
+			// Send with complete template (entities, buttons and group footer)
+			footerTemplate, footerEntities := b.service.ApplyFooter(group, template, entities)
+			footerTemplate = b.service.TrackButtons(group, channel.ChannelID, footerTemplate)
+			sent, err = b.service.SendTemplate(channel.ChannelID, footerTemplate, footerEntities)
 
 			if err != nil {
 				log.Printf("Failed to send custom push message to channel %s: %v", channel.ChannelID, err)
 			} else {
 				successCount++
+				b.service.RecordPublished(groupID, channel.ChannelID, models.PublishKindPush, sent.IDs())
+
 				// Update last message ID in database
-				if err := b.repo.UpdateChannelLastMessageID(channel.ChannelID, messageID); err != nil {
+				if err := b.repo.UpdateChannelLastMessageID(channel.ID, sent.MessageID, sent.PartIDs); err != nil {
 					log.Printf("Failed to update last message ID for channel %s: %v", channel.ChannelID, err)
 				}
 			}
@@ -2561,6 +3433,7 @@ func (b *Bot) executeCustomRepost(chatID int64, groupID int64, messageContent st
 	}
 
 	// Get channels for this group
+	b.service.RefreshTaggedChannels(group)
 	channels, err := b.repo.GetChannelsByGroupID(groupID)
 	if err != nil {
 		b.clearState(chatID)
@@ -2574,6 +3447,14 @@ func (b *Bot) executeCustomRepost(chatID int64, groupID int64, messageContent st
 		return
 	}
 
+	// Use the options chosen for this send, if any
+	sendOptions := group.SendOptions
+	b.stateMutex.RLock()
+	if userState, exists := b.userStates[chatID]; exists {
+		sendOptions = b.sendOptionsFor(group, userState.Data)
+	}
+	b.stateMutex.RUnlock()
+
 	// Create temporary message template
 	template := &models.MessageTemplate{
 		Title:       "自定义重发消息",
@@ -2581,6 +3462,7 @@ func (b *Bot) executeCustomRepost(chatID int64, groupID int64, messageContent st
 		MessageType: models.MessageTypeText,
 		MediaURL:    "",
 		Buttons:     models.InlineKeyboard{},
+		Options:     sendOptions,
 	}
 
 	// Send messages to all channels (repost - delete previous first) with rate limiting
@@ -2593,16 +3475,19 @@ func (b *Bot) executeCustomRepost(chatID int64, groupID int64, messageContent st
 				log.Printf("Rate limiting: waiting 400ms before sending repost to channel %s", channel.ChannelID)
 			}
 
-			// Delete previous message if exists (repost behavior)
+			// Delete previous message and its parts if exists (repost behavior)
 			if channel.LastMessageID != "" {
-				err := b.service.DeleteMessage(channel.ChannelID, channel.LastMessageID)
+				b.service.ClosePoll(channel.ChannelID, channel.LastMessageID)
+			}
+			for _, messageID := range channel.LastMessage().IDs() {
+				err := b.service.DeleteMessage(channel.ChannelID, messageID)
 				if err != nil {
 					log.Printf("Failed to delete previous message from channel %s: %v", channel.ChannelID, err)
 				}
 			}
 
 			// Send new message
-			var messageID string
+			var sent models.SentMessage
 			var err error
 
 			// Check if we have entities stored in user state
@@ -2610,19 +3495,22 @@ func (b *Bot) executeCustomRepost(chatID int64, groupID int64, messageContent st
 			userState, exists := b.userStates[chatID]
 			b.stateMutex.RUnlock()
 
+			var entities []tgbotapi.MessageEntity
 			if exists && userState.Data["entities"] != nil {
 				// Send with entities to preserve formatting
-				entities := userState.Data["entities"].([]tgbotapi.MessageEntity)
-				messageID, err = b.service.SendMessageWithEntities(channel.ChannelID, messageContent, entities)
-			} else {
-				// Send as regular template
-				messageID, err = b.service.SendMessage(channel.ChannelID, template)
+				entities = userState.Data["entities"].([]tgbotapi.MessageEntity)
 			}
 
+			// Append the group footer and send
+			footerTemplate, footerEntities := b.service.ApplyFooter(group, template, entities)
+			footerTemplate = b.service.TrackButtons(group, channel.ChannelID, footerTemplate)
+			sent, err = b.service.SendTemplate(channel.ChannelID, footerTemplate, footerEntities)
+
 			if err != nil {
 				log.Printf("Failed to send custom repost message to channel %s: %v", channel.ChannelID, err)
 			} else {
 				successCount++
+				messageID := sent.MessageID
 
 				// Pin message if auto pin is enabled
 				if group.AutoPin {
@@ -2635,8 +3523,10 @@ func (b *Bot) executeCustomRepost(chatID int64, groupID int64, messageContent st
 					}
 				}
 
+				b.service.RecordPublished(groupID, channel.ChannelID, models.PublishKindRepost, sent.IDs())
+
 				// Update last message ID in database
-				if err := b.repo.UpdateChannelLastMessageID(channel.ChannelID, messageID); err != nil {
+				if err := b.repo.UpdateChannelLastMessageID(channel.ID, messageID, sent.PartIDs); err != nil {
 					log.Printf("Failed to update last message ID for channel %s: %v", channel.ChannelID, err)
 				}
 			}
@@ -2868,8 +3758,8 @@ func (b *Bot) handleEditGroupTemplate(chatID int64, input string, userState *Use
 	b.clearState(chatID)
 	b.sendMessage(chatID, "✅ 消息模板已更新")
 
-	// Return to group details
-	b.showGroupDetails(chatID, groupID)
+	// Offer to push the new template to messages that are already published
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("group_%d", groupID))
 }
 
 // handleEditGroupTemplateWithEntities handles editing group template with entities preservation
@@ -2884,10 +3774,22 @@ func (b *Bot) handleEditGroupTemplateWithEntities(chatID int64, message *tgbotap
 		return
 	}
 
+	// Polls sent or forwarded while editing become poll templates
+	if message.Poll != nil {
+		question, poll := pollFromMessage(message.Poll)
+		if err := validatePoll(question, poll); err != nil {
+			b.sendMessage(chatID, "❌ "+err.Error())
+			return
+		}
+		b.savePollTemplate(chatID, groupID, question, poll)
+		return
+	}
+
 	var messageType models.MessageType
 	var content string
 	var mediaURL string
 	var entitiesJSON string
+	var textEntities []tgbotapi.MessageEntity
 
 	// Check message type and extract content
 	if message.Photo != nil && len(message.Photo) > 0 {
@@ -2901,7 +3803,7 @@ func (b *Bot) handleEditGroupTemplateWithEntities(chatID int64, message *tgbotap
 
 		// Extract entities from caption
 		if message.CaptionEntities != nil && len(message.CaptionEntities) > 0 {
-			entitiesBytes, err := json.Marshal(message.CaptionEntities)
+			entitiesBytes, err := json.Marshal(entityutil.Repair(content, message.CaptionEntities))
 			if err != nil {
 				log.Printf("Failed to serialize caption entities: %v", err)
 			} else {
@@ -2912,21 +3814,24 @@ func (b *Bot) handleEditGroupTemplateWithEntities(chatID int64, message *tgbotap
 	} else if message.Text != "" {
 		// Text message
 		messageType = models.MessageTypeText
-		content = strings.TrimSpace(message.Text)
 		mediaURL = ""
 
+		// Trim the text and move its entities along
+		content, textEntities = entityutil.TrimSpace(message.Text, message.Entities)
+		textEntities = entityutil.Repair(content, textEntities)
+
 		// Extract entities from text
-		if message.Entities != nil && len(message.Entities) > 0 {
-			entitiesBytes, err := json.Marshal(message.Entities)
+		if len(textEntities) > 0 {
+			entitiesBytes, err := json.Marshal(textEntities)
 			if err != nil {
 				log.Printf("Failed to serialize text entities: %v", err)
 			} else {
 				entitiesJSON = string(entitiesBytes)
-				log.Printf("Saving %d text entities for template", len(message.Entities))
+				log.Printf("Saving %d text entities for template", len(textEntities))
 			}
 		}
 	} else {
-		b.sendMessage(chatID, "❌ 请发送文字消息或图片消息作为模板内容")
+		b.sendMessage(chatID, "❌ 请发送文字消息、图片消息或投票作为模板内容")
 		return
 	}
 
@@ -2949,7 +3854,7 @@ func (b *Bot) handleEditGroupTemplateWithEntities(chatID int64, message *tgbotap
 			// Use entities for the caption part (adjust offset for prefix)
 			if message.CaptionEntities != nil && len(message.CaptionEntities) > 0 {
 				prefixText := fmt.Sprintf("✅ 图片消息模板已更新\n\n📸 类型：图片消息\n💬 说明文字：")
-				adjustedEntities := b.adjustEntitiesForPreview(message.CaptionEntities, len([]byte(prefixText)))
+				adjustedEntities := b.adjustEntitiesForPreview(message.CaptionEntities, prefixText)
 				photoMsg.CaptionEntities = adjustedEntities
 			}
 			b.api.Send(photoMsg)
@@ -2964,17 +3869,18 @@ func (b *Bot) handleEditGroupTemplateWithEntities(chatID int64, message *tgbotap
 		successMsg := fmt.Sprintf("✅ 文字消息模板已更新\n\n📝 类型：文字消息\n💬 内容：%s", content)
 		msg := tgbotapi.NewMessage(chatID, successMsg)
 		// Use entities for the content part (adjust offset for prefix)
-		if message.Entities != nil && len(message.Entities) > 0 {
+		if len(textEntities) > 0 {
 			prefixText := "✅ 文字消息模板已更新\n\n📝 类型：文字消息\n💬 内容："
-			adjustedEntities := b.adjustEntitiesForPreview(message.Entities, len([]byte(prefixText)))
+			adjustedEntities := b.adjustEntitiesForPreview(textEntities, prefixText)
 			msg.Entities = adjustedEntities
 		}
 		msg.DisableWebPagePreview = true
 		b.api.Send(msg)
 	}
+	b.warnIfSplit(chatID, messageType, content)
 
-	// Return to group details
-	b.showGroupDetails(chatID, groupID)
+	// Offer to push the new template to messages that are already published
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("group_%d", groupID))
 }
 
 // askForButtons asks user if they want to add buttons to the template
@@ -3026,7 +3932,7 @@ func (b *Bot) handleManageButtonsAction(chatID int64, data string) {
 		buttonText = "当前按钮：\n"
 		for _, row := range template.Buttons {
 			for _, button := range row {
-				buttonText += fmt.Sprintf("%s|%s\n", button.Text, button.URL)
+				buttonText += fmt.Sprintf("%s|%s\n", button.Text, formatButtonAction(button))
 			}
 		}
 	}
@@ -3078,7 +3984,7 @@ func (b *Bot) handleAddButtonsAction(chatID int64, data string) {
 		"layout":  "single", // default layout
 	})
 
-	b.sendMessage(chatID, "🔘 *批量添加按钮*\n\n请输入按钮信息，支持批量输入，一行一个按钮：\n\n**格式：**\n`按钮文字|链接URL`\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n🔥 更多资源|https://example.com\n```\n\n💡 **提示：**\n• 可以一次性输入多个按钮\n• 每行一个按钮\n• 空行会被忽略\n• 也支持单个按钮输入")
+	b.sendMessage(chatID, "🔘 *批量添加按钮*\n\n请输入按钮信息，支持批量输入，一行一个按钮：\n\n**格式：**\n`按钮文字|链接URL`\n"+buttonTypesHelp+"\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n🔥 更多资源|https://example.com\n```\n\n💡 **提示：**\n• 可以一次性输入多个按钮\n• 每行一个按钮\n• 空行会被忽略\n• 也支持单个按钮输入")
 }
 
 // handleSkipButtonsAction handles skip buttons action
@@ -3155,28 +4061,25 @@ func (b *Bot) parseBatchButtons(input string, layout string) ([][]models.InlineK
 			continue // Skip empty lines
 		}
 
-		// Parse button input: "text|url"
-		parts := strings.Split(line, "|")
+		// Parse button input: "text|action"; the action may itself contain "|"
+		parts := strings.SplitN(line, "|", 2)
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("第%d行格式错误：%s\n请使用格式：按钮文字|链接URL", i+1, line)
 		}
 
 		buttonText := strings.TrimSpace(parts[0])
-		buttonURL := strings.TrimSpace(parts[1])
+		buttonAction := strings.TrimSpace(parts[1])
 
-		if buttonText == "" || buttonURL == "" {
+		if buttonText == "" || buttonAction == "" {
 			return nil, fmt.Errorf("第%d行按钮文字和链接都不能为空：%s", i+1, line)
 		}
 
-		// Validate URL
-		if !strings.HasPrefix(buttonURL, "http://") && !strings.HasPrefix(buttonURL, "https://") {
-			return nil, fmt.Errorf("第%d行链接必须以 http:// 或 https:// 开头：%s", i+1, buttonURL)
+		button, err := parseButtonAction(buttonText, buttonAction)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行%s", i+1, err.Error())
 		}
 
-		allButtons = append(allButtons, models.InlineKeyboardButton{
-			Text: buttonText,
-			URL:  buttonURL,
-		})
+		allButtons = append(allButtons, button)
 	}
 
 	if len(allButtons) == 0 {
@@ -3290,7 +4193,7 @@ func (b *Bot) handleGroupLayoutChoice(chatID int64, data string, layout string)
 		layoutText = "双列（每行2个）"
 	}
 
-	b.sendMessage(chatID, fmt.Sprintf("🔘 *批量添加按钮 - %s*\n\n请输入按钮信息，支持批量输入：\n\n**格式：**\n`按钮文字|链接URL`\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n```\n\n💡 **提示：** 选择%s布局，按钮会自动按此方式排列", layoutText, layoutText))
+	b.sendMessage(chatID, fmt.Sprintf("🔘 *批量添加按钮 - %s*\n\n请输入按钮信息，支持批量输入：\n\n**格式：**\n`按钮文字|链接URL`\n"+buttonTypesHelp+"\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n```\n\n💡 **提示：** 选择%s布局，按钮会自动按此方式排列", layoutText, layoutText))
 }
 
 // handleClearButtonsAction handles clear all buttons action
@@ -3317,14 +4220,17 @@ func (b *Bot) handleClearButtonsAction(chatID int64, data string) {
 
 	b.sendMessage(chatID, "✅ 已清空所有按钮")
 
-	// Return to button management
-	b.handleManageButtonsAction(chatID, fmt.Sprintf("manage_buttons_%d", groupID))
+	// Offer to push the new buttons to messages that are already published
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("manage_buttons_%d", groupID))
 }
 
 // handlePreviewMessageAction handles preview message action
 func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
-	groupID := b.extractGroupIDFromData(data, "preview_message_")
-	if groupID == 0 {
+	// preview_message_{groupID} previews the default content, preview_message_{groupID}_{language} a translation
+	idPart, language, _ := strings.Cut(strings.TrimPrefix(data, "preview_message_"), "_")
+	groupID, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
 		return
 	}
 
@@ -3341,20 +4247,15 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 		b.sendMessage(chatID, "❌ 加载模板失败："+err.Error())
 		return
 	}
+	languages := template.Translations.Languages()
+	previewName := group.Name
+	if language != "" {
+		template = template.Localize(language)
+		previewName = fmt.Sprintf("%s（%s）", group.Name, language)
+	}
 
 	// Create inline keyboard from template buttons if they exist
-	var keyboard tgbotapi.InlineKeyboardMarkup
-	if len(template.Buttons) > 0 {
-		var keyboardRows [][]tgbotapi.InlineKeyboardButton
-		for _, row := range template.Buttons {
-			var keyboardRow []tgbotapi.InlineKeyboardButton
-			for _, button := range row {
-				keyboardRow = append(keyboardRow, tgbotapi.NewInlineKeyboardButtonURL(button.Text, button.URL))
-			}
-			keyboardRows = append(keyboardRows, keyboardRow)
-		}
-		keyboard = tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
-	}
+	keyboard := template.Buttons.Markup()
 
 	// Parse entities from template if they exist
 	var entities []tgbotapi.MessageEntity
@@ -3374,15 +4275,15 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 		if template.MediaURL != "" {
 			photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(template.MediaURL))
 			// Build the complete caption
-			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", group.Name)
+			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", previewName)
 			photoMsg.Caption = previewPrefix + template.Content
 			// Use entities for preview to match actual message format
 			if entities != nil && len(entities) > 0 {
 				// Adjust entity offsets for preview prefix
-				adjustedEntities := b.adjustEntitiesForPreview(entities, len([]byte(previewPrefix)))
+				adjustedEntities := b.adjustEntitiesForPreview(entities, previewPrefix)
 				photoMsg.CaptionEntities = adjustedEntities
-				log.Printf("Photo preview: prefix='%s' (length=%d bytes), content='%s'",
-					previewPrefix, len([]byte(previewPrefix)), template.Content)
+				log.Printf("Photo preview: prefix='%s' (length=%d UTF-16 units), content='%s'",
+					previewPrefix, entityutil.UTF16Len(previewPrefix), template.Content)
 			}
 			if len(template.Buttons) > 0 {
 				photoMsg.ReplyMarkup = keyboard
@@ -3390,7 +4291,7 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 			msg = photoMsg
 		} else {
 			// Fallback to text if no media URL
-			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 图片模板但无媒体文件", group.Name, template.Content))
+			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 图片模板但无媒体文件", previewName, template.Content))
 			textMsg.ParseMode = "Markdown"
 			textMsg.DisableWebPagePreview = true
 			if len(template.Buttons) > 0 {
@@ -3402,12 +4303,12 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 		if template.MediaURL != "" {
 			videoMsg := tgbotapi.NewVideo(chatID, tgbotapi.FileID(template.MediaURL))
 			// Build the complete caption
-			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", group.Name)
+			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", previewName)
 			videoMsg.Caption = previewPrefix + template.Content
 			// Use entities for preview to match actual message format
 			if entities != nil && len(entities) > 0 {
 				// Adjust entity offsets for preview prefix
-				adjustedEntities := b.adjustEntitiesForPreview(entities, len([]byte(previewPrefix)))
+				adjustedEntities := b.adjustEntitiesForPreview(entities, previewPrefix)
 				videoMsg.CaptionEntities = adjustedEntities
 			}
 			if len(template.Buttons) > 0 {
@@ -3415,7 +4316,7 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 			}
 			msg = videoMsg
 		} else {
-			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 视频模板但无媒体文件", group.Name, template.Content))
+			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 视频模板但无媒体文件", previewName, template.Content))
 			textMsg.ParseMode = "Markdown"
 			textMsg.DisableWebPagePreview = true
 			if len(template.Buttons) > 0 {
@@ -3427,12 +4328,12 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 		if template.MediaURL != "" {
 			docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FileID(template.MediaURL))
 			// Build the complete caption
-			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", group.Name)
+			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", previewName)
 			docMsg.Caption = previewPrefix + template.Content
 			// Use entities for preview to match actual message format
 			if entities != nil && len(entities) > 0 {
 				// Adjust entity offsets for preview prefix
-				adjustedEntities := b.adjustEntitiesForPreview(entities, len([]byte(previewPrefix)))
+				adjustedEntities := b.adjustEntitiesForPreview(entities, previewPrefix)
 				docMsg.CaptionEntities = adjustedEntities
 			}
 			if len(template.Buttons) > 0 {
@@ -3440,7 +4341,7 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 			}
 			msg = docMsg
 		} else {
-			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 文档模板但无媒体文件", group.Name, template.Content))
+			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 文档模板但无媒体文件", previewName, template.Content))
 			textMsg.ParseMode = "Markdown"
 			textMsg.DisableWebPagePreview = true
 			if len(template.Buttons) > 0 {
@@ -3452,12 +4353,12 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 		if template.MediaURL != "" {
 			audioMsg := tgbotapi.NewAudio(chatID, tgbotapi.FileID(template.MediaURL))
 			// Build the complete caption
-			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", group.Name)
+			previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", previewName)
 			audioMsg.Caption = previewPrefix + template.Content
 			// Use entities for preview to match actual message format
 			if entities != nil && len(entities) > 0 {
 				// Adjust entity offsets for preview prefix
-				adjustedEntities := b.adjustEntitiesForPreview(entities, len([]byte(previewPrefix)))
+				adjustedEntities := b.adjustEntitiesForPreview(entities, previewPrefix)
 				audioMsg.CaptionEntities = adjustedEntities
 			}
 			if len(template.Buttons) > 0 {
@@ -3465,7 +4366,7 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 			}
 			msg = audioMsg
 		} else {
-			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 音频模板但无媒体文件", group.Name, template.Content))
+			textMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s\n\n⚠️ 音频模板但无媒体文件", previewName, template.Content))
 			textMsg.ParseMode = "Markdown"
 			textMsg.DisableWebPagePreview = true
 			if len(template.Buttons) > 0 {
@@ -3473,14 +4374,17 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 			}
 			msg = textMsg
 		}
+	case models.MessageTypePoll:
+		// The question and settings are listed first; the poll itself follows as it will be published
+		msg = tgbotapi.NewMessage(chatID, fmt.Sprintf("📱 消息预览: %s\n\n%s", previewName, describePoll(template)))
 	default: // MessageTypeText
 		// Build the complete message
-		previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", group.Name)
+		previewPrefix := fmt.Sprintf("📱 消息预览: %s\n\n", previewName)
 		textMsg := tgbotapi.NewMessage(chatID, previewPrefix+template.Content)
 		// Use entities for preview to match actual message format
 		if entities != nil && len(entities) > 0 {
 			// Adjust entity offsets for preview prefix
-			adjustedEntities := b.adjustEntitiesForPreview(entities, len([]byte(previewPrefix)))
+			adjustedEntities := b.adjustEntitiesForPreview(entities, previewPrefix)
 			textMsg.Entities = adjustedEntities
 		}
 		textMsg.DisableWebPagePreview = true
@@ -3491,14 +4395,28 @@ func (b *Bot) handlePreviewMessageAction(chatID int64, data string) {
 	}
 
 	b.api.Send(msg)
+	if template.MessageType == models.MessageTypePoll {
+		b.sendPollPreview(chatID, template)
+	}
 
-	// Send a follow-up message with return button
+	// Send a follow-up message with return button and the previews of the other languages
 	returnText := "👆 以上是消息预览效果"
-	returnKeyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 返回按钮管理", fmt.Sprintf("manage_buttons_%d", groupID)),
-		),
-	)
+	returnKeyboard := tgbotapi.NewInlineKeyboardMarkup()
+	if len(languages) > 0 {
+		var row []tgbotapi.InlineKeyboardButton
+		if language != "" {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData("👁️ 默认", fmt.Sprintf("preview_message_%d", groupID)))
+		}
+		for _, code := range languages {
+			if code != language {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData("👁️ "+code, fmt.Sprintf("preview_message_%d_%s", groupID, code)))
+			}
+		}
+		returnKeyboard.InlineKeyboard = append(returnKeyboard.InlineKeyboard, row)
+	}
+	returnKeyboard.InlineKeyboard = append(returnKeyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回按钮管理", fmt.Sprintf("manage_buttons_%d", groupID)),
+	))
 
 	returnMsg := tgbotapi.NewMessage(chatID, returnText)
 	returnMsg.ReplyMarkup = returnKeyboard
@@ -3573,8 +4491,8 @@ func (b *Bot) handleAddSingleButton(chatID int64, input string, userState *UserS
 	b.clearState(chatID)
 	b.sendMessage(chatID, fmt.Sprintf("✅ 成功添加 %d 个按钮（%s布局）", totalButtons, layoutText))
 
-	// Return to button management
-	b.handleManageButtonsAction(chatID, fmt.Sprintf("manage_buttons_%d", groupID))
+	// Offer to push the new buttons to messages that are already published
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("manage_buttons_%d", groupID))
 }
 
 // handleForwardRequest handles the forward request
@@ -3676,7 +4594,7 @@ func (b *Bot) handleLayoutChoice(chatID int64, layout string) {
 		layoutText = "双列（每行2个）"
 	}
 
-	b.sendMessage(chatID, fmt.Sprintf("🔘 *批量添加推送按钮 - %s*\n\n请输入按钮信息，支持批量输入：\n\n**格式：**\n`按钮文字|链接URL`\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n```\n\n💡 **提示：** 选择%s布局，按钮会自动按此方式排列", layoutText, layoutText))
+	b.sendMessage(chatID, fmt.Sprintf("🔘 *批量添加推送按钮 - %s*\n\n请输入按钮信息，支持批量输入：\n\n**格式：**\n`按钮文字|链接URL`\n"+buttonTypesHelp+"\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n```\n\n💡 **提示：** 选择%s布局，按钮会自动按此方式排列", layoutText, layoutText))
 }
 
 // handleSkipPushButtonsAction handles skip buttons for push message
@@ -3775,7 +4693,9 @@ func (b *Bot) finishAddingPushButtons(chatID int64, userState *UserState) {
 	b.showGroupSelectionForCustomPush(chatID, messageContent)
 }
 
-// handleForwardedMessage handles forwarded messages for no-reference forwarding
+// handleForwardedMessage handles a message forwarded (or sent) to the bot for no-quote forwarding.
+// The original message stays in the operator's chat and is later copied to each channel with
+// copyMessage, so every message type is supported.
 func (b *Bot) handleForwardedMessage(chatID int64, message *tgbotapi.Message) {
 	// Check if user is in waiting_forward state
 	b.stateMutex.RLock()
@@ -3794,116 +4714,30 @@ func (b *Bot) handleForwardedMessage(chatID int64, message *tgbotapi.Message) {
 		return
 	}
 
-	var messageContent string
-	var messageType string
-	var mediaURL string
-	var entities []tgbotapi.MessageEntity
-
-	// Determine message type and extract content
-	if message.Text != "" {
-		// Text message
-		messageContent = message.Text
-		messageType = "text"
-		if message.Entities != nil {
-			entities = message.Entities
-		}
-	} else if message.Photo != nil && len(message.Photo) > 0 {
-		// Photo message
-		messageContent = message.Caption
-		messageType = "photo"
-		// Get the highest resolution photo
-		photo := message.Photo[len(message.Photo)-1]
-		mediaURL = photo.FileID
-		if message.CaptionEntities != nil {
-			entities = message.CaptionEntities
-		}
-	} else if message.Video != nil {
-		// Video message
-		messageContent = message.Caption
-		messageType = "video"
-		mediaURL = message.Video.FileID
-		if message.CaptionEntities != nil {
-			entities = message.CaptionEntities
-		}
-	} else if message.Document != nil {
-		// Document message
-		messageContent = message.Caption
-		messageType = "document"
-		mediaURL = message.Document.FileID
-		if message.CaptionEntities != nil {
-			entities = message.CaptionEntities
-		}
-	} else if message.Audio != nil {
-		// Audio message
-		messageContent = message.Caption
-		messageType = "audio"
-		mediaURL = message.Audio.FileID
-		if message.CaptionEntities != nil {
-			entities = message.CaptionEntities
-		}
-	} else if message.Voice != nil {
-		// Voice message
-		messageContent = message.Caption
-		messageType = "voice"
-		mediaURL = message.Voice.FileID
-		if message.CaptionEntities != nil {
-			entities = message.CaptionEntities
-		}
-	} else if message.VideoNote != nil {
-		// Video note message
-		messageContent = ""
-		messageType = "video_note"
-		mediaURL = message.VideoNote.FileID
-	} else if message.Sticker != nil {
-		// Sticker message
-		messageContent = ""
-		messageType = "sticker"
-		mediaURL = message.Sticker.FileID
-	} else if message.Animation != nil {
-		// GIF/Animation message
+	messageContent := message.Text
+	if messageContent == "" {
 		messageContent = message.Caption
-		messageType = "animation"
-		mediaURL = message.Animation.FileID
-		if message.CaptionEntities != nil {
-			entities = message.CaptionEntities
-		}
-	} else {
-		// Unsupported message type
-		b.sendMessage(chatID, "❌ 不支持的消息类型。请转发文本、图片、视频或文档消息。")
-		return
 	}
+	messageType := services.MessageKind(message)
 
-	// Store the forwarded message data
+	// Store the source of the forwarded message
 	messageData := map[string]interface{}{
-		"message_content": messageContent,
-		"message_type":    messageType,
-		"media_url":       mediaURL,
-	}
-
-	if len(entities) > 0 {
-		messageData["entities"] = entities
-		log.Printf("Storing %d entities from forwarded %s message", len(entities), messageType)
+		"message_content":    messageContent,
+		"message_type":       messageType,
+		"source_message_ids": []int{message.MessageID},
+		"source_messages":    []*tgbotapi.Message{message},
 	}
 
-	log.Printf("Processing forwarded %s message with content length: %d", messageType, len(messageContent))
+	log.Printf("Processing forwarded %s message %d with content length: %d", messageType, message.MessageID, len(messageContent))
 
 	// Update state to show group selection
 	b.setState(chatID, "forward_message_content", messageData)
 
-	// Show group selection for forwarding
-	previewContent := messageContent
-	if previewContent == "" {
-		previewContent = fmt.Sprintf("[%s消息]", messageType)
-	}
-	if len(previewContent) > 100 {
-		previewContent = previewContent[:100] + "..."
-	}
-
-	b.showGroupSelectionForForward(chatID, previewContent)
+	b.showGroupSelectionForForward(chatID, messageData)
 }
 
 // showGroupSelectionForForward shows group selection for forwarding
-func (b *Bot) showGroupSelectionForForward(chatID int64, messageContent string) {
+func (b *Bot) showGroupSelectionForForward(chatID int64, messageData map[string]interface{}) {
 	groups, err := b.repo.GetChannelGroups()
 	if err != nil {
 		b.sendMessage(chatID, "加载频道组时出错。")
@@ -3915,7 +4749,17 @@ func (b *Bot) showGroupSelectionForForward(chatID int64, messageContent string)
 		return
 	}
 
-	text := "📤 *无引用转发*\n\n选择要转发到的频道组："
+	messageIDs, _ := messageData["source_message_ids"].([]int)
+	isAlbum := len(messageIDs) > 1
+	buttons, _ := messageData["buttons"].(models.InlineKeyboard)
+
+	text := "📤 *无引用转发*\n\n"
+	if isAlbum {
+		text += fmt.Sprintf("📎 媒体组：%d 个文件\n\n", len(messageIDs))
+	} else if len(buttons) > 0 {
+		text += fmt.Sprintf("🔘 将使用 %d 行新按钮替换原消息按钮\n\n", len(buttons))
+	}
+	text += "选择要转发到的频道组："
 	var keyboard [][]tgbotapi.InlineKeyboardButton
 
 	for _, group := range groups {
@@ -3930,6 +4774,14 @@ func (b *Bot) showGroupSelectionForForward(chatID int64, messageContent string)
 		))
 	}
 
+	// Albums cannot carry an inline keyboard
+	if !isAlbum {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔘 替换按钮", "forward_buttons"),
+		))
+	}
+	keyboard = append(keyboard, pushOptionsRow(messageData, "forward"))
+
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "send_messages"),
 	))
@@ -3941,6 +4793,36 @@ func (b *Bot) showGroupSelectionForForward(chatID int64, messageContent string)
 	b.api.Send(msg)
 }
 
+// handleForwardButtonsAction asks for a keyboard that replaces the forwarded message's buttons
+func (b *Bot) handleForwardButtonsAction(chatID int64) {
+	b.stateMutex.RLock()
+	userState, exists := b.userStates[chatID]
+	b.stateMutex.RUnlock()
+
+	if !exists || userState.State != "forward_message_content" {
+		b.sendMessage(chatID, "❌ 没有找到消息数据，请重新转发消息。")
+		b.sendMainMenu(chatID)
+		return
+	}
+
+	b.setState(chatID, "forward_buttons", userState.Data)
+	b.sendMessage(chatID, "🔘 *替换按钮*\n\n请输入新的按钮，一行一个：\n\n**格式：**\n`按钮文字|链接URL`\n"+buttonTypesHelp+"\n\n**示例：**\n```\n💎 站长仓库|https://t.me/zhanzhangck\n👀  站长交流群|https://t.me/vpsbbq\n```")
+}
+
+// handleForwardButtons handles the replacement keyboard input for a forwarded message
+func (b *Bot) handleForwardButtons(chatID int64, input string, userState *UserState) {
+	buttonRows, err := b.parseBatchButtons(strings.TrimSpace(input), "single")
+	if err != nil {
+		b.sendMessage(chatID, "❌ "+err.Error()+"\n\n请重新输入：")
+		return
+	}
+
+	userState.Data["buttons"] = models.InlineKeyboard(buttonRows)
+	b.setState(chatID, "forward_message_content", userState.Data)
+
+	b.showGroupSelectionForForward(chatID, userState.Data)
+}
+
 // handleForwardAction handles forward action for a specific group
 func (b *Bot) handleForwardAction(chatID int64, data string) {
 	// Extract group ID from callback data
@@ -3984,8 +4866,8 @@ func (b *Bot) handleForwardAction(chatID int64, data string) {
 			keys = append(keys, k)
 		}
 		log.Printf("handleForwardAction: userState.Data keys=%v", keys)
-		if userState.Data["media_urls"] != nil {
-			log.Printf("handleForwardAction: Found media_urls in userState")
+		if userState.Data["source_message_ids"] != nil {
+			log.Printf("handleForwardAction: Found source_message_ids in userState")
 		}
 		if userState.Data["message_content"] != nil {
 			log.Printf("handleForwardAction: Found message_content in userState")
@@ -3999,7 +4881,7 @@ func (b *Bot) handleForwardAction(chatID int64, data string) {
 	}
 
 	// Check if this is a media group or regular message
-	if userState.Data["media_urls"] != nil {
+	if userState.Data["message_type"] == "media_group" {
 		// This is a media group
 		log.Printf("handleForwardAction: Executing media group forward")
 		b.executeMediaGroupForward(chatID, groupID, userState.Data)
@@ -4027,6 +4909,7 @@ func (b *Bot) executeForward(chatID int64, groupID int64, messageContent string)
 	}
 
 	// Get channels for this group
+	b.service.RefreshTaggedChannels(group)
 	channels, err := b.repo.GetChannelsByGroupID(groupID)
 	if err != nil {
 		b.clearState(chatID)
@@ -4052,7 +4935,11 @@ func (b *Bot) executeForward(chatID int64, groupID int64, messageContent string)
 		return
 	}
 
-	messageType := userState.Data["message_type"].(string)
+	// Load the group's rewrite rules
+	rewriteRules, err := b.repo.GetRewriteRulesByGroupID(groupID)
+	if err != nil {
+		log.Printf("Failed to load rewrite rules for group %d: %v", groupID, err)
+	}
 
 	// Send messages to all channels (forward - don't delete previous)
 	// Add rate limiting for API safety
@@ -4065,36 +4952,8 @@ func (b *Bot) executeForward(chatID int64, groupID int64, messageContent string)
 				log.Printf("Rate limiting: waiting 500ms before sending to channel %s", channel.ChannelID)
 			}
 
-			// Send new message
-			var err error
-
-			if messageType == "media_group" {
-				// Handle media group forwarding
-				err = b.forwardMediaGroup(channel.ChannelID, userState.Data)
-			} else if messageType == "text" && userState.Data["entities"] != nil {
-				// Send text with entities to preserve formatting
-				entities := userState.Data["entities"].([]tgbotapi.MessageEntity)
-				_, err = b.service.SendMessageWithEntities(channel.ChannelID, messageContent, entities)
-			} else {
-				// Send single media message
-				mediaURL := ""
-				if userState.Data["media_url"] != nil {
-					mediaURL = userState.Data["media_url"].(string)
-				}
-
-				// Create temporary message template
-				template := &models.MessageTemplate{
-					Title:       "无引用转发消息",
-					Content:     messageContent,
-					MessageType: b.convertToModelMessageType(messageType),
-					MediaURL:    mediaURL,
-					Buttons:     models.InlineKeyboard{},
-				}
-
-				// Send as regular template (supports all media types)
-				_, err = b.service.SendMessage(channel.ChannelID, template)
-			}
-
+			// Copy the original message
+			err := b.copyForwardedMessage(channel, rewriteRules, b.sendOptionsFor(group, userState.Data), userState.Data)
 			if err != nil {
 				log.Printf("Failed to send forward message to channel %s: %v", channel.ChannelID, err)
 			} else {
@@ -4105,6 +4964,10 @@ func (b *Bot) executeForward(chatID int64, groupID int64, messageContent string)
 
 	b.clearState(chatID)
 
+	if messageContent == "" {
+		messageContent = fmt.Sprintf("[%s消息]", userState.Data["message_type"])
+	}
+
 	successMsg := fmt.Sprintf("📤 *无引用转发完成*\n\n"+
 		"📋 频道组：%s\n"+
 		"📢 成功转发：%d/%d 个频道\n"+
@@ -4132,6 +4995,7 @@ func (b *Bot) executeMediaGroupForward(chatID int64, groupID int64, messageData
 	}
 
 	// Get channels for this group
+	b.service.RefreshTaggedChannels(group)
 	channels, err := b.repo.GetChannelsByGroupID(groupID)
 	if err != nil {
 		b.clearState(chatID)
@@ -4145,6 +5009,12 @@ func (b *Bot) executeMediaGroupForward(chatID int64, groupID int64, messageData
 		return
 	}
 
+	// Load the group's rewrite rules
+	rewriteRules, err := b.repo.GetRewriteRulesByGroupID(groupID)
+	if err != nil {
+		log.Printf("Failed to load rewrite rules for group %d: %v", groupID, err)
+	}
+
 	// Send media group to all channels with rate limiting
 	successCount := 0
 	for i, channel := range channels {
@@ -4155,7 +5025,7 @@ func (b *Bot) executeMediaGroupForward(chatID int64, groupID int64, messageData
 				log.Printf("Rate limiting: waiting 1s before sending media group to channel %s", channel.ChannelID)
 			}
 
-			err := b.forwardMediaGroup(channel.ChannelID, messageData)
+			err := b.copyForwardedMessage(channel, rewriteRules, b.sendOptionsFor(group, messageData), messageData)
 			if err != nil {
 				log.Printf("Failed to send media group to channel %s: %v", channel.ChannelID, err)
 			} else {
@@ -4172,8 +5042,8 @@ func (b *Bot) executeMediaGroupForward(chatID int64, groupID int64, messageData
 		messageContent = messageData["message_content"].(string)
 	}
 	if messageContent == "" {
-		mediaURLs := messageData["media_urls"].([]string)
-		messageContent = fmt.Sprintf("[媒体组 - %d个文件]", len(mediaURLs))
+		messageIDs, _ := messageData["source_message_ids"].([]int)
+		messageContent = fmt.Sprintf("[媒体组 - %d个文件]", len(messageIDs))
 	}
 
 	successMsg := fmt.Sprintf("📤 *无引用转发完成*\n\n"+
@@ -4190,38 +5060,13 @@ func (b *Bot) executeMediaGroupForward(chatID int64, groupID int64, messageData
 	b.sendMainMenu(chatID)
 }
 
-// convertToModelMessageType converts string message type to models.MessageType
-func (b *Bot) convertToModelMessageType(messageType string) models.MessageType {
-	switch messageType {
-	case "text":
-		return models.MessageTypeText
-	case "photo":
-		return models.MessageTypePhoto
-	case "video":
-		return models.MessageTypeVideo
-	case "document":
-		return models.MessageTypeDocument
-	case "audio":
-		return models.MessageTypeAudio
-	case "voice":
-		return models.MessageTypeAudio // Voice messages are treated as audio
-	case "video_note":
-		return models.MessageTypeVideo // Video notes are treated as video
-	case "sticker":
-		return models.MessageTypePhoto // Stickers are treated as photo
-	case "animation":
-		return models.MessageTypeVideo // Animations/GIFs are treated as video
-	default:
-		return models.MessageTypeText
-	}
-}
-
 // MediaGroupBuffer stores media group messages temporarily
 type MediaGroupBuffer struct {
-	Messages []*tgbotapi.Message
-	Timer    *time.Timer
-	ChatID   int64
-	GroupID  string
+	Messages   []*tgbotapi.Message
+	Timer      *time.Timer
+	ChatID     int64
+	GroupID    string
+	OnComplete func(buffer *MediaGroupBuffer) // Called with the complete, sorted album
 }
 
 var mediaGroupBuffers = make(map[string]*MediaGroupBuffer)
@@ -4239,6 +5084,12 @@ func (b *Bot) handleMediaGroupMessage(chatID int64, message *tgbotapi.Message) {
 		return
 	}
 
+	b.bufferMediaGroupMessage(chatID, message, b.processMediaGroup)
+}
+
+// bufferMediaGroupMessage adds a message to the buffer of its media group. Once no new message
+// of the group arrived for 2 seconds, onComplete is called with the whole group.
+func (b *Bot) bufferMediaGroupMessage(chatID int64, message *tgbotapi.Message, onComplete func(buffer *MediaGroupBuffer)) {
 	mediaGroupMutex.Lock()
 	defer mediaGroupMutex.Unlock()
 
@@ -4249,9 +5100,10 @@ func (b *Bot) handleMediaGroupMessage(chatID int64, message *tgbotapi.Message) {
 	buffer, exists := mediaGroupBuffers[groupID]
 	if !exists {
 		buffer = &MediaGroupBuffer{
-			Messages: []*tgbotapi.Message{},
-			ChatID:   chatID,
-			GroupID:  groupID,
+			Messages:   []*tgbotapi.Message{},
+			ChatID:     chatID,
+			GroupID:    groupID,
+			OnComplete: onComplete,
 		}
 		mediaGroupBuffers[groupID] = buffer
 	}
@@ -4266,14 +5118,14 @@ func (b *Bot) handleMediaGroupMessage(chatID int64, message *tgbotapi.Message) {
 
 	// Set timer to process the group after 2 seconds of no new messages
 	buffer.Timer = time.AfterFunc(2*time.Second, func() {
-		b.processMediaGroup(groupID)
+		b.flushMediaGroup(groupID)
 	})
 
 	log.Printf("Added message to media group %s, total messages: %d", groupID, len(buffer.Messages))
 }
 
-// processMediaGroup processes a complete media group
-func (b *Bot) processMediaGroup(groupID string) {
+// flushMediaGroup removes a complete media group from the buffers and hands it to its handler
+func (b *Bot) flushMediaGroup(groupID string) {
 	mediaGroupMutex.Lock()
 	buffer, exists := mediaGroupBuffers[groupID]
 	if !exists {
@@ -4297,121 +5149,58 @@ func (b *Bot) processMediaGroup(groupID string) {
 	})
 	log.Printf("Sorted %d messages by MessageID for correct order", len(buffer.Messages))
 
-	// Find the message with caption (usually the first one)
-	var mainMessage *tgbotapi.Message
-	var messageContent string
-	var entities []tgbotapi.MessageEntity
+	buffer.OnComplete(buffer)
+}
 
+// processMediaGroup processes a complete media group for no-quote forwarding
+func (b *Bot) processMediaGroup(buffer *MediaGroupBuffer) {
+	// Find the caption of the album (usually on the first message)
+	var messageContent string
 	for _, msg := range buffer.Messages {
 		if msg.Caption != "" {
-			mainMessage = msg
 			messageContent = msg.Caption
-			if msg.CaptionEntities != nil {
-				entities = msg.CaptionEntities
-			}
 			break
 		}
 	}
 
-	// If no message has caption, use the first message
-	if mainMessage == nil {
-		mainMessage = buffer.Messages[0]
-	}
-
-	// Collect all media URLs and types
-	var mediaURLs []string
-	var mediaTypes []string
-	var messageType string
-
-	for _, msg := range buffer.Messages {
-		if msg.Photo != nil && len(msg.Photo) > 0 {
-			photo := msg.Photo[len(msg.Photo)-1]
-			mediaURLs = append(mediaURLs, photo.FileID)
-			mediaTypes = append(mediaTypes, "photo")
-			if messageType == "" {
-				messageType = "photo"
-			}
-		} else if msg.Video != nil {
-			mediaURLs = append(mediaURLs, msg.Video.FileID)
-			mediaTypes = append(mediaTypes, "video")
-			if messageType == "" {
-				messageType = "video"
-			}
-		} else if msg.Document != nil {
-			mediaURLs = append(mediaURLs, msg.Document.FileID)
-			mediaTypes = append(mediaTypes, "document")
-			if messageType == "" {
-				messageType = "document"
-			}
-		}
+	// Collect message IDs so the album can be copied as a whole
+	messageIDs := make([]int, len(buffer.Messages))
+	for i, msg := range buffer.Messages {
+		messageIDs[i] = msg.MessageID
 	}
 
-	// Store the media group data
+	// Store the media group source
 	messageData := map[string]interface{}{
-		"message_content": messageContent,
-		"message_type":    "media_group",
-		"media_urls":      mediaURLs,
-		"media_types":     mediaTypes,
-		"media_count":     len(mediaURLs),
-		"group_id":        groupID,
-	}
-
-	if len(entities) > 0 {
-		messageData["entities"] = entities
-		log.Printf("Storing %d entities from media group", len(entities))
+		"message_content":    messageContent,
+		"message_type":       "media_group",
+		"source_message_ids": messageIDs,
+		"source_messages":    buffer.Messages,
+		"media_count":        len(messageIDs),
+		"group_id":           buffer.GroupID,
 	}
 
-	log.Printf("Processing media group with %d media items, content length: %d", len(mediaURLs), len(messageContent))
+	log.Printf("Processing media group with %d media items, content length: %d", len(messageIDs), len(messageContent))
 
 	// Update state to show group selection
 	b.setState(buffer.ChatID, "forward_message_content", messageData)
 
-	// Show group selection for forwarding
-	previewContent := messageContent
-	if previewContent == "" {
-		previewContent = fmt.Sprintf("[媒体组 - %d个文件]", len(mediaURLs))
-	}
-	if len(previewContent) > 100 {
-		previewContent = previewContent[:100] + "..."
-	}
-
-	b.showGroupSelectionForForward(buffer.ChatID, previewContent)
+	b.showGroupSelectionForForward(buffer.ChatID, messageData)
 }
 
-// forwardMediaGroup forwards a media group to a channel
-func (b *Bot) forwardMediaGroup(channelID string, messageData map[string]interface{}) error {
-	mediaURLs, ok := messageData["media_urls"].([]string)
-	if !ok || len(mediaURLs) == 0 {
-		return fmt.Errorf("no media URLs found in media group")
-	}
-
-	messageContent := ""
-	if messageData["message_content"] != nil {
-		messageContent = messageData["message_content"].(string)
-	}
-
-	// Get media types from stored data
-	mediaTypes, ok := messageData["media_types"].([]string)
-	if !ok || len(mediaTypes) != len(mediaURLs) {
-		// Fallback: assume all are photos
-		mediaTypes = make([]string, len(mediaURLs))
-		for i := range mediaTypes {
-			mediaTypes[i] = "photo"
-		}
+// copyForwardedMessage copies the operator's original message (or album) to a channel,
+// applying the group's rewrite rules and the send options
+func (b *Bot) copyForwardedMessage(channel models.Channel, rules []models.RewriteRule, options models.SendOptions, messageData map[string]interface{}) error {
+	messages, _ := messageData["source_messages"].([]*tgbotapi.Message)
+	if len(messages) == 0 {
+		return fmt.Errorf("no source message found")
 	}
 
-	// Get entities from stored data
-	var entities []tgbotapi.MessageEntity
-	if messageData["entities"] != nil {
-		entities = messageData["entities"].([]tgbotapi.MessageEntity)
-		log.Printf("forwardMediaGroup: Found %d entities in messageData", len(entities))
-		for i, entity := range entities {
-			log.Printf("Entity %d: type=%s, offset=%d, length=%d, url=%s", i, entity.Type, entity.Offset, entity.Length, entity.URL)
-		}
-	} else {
-		log.Printf("forwardMediaGroup: No entities found in messageData")
+	buttons, _ := messageData["buttons"].(models.InlineKeyboard)
+	messageIDs, err := b.service.CopyWithRewrite(channel.ChannelID, rules, messages, buttons, options)
+	if err != nil {
+		return err
 	}
 
-	// Use the message service to send media group with entities
-	return b.service.SendMediaGroupWithEntities(channelID, mediaURLs, mediaTypes, messageContent, entities)
+	b.service.RecordPublished(channel.GroupID, channel.ChannelID, models.PublishKindForward, messageIDs)
+	return nil
 }
@@ -0,0 +1,358 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"tg-channel-repost-bot/internal/services"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleBulkChannelsAction starts selecting channels of a group for bulk actions
+func (b *Bot) handleBulkChannelsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "bulk_channels_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "bulk_channels", map[string]interface{}{
+		"groupID":  groupID,
+		"selected": make(map[int64]bool),
+	})
+	b.showBulkChannels(chatID, groupID)
+}
+
+// bulkSelection returns the channels selected in a group, false when no selection is in progress
+func (b *Bot) bulkSelection(chatID int64, groupID int64) ([]int64, bool) {
+	b.stateMutex.RLock()
+	defer b.stateMutex.RUnlock()
+
+	userState, exists := b.userStates[chatID]
+	if !exists || userState.State != "bulk_channels" || userState.Data["groupID"] != groupID {
+		return nil, false
+	}
+
+	var ids []int64
+	for id, selected := range userState.Data["selected"].(map[int64]bool) {
+		if selected {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, true
+}
+
+// updateBulkSelection changes the channels selected in a group
+func (b *Bot) updateBulkSelection(chatID int64, groupID int64, update func(selected map[int64]bool)) bool {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	userState, exists := b.userStates[chatID]
+	if !exists || userState.State != "bulk_channels" || userState.Data["groupID"] != groupID {
+		return false
+	}
+	update(userState.Data["selected"].(map[int64]bool))
+	return true
+}
+
+// bulkExpired tells the user that the selection is gone and returns to the channel list
+func (b *Bot) bulkExpired(chatID int64, groupID int64) {
+	b.sendMessage(chatID, "❌ 批量操作已过期，请重新选择频道。")
+	b.showChannelManagement(chatID, groupID)
+}
+
+// showBulkChannels shows the channels of a group, including inactive ones, with their selection
+// and the actions for the selected channels
+func (b *Bot) showBulkChannels(chatID int64, groupID int64) {
+	selectedIDs, ok := b.bulkSelection(chatID, groupID)
+	if !ok {
+		b.bulkExpired(chatID, groupID)
+		return
+	}
+	selected := make(map[int64]bool)
+	for _, id := range selectedIDs {
+		selected[id] = true
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	channels, err := b.repo.GetAllChannelsByGroupID(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载频道列表时出错。")
+		return
+	}
+
+	text := fmt.Sprintf("☑️ 批量管理频道：%s\n\n点击频道选择或取消选择（🟢 启用，🔴 停用），再选择要执行的操作。\n\n"+
+		"➡️ 移动：频道移到其他组，保留最新消息和单独设置，新组重发时替换该消息\n"+
+		"📋 复制：频道同时加入其他组，复制单独设置\n\n已选择 %d / %d 个频道", group.Name, len(selectedIDs), len(channels))
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, channel := range channels {
+		mark := "⬜"
+		if selected[channel.ID] {
+			mark = "☑️"
+		}
+		status := "🟢"
+		if !channel.IsActive {
+			status = "🔴"
+		}
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s %s %s", mark, status, channel.ChannelName), fmt.Sprintf("bulk_sel_%d_%d", groupID, channel.ID)),
+		))
+	}
+
+	if len(channels) > 0 {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("☑️ 全选", fmt.Sprintf("bulk_all_%d", groupID)),
+			tgbotapi.NewInlineKeyboardButtonData("⬜ 全不选", fmt.Sprintf("bulk_none_%d", groupID)),
+		))
+	}
+	if len(selectedIDs) > 0 {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➡️ 移动到...", fmt.Sprintf("bulk_move_%d", groupID)),
+			tgbotapi.NewInlineKeyboardButtonData("📋 复制到...", fmt.Sprintf("bulk_copy_%d", groupID)),
+		))
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🟢 启用", fmt.Sprintf("bulk_on_%d", groupID)),
+			tgbotapi.NewInlineKeyboardButtonData("🔴 停用", fmt.Sprintf("bulk_off_%d", groupID)),
+		))
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ 完成", fmt.Sprintf("bulk_done_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleBulkSelectAction selects or unselects a channel: bulk_sel_{groupID}_{channelID}
+func (b *Bot) handleBulkSelectAction(chatID int64, data string) {
+	groupID, channelID, err := b.parseChannelActionData(data, "bulk_sel_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的频道操作。")
+		return
+	}
+
+	if !b.updateBulkSelection(chatID, groupID, func(selected map[int64]bool) {
+		selected[channelID] = !selected[channelID]
+	}) {
+		b.bulkExpired(chatID, groupID)
+		return
+	}
+	b.showBulkChannels(chatID, groupID)
+}
+
+// handleBulkSelectAllAction selects all channels of a group (bulk_all_) or none (bulk_none_)
+func (b *Bot) handleBulkSelectAllAction(chatID int64, data string) {
+	all := strings.HasPrefix(data, "bulk_all_")
+	prefix := "bulk_none_"
+	if all {
+		prefix = "bulk_all_"
+	}
+	groupID := b.extractGroupIDFromData(data, prefix)
+	if groupID == 0 {
+		return
+	}
+
+	channels, err := b.repo.GetAllChannelsByGroupID(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载频道列表时出错。")
+		return
+	}
+
+	if !b.updateBulkSelection(chatID, groupID, func(selected map[int64]bool) {
+		for id := range selected {
+			delete(selected, id)
+		}
+		if all {
+			for _, channel := range channels {
+				selected[channel.ID] = true
+			}
+		}
+	}) {
+		b.bulkExpired(chatID, groupID)
+		return
+	}
+	b.showBulkChannels(chatID, groupID)
+}
+
+// handleBulkStatusAction enables (bulk_on_) or disables (bulk_off_) the selected channels
+func (b *Bot) handleBulkStatusAction(chatID int64, data string) {
+	active := strings.HasPrefix(data, "bulk_on_")
+	prefix, action := "bulk_off_", "停用"
+	if active {
+		prefix, action = "bulk_on_", "启用"
+	}
+	groupID := b.extractGroupIDFromData(data, prefix)
+	if groupID == 0 {
+		return
+	}
+
+	ids, ok := b.bulkSelection(chatID, groupID)
+	if !ok {
+		b.bulkExpired(chatID, groupID)
+		return
+	}
+
+	updated := 0
+	for _, id := range ids {
+		if err := b.repo.UpdateChannelStatus(id, active); err != nil {
+			log.Printf("Failed to update status of channel %d: %v", id, err)
+			continue
+		}
+		updated++
+	}
+
+	b.sendMessage(chatID, fmt.Sprintf("✅ 已%s %d 个频道", action, updated))
+	b.showBulkChannels(chatID, groupID)
+}
+
+// handleBulkTargetAction asks for the group to move (bulk_move_) or copy (bulk_copy_) the
+// selected channels to
+func (b *Bot) handleBulkTargetAction(chatID int64, data string) {
+	kind, action := "copy", "复制"
+	if strings.HasPrefix(data, "bulk_move_") {
+		kind, action = "move", "移动"
+	}
+	groupID := b.extractGroupIDFromData(data, "bulk_"+kind+"_")
+	if groupID == 0 {
+		return
+	}
+
+	ids, ok := b.bulkSelection(chatID, groupID)
+	if !ok {
+		b.bulkExpired(chatID, groupID)
+		return
+	}
+
+	groups, err := b.repo.GetChannelGroups()
+	if err != nil {
+		b.sendMessage(chatID, fmt.Sprintf("加载频道组时出错：%v", err))
+		return
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		if group.ID == groupID {
+			continue
+		}
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(group.Name, fmt.Sprintf("bulk_to_%s_%d_%d", kind, groupID, group.ID)),
+		))
+	}
+	if len(keyboard) == 0 {
+		b.sendMessage(chatID, "❌ 没有其他频道组，请先创建频道组。")
+		return
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("bulk_show_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("请选择要将 %d 个频道%s到的频道组：", len(ids), action))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleBulkShowAction returns to the channel selection: bulk_show_{groupID}
+func (b *Bot) handleBulkShowAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "bulk_show_")
+	if groupID == 0 {
+		return
+	}
+
+	b.showBulkChannels(chatID, groupID)
+}
+
+// handleBulkTransferAction moves or copies the selected channels:
+// bulk_to_{move|copy}_{groupID}_{targetGroupID}
+func (b *Bot) handleBulkTransferAction(chatID int64, data string) {
+	kind := "copy"
+	if strings.HasPrefix(data, "bulk_to_move_") {
+		kind = "move"
+	}
+	groupID, targetGroupID, err := b.parseChannelActionData(data, "bulk_to_"+kind+"_")
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	ids, ok := b.bulkSelection(chatID, groupID)
+	if !ok {
+		b.bulkExpired(chatID, groupID)
+		return
+	}
+
+	target, err := b.repo.GetChannelGroup(targetGroupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	// Both groups change, so neither may be reposting meanwhile
+	lock := b.getOperationLock(groupID)
+	if !lock.TryLock() {
+		b.sendMessage(chatID, "⚠️ 该频道组正在处理其他操作，请稍后再试。")
+		return
+	}
+	targetLock := b.getOperationLock(targetGroupID)
+	if !targetLock.TryLock() {
+		lock.Unlock()
+		b.sendMessage(chatID, fmt.Sprintf("⚠️ 频道组 %s 正在处理其他操作，请稍后再试。", target.Name))
+		return
+	}
+	defer func() {
+		targetLock.Unlock()
+		lock.Unlock()
+		// Clean up the locks after operation completes
+		go func() {
+			time.Sleep(1 * time.Second)
+			b.cleanupOperationLock(groupID)
+			b.cleanupOperationLock(targetGroupID)
+		}()
+	}()
+
+	var result services.ChannelTransferResult
+	action := "复制"
+	if kind == "move" {
+		action = "移动"
+		result = b.service.MoveChannels(ids, targetGroupID)
+		// Moved channels are no longer in the group
+		b.updateBulkSelection(chatID, groupID, func(selected map[int64]bool) {
+			for id := range selected {
+				delete(selected, id)
+			}
+		})
+	} else {
+		result = b.service.CopyChannels(ids, targetGroupID)
+	}
+
+	text := fmt.Sprintf("✅ 已将 %d 个频道%s到 %s", result.Done, action, target.Name)
+	if len(result.Skipped) > 0 {
+		text += fmt.Sprintf("\n\n⏭️ %d 个频道已在 %s 中，已跳过：%s", len(result.Skipped), target.Name, strings.Join(result.Skipped, "、"))
+	}
+	if len(result.Failed) > 0 {
+		text += fmt.Sprintf("\n\n❌ %d 个频道失败：\n%s", len(result.Failed), strings.Join(result.Failed, "\n"))
+	}
+	b.sendMessage(chatID, text)
+	b.showBulkChannels(chatID, groupID)
+}
+
+// handleBulkDoneAction ends the selection and returns to the channel list: bulk_done_{groupID}
+func (b *Bot) handleBulkDoneAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "bulk_done_")
+	if groupID == 0 {
+		return
+	}
+
+	b.clearState(chatID)
+	b.showChannelManagement(chatID, groupID)
+}
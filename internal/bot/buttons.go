@@ -0,0 +1,199 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Prefixes of the button actions in batch button input; anything else is a link
+const (
+	buttonInlinePrefix = "inline:"
+	buttonCopyPrefix   = "copy:"
+	buttonAlertPrefix  = "alert:"
+	buttonVoteAction   = "vote"
+)
+
+// Telegram limits of button actions
+const (
+	maxCallbackDataBytes = 64
+	maxCopyTextLength    = 256
+)
+
+// buttonTypesHelp lists the button actions accepted after the "|" of batch button input
+const buttonTypesHelp = "`按钮文字|inline:查询内容` 内联查询按钮\n" +
+	"`按钮文字|copy:复制内容` 点击复制文字\n" +
+	"`按钮文字|alert:提示内容` 点击弹出提示\n" +
+	"`按钮文字|vote` 投票按钮，按钮上显示票数\n" +
+	"链接支持 http(s)://、tg:// 和 t.me/ 开头"
+
+// parseButtonAction parses the action part of a batch button line into a button
+func parseButtonAction(text, action string) (models.InlineKeyboardButton, error) {
+	button := models.InlineKeyboardButton{Text: text}
+
+	switch {
+	case strings.HasPrefix(action, buttonInlinePrefix):
+		query := strings.TrimSpace(strings.TrimPrefix(action, buttonInlinePrefix))
+		button.SwitchInlineQuery = &query
+	case strings.HasPrefix(action, buttonCopyPrefix):
+		copyText := strings.TrimSpace(strings.TrimPrefix(action, buttonCopyPrefix))
+		if copyText == "" {
+			return button, fmt.Errorf("复制内容不能为空")
+		}
+		if utf8.RuneCountInString(copyText) > maxCopyTextLength {
+			return button, fmt.Errorf("复制内容不能超过%d个字符", maxCopyTextLength)
+		}
+		button.CopyText = &models.CopyTextButton{Text: copyText}
+	case strings.HasPrefix(action, buttonAlertPrefix):
+		alert := strings.TrimSpace(strings.TrimPrefix(action, buttonAlertPrefix))
+		if alert == "" {
+			return button, fmt.Errorf("提示内容不能为空")
+		}
+		data := models.ButtonCallbackPrefix + alert
+		if len(data) > maxCallbackDataBytes {
+			return button, fmt.Errorf("提示内容过长，最多%d字节（约%d个汉字）",
+				maxCallbackDataBytes-len(models.ButtonCallbackPrefix), (maxCallbackDataBytes-len(models.ButtonCallbackPrefix))/3)
+		}
+		button.CallbackData = data
+	case action == buttonVoteAction:
+		data := models.VoteCallbackPrefix + text
+		if len(data) > maxCallbackDataBytes {
+			return button, fmt.Errorf("投票按钮文字过长，最多%d字节", maxCallbackDataBytes-len(models.VoteCallbackPrefix))
+		}
+		button.CallbackData = data
+	case strings.HasPrefix(action, "http://"), strings.HasPrefix(action, "https://"), strings.HasPrefix(action, "tg://"):
+		button.URL = action
+	case strings.HasPrefix(action, "t.me/"):
+		button.URL = "https://" + action
+	default:
+		return button, fmt.Errorf("链接必须以 http://、https://、tg:// 或 t.me/ 开头：%s", action)
+	}
+
+	return button, nil
+}
+
+// formatButtonAction returns the action of a button in batch button input syntax
+func formatButtonAction(button models.InlineKeyboardButton) string {
+	switch {
+	case button.SwitchInlineQuery != nil:
+		return buttonInlinePrefix + *button.SwitchInlineQuery
+	case button.CopyText != nil:
+		return buttonCopyPrefix + button.CopyText.Text
+	case button.VoteChoice() != "":
+		return buttonVoteAction
+	case button.CallbackData != "":
+		return buttonAlertPrefix + strings.TrimPrefix(button.CallbackData, models.ButtonCallbackPrefix)
+	default:
+		return button.URL
+	}
+}
+
+// handleButtonCallback answers a press on a template's alert button by showing its text; the
+// buttons live in channels, so anyone may press them
+func (b *Bot) handleButtonCallback(query *tgbotapi.CallbackQuery) {
+	alert := strings.TrimPrefix(query.Data, models.ButtonCallbackPrefix)
+	callback := tgbotapi.NewCallbackWithAlert(query.ID, alert)
+	if _, err := b.api.Request(callback); err != nil {
+		log.Printf("Failed to answer button callback: %v", err)
+	}
+}
+
+// handleVoteCallback records a reader's press on a vote button and answers with the result
+func (b *Bot) handleVoteCallback(query *tgbotapi.CallbackQuery) {
+	if query.Message == nil || query.From == nil {
+		b.api.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	choice := strings.TrimPrefix(query.Data, models.VoteCallbackPrefix)
+	answer, err := b.service.Vote(query.Message, query.From.ID, choice)
+	if err != nil {
+		log.Printf("Failed to record vote on message %d in chat %d: %v", query.Message.MessageID, query.Message.Chat.ID, err)
+		answer = "投票失败，请稍后重试"
+	}
+
+	if _, err := b.api.Request(tgbotapi.NewCallback(query.ID, answer)); err != nil {
+		log.Printf("Failed to answer vote callback: %v", err)
+	}
+}
+
+// showVoteStats shows the vote counts of the most recently published vote messages
+func (b *Bot) showVoteStats(chatID int64) {
+	summaries, err := b.repo.GetRecentVoteSummaries(10)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载投票统计失败："+err.Error())
+		return
+	}
+
+	text := "🗳️ *投票统计*\n\n"
+	if len(summaries) == 0 {
+		text += "还没有带投票按钮的消息。添加按钮时使用 `按钮文字|vote` 格式即可创建投票按钮。"
+	}
+	for _, summary := range summaries {
+		chat := summary.ChatTitle
+		if chat == "" {
+			chat = strconv.FormatInt(summary.ChatID, 10)
+		}
+
+		var results []string
+		for _, choice := range summary.Buttons.VoteChoices() {
+			results = append(results, fmt.Sprintf("%s %d", choice, summary.Counts[choice]))
+		}
+		text += fmt.Sprintf("• %s · 消息 %d（%s）\n  %s，共 %d 票\n",
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdown, chat), summary.MessageID, summary.CreatedAt.Format("01-02 15:04"),
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdown, strings.Join(results, " / ")), summary.Total)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 刷新", "records_votes"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "view_records"),
+		),
+	)
+	b.api.Send(msg)
+}
+
+// showClickStats shows the click counts of tracked buttons per group
+func (b *Bot) showClickStats(chatID int64) {
+	text := "🖱️ *点击统计*\n\n"
+	if !b.config.Server.TracksClicks() {
+		text += "点击统计未开启。在配置文件的 `server.public_url` 中填写本服务的公网地址后，推送和重发消息的链接按钮会自动改为统计跳转链接。"
+	} else {
+		stats, err := b.repo.GetButtonClickStats(20)
+		if err != nil {
+			b.sendMessage(chatID, "❌ 加载点击统计失败："+err.Error())
+			return
+		}
+		if len(stats) == 0 {
+			text += "还没有统计中的按钮，发送带链接按钮的消息后即可看到点击次数。"
+		}
+		for _, stat := range stats {
+			text += fmt.Sprintf("• %s · %s：%d 次（%d 个频道）\n",
+				tgbotapi.EscapeText(tgbotapi.ModeMarkdown, stat.GroupName),
+				tgbotapi.EscapeText(tgbotapi.ModeMarkdown, stat.ButtonText), stat.Clicks, stat.Channels)
+		}
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 刷新", "records_clicks"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "view_records"),
+		),
+	)
+	b.api.Send(msg)
+}
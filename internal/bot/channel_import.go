@@ -0,0 +1,213 @@
+package bot
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"tg-channel-repost-bot/internal/services"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxChannelImportFileSize is the largest channel file accepted for import
+const maxChannelImportFileSize = 256 * 1024
+
+// maxImportReportLines is the most lines of an import listed in its report
+const maxImportReportLines = 30
+
+// importActionMarks maps import actions to the marks shown in reports
+var importActionMarks = map[services.ChannelImportAction]string{
+	services.ChannelImportAdd:    "➕",
+	services.ChannelImportUpdate: "✏️",
+	services.ChannelImportRemove: "🗑️",
+}
+
+// handleImportChannelsAction asks for the channel file to import into a group
+func (b *Bot) handleImportChannelsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "import_channels_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "import_channels", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	b.sendMessage(chatID, "📥 导入频道\n\n"+
+		"请上传 CSV 或 TXT 文件，导入前会先显示将要进行的修改，确认后才会执行。\n\n"+
+		"CSV 文件第一行为表头，可用列：\n"+
+		"action - add 添加、update 更新、remove 移除，留空表示添加或更新\n"+
+		"group - 频道组ID或名称，留空表示当前频道组\n"+
+		"channel_id - 频道ID（必填，@username 或 -100 开头）\n"+
+		"channel_name - 频道名称\n"+
+		"tags - 标签，用空格分隔，填 无 清除\n"+
+		"active - true 启用、false 停用\n\n"+
+		"示例：\naction,group,channel_id,channel_name,tags\n,,@channel1,频道1,crypto asia\nremove,,-1001234567890,,\n\n"+
+		"TXT 文件每行一个频道：频道名称|频道ID 或 频道ID，添加到当前频道组。\n\n"+
+		"💡 \"📤 导出频道\" 得到的 CSV 文件修改后可直接导入。")
+}
+
+// handleImportChannels plans the import of an uploaded (or pasted) channel file and shows what
+// it would change, asking for confirmation
+func (b *Bot) handleImportChannels(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	fileName := ""
+	content := []byte(message.Text)
+	if message.Document != nil {
+		fileName = message.Document.FileName
+		switch strings.ToLower(path.Ext(fileName)) {
+		case ".csv", ".txt":
+		default:
+			b.sendMessage(chatID, "❌ 仅支持 .csv 或 .txt 文件")
+			return
+		}
+		var err error
+		content, err = b.downloadDocument(message.Document, maxChannelImportFileSize)
+		if err != nil {
+			b.sendMessage(chatID, "❌ 读取文件失败："+err.Error())
+			return
+		}
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		b.sendMessage(chatID, "❌ 请上传 CSV 或 TXT 文件")
+		return
+	}
+
+	b.sendMessage(chatID, "⏳ 正在检查文件中的频道...")
+	plan, err := b.service.PlanChannelImport(fileName, content, groupID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无法导入："+err.Error()+"\n\n请修改后重新上传：")
+		return
+	}
+
+	report := describeImportPlan(plan)
+	if !plan.HasChanges() {
+		b.clearState(chatID)
+		b.sendMessage(chatID, report+"\n没有需要执行的修改。")
+		b.showChannelManagement(chatID, groupID)
+		return
+	}
+
+	// Keep the plan until it is confirmed; uploading another file replaces it
+	b.setState(chatID, "confirm_channel_import", map[string]interface{}{
+		"groupID": groupID,
+		"plan":    plan,
+	})
+
+	msg := tgbotapi.NewMessage(chatID, report+"\n确认执行以上修改吗？出错的行会被跳过。")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 确认导入", fmt.Sprintf("import_confirm_%d", groupID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", fmt.Sprintf("import_cancel_%d", groupID)),
+		),
+	)
+	b.api.Send(msg)
+}
+
+// describeImportPlan returns the dry-run report of an import
+func describeImportPlan(plan *services.ChannelImportPlan) string {
+	text := fmt.Sprintf("📋 导入预览（尚未修改）\n\n➕ 添加 %d  ✏️ 更新 %d  🗑️ 移除 %d  ⏸️ 无变化 %d  ❌ 出错 %d\n\n",
+		plan.Count(services.ChannelImportAdd), plan.Count(services.ChannelImportUpdate), plan.Count(services.ChannelImportRemove),
+		plan.Count(services.ChannelImportNone), plan.Errors())
+
+	listed := 0
+	for _, row := range plan.Rows {
+		if row.Error == "" && row.Action == services.ChannelImportNone {
+			continue
+		}
+		if listed == maxImportReportLines {
+			text += "……\n"
+			break
+		}
+		listed++
+
+		if row.Error != "" {
+			text += fmt.Sprintf("❌ 第 %d 行：%s\n", row.Line, row.Error)
+			continue
+		}
+		name := row.ChannelName
+		if row.Existing != nil {
+			name = row.Existing.ChannelName
+		}
+		text += fmt.Sprintf("%s 第 %d 行 %s：%s (%s)", importActionMarks[row.Action], row.Line, row.Group.Name, name, row.ChannelID)
+		if len(row.Changes) > 0 {
+			text += "：" + strings.Join(row.Changes, "，")
+		}
+		text += "\n"
+	}
+
+	return text
+}
+
+// handleImportConfirmAction applies the confirmed import: import_confirm_{groupID}
+func (b *Bot) handleImportConfirmAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "import_confirm_")
+	if groupID == 0 {
+		return
+	}
+
+	b.stateMutex.RLock()
+	userState, exists := b.userStates[chatID]
+	b.stateMutex.RUnlock()
+
+	if !exists || userState.State != "confirm_channel_import" || userState.Data["groupID"] != groupID {
+		b.sendMessage(chatID, "❌ 导入已过期，请重新上传文件。")
+		return
+	}
+	plan := userState.Data["plan"].(*services.ChannelImportPlan)
+
+	// Clear the plan first so that it is never applied twice
+	b.clearState(chatID)
+
+	result := b.service.ApplyChannelImport(plan)
+	text := fmt.Sprintf("✅ 导入完成\n\n➕ 已添加 %d 个频道\n✏️ 已更新 %d 个频道\n🗑️ 已移除 %d 个频道\n", result.Added, result.Updated, result.Removed)
+	if result.Failed > 0 {
+		text += fmt.Sprintf("\n❌ %d 行失败：\n%s\n", result.Failed, strings.Join(result.Errors, "\n"))
+	}
+	b.sendMessage(chatID, text)
+	b.showChannelManagement(chatID, groupID)
+}
+
+// handleImportCancelAction drops a planned import: import_cancel_{groupID}
+func (b *Bot) handleImportCancelAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "import_cancel_")
+	if groupID == 0 {
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, "已取消导入。")
+	b.showChannelManagement(chatID, groupID)
+}
+
+// handleExportChannelsAction sends the channels of a group as a CSV document
+func (b *Bot) handleExportChannelsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "export_channels_")
+	if groupID == 0 {
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	content, err := b.service.ExportChannelsCSV(group)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 导出频道失败："+err.Error())
+		return
+	}
+
+	document := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("channels_%d_%s.csv", groupID, time.Now().Format("20060102")),
+		Bytes: content,
+	})
+	document.Caption = fmt.Sprintf("📤 频道组 %s 的频道列表\n\n修改后可通过 \"📥 导入频道\" 上传，用于批量添加、更新或移除频道。", group.Name)
+	if _, err := b.api.Send(document); err != nil {
+		b.sendMessage(chatID, "❌ 发送文件失败："+err.Error())
+	}
+}
@@ -0,0 +1,298 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-channel-repost-bot/internal/services"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cleanupDateFormat is the date format of cleanup date ranges
+const cleanupDateFormat = "2006-01-02"
+
+// cleanupProgressInterval is the number of messages between progress updates of a cleanup
+const cleanupProgressInterval = 10
+
+// showGroupSelectionForCleanup shows the groups whose published messages can be cleaned up
+func (b *Bot) showGroupSelectionForCleanup(chatID int64) {
+	groups, err := b.repo.GetChannelGroups()
+	if err != nil {
+		b.sendMessage(chatID, "加载频道组时出错。")
+		return
+	}
+
+	if len(groups) == 0 {
+		b.sendMessage(chatID, "没有可用的频道组。请先创建频道组。")
+		return
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		status := "🟢"
+		if !group.IsActive {
+			status = "🔴"
+		}
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s %s", status, group.Name), fmt.Sprintf("cleanup_%d", group.ID)),
+		))
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "send_delete"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, "🧹 *清理历史消息*\n\n选择要清理的频道组：")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleCleanupAction shows the cleanup options of a group
+func (b *Bot) handleCleanupAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "cleanup_")
+	if groupID == 0 {
+		return
+	}
+
+	b.showCleanup(chatID, groupID)
+}
+
+// showCleanup shows the ledger of a group's published messages with the cleanup options
+func (b *Bot) showCleanup(chatID int64, groupID int64) {
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	stats, err := b.repo.GetPublishedStats(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载发布记录失败："+err.Error())
+		return
+	}
+
+	text := fmt.Sprintf("🧹 清理历史消息：%s\n\n", group.Name)
+	text += fmt.Sprintf("已发布 %d 条消息，已删除 %d 条，频道中还有 %d 条\n", stats.Total, stats.Deleted, stats.Total-stats.Deleted)
+	if stats.Oldest != nil {
+		text += fmt.Sprintf("最早一条发布于 %s\n", stats.Oldest.Local().Format("2006-01-02 15:04"))
+	}
+	text += "\n包括重发、推送、无引用转发和频道镜像发出的全部消息（拆分消息和相册的每一条）。"
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑️ 删除全部", fmt.Sprintf("cleanup_all_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏳ 删除 N 天前的消息", fmt.Sprintf("cleanup_days_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📅 按日期范围删除", fmt.Sprintf("cleanup_range_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "cleanup_groups"),
+		),
+	)
+	b.api.Send(msg)
+}
+
+// handleCleanupAllAction asks to confirm deleting everything a group published
+func (b *Bot) handleCleanupAllAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "cleanup_all_")
+	if groupID == 0 {
+		return
+	}
+
+	b.confirmCleanup(chatID, groupID, time.Time{}, time.Time{}, "全部消息")
+}
+
+// handleCleanupDaysAction asks for the age of the messages to delete
+func (b *Bot) handleCleanupDaysAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "cleanup_days_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "cleanup_days", map[string]interface{}{
+		"groupID": groupID,
+	})
+	b.sendMessage(chatID, "⏳ 请输入天数，将删除该组在此天数之前发布的消息（如 `30`）：")
+}
+
+// handleCleanupDays asks to confirm deleting the messages published before a number of days ago
+func (b *Bot) handleCleanupDays(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	days, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || days < 1 {
+		b.sendMessage(chatID, "❌ 天数必须是正整数，请重新输入：")
+		return
+	}
+
+	b.clearState(chatID)
+	to := time.Now().AddDate(0, 0, -days)
+	b.confirmCleanup(chatID, groupID, time.Time{}, to, fmt.Sprintf("%d 天前（%s 之前）的消息", days, to.Format("2006-01-02 15:04")))
+}
+
+// handleCleanupRangeAction asks for the dates of the messages to delete
+func (b *Bot) handleCleanupRangeAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "cleanup_range_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "cleanup_range", map[string]interface{}{
+		"groupID": groupID,
+	})
+	b.sendMessage(chatID, "📅 请输入开始和结束日期（含），用空格分隔：\n\n例如：`2024-01-01 2024-01-31`")
+}
+
+// handleCleanupRange asks to confirm deleting the messages published in a date range
+func (b *Bot) handleCleanupRange(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	fields := strings.Fields(input)
+	if len(fields) != 2 {
+		b.sendMessage(chatID, "❌ 请输入两个日期，格式：`2024-01-01 2024-01-31`")
+		return
+	}
+	from, err := time.ParseInLocation(cleanupDateFormat, fields[0], time.Local)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的开始日期："+fields[0])
+		return
+	}
+	last, err := time.ParseInLocation(cleanupDateFormat, fields[1], time.Local)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的结束日期："+fields[1])
+		return
+	}
+	if last.Before(from) {
+		b.sendMessage(chatID, "❌ 结束日期不能早于开始日期")
+		return
+	}
+
+	b.clearState(chatID)
+	b.confirmCleanup(chatID, groupID, from, last.AddDate(0, 0, 1), fmt.Sprintf("%s 至 %s 的消息", fields[0], fields[1]))
+}
+
+// confirmCleanup shows how many messages a cleanup would delete and asks to confirm it
+func (b *Bot) confirmCleanup(chatID int64, groupID int64, from, to time.Time, description string) {
+	messages, err := b.repo.GetPublishedMessages(groupID, from, to)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载发布记录失败："+err.Error())
+		return
+	}
+
+	if len(messages) == 0 {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("ℹ️ %s：没有需要删除的消息", description))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("cleanup_%d", groupID)),
+			),
+		)
+		b.api.Send(msg)
+		return
+	}
+
+	channels := make(map[string]bool)
+	for _, message := range messages {
+		channels[message.ChannelID] = true
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ 确认删除%s？\n\n将从 %d 个频道删除 %d 条消息，删除后无法恢复。",
+		description, len(channels), len(messages)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 确认删除", fmt.Sprintf("cleanup_run_%d_%d_%d", groupID, unixOrZero(from), unixOrZero(to))),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", fmt.Sprintf("cleanup_%d", groupID)),
+		),
+	)
+	b.api.Send(msg)
+}
+
+// handleCleanupRunAction deletes a group's published messages in a time range, reporting the
+// progress: cleanup_run_{groupID}_{from}_{to} with Unix times, 0 leaving that end open
+func (b *Bot) handleCleanupRunAction(chatID int64, data string) {
+	parts := strings.Split(strings.TrimPrefix(data, "cleanup_run_"), "_")
+	if len(parts) != 3 {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+	var values [3]int64
+	for i, part := range parts {
+		value, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			b.sendMessage(chatID, "❌ 无效的操作格式")
+			return
+		}
+		values[i] = value
+	}
+	groupID, from, to := values[0], timeOrZero(values[1]), timeOrZero(values[2])
+
+	// Get operation lock for this group to prevent concurrent operations
+	lock := b.getOperationLock(groupID)
+	if !lock.TryLock() {
+		b.sendMessage(chatID, "⚠️ 该频道组正在处理其他操作，请稍后再试。")
+		return
+	}
+	defer func() {
+		lock.Unlock()
+		// Clean up the lock after operation completes
+		go func() {
+			time.Sleep(1 * time.Second)
+			b.cleanupOperationLock(groupID)
+		}()
+	}()
+
+	status, err := b.api.Send(tgbotapi.NewMessage(chatID, "🧹 正在清理消息..."))
+	if err != nil {
+		log.Printf("Failed to send cleanup progress message: %v", err)
+	}
+
+	result, err := b.service.CleanupPublished(groupID, from, to, func(done int, result services.CleanupResult) {
+		if status.MessageID == 0 || (done%cleanupProgressInterval != 0 && done != result.Total) {
+			return
+		}
+		edit := tgbotapi.NewEditMessageText(chatID, status.MessageID, fmt.Sprintf("🧹 正在清理消息... %d/%d\n\n已删除 %d · 已不存在 %d · 失败 %d",
+			done, result.Total, result.Deleted, result.Gone, result.Failed))
+		if _, err := b.api.Send(edit); err != nil {
+			log.Printf("Failed to update cleanup progress: %v", err)
+		}
+	})
+	if err != nil {
+		b.sendMessage(chatID, "❌ 清理失败："+err.Error())
+		return
+	}
+
+	text := fmt.Sprintf("✅ 清理完成\n\n共 %d 条消息：已删除 %d 条，%d 条已不存在", result.Total, result.Deleted, result.Gone)
+	if result.Failed > 0 {
+		text += fmt.Sprintf("，%d 条删除失败（机器人可能缺少删除权限，可稍后重试）", result.Failed)
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("cleanup_%d", groupID)),
+		),
+	)
+	b.api.Send(msg)
+}
+
+// unixOrZero returns the Unix time of t, or 0 for the zero time
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// timeOrZero returns the time of a Unix time, or the zero time for 0
+func timeOrZero(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0)
+}
@@ -0,0 +1,205 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+	"tg-channel-repost-bot/pkg/entityutil"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleFooterSettingsAction handles the footer settings action of a group
+func (b *Bot) handleFooterSettingsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "footer_settings_")
+	if groupID == 0 {
+		return
+	}
+
+	b.showFooterSettings(chatID, groupID)
+}
+
+// showFooterSettings shows the footer text and buttons of a group
+func (b *Bot) showFooterSettings(chatID int64, groupID int64) {
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	prefix := fmt.Sprintf("📎 页脚设置：%s\n\n页脚会在发送时自动追加到该组的推送和重发消息末尾。\n\n📝 页脚文字：", group.Name)
+	text := prefix
+	var entities []tgbotapi.MessageEntity
+	if group.FooterText == "" {
+		text += "未设置"
+	} else {
+		text += "\n" + group.FooterText
+		if group.FooterEntities != "" {
+			var footerEntities []tgbotapi.MessageEntity
+			if err := json.Unmarshal([]byte(group.FooterEntities), &footerEntities); err != nil {
+				log.Printf("Failed to deserialize footer entities for group %d: %v", groupID, err)
+			} else {
+				entities = b.adjustEntitiesForPreview(footerEntities, prefix+"\n")
+			}
+		}
+	}
+
+	text += "\n\n🔘 页脚按钮："
+	if len(group.FooterButtons) == 0 {
+		text += "未设置"
+	}
+	for _, row := range group.FooterButtons {
+		for _, button := range row {
+			text += fmt.Sprintf("\n• %s → %s", button.Text, formatButtonAction(button))
+		}
+	}
+
+	keyboard := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📝 设置页脚文字", fmt.Sprintf("footer_text_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔘 设置页脚按钮", fmt.Sprintf("footer_buttons_%d", groupID)),
+		),
+	}
+	if group.FooterText != "" || len(group.FooterButtons) > 0 {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑️ 清除页脚", fmt.Sprintf("footer_clear_%d", groupID)),
+		))
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回编辑选项", fmt.Sprintf("edit_group_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.Entities = entities
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleFooterTextAction asks for the footer text of a group
+func (b *Bot) handleFooterTextAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "footer_text_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "edit_group_footer", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	b.sendMessage(chatID, "📝 *设置页脚文字*\n\n请发送页脚内容，支持粗体、链接等格式，格式会原样保留。\n\n💡 输入 `无` 清除页脚文字")
+}
+
+// handleEditGroupFooter handles the footer text input, preserving its entities
+func (b *Bot) handleEditGroupFooter(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	text := message.Text
+	if text == "" {
+		b.sendMessage(chatID, "❌ 请发送文字消息作为页脚内容")
+		return
+	}
+
+	var entitiesJSON string
+	if strings.TrimSpace(text) == "无" {
+		text = ""
+	} else if entities := entityutil.Repair(text, message.Entities); len(entities) > 0 {
+		entitiesBytes, err := json.Marshal(entities)
+		if err != nil {
+			log.Printf("Failed to serialize footer entities: %v", err)
+		} else {
+			entitiesJSON = string(entitiesBytes)
+		}
+	}
+
+	if err := b.repo.UpdateChannelGroupFooter(groupID, text, entitiesJSON); err != nil {
+		b.sendMessage(chatID, "❌ 保存页脚失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	if text == "" {
+		b.sendMessage(chatID, "✅ 页脚文字已清除")
+	} else {
+		b.sendMessage(chatID, "✅ 页脚文字已更新")
+	}
+
+	// Offer to push the new footer to messages that are already published
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("footer_settings_%d", groupID))
+}
+
+// handleFooterButtonsAction asks for the footer buttons of a group
+func (b *Bot) handleFooterButtonsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "footer_buttons_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "edit_group_footer_buttons", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	b.sendMessage(chatID, "🔘 *设置页脚按钮*\n\n请输入按钮，一行一个，所有按钮将排成一行追加在消息按钮下方：\n`按钮文字|链接URL`\n"+buttonTypesHelp+"\n\n**示例：**\n```\n📢 主频道|https://t.me/example\n💬 交流群|https://t.me/example_chat\n```\n\n💡 输入 `无` 清除页脚按钮")
+}
+
+// handleEditGroupFooterButtons handles the footer buttons input
+func (b *Bot) handleEditGroupFooterButtons(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	input = strings.TrimSpace(input)
+
+	var buttons models.InlineKeyboard
+	if input != "无" {
+		rows, err := b.parseBatchButtons(input, "single")
+		if err != nil {
+			b.sendMessage(chatID, "❌ "+err.Error())
+			return
+		}
+
+		// The footer adds a single extra row
+		var row []models.InlineKeyboardButton
+		for _, r := range rows {
+			row = append(row, r...)
+		}
+		buttons = models.InlineKeyboard{row}
+	}
+
+	if err := b.repo.UpdateChannelGroupFooterButtons(groupID, buttons); err != nil {
+		b.sendMessage(chatID, "❌ 保存页脚按钮失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	if len(buttons) == 0 {
+		b.sendMessage(chatID, "✅ 页脚按钮已清除")
+	} else {
+		b.sendMessage(chatID, fmt.Sprintf("✅ 已设置 %d 个页脚按钮", len(buttons[0])))
+	}
+
+	// Offer to push the new footer to messages that are already published
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("footer_settings_%d", groupID))
+}
+
+// handleFooterClearAction removes the footer text and buttons of a group
+func (b *Bot) handleFooterClearAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "footer_clear_")
+	if groupID == 0 {
+		return
+	}
+
+	if err := b.repo.UpdateChannelGroupFooter(groupID, "", ""); err != nil {
+		b.sendMessage(chatID, "❌ 清除页脚失败："+err.Error())
+		return
+	}
+	if err := b.repo.UpdateChannelGroupFooterButtons(groupID, nil); err != nil {
+		b.sendMessage(chatID, "❌ 清除页脚失败："+err.Error())
+		return
+	}
+
+	b.sendMessage(chatID, "✅ 页脚已清除")
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("footer_settings_%d", groupID))
+}
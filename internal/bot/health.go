@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+)
+
+// describeChannelHealth returns the result of a channel's last health check as plain text
+func describeChannelHealth(health models.ChannelHealth) string {
+	if !health.Checked() {
+		return "🩺 权限检查：尚未检查\n"
+	}
+
+	text := fmt.Sprintf("🩺 权限检查（%s）：", health.CheckedAt.Format("01-02 15:04"))
+	if health.Error != "" {
+		return text + "⚠️ 无法访问：" + health.Error + "\n"
+	}
+
+	text += fmt.Sprintf("%s · %s\n", health.Title, health.Type)
+	rights := []struct {
+		name string
+		ok   bool
+	}{
+		{"发布", health.CanPost},
+		{"编辑", health.CanEdit},
+		{"删除", health.CanDelete},
+		{"置顶", health.CanPin},
+	}
+	var marks []string
+	for _, right := range rights {
+		mark := "✅"
+		if !right.ok {
+			mark = "❌"
+		}
+		marks = append(marks, mark+right.name)
+	}
+	text += fmt.Sprintf("机器人身份：%s，%s\n", health.Status, strings.Join(marks, " "))
+
+	return text
+}
+
+// handleCheckChannelsAction health checks the channels of a group on demand
+func (b *Bot) handleCheckChannelsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "check_channels_")
+	if groupID == 0 {
+		return
+	}
+
+	channels, err := b.repo.GetChannelsByGroupID(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载频道列表时出错。")
+		return
+	}
+
+	unhealthy := 0
+	for i := range channels {
+		health, err := b.service.CheckChannelHealth(&channels[i])
+		if err != nil {
+			log.Printf("Failed to store health of channel %s: %v", channels[i].ChannelID, err)
+		}
+		if len(health.Problems()) > 0 {
+			unhealthy++
+		}
+	}
+
+	if unhealthy > 0 {
+		b.sendMessage(chatID, fmt.Sprintf("⚠️ 已检查 %d 个频道，%d 个频道存在权限问题", len(channels), unhealthy))
+	} else {
+		b.sendMessage(chatID, fmt.Sprintf("✅ 已检查 %d 个频道，机器人权限正常", len(channels)))
+	}
+
+	b.showChannelManagement(chatID, groupID)
+}
@@ -0,0 +1,367 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// languageCodePattern matches language codes such as "en", "zh" or "pt-br"
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// normalizeLanguage checks a language code typed by the admin and returns it in lower case
+func normalizeLanguage(input string) (string, error) {
+	language := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(input)), "_", "-")
+	if !languageCodePattern.MatchString(language) {
+		return "", fmt.Errorf("无效的语言代码：%s，请使用如 zh、en、pt-br 的格式", input)
+	}
+	return language, nil
+}
+
+// describeLanguage returns the language of a channel for display
+func describeLanguage(language string) string {
+	if language == "" {
+		return "默认"
+	}
+	return language
+}
+
+// handleChannelLanguageAction asks for the language of a channel
+func (b *Bot) handleChannelLanguageAction(chatID int64, data string) {
+	groupID, channelID, err := b.parseChannelActionData(data, "channel_language_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的频道操作。")
+		return
+	}
+
+	b.setState(chatID, "edit_channel_language", map[string]interface{}{
+		"groupID":   groupID,
+		"channelID": channelID,
+	})
+
+	b.sendMessage(chatID, "🌐 设置频道语言\n\n请输入语言代码（如 zh、en、pt-br），发送时使用模板中该语言的翻译，没有对应翻译时使用默认内容。\n\n输入 无 恢复使用默认内容。")
+}
+
+// handleEditChannelLanguage saves the language of a channel
+func (b *Bot) handleEditChannelLanguage(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	channelID := userState.Data["channelID"].(int64)
+
+	channel, err := b.repo.GetChannel(channelID)
+	if err != nil || channel.GroupID != groupID {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "未找到指定的频道。")
+		return
+	}
+
+	language := ""
+	if strings.TrimSpace(input) != "无" {
+		var err error
+		language, err = normalizeLanguage(input)
+		if err != nil {
+			b.sendMessage(chatID, "❌ "+err.Error())
+			return
+		}
+	}
+
+	if err := b.repo.UpdateChannelLanguage(channelID, language); err != nil {
+		b.sendMessage(chatID, "❌ 保存频道语言失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, "✅ 频道语言已设置为 "+describeLanguage(language))
+	b.showChannelSettings(chatID, groupID, channelID)
+}
+
+// handleTranslationsAction handles the multilingual template action of a group
+func (b *Bot) handleTranslationsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "translations_")
+	if groupID == 0 {
+		return
+	}
+
+	b.showTranslations(chatID, groupID)
+}
+
+// showTranslations shows the translations of a group's template and the channels using them
+func (b *Bot) showTranslations(chatID int64, groupID int64) {
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	template, err := b.repo.GetMessageTemplate(group.MessageID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载模板失败："+err.Error())
+		return
+	}
+
+	channels, err := b.repo.GetChannelsByGroupID(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载频道失败："+err.Error())
+		return
+	}
+	channelCounts := make(map[string]int)
+	for _, channel := range channels {
+		channelCounts[template.Translations.Match(channel.Language)]++
+	}
+
+	text := fmt.Sprintf("🌐 多语言模板：%s\n\n", group.Name)
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+
+	if template.MessageType == models.MessageTypePoll {
+		text += "投票模板不支持多语言。"
+	} else {
+		text += "在频道设置中为频道设置语言后，发送时使用该语言的翻译；没有对应翻译的频道使用默认内容。en-us 等地区代码没有单独翻译时使用 en 的翻译。\n\n"
+		text += fmt.Sprintf("• 默认：%d 个频道\n", channelCounts[""])
+		for _, language := range template.Translations.Languages() {
+			translation := template.Translations[language]
+			buttons := "使用模板按钮"
+			if len(translation.Buttons) > 0 {
+				buttons = fmt.Sprintf("%d 行单独按钮", len(translation.Buttons))
+			}
+			text += fmt.Sprintf("• %s：%d 个频道，%s\n  %s\n", language, channelCounts[language], buttons, truncateText(translation.Content, 50))
+
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✏️ "+language, fmt.Sprintf("tr_edit_%d_%s", groupID, language)),
+				tgbotapi.NewInlineKeyboardButtonData("🔘 按钮", fmt.Sprintf("tr_buttons_%d_%s", groupID, language)),
+				tgbotapi.NewInlineKeyboardButtonData("🗑️ 删除", fmt.Sprintf("tr_delete_%d_%s", groupID, language)),
+			))
+		}
+
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ 添加翻译", fmt.Sprintf("tr_add_%d", groupID)),
+			tgbotapi.NewInlineKeyboardButtonData("👁️ 预览消息", fmt.Sprintf("preview_message_%d", groupID)),
+		))
+	}
+
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回编辑选项", fmt.Sprintf("edit_group_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// truncateText shortens text for listings
+func truncateText(text string, maxRunes int) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
+	}
+	return string([]rune(text)[:maxRunes]) + "..."
+}
+
+// parseTranslationActionData parses translation callback data: {prefix}{groupID}_{language}
+func parseTranslationActionData(data, prefix string) (int64, string, error) {
+	idPart, language, found := strings.Cut(strings.TrimPrefix(data, prefix), "_")
+	if !found || language == "" {
+		return 0, "", fmt.Errorf("invalid translation action: %s", data)
+	}
+
+	groupID, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid group ID: %w", err)
+	}
+
+	return groupID, language, nil
+}
+
+// handleTranslationAddAction asks for the language of a new translation
+func (b *Bot) handleTranslationAddAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "tr_add_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "add_translation_language", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	b.sendMessage(chatID, "🌐 添加翻译\n\n请输入翻译的语言代码（如 en、ja、pt-br）：")
+}
+
+// handleAddTranslationLanguage takes the language of a new translation and asks for its content
+func (b *Bot) handleAddTranslationLanguage(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	language, err := normalizeLanguage(input)
+	if err != nil {
+		b.sendMessage(chatID, "❌ "+err.Error())
+		return
+	}
+
+	b.askTranslationContent(chatID, groupID, language)
+}
+
+// handleTranslationEditAction asks for the new content of a translation
+func (b *Bot) handleTranslationEditAction(chatID int64, data string) {
+	groupID, language, err := parseTranslationActionData(data, "tr_edit_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的翻译操作。")
+		return
+	}
+
+	b.askTranslationContent(chatID, groupID, language)
+}
+
+// askTranslationContent asks for the content of a translation
+func (b *Bot) askTranslationContent(chatID int64, groupID int64, language string) {
+	b.setState(chatID, "edit_translation", map[string]interface{}{
+		"groupID":  groupID,
+		"language": language,
+	})
+
+	b.sendMessage(chatID, fmt.Sprintf("🌐 翻译：%s\n\n请发送该语言的模板内容（支持格式化）。图片模板可以发送图片+说明文字替换图片，或只发送文字作为说明文字。", language))
+}
+
+// handleEditTranslation saves the content of a translation from a message
+func (b *Bot) handleEditTranslation(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	language := userState.Data["language"].(string)
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+	template, err := b.repo.GetMessageTemplate(group.MessageID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 加载模板失败："+err.Error())
+		return
+	}
+
+	messageType, content, mediaURL, entitiesJSON, ok := b.extractTemplateContent(message)
+	if !ok {
+		b.sendMessage(chatID, "❌ 请发送文字消息或图片消息作为翻译内容")
+		return
+	}
+	if messageType == models.MessageTypePhoto && template.MessageType != models.MessageTypePhoto {
+		b.sendMessage(chatID, "❌ 文字模板的翻译只能是文字消息")
+		return
+	}
+
+	translations := models.Translations{}
+	for code, translation := range template.Translations {
+		translations[code] = translation
+	}
+	translation := translations[language]
+	translation.Content = content
+	translation.Entities = entitiesJSON
+	translation.MediaURL = mediaURL
+	translations[language] = translation
+
+	if err := b.repo.UpdateMessageTemplateTranslations(template.ID, translations); err != nil {
+		b.sendMessage(chatID, "❌ 保存翻译失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, fmt.Sprintf("✅ %s 翻译已保存", language))
+	b.warnIfSplit(chatID, template.MessageType, content)
+
+	b.showTranslations(chatID, groupID)
+}
+
+// handleTranslationButtonsAction asks for the buttons of a translation
+func (b *Bot) handleTranslationButtonsAction(chatID int64, data string) {
+	groupID, language, err := parseTranslationActionData(data, "tr_buttons_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的翻译操作。")
+		return
+	}
+
+	b.setState(chatID, "edit_translation_buttons", map[string]interface{}{
+		"groupID":  groupID,
+		"language": language,
+	})
+
+	b.sendMessage(chatID, fmt.Sprintf("🔘 *设置 %s 翻译的按钮*\n\n该语言的频道将使用这些按钮代替模板按钮，一行一个，输入 `无` 恢复使用模板按钮：\n\n**格式：**\n`按钮文字|链接URL`\n", language)+buttonTypesHelp)
+}
+
+// handleEditTranslationButtons saves the buttons of a translation
+func (b *Bot) handleEditTranslationButtons(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	language := userState.Data["language"].(string)
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+	template, err := b.repo.GetMessageTemplate(group.MessageID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 加载模板失败："+err.Error())
+		return
+	}
+
+	translation, ok := template.Translations[language]
+	if !ok {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 该翻译不存在")
+		return
+	}
+
+	translation.Buttons = nil
+	if strings.TrimSpace(input) != "无" {
+		buttonRows, err := b.parseBatchButtons(input, "single")
+		if err != nil {
+			b.sendMessage(chatID, "❌ "+err.Error())
+			return
+		}
+		translation.Buttons = models.InlineKeyboard(buttonRows)
+	}
+	template.Translations[language] = translation
+
+	if err := b.repo.UpdateMessageTemplateTranslations(template.ID, template.Translations); err != nil {
+		b.sendMessage(chatID, "❌ 保存按钮失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, fmt.Sprintf("✅ %s 翻译的按钮已保存", language))
+	b.showTranslations(chatID, groupID)
+}
+
+// handleTranslationDeleteAction deletes a translation
+func (b *Bot) handleTranslationDeleteAction(chatID int64, data string) {
+	groupID, language, err := parseTranslationActionData(data, "tr_delete_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的翻译操作。")
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+	template, err := b.repo.GetMessageTemplate(group.MessageID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载模板失败："+err.Error())
+		return
+	}
+
+	delete(template.Translations, language)
+	if err := b.repo.UpdateMessageTemplateTranslations(template.ID, template.Translations); err != nil {
+		b.sendMessage(chatID, "❌ 删除翻译失败："+err.Error())
+		return
+	}
+
+	b.sendMessage(chatID, fmt.Sprintf("🗑️ %s 翻译已删除，该语言的频道将使用默认内容", language))
+	b.showTranslations(chatID, groupID)
+}
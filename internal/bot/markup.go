@@ -0,0 +1,253 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/pkg/entityutil"
+	"tg-channel-repost-bot/pkg/markup"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxMarkupFileSize is the largest template file accepted for upload
+const maxMarkupFileSize = 64 * 1024
+
+// markupFormatNames maps markup formats to their display names
+var markupFormatNames = map[markup.Format]string{
+	markup.FormatMarkdownV2: "MarkdownV2",
+	markup.FormatHTML:       "HTML",
+}
+
+// handleTemplateCommand handles the /template command by listing the groups whose template can be authored
+func (b *Bot) handleTemplateCommand(chatID int64) {
+	groups, err := b.repo.GetChannelGroups()
+	if err != nil {
+		b.sendMessage(chatID, fmt.Sprintf("加载频道组时出错：%v", err))
+		return
+	}
+
+	if len(groups) == 0 {
+		b.sendMessage(chatID, "未找到频道组。")
+		return
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(group.Name, fmt.Sprintf("author_template_%d", group.ID)),
+		))
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回主菜单", "main_menu"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, "✍️ *编写模板*\n\n使用 MarkdownV2 或 HTML 编写消息模板，请选择频道组：")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleAuthorTemplateAction shows the markup formats a group template can be authored in
+func (b *Bot) handleAuthorTemplateAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "author_template_")
+	if groupID == 0 {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "✍️ *编写模板*\n\n请选择模板格式：")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✍️ MarkdownV2", fmt.Sprintf("author_format_%s_%d", markup.FormatMarkdownV2, groupID)),
+			tgbotapi.NewInlineKeyboardButtonData("🏷️ HTML", fmt.Sprintf("author_format_%s_%d", markup.FormatHTML, groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回组详情", fmt.Sprintf("group_%d", groupID)),
+		),
+	)
+	b.api.Send(msg)
+}
+
+// handleAuthorFormatAction asks for the markup source of a group template
+func (b *Bot) handleAuthorFormatAction(chatID int64, data string) {
+	// Parse data: author_format_{format}_{groupID}
+	parts := strings.Split(data, "_")
+	if len(parts) != 4 {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	format := markup.Format(parts[2])
+	if _, ok := markupFormatNames[format]; !ok {
+		b.sendMessage(chatID, "❌ 不支持的模板格式")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
+		return
+	}
+
+	b.setState(chatID, "author_template", map[string]interface{}{
+		"groupID": groupID,
+		"format":  string(format),
+	})
+
+	var example string
+	if format == markup.FormatHTML {
+		example = "<b>粗体</b> <i>斜体</i> <u>下划线</u> <s>删除线</s>\n<tg-spoiler>剧透</tg-spoiler> <code>代码</code>\n<a href=\"https://t.me/example\">链接</a>\n<blockquote>引用</blockquote>"
+	} else {
+		example = "*粗体* _斜体_ __下划线__ ~删除线~\n||剧透|| `代码`\n[链接](https://t.me/example)\n>引用\n特殊字符需转义，例如 \\. \\! \\-"
+	}
+
+	text := fmt.Sprintf("✍️ 使用 %s 编写模板\n\n请发送模板源码，或上传 .md / .html / .txt 文件。\n\n示例：\n%s\n\n💡 图片模板只会更新说明文字", markupFormatNames[format], example)
+	b.sendMessage(chatID, text)
+}
+
+// handleAuthorTemplate parses the markup source of a group template and saves it
+func (b *Bot) handleAuthorTemplate(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	format := markup.Format(userState.Data["format"].(string))
+
+	source := message.Text
+	if message.Document != nil {
+		content, err := b.downloadMarkupFile(message.Document)
+		if err != nil {
+			b.sendMessage(chatID, "❌ 读取文件失败："+err.Error())
+			return
+		}
+		source = content
+	}
+	if strings.TrimSpace(source) == "" {
+		b.sendMessage(chatID, "❌ 请发送模板源码或上传模板文件")
+		return
+	}
+
+	text, entities, err := markup.Parse(format, source)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 模板格式错误\n\n"+describeMarkupError(source, err)+"\n\n请修改后重新发送：")
+		return
+	}
+	text, entities = entityutil.TrimSpace(text, entities)
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 加载组信息失败："+err.Error())
+		return
+	}
+
+	template, err := b.repo.GetMessageTemplate(group.MessageID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 加载模板失败："+err.Error())
+		return
+	}
+
+	var entitiesJSON string
+	if len(entities) > 0 {
+		entitiesBytes, err := json.Marshal(entities)
+		if err != nil {
+			log.Printf("Failed to serialize authored template entities: %v", err)
+		} else {
+			entitiesJSON = string(entitiesBytes)
+		}
+	}
+
+	// Keep the template type and media; only the text and its formatting are authored
+	err = b.repo.UpdateMessageTemplateComplete(template.ID, text, string(template.MessageType), template.MediaURL, entitiesJSON)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 更新模板失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+
+	prefix := "✅ 模板已更新\n\n💬 内容：\n"
+	msg := tgbotapi.NewMessage(chatID, prefix+text)
+	msg.Entities = b.adjustEntitiesForPreview(entities, prefix)
+	msg.DisableWebPagePreview = true
+	b.api.Send(msg)
+	b.warnIfSplit(chatID, template.MessageType, text)
+
+	// Offer to push the new template to messages that are already published
+	b.askApplyToPublished(chatID, groupID, fmt.Sprintf("group_%d", groupID))
+}
+
+// downloadMarkupFile downloads an uploaded template file
+func (b *Bot) downloadMarkupFile(document *tgbotapi.Document) (string, error) {
+	switch strings.ToLower(path.Ext(document.FileName)) {
+	case ".md", ".markdown", ".html", ".htm", ".txt":
+	default:
+		return "", fmt.Errorf("仅支持 .md、.html 或 .txt 文件")
+	}
+
+	content, err := b.downloadDocument(document, maxMarkupFileSize)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// downloadDocument downloads an uploaded file of at most maxSize bytes
+func (b *Bot) downloadDocument(document *tgbotapi.Document, maxSize int) ([]byte, error) {
+	if document.FileSize > maxSize {
+		return nil, fmt.Errorf("文件过大，最大 %d KB", maxSize/1024)
+	}
+
+	url, err := b.api.GetFileDirectURL(document.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxSize {
+		return nil, fmt.Errorf("文件过大，最大 %d KB", maxSize/1024)
+	}
+
+	return content, nil
+}
+
+// describeMarkupError formats a markup error with the offending source line, marking the error column
+func describeMarkupError(source string, err error) string {
+	var markupErr *markup.Error
+	if !errors.As(err, &markupErr) {
+		return err.Error()
+	}
+
+	description := fmt.Sprintf("第 %d 行第 %d 列：%s", markupErr.Line, markupErr.Column, markupErr.Message)
+
+	lines := strings.Split(source, "\n")
+	if markupErr.Line < 1 || markupErr.Line > len(lines) {
+		return description
+	}
+	line := []rune(lines[markupErr.Line-1])
+	column := markupErr.Column - 1
+	if column > len(line) {
+		column = len(line)
+	}
+
+	return description + "\n\n" + string(line[:column]) + "👉" + string(line[column:])
+}
@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+	"tg-channel-repost-bot/internal/services"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleMyChatMember records changes of the bot's membership in channels and tells the user who
+// made them: a promotion offers to add the channel to a group, a removal reports the groups the
+// channel was deactivated in
+func (b *Bot) handleMyChatMember(update *tgbotapi.ChatMemberUpdated) {
+	if update.Chat.Type != "channel" && update.Chat.Type != "supergroup" {
+		return
+	}
+
+	channel, groups, err := b.service.RecordMembership(update)
+	if err != nil {
+		log.Printf("Failed to record membership in chat %d: %v", update.Chat.ID, err)
+		return
+	}
+
+	oldMember, newMember := update.OldChatMember, update.NewChatMember
+	log.Printf("Bot membership in chat %s changed from %s to %s by user %d", channel.ChatID, oldMember.Status, newMember.Status, update.From.ID)
+
+	var msg tgbotapi.MessageConfig
+	switch {
+	case services.IsAdministrator(newMember) && !services.IsAdministrator(oldMember):
+		msg = b.promotedMessage(update.From.ID, channel, groups)
+	case services.IsRemoved(newMember) && !services.IsRemoved(oldMember):
+		msg = tgbotapi.NewMessage(update.From.ID, fmt.Sprintf("⚠️ 机器人已被移出 %s (%s)\n\n已在 %d 个频道组中停用该频道，重新设为管理员后会自动恢复。",
+			channel.Title, channel.ChatID, groups))
+	case services.IsAdministrator(oldMember) && !services.IsAdministrator(newMember):
+		msg = tgbotapi.NewMessage(update.From.ID, fmt.Sprintf("⚠️ 机器人在 %s (%s) 不再是管理员，将无法发布消息\n\n%s",
+			channel.Title, channel.ChatID, describeChannelHealth(channel.Health)))
+	default:
+		return
+	}
+
+	if _, err := b.api.Send(msg); err != nil {
+		// The user may never have started a chat with the bot
+		log.Printf("Failed to notify user %d of membership in chat %s: %v", update.From.ID, channel.ChatID, err)
+	}
+}
+
+// promotedMessage builds the notice of the bot's promotion in a channel, with a button for each
+// group the channel can be added to
+func (b *Bot) promotedMessage(userID int64, channel *models.KnownChannel, reactivated int64) tgbotapi.MessageConfig {
+	text := fmt.Sprintf("✅ 机器人已成为 %s (%s) 的管理员\n\n%s", channel.Title, channel.ChatID, describeChannelHealth(channel.Health))
+	if reactivated > 0 {
+		text += fmt.Sprintf("\n已在 %d 个频道组中恢复该频道。\n", reactivated)
+	}
+
+	groups, err := b.repo.GetChannelGroups()
+	if err != nil {
+		log.Printf("Failed to get channel groups: %v", err)
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		existing, err := b.repo.GetGroupChannel(group.ID, channel.ChatID)
+		if err != nil {
+			log.Printf("Failed to check channel %s in group %d: %v", channel.ChatID, group.ID, err)
+			continue
+		}
+		if existing != nil && existing.IsActive {
+			continue
+		}
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ 加入 "+group.Name, fmt.Sprintf("known_add_%d_%s", group.ID, channel.ChatID)),
+		))
+	}
+
+	if len(keyboard) > 0 {
+		text += "\n选择要加入的频道组："
+	} else {
+		text += "\n没有可加入的频道组，可在 \"📋 管理频道组\" 中创建。"
+	}
+
+	msg := tgbotapi.NewMessage(userID, text)
+	if len(keyboard) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	}
+	return msg
+}
+
+// handleKnownAddAction adds a known channel to a group: known_add_{groupID}_{chatID}
+func (b *Bot) handleKnownAddAction(chatID int64, data string) {
+	parts := strings.SplitN(strings.TrimPrefix(data, "known_add_"), "_", 2)
+	if len(parts) != 2 {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+	groupID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
+		return
+	}
+
+	known, err := b.repo.GetKnownChannel(parts[1])
+	if err != nil || known == nil {
+		b.sendMessage(chatID, "❌ 未找到该频道的记录")
+		return
+	}
+	if !known.IsActive {
+		b.sendMessage(chatID, "❌ 机器人已不在该频道中")
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	existing, err := b.repo.GetGroupChannel(groupID, known.ChatID)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 添加频道失败："+err.Error())
+		return
+	}
+
+	switch {
+	case existing != nil && existing.IsActive:
+		b.sendMessage(chatID, fmt.Sprintf("ℹ️ %s 已在频道组 %s 中", known.Title, group.Name))
+		return
+	case existing != nil:
+		err = b.repo.UpdateChannelStatus(existing.ID, true)
+	default:
+		channel := &models.Channel{
+			ChannelID:   known.ChatID,
+			ChannelName: known.Title,
+			GroupID:     groupID,
+			IsActive:    true,
+		}
+		err = b.repo.CreateChannel(channel)
+		if err == nil {
+			err = b.repo.UpdateChannelHealth(channel.ID, known.Health)
+		}
+	}
+	if err != nil {
+		b.sendMessage(chatID, "❌ 添加频道失败："+err.Error())
+		return
+	}
+
+	b.sendMessage(chatID, fmt.Sprintf("✅ 已将 %s 加入频道组 %s", known.Title, group.Name))
+	b.showChannelManagement(chatID, groupID)
+}
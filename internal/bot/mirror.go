@@ -0,0 +1,461 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// mirrorMessageTypes lists the message types that mirror rules can filter on
+var mirrorMessageTypes = []string{
+	"text", "photo", "video", "animation", "document", "audio", "voice",
+	"video_note", "sticker", "poll", "venue", "location", "contact", "dice",
+}
+
+// handleChannelPost relays new posts of watched source channels according to mirror rules
+func (b *Bot) handleChannelPost(post *tgbotapi.Message) {
+	rules, err := b.repo.GetActiveMirrorRulesBySource(post.Chat.ID)
+	if err != nil {
+		log.Printf("Failed to load mirror rules for chat %d: %v", post.Chat.ID, err)
+		return
+	}
+
+	if len(rules) == 0 {
+		return
+	}
+
+	// Albums arrive as separate posts; relay them together once complete
+	if post.MediaGroupID != "" {
+		b.bufferMediaGroupMessage(post.Chat.ID, post, func(buffer *MediaGroupBuffer) {
+			b.relayMirroredPost(rules, buffer.Messages)
+		})
+		return
+	}
+
+	b.relayMirroredPost(rules, []*tgbotapi.Message{post})
+}
+
+// relayMirroredPost relays a source post to the target group of every matching rule
+func (b *Bot) relayMirroredPost(rules []models.MirrorRule, messages []*tgbotapi.Message) {
+	for _, rule := range rules {
+		b.mirror.Relay(rule, messages)
+	}
+}
+
+// showMirrorRules shows all mirror rules
+func (b *Bot) showMirrorRules(chatID int64) {
+	rules, err := b.repo.GetMirrorRules()
+	if err != nil {
+		b.sendMessage(chatID, "加载镜像规则时出错。")
+		return
+	}
+
+	text := "🪞 *频道镜像*\n\n自动将源频道的新消息无引用转发到频道组。\n\n"
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+
+	if len(rules) == 0 {
+		text += "暂无镜像规则。"
+	} else {
+		text += "选择要管理的镜像规则："
+		for _, rule := range rules {
+			groupName := fmt.Sprintf("#%d", rule.GroupID)
+			if group, err := b.repo.GetChannelGroup(rule.GroupID); err == nil {
+				groupName = group.Name
+			}
+
+			status := "🔴"
+			if rule.IsActive {
+				status = "🟢"
+			}
+			buttonText := fmt.Sprintf("%s %s → %s", status, mirrorSourceName(rule), groupName)
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(buttonText, fmt.Sprintf("mirror_rule_%d", rule.ID)),
+			))
+		}
+	}
+
+	keyboard = append(keyboard,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ 添加镜像规则", "mirror_add"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "settings"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// mirrorSourceName returns a display name of a mirror rule's source channel
+func mirrorSourceName(rule models.MirrorRule) string {
+	if rule.SourceTitle != "" {
+		return rule.SourceTitle
+	}
+	return strconv.FormatInt(rule.SourceChatID, 10)
+}
+
+// handleMirrorAddAction starts adding a mirror rule
+func (b *Bot) handleMirrorAddAction(chatID int64) {
+	b.setState(chatID, "add_mirror_source", nil)
+	b.sendMessage(chatID, "🪞 *添加镜像规则*\n\n请从源频道转发一条消息给我，或输入源频道的ID或用户名（如 @channel）。\n\n⚠️ 机器人必须是源频道的管理员才能收到新消息。")
+}
+
+// handleAddMirrorSource handles the source channel input of a new mirror rule
+func (b *Bot) handleAddMirrorSource(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	var sourceChat *tgbotapi.Chat
+
+	if message.ForwardFromChat != nil {
+		sourceChat = message.ForwardFromChat
+	} else {
+		input := strings.TrimSpace(message.Text)
+		if input == "" {
+			b.sendMessage(chatID, "❌ 请转发一条源频道的消息，或输入频道ID或用户名：")
+			return
+		}
+
+		config := tgbotapi.ChatInfoConfig{}
+		if id, err := strconv.ParseInt(input, 10, 64); err == nil {
+			config.ChatID = id
+		} else {
+			if !strings.HasPrefix(input, "@") {
+				input = "@" + input
+			}
+			config.SuperGroupUsername = input
+		}
+
+		chat, err := b.api.GetChat(config)
+		if err != nil {
+			b.sendMessage(chatID, "❌ 无法获取该频道信息，请确认机器人已加入该频道：\n"+err.Error())
+			return
+		}
+		sourceChat = &chat
+	}
+
+	if sourceChat.Type != "channel" {
+		b.sendMessage(chatID, "❌ 源必须是频道，请重新转发或输入：")
+		return
+	}
+
+	userState.Data["sourceChatID"] = sourceChat.ID
+	userState.Data["sourceTitle"] = sourceChat.Title
+
+	groups, err := b.repo.GetChannelGroups()
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "加载频道组时出错。")
+		return
+	}
+
+	if len(groups) == 0 {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "没有可用的频道组。请先创建频道组。")
+		return
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(group.Name, fmt.Sprintf("mirror_target_%d", group.ID)),
+		))
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "mirror_rules"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 源频道：%s\n\n请选择要镜像到的频道组：", sourceChat.Title))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleMirrorTargetAction creates a mirror rule for the chosen target group
+func (b *Bot) handleMirrorTargetAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "mirror_target_")
+	if groupID == 0 {
+		return
+	}
+
+	b.stateMutex.RLock()
+	userState, exists := b.userStates[chatID]
+	b.stateMutex.RUnlock()
+
+	if !exists || userState.State != "add_mirror_source" || userState.Data["sourceChatID"] == nil {
+		b.sendMessage(chatID, "❌ 操作已过期，请重新开始。")
+		b.showMirrorRules(chatID)
+		return
+	}
+
+	rule := &models.MirrorRule{
+		SourceChatID: userState.Data["sourceChatID"].(int64),
+		SourceTitle:  userState.Data["sourceTitle"].(string),
+		GroupID:      groupID,
+		IsActive:     true,
+	}
+
+	b.clearState(chatID)
+
+	if err := b.repo.CreateMirrorRule(rule); err != nil {
+		b.sendMessage(chatID, "❌ 创建镜像规则失败："+err.Error())
+		return
+	}
+
+	b.sendMessage(chatID, "✅ 镜像规则已创建，源频道的新消息将自动转发到该频道组。")
+	b.showMirrorRule(chatID, rule.ID)
+}
+
+// handleMirrorRuleAction shows a mirror rule
+func (b *Bot) handleMirrorRuleAction(chatID int64, data string) {
+	ruleID := b.extractGroupIDFromData(data, "mirror_rule_")
+	if ruleID == 0 {
+		return
+	}
+
+	b.showMirrorRule(chatID, ruleID)
+}
+
+// showMirrorRule shows the details and actions of a mirror rule
+func (b *Bot) showMirrorRule(chatID int64, ruleID int64) {
+	rule, err := b.repo.GetMirrorRule(ruleID)
+	if err != nil {
+		b.sendMessage(chatID, "加载镜像规则时出错。")
+		return
+	}
+
+	groupName := fmt.Sprintf("#%d", rule.GroupID)
+	if group, err := b.repo.GetChannelGroup(rule.GroupID); err == nil {
+		groupName = group.Name
+	}
+
+	count, err := b.repo.CountMirrorRecordsByRule(rule.ID)
+	if err != nil {
+		log.Printf("Failed to count mirror records for rule %d: %v", rule.ID, err)
+	}
+
+	text := "🪞 镜像规则\n\n"
+	text += fmt.Sprintf("📡 源频道：%s (%d)\n", mirrorSourceName(*rule), rule.SourceChatID)
+	text += fmt.Sprintf("📋 目标频道组：%s\n", groupName)
+	text += fmt.Sprintf("状态：%s\n", map[bool]string{true: "🟢 启用", false: "🔴 停用"}[rule.IsActive])
+	text += fmt.Sprintf("包含关键词：%s\n", formatMirrorList(rule.IncludeKeywords))
+	text += fmt.Sprintf("排除关键词：%s\n", formatMirrorList(rule.ExcludeKeywords))
+	text += fmt.Sprintf("包含类型：%s\n", formatMirrorList(rule.IncludeTypes))
+	text += fmt.Sprintf("排除类型：%s\n", formatMirrorList(rule.ExcludeTypes))
+	text += fmt.Sprintf("延迟：%d 秒\n", rule.DelaySeconds)
+	text += fmt.Sprintf("已转发消息：%d 条", count)
+
+	toggleText := "🔴 停用规则"
+	if !rule.IsActive {
+		toggleText = "🟢 启用规则"
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(toggleText, fmt.Sprintf("mirror_toggle_%d", rule.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⚙️ 编辑过滤条件", fmt.Sprintf("mirror_filters_%d", rule.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑️ 删除规则", fmt.Sprintf("mirror_delete_%d", rule.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "mirror_rules"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	b.api.Send(msg)
+}
+
+// formatMirrorList formats a filter list for display
+func formatMirrorList(list models.StringList) string {
+	if len(list) == 0 {
+		return "无"
+	}
+	return strings.Join(list, ", ")
+}
+
+// handleMirrorToggleAction enables or disables a mirror rule
+func (b *Bot) handleMirrorToggleAction(chatID int64, data string) {
+	ruleID := b.extractGroupIDFromData(data, "mirror_toggle_")
+	if ruleID == 0 {
+		return
+	}
+
+	rule, err := b.repo.GetMirrorRule(ruleID)
+	if err != nil {
+		b.sendMessage(chatID, "加载镜像规则时出错。")
+		return
+	}
+
+	if err := b.repo.UpdateMirrorRuleStatus(ruleID, !rule.IsActive); err != nil {
+		b.sendMessage(chatID, "❌ 更新规则状态失败："+err.Error())
+		return
+	}
+
+	b.showMirrorRule(chatID, ruleID)
+}
+
+// handleMirrorFiltersAction starts editing the filters of a mirror rule
+func (b *Bot) handleMirrorFiltersAction(chatID int64, data string) {
+	ruleID := b.extractGroupIDFromData(data, "mirror_filters_")
+	if ruleID == 0 {
+		return
+	}
+
+	b.setState(chatID, "edit_mirror_filters", map[string]interface{}{
+		"ruleID": ruleID,
+	})
+
+	b.sendMessage(chatID, "⚙️ *编辑过滤条件*\n\n请按行输入要修改的条件，未填写的条件保持不变，填写 `无` 可清空：\n\n"+
+		"```\n包含: 关键词1, 关键词2\n排除: 广告\n类型: photo, video\n排除类型: sticker\n延迟: 60\n```\n\n"+
+		"💡 **可用类型：** "+strings.Join(mirrorMessageTypes, ", ")+"\n💡 延迟单位为秒")
+}
+
+// handleEditMirrorFilters handles the filter input of a mirror rule
+func (b *Bot) handleEditMirrorFilters(chatID int64, input string, userState *UserState) {
+	ruleID := userState.Data["ruleID"].(int64)
+
+	rule, err := b.repo.GetMirrorRule(ruleID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "加载镜像规则时出错。")
+		return
+	}
+
+	for i, line := range strings.Split(strings.TrimSpace(input), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// Accept both ASCII and full-width colons
+		line = strings.Replace(line, "：", ":", 1)
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			b.sendMessage(chatID, fmt.Sprintf("❌ 第%d行格式错误：%s\n请使用格式：条件: 值", i+1, line))
+			return
+		}
+
+		key := strings.TrimSpace(parts[0])
+		values := parseMirrorList(parts[1])
+
+		switch key {
+		case "包含":
+			rule.IncludeKeywords = values
+		case "排除":
+			rule.ExcludeKeywords = values
+		case "类型", "排除类型":
+			for _, value := range values {
+				if !containsString(mirrorMessageTypes, value) {
+					b.sendMessage(chatID, fmt.Sprintf("❌ 第%d行包含未知类型：%s", i+1, value))
+					return
+				}
+			}
+			if key == "类型" {
+				rule.IncludeTypes = values
+			} else {
+				rule.ExcludeTypes = values
+			}
+		case "延迟":
+			value := strings.TrimSpace(parts[1])
+			if value == "无" {
+				value = "0"
+			}
+			delay, err := strconv.Atoi(value)
+			if err != nil || delay < 0 {
+				b.sendMessage(chatID, fmt.Sprintf("❌ 第%d行延迟必须是非负整数：%s", i+1, value))
+				return
+			}
+			rule.DelaySeconds = delay
+		default:
+			b.sendMessage(chatID, fmt.Sprintf("❌ 第%d行未知条件：%s\n可用条件：包含、排除、类型、排除类型、延迟", i+1, key))
+			return
+		}
+	}
+
+	if err := b.repo.UpdateMirrorRuleFilters(rule); err != nil {
+		b.sendMessage(chatID, "❌ 保存过滤条件失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, "✅ 过滤条件已更新")
+	b.showMirrorRule(chatID, ruleID)
+}
+
+// parseMirrorList parses a comma separated filter list; "无" clears the list
+func parseMirrorList(input string) models.StringList {
+	input = strings.TrimSpace(input)
+	if input == "" || input == "无" {
+		return nil
+	}
+
+	var list models.StringList
+	for _, item := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == '，' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// handleMirrorDeleteAction asks to confirm deleting a mirror rule
+func (b *Bot) handleMirrorDeleteAction(chatID int64, data string) {
+	ruleID := b.extractGroupIDFromData(data, "mirror_delete_")
+	if ruleID == 0 {
+		return
+	}
+
+	rule, err := b.repo.GetMirrorRule(ruleID)
+	if err != nil {
+		b.sendMessage(chatID, "加载镜像规则时出错。")
+		return
+	}
+
+	text := fmt.Sprintf("🗑️ 确认删除镜像规则\n\n📡 源频道：%s\n\n⚠️ 此操作不可撤销，已转发的消息不会被删除。", mirrorSourceName(*rule))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 确认删除", fmt.Sprintf("mirror_confirm_delete_%d", ruleID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", fmt.Sprintf("mirror_rule_%d", ruleID)),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	b.api.Send(msg)
+}
+
+// handleMirrorConfirmDeleteAction deletes a mirror rule
+func (b *Bot) handleMirrorConfirmDeleteAction(chatID int64, data string) {
+	ruleID := b.extractGroupIDFromData(data, "mirror_confirm_delete_")
+	if ruleID == 0 {
+		return
+	}
+
+	if err := b.repo.DeleteMirrorRule(ruleID); err != nil {
+		b.sendMessage(chatID, "❌ 删除镜像规则失败："+err.Error())
+		return
+	}
+
+	b.sendMessage(chatID, "✅ 镜像规则已删除")
+	b.showMirrorRules(chatID)
+}
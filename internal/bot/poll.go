@@ -0,0 +1,287 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"tg-channel-repost-bot/internal/models"
+	"tg-channel-repost-bot/internal/services"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Prefixes of the poll template text format
+const (
+	pollCorrectPrefix     = "*"
+	pollMultiplePrefix    = "#多选"
+	pollExplanationPrefix = "#解析"
+	pollOpenPeriodPrefix  = "#时限"
+)
+
+// pollFormatHelp explains the text format of poll templates
+var pollFormatHelp = "第一行为问题，之后每行一个选项：\n" +
+	"`今天想看什么内容？`\n`教程`\n`资讯`\n`闲聊`\n\n" +
+	"**可选设置：**\n" +
+	"• 在选项前加 `*` 标记正确答案，投票即成为测验\n" +
+	"• `#多选` 允许选择多个选项（仅普通投票）\n" +
+	"• `#解析 解析内容` 测验作答后显示的解析\n" +
+	fmt.Sprintf("• `#时限 60` 发出后自动关闭的秒数（%d-%d）\n\n", services.MinPollOpenPeriod, services.MaxPollOpenPeriod) +
+	"也可以直接发送或转发一个投票/测验给我。"
+
+// parsePollTemplate parses a poll template written in the text format
+func parsePollTemplate(input string) (string, models.Poll, error) {
+	var question string
+	var poll models.Poll
+	correct := -1
+
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case question == "":
+			question = line
+		case line == pollMultiplePrefix:
+			poll.AllowsMultipleAnswers = true
+		case strings.HasPrefix(line, pollExplanationPrefix):
+			poll.Explanation = strings.TrimSpace(strings.TrimPrefix(line, pollExplanationPrefix))
+		case strings.HasPrefix(line, pollOpenPeriodPrefix):
+			period, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, pollOpenPeriodPrefix)))
+			if err != nil {
+				return "", poll, fmt.Errorf("时限必须是秒数：%s", line)
+			}
+			poll.OpenPeriod = period
+		case strings.HasPrefix(line, pollCorrectPrefix):
+			if correct >= 0 {
+				return "", poll, fmt.Errorf("测验只能有一个正确答案")
+			}
+			correct = len(poll.Options)
+			poll.Options = append(poll.Options, strings.TrimSpace(strings.TrimPrefix(line, pollCorrectPrefix)))
+		default:
+			poll.Options = append(poll.Options, line)
+		}
+	}
+
+	if correct >= 0 {
+		poll.Quiz = true
+		poll.CorrectOptionID = correct
+	}
+
+	return question, poll, validatePoll(question, poll)
+}
+
+// pollFromMessage takes the question and settings of a poll sent or forwarded to the bot
+func pollFromMessage(message *tgbotapi.Poll) (string, models.Poll) {
+	poll := models.Poll{
+		Quiz:                  message.Type == "quiz",
+		AllowsMultipleAnswers: message.AllowsMultipleAnswers,
+		CorrectOptionID:       message.CorrectOptionID,
+		Explanation:           message.Explanation,
+		OpenPeriod:            message.OpenPeriod,
+	}
+	for _, option := range message.Options {
+		poll.Options = append(poll.Options, option.Text)
+	}
+	return message.Question, poll
+}
+
+// validatePoll checks a poll template against Telegram's limits
+func validatePoll(question string, poll models.Poll) error {
+	if question == "" {
+		return fmt.Errorf("问题不能为空")
+	}
+	if utf8.RuneCountInString(question) > services.MaxPollQuestionLength {
+		return fmt.Errorf("问题不能超过%d个字符", services.MaxPollQuestionLength)
+	}
+	if len(poll.Options) < services.MinPollOptions || len(poll.Options) > services.MaxPollOptions {
+		return fmt.Errorf("选项数量必须在%d到%d个之间", services.MinPollOptions, services.MaxPollOptions)
+	}
+	for _, option := range poll.Options {
+		if option == "" {
+			return fmt.Errorf("选项不能为空")
+		}
+		if utf8.RuneCountInString(option) > services.MaxPollOptionLength {
+			return fmt.Errorf("选项不能超过%d个字符：%s", services.MaxPollOptionLength, option)
+		}
+	}
+	if poll.Quiz && poll.AllowsMultipleAnswers {
+		return fmt.Errorf("测验不支持多选")
+	}
+	if !poll.Quiz && poll.Explanation != "" {
+		return fmt.Errorf("只有测验可以设置解析，请用 * 标记正确答案")
+	}
+	if utf8.RuneCountInString(poll.Explanation) > services.MaxPollExplanationLength {
+		return fmt.Errorf("解析不能超过%d个字符", services.MaxPollExplanationLength)
+	}
+	if poll.OpenPeriod != 0 && (poll.OpenPeriod < services.MinPollOpenPeriod || poll.OpenPeriod > services.MaxPollOpenPeriod) {
+		return fmt.Errorf("时限必须在%d到%d秒之间", services.MinPollOpenPeriod, services.MaxPollOpenPeriod)
+	}
+	return nil
+}
+
+// describePoll returns the question and settings of a poll template as plain text
+func describePoll(template *models.MessageTemplate) string {
+	poll := template.Poll
+	kind := "📊 投票"
+	if poll.Quiz {
+		kind = "🧠 测验"
+	}
+
+	text := fmt.Sprintf("%s：%s\n", kind, template.Content)
+	for i, option := range poll.Options {
+		mark := "•"
+		if poll.Quiz && i == poll.CorrectOptionID {
+			mark = "✅"
+		}
+		text += fmt.Sprintf("%s %s\n", mark, option)
+	}
+
+	var settings []string
+	if poll.AllowsMultipleAnswers {
+		settings = append(settings, "允许多选")
+	}
+	if poll.Explanation != "" {
+		settings = append(settings, "解析："+poll.Explanation)
+	}
+	if poll.OpenPeriod > 0 {
+		settings = append(settings, fmt.Sprintf("%d 秒后自动关闭", poll.OpenPeriod))
+	}
+	if len(settings) > 0 {
+		text += "\n" + strings.Join(settings, "\n")
+	}
+
+	return text
+}
+
+// handlePollTemplateAction asks for a poll template of a group
+func (b *Bot) handlePollTemplateAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "poll_template_")
+	if groupID == 0 {
+		return
+	}
+
+	b.setState(chatID, "edit_poll_template", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	b.sendMessage(chatID, "📊 *设置投票/测验模板*\n\n"+pollFormatHelp)
+}
+
+// handleEditPollTemplate saves a poll template from a poll message or the text format
+func (b *Bot) handleEditPollTemplate(chatID int64, message *tgbotapi.Message, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	var question string
+	var poll models.Poll
+	if message.Poll != nil {
+		question, poll = pollFromMessage(message.Poll)
+		if err := validatePoll(question, poll); err != nil {
+			b.sendMessage(chatID, "❌ "+err.Error())
+			return
+		}
+	} else {
+		var err error
+		question, poll, err = parsePollTemplate(message.Text)
+		if err != nil {
+			b.sendMessage(chatID, "❌ "+err.Error()+"\n\n请重新输入：")
+			return
+		}
+	}
+
+	b.savePollTemplate(chatID, groupID, question, poll)
+}
+
+// savePollTemplate turns a group's template into a poll template
+func (b *Bot) savePollTemplate(chatID int64, groupID int64, question string, poll models.Poll) {
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "❌ 加载组信息失败："+err.Error())
+		return
+	}
+
+	if err := b.repo.UpdateMessageTemplatePoll(group.MessageID, question, poll); err != nil {
+		b.sendMessage(chatID, "❌ 更新模板失败："+err.Error())
+		return
+	}
+
+	b.clearState(chatID)
+
+	template := &models.MessageTemplate{Content: question, MessageType: models.MessageTypePoll, Poll: poll}
+	text := "✅ 投票模板已更新\n\n" + describePoll(template) +
+		"\n\n投票无法编辑，新模板将在下次推送或重发时发出；重发时上一条投票会先关闭，最终结果记录在发送记录中。"
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👁️ 预览消息", fmt.Sprintf("preview_message_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回编辑选项", fmt.Sprintf("edit_group_%d", groupID)),
+		),
+	)
+	b.api.Send(msg)
+}
+
+// sendPollPreview sends a poll template to the admin as it will be published
+func (b *Bot) sendPollPreview(chatID int64, template *models.MessageTemplate) {
+	params := make(tgbotapi.Params)
+	params.AddNonZero64("chat_id", chatID)
+	if err := services.AddPollParams(params, template); err != nil {
+		b.sendMessage(chatID, "❌ 预览投票失败："+err.Error())
+		return
+	}
+	if len(template.Buttons) > 0 {
+		if err := params.AddInterface("reply_markup", template.Buttons.Markup()); err != nil {
+			log.Printf("Failed to encode buttons for poll preview: %v", err)
+		}
+	}
+
+	if _, err := b.api.MakeRequest("sendPoll", params); err != nil {
+		b.sendMessage(chatID, "❌ 预览投票失败："+err.Error())
+	}
+}
+
+// showPollResults shows the results of the most recently sent polls
+func (b *Bot) showPollResults(chatID int64) {
+	records, err := b.repo.GetRecentPollRecords(10)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 加载投票结果失败："+err.Error())
+		return
+	}
+
+	text := "📊 *投票结果*\n\n"
+	if len(records) == 0 {
+		text += "还没有投票结果。使用投票模板推送或重发后，结果会在投票进行中和被替换关闭时记录。"
+	}
+	for _, record := range records {
+		results := record.PollResults
+		status := "进行中"
+		if results.Closed {
+			status = "已结束"
+		}
+
+		var options []string
+		for _, option := range results.Options {
+			options = append(options, fmt.Sprintf("%s %d", option.Text, option.VoterCount))
+		}
+		text += fmt.Sprintf("• %s · %s（%s，%s）\n  %s，共 %d 人\n",
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdown, results.Question),
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdown, record.ChannelID), record.CreatedAt.Format("01-02 15:04"), status,
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdown, strings.Join(options, " / ")), results.TotalVoterCount)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 刷新", "records_polls"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回", "view_records"),
+		),
+	)
+	b.api.Send(msg)
+}
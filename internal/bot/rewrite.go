@@ -0,0 +1,277 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// rewriteRuleNames maps rewrite rule types to their display names
+var rewriteRuleNames = map[models.RewriteRuleType]string{
+	models.RewriteRuleRegex:          "🔤 正则替换",
+	models.RewriteRuleRemoveMentions: "🚫 移除 @提及",
+	models.RewriteRuleReplaceURLs:    "🔗 替换链接",
+	models.RewriteRuleDomainMap:      "🌐 域名映射",
+	models.RewriteRuleStripButtons:   "🔘 移除原按钮",
+	models.RewriteRuleAppendFooter:   "📝 追加页脚",
+}
+
+// rewriteRuleOrder lists rewrite rule types in the order they are offered
+var rewriteRuleOrder = []models.RewriteRuleType{
+	models.RewriteRuleRegex,
+	models.RewriteRuleRemoveMentions,
+	models.RewriteRuleReplaceURLs,
+	models.RewriteRuleDomainMap,
+	models.RewriteRuleStripButtons,
+	models.RewriteRuleAppendFooter,
+}
+
+// handleRewriteRulesAction handles the rewrite rules action of a group
+func (b *Bot) handleRewriteRulesAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "rewrite_rules_")
+	if groupID == 0 {
+		return
+	}
+
+	b.showRewriteRules(chatID, groupID)
+}
+
+// showRewriteRules shows the rewrite rules of a group
+func (b *Bot) showRewriteRules(chatID int64, groupID int64) {
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	rules, err := b.repo.GetRewriteRulesByGroupID(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载改写规则时出错。")
+		return
+	}
+
+	text := fmt.Sprintf("✂️ 内容改写规则：%s\n\n无引用转发和频道镜像的消息将按以下顺序改写：\n\n", group.Name)
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+
+	if len(rules) == 0 {
+		text += "暂无改写规则。"
+	}
+	for i, rule := range rules {
+		text += fmt.Sprintf("%d. %s\n", i+1, describeRewriteRule(rule))
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑️ 删除规则 %d", i+1), fmt.Sprintf("rewrite_del_%d_%d", groupID, rule.ID)),
+		))
+	}
+
+	keyboard = append(keyboard,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ 添加规则", fmt.Sprintf("rewrite_add_%d", groupID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔙 返回编辑选项", fmt.Sprintf("edit_group_%d", groupID)),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// describeRewriteRule returns a one-line description of a rewrite rule
+func describeRewriteRule(rule models.RewriteRule) string {
+	name := rewriteRuleNames[rule.RuleType]
+	switch rule.RuleType {
+	case models.RewriteRuleRegex, models.RewriteRuleDomainMap:
+		return fmt.Sprintf("%s：%s → %s", name, rule.Pattern, rule.Replacement)
+	case models.RewriteRuleReplaceURLs:
+		if rule.Replacement == "" {
+			return name + "：删除链接"
+		}
+		return fmt.Sprintf("%s：→ %s", name, rule.Replacement)
+	case models.RewriteRuleAppendFooter:
+		return fmt.Sprintf("%s：%s", name, rule.Replacement)
+	default:
+		return name
+	}
+}
+
+// handleRewriteAddAction shows the rewrite rule types to add
+func (b *Bot) handleRewriteAddAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "rewrite_add_")
+	if groupID == 0 {
+		return
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, ruleType := range rewriteRuleOrder {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(rewriteRuleNames[ruleType], fmt.Sprintf("rewrite_type_%s_%d", ruleType, groupID)),
+		))
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回", fmt.Sprintf("rewrite_rules_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, "➕ *添加改写规则*\n\n请选择规则类型：")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleRewriteTypeAction creates a rule that needs no input, or asks for the rule's input
+func (b *Bot) handleRewriteTypeAction(chatID int64, data string) {
+	// Parse data: rewrite_type_{type}_{groupID}, where type may contain underscores
+	remaining := strings.TrimPrefix(data, "rewrite_type_")
+	separator := strings.LastIndex(remaining, "_")
+	if separator < 0 {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	ruleType := models.RewriteRuleType(remaining[:separator])
+	groupID, err := strconv.ParseInt(remaining[separator+1:], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
+		return
+	}
+
+	if _, ok := rewriteRuleNames[ruleType]; !ok {
+		b.sendMessage(chatID, "❌ 未知的规则类型")
+		return
+	}
+
+	switch ruleType {
+	case models.RewriteRuleRemoveMentions, models.RewriteRuleStripButtons:
+		b.saveRewriteRules(chatID, groupID, []models.RewriteRule{{GroupID: groupID, RuleType: ruleType}})
+		return
+	}
+
+	b.setState(chatID, "add_rewrite_rule", map[string]interface{}{
+		"groupID":  groupID,
+		"ruleType": string(ruleType),
+	})
+
+	var prompt string
+	switch ruleType {
+	case models.RewriteRuleRegex:
+		prompt = "🔤 *正则替换*\n\n请输入规则，一行一条：\n`正则表达式 => 替换内容`\n\n**示例：**\n```\n关注\\s*@\\w+ => \n(?i)vip(\\d+) => 会员$1\n```\n\n💡 替换内容可使用 `$1` 引用分组，留空表示删除"
+	case models.RewriteRuleReplaceURLs:
+		prompt = "🔗 *替换链接*\n\n请输入替换后的链接，所有链接都将替换为该链接。\n\n💡 输入 `无` 表示删除所有链接"
+	case models.RewriteRuleDomainMap:
+		prompt = "🌐 *域名映射*\n\n请输入映射，一行一条：\n`原域名 => 新域名`\n\n**示例：**\n```\nold.example.com => new.example.com\nt.me/oldchannel => t.me/newchannel\n```"
+	case models.RewriteRuleAppendFooter:
+		prompt = "📝 *追加页脚*\n\n请输入要追加到消息末尾的文字："
+	}
+	b.sendMessage(chatID, prompt)
+}
+
+// handleAddRewriteRule handles the input of a new rewrite rule
+func (b *Bot) handleAddRewriteRule(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	ruleType := models.RewriteRuleType(userState.Data["ruleType"].(string))
+	input = strings.TrimSpace(input)
+
+	if input == "" {
+		b.sendMessage(chatID, "❌ 输入不能为空，请重新输入：")
+		return
+	}
+
+	var rules []models.RewriteRule
+	switch ruleType {
+	case models.RewriteRuleRegex, models.RewriteRuleDomainMap:
+		for i, line := range strings.Split(input, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+
+			parts := strings.SplitN(line, "=>", 2)
+			pattern := strings.TrimSpace(parts[0])
+			if len(parts) != 2 || pattern == "" {
+				b.sendMessage(chatID, fmt.Sprintf("❌ 第%d行格式错误：%s\n请使用格式：原内容 => 替换内容", i+1, line))
+				return
+			}
+			replacement := strings.TrimSpace(parts[1])
+
+			if ruleType == models.RewriteRuleRegex {
+				if _, err := regexp.Compile(pattern); err != nil {
+					b.sendMessage(chatID, fmt.Sprintf("❌ 第%d行正则表达式无效：%v", i+1, err))
+					return
+				}
+			} else if replacement == "" {
+				b.sendMessage(chatID, fmt.Sprintf("❌ 第%d行新域名不能为空：%s", i+1, line))
+				return
+			}
+
+			rules = append(rules, models.RewriteRule{
+				GroupID:     groupID,
+				RuleType:    ruleType,
+				Pattern:     pattern,
+				Replacement: replacement,
+			})
+		}
+	case models.RewriteRuleReplaceURLs:
+		replacement := input
+		if replacement == "无" {
+			replacement = ""
+		}
+		rules = append(rules, models.RewriteRule{GroupID: groupID, RuleType: ruleType, Replacement: replacement})
+	case models.RewriteRuleAppendFooter:
+		rules = append(rules, models.RewriteRule{GroupID: groupID, RuleType: ruleType, Replacement: input})
+	}
+
+	if len(rules) == 0 {
+		b.sendMessage(chatID, "❌ 没有找到有效的规则，请重新输入：")
+		return
+	}
+
+	b.clearState(chatID)
+	b.saveRewriteRules(chatID, groupID, rules)
+}
+
+// saveRewriteRules saves new rewrite rules of a group and shows the rule list
+func (b *Bot) saveRewriteRules(chatID int64, groupID int64, rules []models.RewriteRule) {
+	for i := range rules {
+		if err := b.repo.CreateRewriteRule(&rules[i]); err != nil {
+			b.sendMessage(chatID, "❌ 保存改写规则失败："+err.Error())
+			return
+		}
+	}
+
+	b.sendMessage(chatID, fmt.Sprintf("✅ 已添加 %d 条改写规则", len(rules)))
+	b.showRewriteRules(chatID, groupID)
+}
+
+// handleRewriteDeleteAction deletes a rewrite rule
+func (b *Bot) handleRewriteDeleteAction(chatID int64, data string) {
+	// Parse data: rewrite_del_{groupID}_{ruleID}
+	parts := strings.Split(data, "_")
+	if len(parts) != 4 {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
+		return
+	}
+
+	ruleID, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的规则ID")
+		return
+	}
+
+	if err := b.repo.DeleteRewriteRule(groupID, ruleID); err != nil {
+		b.sendMessage(chatID, "❌ 删除改写规则失败："+err.Error())
+		return
+	}
+
+	b.sendMessage(chatID, "✅ 改写规则已删除")
+	b.showRewriteRules(chatID, groupID)
+}
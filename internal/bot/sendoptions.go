@@ -0,0 +1,290 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// linkPreviewNames maps link preview modes to their display names
+var linkPreviewNames = map[models.LinkPreview]string{
+	models.LinkPreviewOff:   "关闭",
+	models.LinkPreviewBelow: "显示在下方",
+	models.LinkPreviewAbove: "显示在上方",
+}
+
+// sendOptionKinds lists the one-off sends whose options can be chosen before picking a group
+var sendOptionKinds = map[string]bool{
+	"push":    true,
+	"repost":  true,
+	"forward": true,
+}
+
+// onOff returns the display text of a boolean option
+func onOff(enabled bool) string {
+	if enabled {
+		return "✅ 开启"
+	}
+	return "❌ 关闭"
+}
+
+// describeSendOptions returns a short summary of send options
+func describeSendOptions(options models.SendOptions) string {
+	var enabled []string
+	if options.Silent {
+		enabled = append(enabled, "静默")
+	}
+	if options.ProtectContent {
+		enabled = append(enabled, "禁止转发")
+	}
+	if options.ShowsLinkPreview() {
+		enabled = append(enabled, "链接预览"+linkPreviewNames[options.LinkPreview])
+	}
+	if options.MediaSpoiler {
+		enabled = append(enabled, "图片剧透")
+	}
+	if len(enabled) == 0 {
+		return "默认"
+	}
+	return strings.Join(enabled, "、")
+}
+
+// toggleSendOption returns the options with one option changed; the link preview cycles
+// through off, below and above
+func toggleSendOption(options models.SendOptions, key string) (models.SendOptions, bool) {
+	switch key {
+	case "silent":
+		options.Silent = !options.Silent
+	case "protect":
+		options.ProtectContent = !options.ProtectContent
+	case "spoiler":
+		options.MediaSpoiler = !options.MediaSpoiler
+	case "preview":
+		switch options.LinkPreview {
+		case models.LinkPreviewBelow:
+			options.LinkPreview = models.LinkPreviewAbove
+		case models.LinkPreviewAbove:
+			options.LinkPreview = models.LinkPreviewOff
+		default:
+			options.LinkPreview = models.LinkPreviewBelow
+		}
+	default:
+		return options, false
+	}
+	return options, true
+}
+
+// sendOptionRows returns the toggle buttons of send options; dataFormat receives the option key
+func sendOptionRows(options models.SendOptions, dataFormat string) [][]tgbotapi.InlineKeyboardButton {
+	linkPreview := options.LinkPreview
+	if !options.ShowsLinkPreview() {
+		linkPreview = models.LinkPreviewOff
+	}
+
+	return [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔕 静默发送："+onOff(options.Silent), fmt.Sprintf(dataFormat, "silent")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔒 禁止转发保存："+onOff(options.ProtectContent), fmt.Sprintf(dataFormat, "protect")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔗 链接预览："+linkPreviewNames[linkPreview], fmt.Sprintf(dataFormat, "preview")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🙈 图片剧透遮罩："+onOff(options.MediaSpoiler), fmt.Sprintf(dataFormat, "spoiler")),
+		),
+	}
+}
+
+// handleSendOptionsAction handles the send options action of a group
+func (b *Bot) handleSendOptionsAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "send_options_")
+	if groupID == 0 {
+		return
+	}
+
+	b.showSendOptions(chatID, groupID)
+}
+
+// showSendOptions shows the send options of a group
+func (b *Bot) showSendOptions(chatID int64, groupID int64) {
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	text := fmt.Sprintf("📨 *发送选项：%s*\n\n该组的推送、重发、无引用转发和镜像消息都按以下选项发送，点击切换：\n\n"+
+		"• 静默发送：订阅者不会收到通知声音\n"+
+		"• 禁止转发保存：消息不能被转发或保存\n"+
+		"• 链接预览：文字消息的链接预览及位置\n"+
+		"• 图片剧透遮罩：图片消息加上剧透遮罩", group.Name)
+
+	keyboard := sendOptionRows(group.SendOptions, "send_opt_%s_"+strconv.FormatInt(groupID, 10))
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 返回编辑选项", fmt.Sprintf("edit_group_%d", groupID)),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handleSendOptionToggleAction toggles one send option of a group
+func (b *Bot) handleSendOptionToggleAction(chatID int64, data string) {
+	// Parse data: send_opt_{key}_{groupID}
+	parts := strings.Split(data, "_")
+	if len(parts) != 4 {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		b.sendMessage(chatID, "❌ 无效的组ID")
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	options, ok := toggleSendOption(group.SendOptions, parts[2])
+	if !ok {
+		b.sendMessage(chatID, "❌ 未知的发送选项")
+		return
+	}
+
+	if err := b.repo.UpdateChannelGroupSendOptions(groupID, options); err != nil {
+		b.sendMessage(chatID, "❌ 保存发送选项失败："+err.Error())
+		return
+	}
+
+	b.showSendOptions(chatID, groupID)
+}
+
+// sendOptionsFor returns the options of a one-off send to a group: the options chosen for this
+// send when there are any, otherwise the group's
+func (b *Bot) sendOptionsFor(group *models.ChannelGroup, data map[string]interface{}) models.SendOptions {
+	if options, ok := data["send_options"].(models.SendOptions); ok {
+		return options
+	}
+	return group.SendOptions
+}
+
+// handlePushOptionsAction shows the options of a one-off send: push_options_{kind}
+func (b *Bot) handlePushOptionsAction(chatID int64, data string) {
+	kind := strings.TrimPrefix(data, "push_options_")
+	if !sendOptionKinds[kind] {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+
+	b.showPushOptions(chatID, kind)
+}
+
+// showPushOptions shows the options chosen for the pending one-off send
+func (b *Bot) showPushOptions(chatID int64, kind string) {
+	b.stateMutex.RLock()
+	userState, exists := b.userStates[chatID]
+	b.stateMutex.RUnlock()
+
+	if !exists {
+		b.sendMessage(chatID, "❌ 没有找到消息内容，请重新发送消息。")
+		b.sendMainMenu(chatID)
+		return
+	}
+
+	text := "⚙️ *本次发送选项*\n\n"
+	options, custom := userState.Data["send_options"].(models.SendOptions)
+	if custom {
+		text += "本次发送将使用以下选项，点击切换："
+	} else {
+		text += "当前使用各频道组自己的发送选项。点击任一选项后，本次发送将改用这里的设置："
+	}
+
+	keyboard := sendOptionRows(options, "push_opt_%s_"+kind)
+	if custom {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("♻️ 恢复使用组设置", "push_opt_reset_"+kind),
+		))
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ 完成，选择频道组", "push_opt_done_"+kind),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	b.api.Send(msg)
+}
+
+// handlePushOptionAction changes the options of the pending one-off send: push_opt_{key}_{kind}
+func (b *Bot) handlePushOptionAction(chatID int64, data string) {
+	parts := strings.Split(data, "_")
+	if len(parts) != 4 || !sendOptionKinds[parts[3]] {
+		b.sendMessage(chatID, "❌ 无效的操作格式")
+		return
+	}
+	key, kind := parts[2], parts[3]
+
+	b.stateMutex.Lock()
+	userState, exists := b.userStates[chatID]
+	if exists {
+		options, _ := userState.Data["send_options"].(models.SendOptions)
+		switch key {
+		case "reset":
+			delete(userState.Data, "send_options")
+		case "done":
+		default:
+			if changed, ok := toggleSendOption(options, key); ok {
+				userState.Data["send_options"] = changed
+			} else {
+				log.Printf("Unknown send option %s", key)
+			}
+		}
+	}
+	b.stateMutex.Unlock()
+
+	if !exists {
+		b.sendMessage(chatID, "❌ 没有找到消息内容，请重新发送消息。")
+		b.sendMainMenu(chatID)
+		return
+	}
+
+	if key != "done" {
+		b.showPushOptions(chatID, kind)
+		return
+	}
+
+	// Return to the group selection of the send
+	switch kind {
+	case "forward":
+		b.showGroupSelectionForForward(chatID, userState.Data)
+	case "repost":
+		b.showGroupSelectionForCustomRepost(chatID, userState.Data["message_content"].(string))
+	default:
+		b.showGroupSelectionForCustomPush(chatID, userState.Data["message_content"].(string))
+	}
+}
+
+// pushOptionsRow returns the button row that opens the options of a one-off send, showing the
+// options chosen so far
+func pushOptionsRow(data map[string]interface{}, kind string) []tgbotapi.InlineKeyboardButton {
+	text := "⚙️ 本次发送选项：使用组设置"
+	if options, ok := data["send_options"].(models.SendOptions); ok {
+		text = "⚙️ 本次发送选项：" + describeSendOptions(options)
+	}
+	return tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(text, "push_options_"+kind),
+	)
+}
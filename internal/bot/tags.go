@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+	"tg-channel-repost-bot/internal/services"
+)
+
+// describeTags returns tags for display
+func describeTags(tags []string) string {
+	if len(tags) == 0 {
+		return "无"
+	}
+	return "#" + strings.Join(tags, " #")
+}
+
+// describeTagRule returns the tag rule of a group for display
+func describeTagRule(group *models.ChannelGroup) string {
+	if !group.HasTagRule() {
+		return "未设置"
+	}
+	text := "包含 " + describeTags(group.TagInclude)
+	if len(group.TagExclude) > 0 {
+		text += "，排除 " + describeTags(group.TagExclude)
+	}
+	return text
+}
+
+// handleChannelTagsAction asks for the tags of a channel
+func (b *Bot) handleChannelTagsAction(chatID int64, data string) {
+	groupID, channelID, err := b.parseChannelActionData(data, "channel_tags_")
+	if err != nil {
+		b.sendMessage(chatID, "无效的频道操作。")
+		return
+	}
+
+	b.setState(chatID, "edit_channel_tags", map[string]interface{}{
+		"groupID":   groupID,
+		"channelID": channelID,
+	})
+
+	b.sendMessage(chatID, "🏷️ 设置频道标签\n\n请输入标签，用空格或逗号分隔，例如：\ncrypto asia news\n\n标签属于频道本身，在所有频道组中通用；设置了标签规则的频道组会自动加入匹配的频道。\n\n输入 无 清除全部标签。")
+}
+
+// handleEditChannelTags saves the tags of a channel and syncs the groups with a tag rule
+func (b *Bot) handleEditChannelTags(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+	channelID := userState.Data["channelID"].(int64)
+
+	channel, err := b.repo.GetChannel(channelID)
+	if err != nil || channel.GroupID != groupID {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "未找到指定的频道。")
+		return
+	}
+
+	var tags []string
+	if strings.TrimSpace(input) != "无" {
+		tags = services.ParseTags(input)
+		if len(tags) == 0 {
+			b.sendMessage(chatID, "❌ 请输入至少一个标签，或输入 无 清除全部标签")
+			return
+		}
+	}
+
+	if err := b.repo.SetChannelTags(channel.ChannelID, tags); err != nil {
+		b.sendMessage(chatID, "❌ 保存频道标签失败："+err.Error())
+		return
+	}
+	b.service.SyncAllTaggedChannels()
+
+	b.clearState(chatID)
+	b.sendMessage(chatID, "✅ 频道标签已设置为 "+describeTags(tags))
+
+	// A channel that joined by the tag rule leaves the group when it no longer matches
+	if _, err := b.repo.GetChannel(channelID); err != nil {
+		b.showChannelManagement(chatID, groupID)
+		return
+	}
+	b.showChannelSettings(chatID, groupID, channelID)
+}
+
+// handleTagRuleAction shows the tag rule of a group and asks for a new one
+func (b *Bot) handleTagRuleAction(chatID int64, data string) {
+	groupID := b.extractGroupIDFromData(data, "tag_rule_")
+	if groupID == 0 {
+		return
+	}
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	text := fmt.Sprintf("🏷️ 标签规则：%s\n\n当前规则：%s\n\n", group.Name, describeTagRule(group))
+
+	counts, err := b.repo.GetTagCounts()
+	if err != nil {
+		log.Printf("Failed to get tag counts: %v", err)
+	}
+	if len(counts) > 0 {
+		text += "已有标签：\n"
+		for _, count := range counts {
+			text += fmt.Sprintf("#%s（%d 个频道）\n", count.Tag, count.Channels)
+		}
+		text += "\n"
+	} else {
+		text += "还没有频道设置标签，可在频道设置中点击 \"🏷️ 设置标签\"。\n\n"
+	}
+
+	text += "请输入新规则：频道需包含全部列出的标签，带 - 的标签表示排除，例如：\ncrypto asia -spam\n\n" +
+		"匹配的频道会在发送时自动加入该组，不再匹配时自动移出；手动添加的频道不受影响。\n\n输入 无 取消标签规则。"
+
+	b.setState(chatID, "edit_tag_rule", map[string]interface{}{
+		"groupID": groupID,
+	})
+
+	b.sendMessage(chatID, text)
+}
+
+// handleEditTagRule saves the tag rule of a group and syncs its channels right away
+func (b *Bot) handleEditTagRule(chatID int64, input string, userState *UserState) {
+	groupID := userState.Data["groupID"].(int64)
+
+	group, err := b.repo.GetChannelGroup(groupID)
+	if err != nil {
+		b.clearState(chatID)
+		b.sendMessage(chatID, "加载组详情时出错。")
+		return
+	}
+
+	var include, exclude []string
+	if strings.TrimSpace(input) != "无" {
+		include, exclude = services.ParseTagRule(input)
+		if len(include) == 0 {
+			b.sendMessage(chatID, "❌ 规则至少需要一个要包含的标签，例如：crypto -spam")
+			return
+		}
+	}
+
+	group.TagInclude = include
+	group.TagExclude = exclude
+	if err := b.repo.UpdateChannelGroup(group); err != nil {
+		b.sendMessage(chatID, "❌ 保存标签规则失败："+err.Error())
+		return
+	}
+	b.clearState(chatID)
+
+	result, err := b.service.SyncTaggedChannels(group)
+	if err != nil {
+		b.sendMessage(chatID, "⚠️ 标签规则已保存，但同步频道失败："+err.Error())
+	} else {
+		b.sendMessage(chatID, fmt.Sprintf("✅ 标签规则已设置为：%s\n\n按规则加入 %d 个频道，移出 %d 个频道", describeTagRule(group), result.Added, result.Removed))
+	}
+
+	b.showChannelManagement(chatID, groupID)
+}
@@ -49,6 +49,18 @@ func (db *DB) Migrate() error {
 		createMessageTemplatesTable,
 		createSendRecordsTable,
 		createRetryConfigsTable,
+		createMirrorRulesTable,
+		createMirrorRecordsTable,
+		createRewriteRulesTable,
+		createVoteMessagesTable,
+		createVotesTable,
+		createTrackedLinksTable,
+		createLinkClicksTable,
+		createPollMessagesTable,
+		createKnownChannelsTable,
+		createPublishedMessagesTable,
+		createChannelTagsTable,
+		createDataMigrationsTable,
 		createIndexes,
 		// addEntitiesFieldToMessageTemplates, // Already added manually
 	}
@@ -57,6 +69,24 @@ func (db *DB) Migrate() error {
 	additionalMigrations := []string{
 		addAutoPinFieldToChannelGroups,
 		addScheduleFieldsToChannelGroups,
+		addOverrideFieldsToChannels,
+		addRepostModeFieldToChannelGroups,
+		addFooterFieldsToChannelGroups,
+		addLastMessagePartsFieldToChannels,
+		addPartMessageIDsFieldToSendRecords,
+		addSendOptionsFieldToChannelGroups,
+		addVariantFieldsToChannelGroups,
+		addVariantFieldsToSendRecords,
+		addTemplateIDFieldToVoteMessages,
+		addPollFieldToMessageTemplates,
+		addPollResultsFieldToSendRecords,
+		addTranslationsFieldToMessageTemplates,
+		addLanguageFieldToChannels,
+		addHealthFieldToChannels,
+		addTagRuleFieldsToChannelGroups,
+		addTagMatchedFieldToChannels,
+		addVariantStartedAtFieldToChannelGroups,
+		addDeactivatedByRemovalFieldToChannels,
 	}
 
 	for _, migration := range additionalMigrations {
@@ -72,6 +102,53 @@ func (db *DB) Migrate() error {
 		}
 	}
 
+	// Run data migrations once, after the tables they read and write exist
+	dataMigrations := []struct {
+		name  string
+		query string
+	}{
+		{"clear_shared_last_message_ids", clearSharedLastMessageIDs},
+		{"backfill_published_messages", backfillPublishedMessages},
+		{"backfill_variant_started_at", backfillVariantStartedAt},
+	}
+
+	for _, migration := range dataMigrations {
+		if err := db.runDataMigration(migration.name, migration.query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runDataMigration runs a data migration unless it is recorded as done, recording it in the
+// same transaction
+func (db *DB) runDataMigration(name, query string) error {
+	var done int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM data_migrations WHERE name = ?`, name).Scan(&done); err != nil {
+		return fmt.Errorf("failed to check data migration %s: %w", name, err)
+	}
+	if done > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin data migration %s: %w", name, err)
+	}
+	if _, err := tx.Exec(query); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to run data migration %s: %w", name, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO data_migrations (name) VALUES (?)`, name); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record data migration %s: %w", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit data migration %s: %w", name, err)
+	}
+
+	log.Printf("Ran data migration %s", name)
 	return nil
 }
 
@@ -84,6 +161,17 @@ CREATE TABLE IF NOT EXISTS channel_groups (
     frequency INTEGER NOT NULL DEFAULT 60,
     is_active BOOLEAN NOT NULL DEFAULT 1,
     auto_pin BOOLEAN NOT NULL DEFAULT 0,
+    repost_mode TEXT NOT NULL DEFAULT 'delete',
+    footer_text TEXT NOT NULL DEFAULT '',
+    footer_entities TEXT NOT NULL DEFAULT '', -- JSON format
+    footer_buttons TEXT, -- JSON format, extra button row
+    send_options TEXT NOT NULL DEFAULT '{}', -- JSON format
+    variant_template_id INTEGER NOT NULL DEFAULT 0, -- template of A/B variant B, 0 = no test
+    variant_mode TEXT NOT NULL DEFAULT 'split',
+    variant_cycle INTEGER NOT NULL DEFAULT 0,
+    variant_started_at DATETIME, -- start of the running A/B test, NULL = no test
+    tag_include TEXT NOT NULL DEFAULT '[]', -- JSON format, tags a channel needs to join by tag rule
+    tag_exclude TEXT NOT NULL DEFAULT '[]', -- JSON format, tags keeping a channel out
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );`
@@ -95,7 +183,14 @@ CREATE TABLE IF NOT EXISTS channels (
     channel_name TEXT,
     group_id INTEGER NOT NULL,
     last_message_id TEXT,
+    last_message_parts TEXT NOT NULL DEFAULT '[]', -- JSON format, follow-up parts of a split repost
+    template_id INTEGER NOT NULL DEFAULT 0, -- override template, 0 = use group template
+    buttons TEXT, -- JSON format, override buttons
+    language TEXT NOT NULL DEFAULT '', -- language code picking template translations
+    health TEXT, -- JSON format, result of the last health check
+    tag_matched BOOLEAN NOT NULL DEFAULT 0, -- joined the group by its tag rule
     is_active BOOLEAN NOT NULL DEFAULT 1,
+    deactivated_by_removal BOOLEAN NOT NULL DEFAULT 0, -- deactivated because the bot was removed
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (group_id) REFERENCES channel_groups(id) ON DELETE CASCADE,
@@ -111,6 +206,8 @@ CREATE TABLE IF NOT EXISTS message_templates (
     media_url TEXT,
     buttons TEXT, -- JSON format
     entities TEXT, -- JSON format for message entities
+    poll TEXT, -- JSON format, settings of poll templates
+    translations TEXT, -- JSON format, content keyed by language code
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );`
@@ -121,6 +218,10 @@ CREATE TABLE IF NOT EXISTS send_records (
     group_id INTEGER NOT NULL,
     channel_id TEXT NOT NULL,
     message_id TEXT,
+    part_message_ids TEXT NOT NULL DEFAULT '[]', -- JSON format, follow-up parts of a split message
+    template_id INTEGER NOT NULL DEFAULT 0,
+    variant TEXT NOT NULL DEFAULT '', -- A/B test variant, empty outside tests
+    poll_results TEXT, -- JSON format, results of a sent poll
     message_type TEXT NOT NULL, -- 'repost' or 'push'
     status TEXT NOT NULL DEFAULT 'pending',
     error_message TEXT,
@@ -145,6 +246,143 @@ CREATE TABLE IF NOT EXISTS retry_configs (
     FOREIGN KEY (group_id) REFERENCES channel_groups(id) ON DELETE CASCADE
 );`
 
+const createMirrorRulesTable = `
+CREATE TABLE IF NOT EXISTS mirror_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source_chat_id INTEGER NOT NULL,
+    source_title TEXT NOT NULL DEFAULT '',
+    group_id INTEGER NOT NULL,
+    include_keywords TEXT NOT NULL DEFAULT '[]', -- JSON format
+    exclude_keywords TEXT NOT NULL DEFAULT '[]', -- JSON format
+    include_types TEXT NOT NULL DEFAULT '[]',    -- JSON format
+    exclude_types TEXT NOT NULL DEFAULT '[]',    -- JSON format
+    delay_seconds INTEGER NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES channel_groups(id) ON DELETE CASCADE,
+    UNIQUE(source_chat_id, group_id)
+);`
+
+const createMirrorRecordsTable = `
+CREATE TABLE IF NOT EXISTS mirror_records (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rule_id INTEGER NOT NULL,
+    source_chat_id INTEGER NOT NULL,
+    source_message_id INTEGER NOT NULL,
+    channel_id TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (rule_id) REFERENCES mirror_rules(id) ON DELETE CASCADE
+);`
+
+const createRewriteRulesTable = `
+CREATE TABLE IF NOT EXISTS rewrite_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    rule_type TEXT NOT NULL,
+    pattern TEXT NOT NULL DEFAULT '',
+    replacement TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES channel_groups(id) ON DELETE CASCADE
+);`
+
+const createVoteMessagesTable = `
+CREATE TABLE IF NOT EXISTS vote_messages (
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    chat_title TEXT NOT NULL DEFAULT '',
+    template_id INTEGER NOT NULL DEFAULT 0,
+    buttons TEXT NOT NULL, -- JSON format, without vote counts
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, message_id)
+);`
+
+const createVotesTable = `
+CREATE TABLE IF NOT EXISTS votes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    choice TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(chat_id, message_id, user_id)
+);`
+
+const createTrackedLinksTable = `
+CREATE TABLE IF NOT EXISTS tracked_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    group_id INTEGER NOT NULL,
+    channel_id TEXT NOT NULL,
+    template_id INTEGER NOT NULL DEFAULT 0,
+    button_text TEXT NOT NULL,
+    url TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES channel_groups(id) ON DELETE CASCADE,
+    UNIQUE(group_id, channel_id, template_id, button_text, url)
+);`
+
+const createLinkClicksTable = `
+CREATE TABLE IF NOT EXISTS link_clicks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    link_id INTEGER NOT NULL,
+    clicked_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (link_id) REFERENCES tracked_links(id) ON DELETE CASCADE
+);`
+
+const createPollMessagesTable = `
+CREATE TABLE IF NOT EXISTS poll_messages (
+    poll_id TEXT PRIMARY KEY,
+    channel_id TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    results TEXT, -- JSON format, latest results
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(channel_id, message_id)
+);`
+
+const createKnownChannelsTable = `
+CREATE TABLE IF NOT EXISTS known_channels (
+    chat_id TEXT PRIMARY KEY,
+    title TEXT NOT NULL DEFAULT '',
+    chat_type TEXT NOT NULL DEFAULT '',
+    health TEXT, -- JSON format, bot status and rights from the last my_chat_member update
+    added_by INTEGER NOT NULL DEFAULT 0,
+    is_active BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+
+const createPublishedMessagesTable = `
+CREATE TABLE IF NOT EXISTS published_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    channel_id TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    kind TEXT NOT NULL, -- 'repost', 'push', 'forward' or 'mirror'
+    deleted BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    FOREIGN KEY (group_id) REFERENCES channel_groups(id) ON DELETE CASCADE,
+    UNIQUE(channel_id, message_id)
+);`
+
+const createChannelTagsTable = `
+CREATE TABLE IF NOT EXISTS channel_tags (
+    channel_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, tag)
+);`
+
+const createDataMigrationsTable = `
+CREATE TABLE IF NOT EXISTS data_migrations (
+    name TEXT PRIMARY KEY,
+    applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+
 const createIndexes = `
 CREATE INDEX IF NOT EXISTS idx_channels_group_id ON channels(group_id);
 CREATE INDEX IF NOT EXISTS idx_channels_channel_id ON channels(channel_id);
@@ -153,6 +391,12 @@ CREATE INDEX IF NOT EXISTS idx_send_records_channel_id ON send_records(channel_i
 CREATE INDEX IF NOT EXISTS idx_send_records_status ON send_records(status);
 CREATE INDEX IF NOT EXISTS idx_send_records_scheduled_at ON send_records(scheduled_at);
 CREATE INDEX IF NOT EXISTS idx_retry_configs_group_id ON retry_configs(group_id);
+CREATE INDEX IF NOT EXISTS idx_mirror_rules_source_chat_id ON mirror_rules(source_chat_id);
+CREATE INDEX IF NOT EXISTS idx_mirror_records_source ON mirror_records(source_chat_id, source_message_id);
+CREATE INDEX IF NOT EXISTS idx_rewrite_rules_group_id ON rewrite_rules(group_id);
+CREATE INDEX IF NOT EXISTS idx_vote_messages_created_at ON vote_messages(created_at);
+CREATE INDEX IF NOT EXISTS idx_link_clicks_link_id ON link_clicks(link_id);
+CREATE INDEX IF NOT EXISTS idx_published_messages_group_id ON published_messages(group_id, created_at);
 `
 
 const addEntitiesFieldToMessageTemplates = `
@@ -173,3 +417,141 @@ ALTER TABLE channel_groups ADD COLUMN schedule_mode TEXT NOT NULL DEFAULT 'frequ
 -- Add schedule_timepoints field to channel_groups table if it doesn't exist
 ALTER TABLE channel_groups ADD COLUMN schedule_timepoints TEXT DEFAULT '[]';
 `
+
+const addOverrideFieldsToChannels = `
+-- Add template_id field to channels table if it doesn't exist
+ALTER TABLE channels ADD COLUMN template_id INTEGER NOT NULL DEFAULT 0;
+-- Add buttons field to channels table if it doesn't exist
+ALTER TABLE channels ADD COLUMN buttons TEXT;
+`
+
+const addRepostModeFieldToChannelGroups = `
+-- Add repost_mode field to channel_groups table if it doesn't exist
+ALTER TABLE channel_groups ADD COLUMN repost_mode TEXT NOT NULL DEFAULT 'delete';
+`
+
+const addFooterFieldsToChannelGroups = `
+-- Add footer_text field to channel_groups table if it doesn't exist
+ALTER TABLE channel_groups ADD COLUMN footer_text TEXT NOT NULL DEFAULT '';
+-- Add footer_entities field to channel_groups table if it doesn't exist
+ALTER TABLE channel_groups ADD COLUMN footer_entities TEXT NOT NULL DEFAULT '';
+-- Add footer_buttons field to channel_groups table if it doesn't exist
+ALTER TABLE channel_groups ADD COLUMN footer_buttons TEXT;
+`
+
+const addLastMessagePartsFieldToChannels = `
+-- Add last_message_parts field to channels table if it doesn't exist
+ALTER TABLE channels ADD COLUMN last_message_parts TEXT NOT NULL DEFAULT '[]';
+`
+
+const addPartMessageIDsFieldToSendRecords = `
+-- Add part_message_ids field to send_records table if it doesn't exist
+ALTER TABLE send_records ADD COLUMN part_message_ids TEXT NOT NULL DEFAULT '[]';
+`
+
+const addSendOptionsFieldToChannelGroups = `
+-- Add send_options field to channel_groups table if it doesn't exist
+ALTER TABLE channel_groups ADD COLUMN send_options TEXT NOT NULL DEFAULT '{}';
+`
+
+const addVariantFieldsToChannelGroups = `
+-- Add A/B test fields to channel_groups table if they don't exist
+ALTER TABLE channel_groups ADD COLUMN variant_template_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE channel_groups ADD COLUMN variant_mode TEXT NOT NULL DEFAULT 'split';
+ALTER TABLE channel_groups ADD COLUMN variant_cycle INTEGER NOT NULL DEFAULT 0;
+`
+
+const addVariantFieldsToSendRecords = `
+-- Add template_id and variant fields to send_records table if they don't exist
+ALTER TABLE send_records ADD COLUMN template_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE send_records ADD COLUMN variant TEXT NOT NULL DEFAULT '';
+`
+
+const addTemplateIDFieldToVoteMessages = `
+-- Add template_id field to vote_messages table if it doesn't exist
+ALTER TABLE vote_messages ADD COLUMN template_id INTEGER NOT NULL DEFAULT 0;
+`
+
+const addPollFieldToMessageTemplates = `
+-- Add poll field to message_templates table if it doesn't exist
+ALTER TABLE message_templates ADD COLUMN poll TEXT;
+`
+
+const addPollResultsFieldToSendRecords = `
+-- Add poll_results field to send_records table if it doesn't exist
+ALTER TABLE send_records ADD COLUMN poll_results TEXT;
+`
+
+const addTranslationsFieldToMessageTemplates = `
+-- Add translations field to message_templates table if it doesn't exist
+ALTER TABLE message_templates ADD COLUMN translations TEXT;
+`
+
+const addLanguageFieldToChannels = `
+-- Add language field to channels table if it doesn't exist
+ALTER TABLE channels ADD COLUMN language TEXT NOT NULL DEFAULT '';
+`
+
+const addHealthFieldToChannels = `
+-- Add health field to channels table if it doesn't exist
+ALTER TABLE channels ADD COLUMN health TEXT;
+`
+
+const backfillVariantStartedAt = `
+-- Start the A/B tests running before their start was kept when their variant B was created
+UPDATE channel_groups
+SET variant_started_at = (SELECT created_at FROM message_templates WHERE id = channel_groups.variant_template_id)
+WHERE variant_template_id != 0 AND variant_started_at IS NULL;
+`
+
+const clearSharedLastMessageIDs = `
+-- Clear last message IDs that were written to every group of a channel by channel ID, keeping
+-- the one of the group that actually sent the message
+UPDATE channels SET last_message_id = '', last_message_parts = '[]'
+WHERE last_message_id != ''
+AND EXISTS (
+    SELECT 1 FROM channels o
+    WHERE o.channel_id = channels.channel_id AND o.group_id != channels.group_id AND o.last_message_id = channels.last_message_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM send_records s
+    WHERE s.group_id = channels.group_id AND s.channel_id = channels.channel_id AND s.message_id = channels.last_message_id AND s.status = 'sent'
+);
+`
+
+const backfillPublishedMessages = `
+-- Add the messages published before the ledger was kept, from send records and last messages
+INSERT OR IGNORE INTO published_messages (group_id, channel_id, message_id, kind, created_at)
+SELECT group_id, channel_id, message_id, message_type, datetime(COALESCE(sent_at, created_at))
+FROM send_records WHERE status = 'sent' AND message_id != '';
+INSERT OR IGNORE INTO published_messages (group_id, channel_id, message_id, kind, created_at)
+SELECT s.group_id, s.channel_id, p.value, s.message_type, datetime(COALESCE(s.sent_at, s.created_at))
+FROM send_records s, json_each(s.part_message_ids) p WHERE s.status = 'sent';
+INSERT OR IGNORE INTO published_messages (group_id, channel_id, message_id, kind, created_at)
+SELECT group_id, channel_id, last_message_id, 'repost', datetime(updated_at)
+FROM channels WHERE last_message_id != '';
+INSERT OR IGNORE INTO published_messages (group_id, channel_id, message_id, kind, created_at)
+SELECT c.group_id, c.channel_id, p.value, 'repost', datetime(c.updated_at)
+FROM channels c, json_each(c.last_message_parts) p;
+`
+
+const addTagRuleFieldsToChannelGroups = `
+-- Add tag rule fields to channel_groups table if they don't exist
+ALTER TABLE channel_groups ADD COLUMN tag_include TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE channel_groups ADD COLUMN tag_exclude TEXT NOT NULL DEFAULT '[]';
+`
+
+const addTagMatchedFieldToChannels = `
+-- Add tag_matched field to channels table if it doesn't exist
+ALTER TABLE channels ADD COLUMN tag_matched BOOLEAN NOT NULL DEFAULT 0;
+`
+
+const addVariantStartedAtFieldToChannelGroups = `
+-- Add variant_started_at field to channel_groups table if it doesn't exist
+ALTER TABLE channel_groups ADD COLUMN variant_started_at DATETIME;
+`
+
+const addDeactivatedByRemovalFieldToChannels = `
+-- Add deactivated_by_removal field to channels table if it doesn't exist
+ALTER TABLE channels ADD COLUMN deactivated_by_removal BOOLEAN NOT NULL DEFAULT 0;
+`
@@ -30,11 +30,19 @@ func (r *Repository) CreateChannelGroup(group *models.ChannelGroup) error {
 		group.ScheduleTimepoints = models.TimePoints{}
 	}
 
+	if group.RepostMode == "" {
+		group.RepostMode = models.RepostModeDelete
+	}
+
+	if group.VariantMode == "" {
+		group.VariantMode = models.VariantModeSplit
+	}
+
 	query := `
-		INSERT INTO channel_groups (name, description, message_id, frequency, schedule_mode, schedule_timepoints, is_active, auto_pin)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO channel_groups (name, description, message_id, frequency, schedule_mode, schedule_timepoints, is_active, auto_pin, repost_mode, footer_text, footer_entities, footer_buttons, send_options, variant_template_id, variant_mode, variant_cycle, tag_include, tag_exclude)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query, group.Name, group.Description, group.MessageID, group.Frequency, group.ScheduleMode, group.ScheduleTimepoints, group.IsActive, group.AutoPin)
+	result, err := r.db.Exec(query, group.Name, group.Description, group.MessageID, group.Frequency, group.ScheduleMode, group.ScheduleTimepoints, group.IsActive, group.AutoPin, group.RepostMode, group.FooterText, group.FooterEntities, group.FooterButtons, group.SendOptions, group.VariantTemplateID, group.VariantMode, group.VariantCycle, group.TagInclude, group.TagExclude)
 	if err != nil {
 		return fmt.Errorf("failed to create channel group: %w", err)
 	}
@@ -48,18 +56,30 @@ func (r *Repository) CreateChannelGroup(group *models.ChannelGroup) error {
 	return nil
 }
 
+// channelGroupColumns lists the columns selected for a channel group, in scanChannelGroup order
+const channelGroupColumns = `id, name, description, message_id, frequency, schedule_mode, schedule_timepoints, is_active, auto_pin, repost_mode, footer_text, footer_entities, footer_buttons, send_options, variant_template_id, variant_mode, variant_cycle, tag_include, tag_exclude, created_at, updated_at`
+
+// scanChannelGroup scans a channel group selected with channelGroupColumns
+func scanChannelGroup(row rowScanner) (models.ChannelGroup, error) {
+	var group models.ChannelGroup
+	err := row.Scan(
+		&group.ID, &group.Name, &group.Description, &group.MessageID,
+		&group.Frequency, &group.ScheduleMode, &group.ScheduleTimepoints, &group.IsActive, &group.AutoPin,
+		&group.RepostMode, &group.FooterText, &group.FooterEntities, &group.FooterButtons, &group.SendOptions,
+		&group.VariantTemplateID, &group.VariantMode, &group.VariantCycle, &group.TagInclude, &group.TagExclude,
+		&group.CreatedAt, &group.UpdatedAt,
+	)
+	return group, err
+}
+
 // GetChannelGroup gets a channel group by ID
 func (r *Repository) GetChannelGroup(id int64) (*models.ChannelGroup, error) {
 	query := `
-		SELECT id, name, description, message_id, frequency, schedule_mode, schedule_timepoints, is_active, auto_pin, created_at, updated_at
+		SELECT ` + channelGroupColumns + `
 		FROM channel_groups
 		WHERE id = ?
 	`
-	var group models.ChannelGroup
-	err := r.db.QueryRow(query, id).Scan(
-		&group.ID, &group.Name, &group.Description, &group.MessageID,
-		&group.Frequency, &group.ScheduleMode, &group.ScheduleTimepoints, &group.IsActive, &group.AutoPin, &group.CreatedAt, &group.UpdatedAt,
-	)
+	group, err := scanChannelGroup(r.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("channel group not found")
@@ -73,7 +93,7 @@ func (r *Repository) GetChannelGroup(id int64) (*models.ChannelGroup, error) {
 // GetChannelGroups gets all channel groups
 func (r *Repository) GetChannelGroups() ([]models.ChannelGroup, error) {
 	query := `
-		SELECT id, name, description, message_id, frequency, schedule_mode, schedule_timepoints, is_active, auto_pin, created_at, updated_at
+		SELECT ` + channelGroupColumns + `
 		FROM channel_groups
 		ORDER BY created_at DESC
 	`
@@ -85,11 +105,7 @@ func (r *Repository) GetChannelGroups() ([]models.ChannelGroup, error) {
 
 	var groups []models.ChannelGroup
 	for rows.Next() {
-		var group models.ChannelGroup
-		err := rows.Scan(
-			&group.ID, &group.Name, &group.Description, &group.MessageID,
-			&group.Frequency, &group.ScheduleMode, &group.ScheduleTimepoints, &group.IsActive, &group.AutoPin, &group.CreatedAt, &group.UpdatedAt,
-		)
+		group, err := scanChannelGroup(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel group: %w", err)
 		}
@@ -103,10 +119,10 @@ func (r *Repository) GetChannelGroups() ([]models.ChannelGroup, error) {
 func (r *Repository) UpdateChannelGroup(group *models.ChannelGroup) error {
 	query := `
 		UPDATE channel_groups
-		SET name = ?, description = ?, message_id = ?, frequency = ?, schedule_mode = ?, schedule_timepoints = ?, is_active = ?, auto_pin = ?, updated_at = CURRENT_TIMESTAMP
+		SET name = ?, description = ?, message_id = ?, frequency = ?, schedule_mode = ?, schedule_timepoints = ?, is_active = ?, auto_pin = ?, repost_mode = ?, footer_text = ?, footer_entities = ?, footer_buttons = ?, send_options = ?, variant_template_id = ?, variant_mode = ?, variant_cycle = ?, tag_include = ?, tag_exclude = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, group.Name, group.Description, group.MessageID, group.Frequency, group.ScheduleMode, group.ScheduleTimepoints, group.IsActive, group.AutoPin, group.ID)
+	_, err := r.db.Exec(query, group.Name, group.Description, group.MessageID, group.Frequency, group.ScheduleMode, group.ScheduleTimepoints, group.IsActive, group.AutoPin, group.RepostMode, group.FooterText, group.FooterEntities, group.FooterButtons, group.SendOptions, group.VariantTemplateID, group.VariantMode, group.VariantCycle, group.TagInclude, group.TagExclude, group.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update channel group: %w", err)
 	}
@@ -130,10 +146,10 @@ func (r *Repository) DeleteChannelGroup(id int64) error {
 // CreateChannel creates a new channel
 func (r *Repository) CreateChannel(channel *models.Channel) error {
 	query := `
-		INSERT INTO channels (channel_id, channel_name, group_id, last_message_id, is_active)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO channels (channel_id, channel_name, group_id, last_message_id, last_message_parts, template_id, buttons, language, tag_matched, is_active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query, channel.ChannelID, channel.ChannelName, channel.GroupID, channel.LastMessageID, channel.IsActive)
+	result, err := r.db.Exec(query, channel.ChannelID, channel.ChannelName, channel.GroupID, channel.LastMessageID, channel.LastMessageParts, channel.TemplateID, channel.Buttons, channel.Language, channel.TagMatched, channel.IsActive)
 	if err != nil {
 		return fmt.Errorf("failed to create channel: %w", err)
 	}
@@ -147,10 +163,44 @@ func (r *Repository) CreateChannel(channel *models.Channel) error {
 	return nil
 }
 
+// channelColumns lists the columns selected for a channel, in scanChannel order
+const channelColumns = `id, channel_id, channel_name, group_id, last_message_id, last_message_parts, template_id, buttons, language, health, tag_matched, is_active, created_at, updated_at,
+	(SELECT json_group_array(tag) FROM channel_tags WHERE channel_tags.channel_id = channels.channel_id)`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanChannel scans a channel selected with channelColumns
+func scanChannel(row rowScanner) (models.Channel, error) {
+	var channel models.Channel
+	err := row.Scan(
+		&channel.ID, &channel.ChannelID, &channel.ChannelName, &channel.GroupID,
+		&channel.LastMessageID, &channel.LastMessageParts, &channel.TemplateID, &channel.Buttons, &channel.Language, &channel.Health, &channel.TagMatched, &channel.IsActive,
+		&channel.CreatedAt, &channel.UpdatedAt, &channel.Tags,
+	)
+	return channel, err
+}
+
+// GetChannel gets a channel by ID
+func (r *Repository) GetChannel(id int64) (*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE id = ?`
+	channel, err := scanChannel(r.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("channel not found")
+		}
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	return &channel, nil
+}
+
 // GetChannelsByGroupID gets all channels for a group
 func (r *Repository) GetChannelsByGroupID(groupID int64) ([]models.Channel, error) {
 	query := `
-		SELECT id, channel_id, channel_name, group_id, last_message_id, is_active, created_at, updated_at
+		SELECT ` + channelColumns + `
 		FROM channels
 		WHERE group_id = ? AND is_active = 1
 		ORDER BY created_at ASC
@@ -163,11 +213,7 @@ func (r *Repository) GetChannelsByGroupID(groupID int64) ([]models.Channel, erro
 
 	var channels []models.Channel
 	for rows.Next() {
-		var channel models.Channel
-		err := rows.Scan(
-			&channel.ID, &channel.ChannelID, &channel.ChannelName, &channel.GroupID,
-			&channel.LastMessageID, &channel.IsActive, &channel.CreatedAt, &channel.UpdatedAt,
-		)
+		channel, err := scanChannel(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel: %w", err)
 		}
@@ -177,343 +223,882 @@ func (r *Repository) GetChannelsByGroupID(groupID int64) ([]models.Channel, erro
 	return channels, nil
 }
 
-// UpdateChannelLastMessageID updates the last message ID for a channel
-func (r *Repository) UpdateChannelLastMessageID(channelID string, messageID string) error {
+// GetAllChannelsByGroupID gets the channels of a group including inactive ones
+func (r *Repository) GetAllChannelsByGroupID(groupID int64) ([]models.Channel, error) {
 	query := `
-		UPDATE channels
-		SET last_message_id = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE channel_id = ?
+		SELECT ` + channelColumns + `
+		FROM channels
+		WHERE group_id = ?
+		ORDER BY created_at ASC
 	`
-	_, err := r.db.Exec(query, messageID, channelID)
+	rows, err := r.db.Query(query, groupID)
 	if err != nil {
-		return fmt.Errorf("failed to update channel last message ID: %w", err)
+		return nil, fmt.Errorf("failed to get channels: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
-}
-
-// DeleteChannel deletes a channel
-func (r *Repository) DeleteChannel(id int64) error {
-	query := `DELETE FROM channels WHERE id = ?`
-	_, err := r.db.Exec(query, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete channel: %w", err)
+	var channels []models.Channel
+	for rows.Next() {
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+		channels = append(channels, channel)
 	}
 
-	return nil
+	return channels, nil
 }
 
-// MessageTemplate operations
-
-// CreateMessageTemplate creates a new message template
-func (r *Repository) CreateMessageTemplate(template *models.MessageTemplate) error {
+// GetActiveChannels gets the active channels of all groups
+func (r *Repository) GetActiveChannels() ([]models.Channel, error) {
 	query := `
-		INSERT INTO message_templates (title, content, message_type, media_url, buttons, entities)
-		VALUES (?, ?, ?, ?, ?, ?)
+		SELECT ` + channelColumns + `
+		FROM channels
+		WHERE is_active = 1
+		ORDER BY group_id ASC, created_at ASC
 	`
-	result, err := r.db.Exec(query, template.Title, template.Content, template.MessageType, template.MediaURL, template.Buttons, template.Entities)
-	if err != nil {
-		return fmt.Errorf("failed to create message template: %w", err)
-	}
-
-	id, err := result.LastInsertId()
+	rows, err := r.db.Query(query)
 	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
+		return nil, fmt.Errorf("failed to get active channels: %w", err)
 	}
+	defer rows.Close()
 
-	template.ID = id
-	return nil
-}
-
-// GetMessageTemplate gets a message template by ID
-func (r *Repository) GetMessageTemplate(id int64) (*models.MessageTemplate, error) {
-	query := `
-		SELECT id, title, content, message_type, media_url, buttons, entities, created_at, updated_at
-		FROM message_templates
-		WHERE id = ?
-	`
-	var template models.MessageTemplate
-	err := r.db.QueryRow(query, id).Scan(
-		&template.ID, &template.Title, &template.Content, &template.MessageType,
-		&template.MediaURL, &template.Buttons, &template.Entities, &template.CreatedAt, &template.UpdatedAt,
-	)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("message template not found")
+	var channels []models.Channel
+	for rows.Next() {
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
 		}
-		return nil, fmt.Errorf("failed to get message template: %w", err)
+		channels = append(channels, channel)
 	}
 
-	return &template, nil
+	return channels, nil
 }
 
-// UpdateMessageTemplateContent updates the content of a message template
-func (r *Repository) UpdateMessageTemplateContent(id int64, content string) error {
+// UpdateChannelLastMessageID updates the last message ID and the follow-up parts of a split
+// last message for a channel of a group. A Telegram channel in several groups keeps the last
+// message of each group apart, so that a group only replaces its own posts.
+func (r *Repository) UpdateChannelLastMessageID(id int64, messageID string, partIDs models.StringList) error {
 	query := `
-		UPDATE message_templates
-		SET content = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE channels
+		SET last_message_id = ?, last_message_parts = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, content, id)
+	_, err := r.db.Exec(query, messageID, partIDs, id)
 	if err != nil {
-		return fmt.Errorf("failed to update message template content: %w", err)
+		return fmt.Errorf("failed to update channel last message ID: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateMessageTemplateContentAndEntities updates the content and entities of a message template
-func (r *Repository) UpdateMessageTemplateContentAndEntities(id int64, content, entities string) error {
+// UpdateChannelTemplateID sets the override template of a channel (0 clears the override)
+func (r *Repository) UpdateChannelTemplateID(id int64, templateID int64) error {
 	query := `
-		UPDATE message_templates
-		SET content = ?, entities = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE channels
+		SET template_id = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, content, entities, id)
+	_, err := r.db.Exec(query, templateID, id)
 	if err != nil {
-		return fmt.Errorf("failed to update message template content and entities: %w", err)
+		return fmt.Errorf("failed to update channel template: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateMessageTemplateComplete updates all fields of a message template
-func (r *Repository) UpdateMessageTemplateComplete(id int64, content, messageType, mediaURL, entities string) error {
+// UpdateChannelButtons sets the override buttons of a channel (empty clears the override)
+func (r *Repository) UpdateChannelButtons(id int64, buttons models.InlineKeyboard) error {
 	query := `
-		UPDATE message_templates
-		SET content = ?, message_type = ?, media_url = ?, entities = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE channels
+		SET buttons = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, content, messageType, mediaURL, entities, id)
+	_, err := r.db.Exec(query, buttons, id)
 	if err != nil {
-		return fmt.Errorf("failed to update message template: %w", err)
+		return fmt.Errorf("failed to update channel buttons: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateMessageTemplateButtons updates the buttons of a message template
-func (r *Repository) UpdateMessageTemplateButtons(id int64, buttons models.InlineKeyboard) error {
+// UpdateChannelName updates the display name of a channel
+func (r *Repository) UpdateChannelName(id int64, name string) error {
 	query := `
-		UPDATE message_templates
-		SET buttons = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE channels
+		SET channel_name = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, buttons, id)
+	_, err := r.db.Exec(query, name, id)
 	if err != nil {
-		return fmt.Errorf("failed to update message template buttons: %w", err)
+		return fmt.Errorf("failed to update channel name: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateChannelGroupName updates the name of a channel group
-func (r *Repository) UpdateChannelGroupName(id int64, name string) error {
+// UpdateChannelLanguage sets the language of a channel (empty uses the default content)
+func (r *Repository) UpdateChannelLanguage(id int64, language string) error {
 	query := `
-		UPDATE channel_groups
-		SET name = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE channels
+		SET language = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, name, id)
+	_, err := r.db.Exec(query, language, id)
 	if err != nil {
-		return fmt.Errorf("failed to update channel group name: %w", err)
+		return fmt.Errorf("failed to update channel language: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateChannelGroupDescription updates the description of a channel group
-func (r *Repository) UpdateChannelGroupDescription(id int64, description string) error {
+// UpdateChannelHealth stores the result of a channel's health check
+func (r *Repository) UpdateChannelHealth(id int64, health models.ChannelHealth) error {
 	query := `
-		UPDATE channel_groups
-		SET description = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE channels
+		SET health = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, description, id)
+	_, err := r.db.Exec(query, health, id)
 	if err != nil {
-		return fmt.Errorf("failed to update channel group description: %w", err)
+		return fmt.Errorf("failed to update channel health: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateChannelGroupFrequency updates the frequency of a channel group
-func (r *Repository) UpdateChannelGroupFrequency(id int64, frequency int) error {
-	query := `
-		UPDATE channel_groups
-		SET frequency = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`
-	_, err := r.db.Exec(query, frequency, id)
+// GetGroupChannel gets the channel of a group with the given channel ID, active or not; it
+// returns nil when the group has no such channel
+func (r *Repository) GetGroupChannel(groupID int64, channelID string) (*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE group_id = ? AND channel_id = ?`
+	channel, err := scanChannel(r.db.QueryRow(query, groupID, channelID))
 	if err != nil {
-		return fmt.Errorf("failed to update channel group frequency: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group channel: %w", err)
 	}
 
-	return nil
+	return &channel, nil
 }
 
-// UpdateChannelGroupStatus updates the status (active/inactive) of a channel group
-func (r *Repository) UpdateChannelGroupStatus(id int64, isActive bool) error {
+// UpdateChannelStatus updates the status (active/inactive) of a channel. The status is then the
+// operator's choice, so adding the bot back to the channel no longer reactivates it.
+func (r *Repository) UpdateChannelStatus(id int64, isActive bool) error {
 	query := `
-		UPDATE channel_groups
-		SET is_active = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE channels
+		SET is_active = ?, deactivated_by_removal = 0, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
 	_, err := r.db.Exec(query, isActive, id)
 	if err != nil {
-		return fmt.Errorf("failed to update channel group status: %w", err)
+		return fmt.Errorf("failed to update channel status: %w", err)
 	}
 
 	return nil
 }
 
-// UpdateChannelGroupAutoPin updates the auto pin setting of a channel group
-func (r *Repository) UpdateChannelGroupAutoPin(id int64, autoPin bool) error {
+// MoveChannel moves a channel to another group, keeping its last message and overrides. The
+// messages the old group published in the channel move to the ledger of the new group, so that
+// its cleanups find them. The channel becomes an explicit member of the group even if it joined
+// its old group by tag rule.
+func (r *Repository) MoveChannel(id int64, groupID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin channel move: %w", err)
+	}
+
 	query := `
-		UPDATE channel_groups
-		SET auto_pin = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE published_messages
+		SET group_id = ?
+		WHERE (group_id, channel_id) = (SELECT group_id, channel_id FROM channels WHERE id = ?)
+	`
+	if _, err := tx.Exec(query, groupID, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to move published messages: %w", err)
+	}
+
+	query = `
+		UPDATE channels
+		SET group_id = ?, tag_matched = 0, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, autoPin, id)
-	if err != nil {
-		return fmt.Errorf("failed to update channel group auto pin: %w", err)
+	if _, err := tx.Exec(query, groupID, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to move channel: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit channel move: %w", err)
 	}
 
 	return nil
 }
 
-// SendRecord operations
-
-// CreateSendRecord creates a new send record
-func (r *Repository) CreateSendRecord(record *models.SendRecord) error {
+// DeactivateRemovedChannel deactivates a Telegram channel the bot was removed from in every group
+// and stores its health. The groups it was active in are marked so that ReactivateRemovedChannel can
+// restore them. It returns the number of groups the channel is in.
+func (r *Repository) DeactivateRemovedChannel(channelID string, health models.ChannelHealth) (int64, error) {
 	query := `
-		INSERT INTO send_records (group_id, channel_id, message_id, message_type, status, scheduled_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		UPDATE channels
+		SET deactivated_by_removal = (deactivated_by_removal OR is_active), is_active = 0, health = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE channel_id = ?
 	`
-	result, err := r.db.Exec(query, record.GroupID, record.ChannelID, record.MessageID, record.MessageType, record.Status, record.ScheduledAt)
+	result, err := r.db.Exec(query, health, channelID)
 	if err != nil {
-		return fmt.Errorf("failed to create send record: %w", err)
+		return 0, fmt.Errorf("failed to deactivate channel: %w", err)
 	}
 
-	id, err := result.LastInsertId()
+	updated, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
 	}
 
-	record.ID = id
-	return nil
+	return updated, nil
 }
 
-// UpdateSendRecord updates a send record
-func (r *Repository) UpdateSendRecord(record *models.SendRecord) error {
+// UpdateChannelHealthByChatID stores the health of a Telegram channel in every group
+func (r *Repository) UpdateChannelHealthByChatID(channelID string, health models.ChannelHealth) error {
 	query := `
-		UPDATE send_records
-		SET message_id = ?, status = ?, error_message = ?, retry_count = ?, sent_at = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
+		UPDATE channels
+		SET health = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE channel_id = ?
 	`
-	_, err := r.db.Exec(query, record.MessageID, record.Status, record.ErrorMessage, record.RetryCount, record.SentAt, record.ID)
+	_, err := r.db.Exec(query, health, channelID)
 	if err != nil {
-		return fmt.Errorf("failed to update send record: %w", err)
+		return fmt.Errorf("failed to update channel health: %w", err)
 	}
 
 	return nil
 }
 
-// GetPendingSendRecords gets all pending send records
-func (r *Repository) GetPendingSendRecords() ([]models.SendRecord, error) {
+// ReactivateRemovedChannel reactivates a Telegram channel in the groups where removing the bot
+// deactivated it; channels deactivated by the operator stay inactive. It returns the number of
+// groups it was reactivated in.
+func (r *Repository) ReactivateRemovedChannel(channelID string) (int64, error) {
 	query := `
-		SELECT id, group_id, channel_id, message_id, message_type, status, error_message, retry_count, scheduled_at, sent_at, created_at, updated_at
-		FROM send_records
-		WHERE status IN ('pending', 'retry') AND scheduled_at <= ?
-		ORDER BY scheduled_at ASC
+		UPDATE channels
+		SET is_active = 1, deactivated_by_removal = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE channel_id = ? AND deactivated_by_removal = 1
 	`
-	rows, err := r.db.Query(query, time.Now())
+	result, err := r.db.Exec(query, channelID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pending send records: %w", err)
+		return 0, fmt.Errorf("failed to reactivate channel: %w", err)
 	}
-	defer rows.Close()
 
-	var records []models.SendRecord
-	for rows.Next() {
-		var record models.SendRecord
-		err := rows.Scan(
-			&record.ID, &record.GroupID, &record.ChannelID, &record.MessageID, &record.MessageType,
-			&record.Status, &record.ErrorMessage, &record.RetryCount, &record.ScheduledAt,
-			&record.SentAt, &record.CreatedAt, &record.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan send record: %w", err)
-		}
-		records = append(records, record)
+	reactivated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
 	}
 
-	return records, nil
+	return reactivated, nil
 }
 
-// GetPendingSendRecordsByGroupAndChannel gets pending send records for a specific group and channel
-func (r *Repository) GetPendingSendRecordsByGroupAndChannel(groupID int64, channelID string) ([]models.SendRecord, error) {
-	query := `
-		SELECT id, group_id, channel_id, message_id, message_type, status, error_message, retry_count, scheduled_at, sent_at, created_at, updated_at
-		FROM send_records
-		WHERE group_id = ? AND channel_id = ? AND status IN ('pending', 'retry')
-		ORDER BY created_at DESC
-	`
-	rows, err := r.db.Query(query, groupID, channelID)
+// GetUsernameChannelIDs gets the distinct channel IDs of channels stored by @username
+func (r *Repository) GetUsernameChannelIDs() ([]string, error) {
+	query := `SELECT DISTINCT channel_id FROM channels WHERE channel_id LIKE '@%'`
+	rows, err := r.db.Query(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pending send records: %w", err)
+		return nil, fmt.Errorf("failed to get username channels: %w", err)
 	}
 	defer rows.Close()
 
-	var records []models.SendRecord
+	var channelIDs []string
 	for rows.Next() {
-		var record models.SendRecord
-		err := rows.Scan(
-			&record.ID, &record.GroupID, &record.ChannelID, &record.MessageID, &record.MessageType,
-			&record.Status, &record.ErrorMessage, &record.RetryCount, &record.ScheduledAt,
-			&record.SentAt, &record.CreatedAt, &record.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan send record: %w", err)
+		var channelID string
+		if err := rows.Scan(&channelID); err != nil {
+			return nil, fmt.Errorf("failed to scan channel ID: %w", err)
 		}
-		records = append(records, record)
+		channelIDs = append(channelIDs, channelID)
 	}
 
-	return records, nil
+	return channelIDs, nil
 }
 
-// GetSendRecordsByGroupID gets send records for a group
-func (r *Repository) GetSendRecordsByGroupID(groupID int64, limit int) ([]models.SendRecord, error) {
+// UpdateChannelChatID replaces a channel ID in the channels and in everything recorded for them,
+// in one transaction. Channels named after their old ID take the given title. Rows that already
+// exist under the new ID, such as a group holding the channel by both IDs, are kept and their
+// duplicates under the old ID are deleted, except for tracked links whose published buttons must
+// keep redirecting.
+func (r *Repository) UpdateChannelChatID(oldID, newID, title string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin channel ID update: %w", err)
+	}
+
 	query := `
-		SELECT id, group_id, channel_id, message_id, message_type, status, error_message, retry_count, scheduled_at, sent_at, created_at, updated_at
-		FROM send_records
-		WHERE group_id = ?
-		ORDER BY created_at DESC
-		LIMIT ?
+		UPDATE OR IGNORE channels
+		SET channel_id = ?,
+			channel_name = CASE WHEN ? != '' AND (channel_name IS NULL OR channel_name = '' OR channel_name = channel_id) THEN ? ELSE channel_name END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE channel_id = ?
 	`
-	rows, err := r.db.Query(query, groupID, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get send records: %w", err)
+	if _, err := tx.Exec(query, newID, title, title, oldID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update channel ID: %w", err)
 	}
-	defer rows.Close()
 
-	var records []models.SendRecord
-	for rows.Next() {
-		var record models.SendRecord
-		err := rows.Scan(
-			&record.ID, &record.GroupID, &record.ChannelID, &record.MessageID, &record.MessageType,
-			&record.Status, &record.ErrorMessage, &record.RetryCount, &record.ScheduledAt,
-			&record.SentAt, &record.CreatedAt, &record.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan send record: %w", err)
+	// Channels left under the old ID duplicate one of their group; drop them with their override template
+	query = `DELETE FROM message_templates WHERE id IN (SELECT template_id FROM channels WHERE channel_id = ? AND template_id != 0)`
+	if _, err := tx.Exec(query, oldID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete duplicate channel templates: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM channels WHERE channel_id = ?`, oldID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete duplicate channels: %w", err)
+	}
+
+	for _, table := range []string{"poll_messages", "published_messages", "channel_tags"} {
+		query := `UPDATE OR IGNORE ` + table + ` SET channel_id = ? WHERE channel_id = ?`
+		if _, err := tx.Exec(query, newID, oldID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to update channel ID of %s: %w", table, err)
+		}
+		query = `DELETE FROM ` + table + ` WHERE channel_id = ?`
+		if _, err := tx.Exec(query, oldID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to delete duplicates in %s: %w", table, err)
 		}
-		records = append(records, record)
 	}
 
-	return records, nil
-}
+	for _, table := range []string{"send_records", "mirror_records"} {
+		query := `UPDATE ` + table + ` SET channel_id = ? WHERE channel_id = ?`
+		if _, err := tx.Exec(query, newID, oldID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to update channel ID of %s: %w", table, err)
+		}
+	}
 
-// CleanupDuplicatePendingRecords removes duplicate pending records for the same group and channel
+	query = `UPDATE OR IGNORE tracked_links SET channel_id = ? WHERE channel_id = ?`
+	if _, err := tx.Exec(query, newID, oldID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update channel ID of tracked_links: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit channel ID update: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteChannel deletes a channel together with its override template, which belongs to it alone
+func (r *Repository) DeleteChannel(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin channel deletion: %w", err)
+	}
+
+	query := `DELETE FROM message_templates WHERE id = (SELECT template_id FROM channels WHERE id = ? AND template_id != 0)`
+	if _, err := tx.Exec(query, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete channel template: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM channels WHERE id = ?`, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete channel: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit channel deletion: %w", err)
+	}
+
+	return nil
+}
+
+// MessageTemplate operations
+
+// CreateMessageTemplate creates a new message template
+func (r *Repository) CreateMessageTemplate(template *models.MessageTemplate) error {
+	query := `
+		INSERT INTO message_templates (title, content, message_type, media_url, buttons, entities, poll, translations)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query, template.Title, template.Content, template.MessageType, template.MediaURL, template.Buttons, template.Entities, template.Poll, template.Translations)
+	if err != nil {
+		return fmt.Errorf("failed to create message template: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	template.ID = id
+	return nil
+}
+
+// GetMessageTemplate gets a message template by ID
+func (r *Repository) GetMessageTemplate(id int64) (*models.MessageTemplate, error) {
+	query := `
+		SELECT id, title, content, message_type, media_url, buttons, entities, poll, translations, created_at, updated_at
+		FROM message_templates
+		WHERE id = ?
+	`
+	var template models.MessageTemplate
+	err := r.db.QueryRow(query, id).Scan(
+		&template.ID, &template.Title, &template.Content, &template.MessageType,
+		&template.MediaURL, &template.Buttons, &template.Entities, &template.Poll, &template.Translations, &template.CreatedAt, &template.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("message template not found")
+		}
+		return nil, fmt.Errorf("failed to get message template: %w", err)
+	}
+
+	return &template, nil
+}
+
+// DeleteMessageTemplate deletes a message template
+func (r *Repository) DeleteMessageTemplate(id int64) error {
+	query := `DELETE FROM message_templates WHERE id = ?`
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete message template: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMessageTemplateContent updates the content of a message template
+func (r *Repository) UpdateMessageTemplateContent(id int64, content string) error {
+	query := `
+		UPDATE message_templates
+		SET content = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, content, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message template content: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMessageTemplateContentAndEntities updates the content and entities of a message template
+func (r *Repository) UpdateMessageTemplateContentAndEntities(id int64, content, entities string) error {
+	query := `
+		UPDATE message_templates
+		SET content = ?, entities = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, content, entities, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message template content and entities: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMessageTemplateComplete updates all fields of a message template
+func (r *Repository) UpdateMessageTemplateComplete(id int64, content, messageType, mediaURL, entities string) error {
+	query := `
+		UPDATE message_templates
+		SET content = ?, message_type = ?, media_url = ?, entities = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, content, messageType, mediaURL, entities, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message template: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMessageTemplatePoll turns a message template into a poll template with the given question
+// and settings; the buttons are kept
+func (r *Repository) UpdateMessageTemplatePoll(id int64, question string, poll models.Poll) error {
+	query := `
+		UPDATE message_templates
+		SET content = ?, message_type = ?, media_url = '', entities = '', poll = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, question, models.MessageTypePoll, poll, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message template poll: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMessageTemplateTranslations replaces the translations of a message template
+func (r *Repository) UpdateMessageTemplateTranslations(id int64, translations models.Translations) error {
+	query := `
+		UPDATE message_templates
+		SET translations = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, translations, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message template translations: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMessageTemplateButtons updates the buttons of a message template
+func (r *Repository) UpdateMessageTemplateButtons(id int64, buttons models.InlineKeyboard) error {
+	query := `
+		UPDATE message_templates
+		SET buttons = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, buttons, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message template buttons: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupName updates the name of a channel group
+func (r *Repository) UpdateChannelGroupName(id int64, name string) error {
+	query := `
+		UPDATE channel_groups
+		SET name = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, name, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group name: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupDescription updates the description of a channel group
+func (r *Repository) UpdateChannelGroupDescription(id int64, description string) error {
+	query := `
+		UPDATE channel_groups
+		SET description = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, description, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group description: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupFrequency updates the frequency of a channel group
+func (r *Repository) UpdateChannelGroupFrequency(id int64, frequency int) error {
+	query := `
+		UPDATE channel_groups
+		SET frequency = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, frequency, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group frequency: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupStatus updates the status (active/inactive) of a channel group
+func (r *Repository) UpdateChannelGroupStatus(id int64, isActive bool) error {
+	query := `
+		UPDATE channel_groups
+		SET is_active = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, isActive, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group status: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupAutoPin updates the auto pin setting of a channel group
+func (r *Repository) UpdateChannelGroupAutoPin(id int64, autoPin bool) error {
+	query := `
+		UPDATE channel_groups
+		SET auto_pin = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, autoPin, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group auto pin: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupRepostMode updates the repost mode of a channel group
+func (r *Repository) UpdateChannelGroupRepostMode(id int64, mode models.RepostMode) error {
+	query := `
+		UPDATE channel_groups
+		SET repost_mode = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, mode, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group repost mode: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupSendOptions updates the send options of a channel group
+func (r *Repository) UpdateChannelGroupSendOptions(id int64, options models.SendOptions) error {
+	query := `
+		UPDATE channel_groups
+		SET send_options = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, options, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group send options: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupVariant updates the A/B test of a channel group: the template of variant B
+// (0 ends the test) and how the variants are assigned. Setting a variant B on a group without one
+// starts the test, whose metrics are counted from then on.
+func (r *Repository) UpdateChannelGroupVariant(id int64, templateID int64, mode models.VariantMode) error {
+	query := `
+		UPDATE channel_groups
+		SET variant_template_id = ?, variant_mode = ?,
+			variant_started_at = CASE
+				WHEN ? = 0 THEN NULL
+				WHEN variant_template_id = 0 OR variant_started_at IS NULL THEN CURRENT_TIMESTAMP
+				ELSE variant_started_at
+			END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, templateID, mode, templateID, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group variant: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupMessageID updates the template of a channel group
+func (r *Repository) UpdateChannelGroupMessageID(id int64, templateID int64) error {
+	query := `
+		UPDATE channel_groups
+		SET message_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, templateID, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group template: %w", err)
+	}
+
+	return nil
+}
+
+// AdvanceChannelGroupVariantCycle counts a repost cycle of a channel group
+func (r *Repository) AdvanceChannelGroupVariantCycle(id int64) error {
+	query := `
+		UPDATE channel_groups
+		SET variant_cycle = variant_cycle + 1
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to advance channel group variant cycle: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupFooter updates the footer text and its entities of a channel group
+func (r *Repository) UpdateChannelGroupFooter(id int64, text, entities string) error {
+	query := `
+		UPDATE channel_groups
+		SET footer_text = ?, footer_entities = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, text, entities, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group footer: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateChannelGroupFooterButtons updates the footer buttons of a channel group
+func (r *Repository) UpdateChannelGroupFooterButtons(id int64, buttons models.InlineKeyboard) error {
+	query := `
+		UPDATE channel_groups
+		SET footer_buttons = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, buttons, id)
+	if err != nil {
+		return fmt.Errorf("failed to update channel group footer buttons: %w", err)
+	}
+
+	return nil
+}
+
+// SendRecord operations
+
+// CreateSendRecord creates a new send record
+func (r *Repository) CreateSendRecord(record *models.SendRecord) error {
+	query := `
+		INSERT INTO send_records (group_id, channel_id, message_id, part_message_ids, template_id, variant, message_type, status, scheduled_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query, record.GroupID, record.ChannelID, record.MessageID, record.PartMessageIDs, record.TemplateID, record.Variant, record.MessageType, record.Status, record.ScheduledAt)
+	if err != nil {
+		return fmt.Errorf("failed to create send record: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	record.ID = id
+	return nil
+}
+
+// sendRecordColumns lists the columns selected for a send record, in scanSendRecord order
+const sendRecordColumns = `id, group_id, channel_id, message_id, part_message_ids, template_id, variant, poll_results, message_type, status, error_message, retry_count, scheduled_at, sent_at, created_at, updated_at`
+
+// scanSendRecord scans a send record selected with sendRecordColumns
+func scanSendRecord(row rowScanner) (models.SendRecord, error) {
+	var record models.SendRecord
+	err := row.Scan(
+		&record.ID, &record.GroupID, &record.ChannelID, &record.MessageID, &record.PartMessageIDs, &record.TemplateID, &record.Variant, &record.PollResults, &record.MessageType,
+		&record.Status, &record.ErrorMessage, &record.RetryCount, &record.ScheduledAt,
+		&record.SentAt, &record.CreatedAt, &record.UpdatedAt,
+	)
+	return record, err
+}
+
+// UpdateSendRecord updates a send record
+func (r *Repository) UpdateSendRecord(record *models.SendRecord) error {
+	query := `
+		UPDATE send_records
+		SET message_id = ?, part_message_ids = ?, template_id = ?, variant = ?, status = ?, error_message = ?, retry_count = ?, sent_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, record.MessageID, record.PartMessageIDs, record.TemplateID, record.Variant, record.Status, record.ErrorMessage, record.RetryCount, record.SentAt, record.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update send record: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingSendRecords gets all pending send records
+func (r *Repository) GetPendingSendRecords() ([]models.SendRecord, error) {
+	query := `
+		SELECT ` + sendRecordColumns + `
+		FROM send_records
+		WHERE status IN ('pending', 'retry') AND scheduled_at <= ?
+		ORDER BY scheduled_at ASC
+	`
+	rows, err := r.db.Query(query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending send records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []models.SendRecord
+	for rows.Next() {
+		record, err := scanSendRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan send record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// GetPendingSendRecordsByGroupAndChannel gets pending send records for a specific group and channel
+func (r *Repository) GetPendingSendRecordsByGroupAndChannel(groupID int64, channelID string) ([]models.SendRecord, error) {
+	query := `
+		SELECT ` + sendRecordColumns + `
+		FROM send_records
+		WHERE group_id = ? AND channel_id = ? AND status IN ('pending', 'retry')
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(query, groupID, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending send records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []models.SendRecord
+	for rows.Next() {
+		record, err := scanSendRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan send record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// GetSendRecordsByGroupID gets send records for a group
+func (r *Repository) GetSendRecordsByGroupID(groupID int64, limit int) ([]models.SendRecord, error) {
+	query := `
+		SELECT ` + sendRecordColumns + `
+		FROM send_records
+		WHERE group_id = ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`
+	rows, err := r.db.Query(query, groupID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get send records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []models.SendRecord
+	for rows.Next() {
+		record, err := scanSendRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan send record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// GetSentSendRecordsByGroupAndChannel gets successfully sent records of a type for a specific group and channel
+func (r *Repository) GetSentSendRecordsByGroupAndChannel(groupID int64, channelID string, sendType models.SendType) ([]models.SendRecord, error) {
+	query := `
+		SELECT ` + sendRecordColumns + `
+		FROM send_records
+		WHERE group_id = ? AND channel_id = ? AND message_type = ? AND status = 'sent' AND message_id != ''
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(query, groupID, channelID, sendType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sent send records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []models.SendRecord
+	for rows.Next() {
+		record, err := scanSendRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan send record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// CleanupDuplicatePendingRecords removes duplicate pending records for the same group and channel
 func (r *Repository) CleanupDuplicatePendingRecords() error {
 	// First, get count of pending records
 	var count int
@@ -521,17 +1106,941 @@ func (r *Repository) CleanupDuplicatePendingRecords() error {
 	r.db.QueryRow(countQuery).Scan(&count)
 	fmt.Printf("Found %d pending repost records before cleanup\n", count)
 
-	// Delete ALL pending repost records - we'll recreate them as needed
-	query := `DELETE FROM send_records WHERE status = 'pending' AND message_type = 'repost'`
-	result, err := r.db.Exec(query)
+	// Delete ALL pending repost records - we'll recreate them as needed
+	query := `DELETE FROM send_records WHERE status = 'pending' AND message_type = 'repost'`
+	result, err := r.db.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup pending records: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		fmt.Printf("Cleaned up %d pending repost records\n", rowsAffected)
+	}
+
+	return nil
+}
+
+// MirrorRule operations
+
+// mirrorRuleColumns lists the columns selected for a mirror rule, in scanMirrorRule order
+const mirrorRuleColumns = `id, source_chat_id, source_title, group_id, include_keywords, exclude_keywords, include_types, exclude_types, delay_seconds, is_active, created_at, updated_at`
+
+// scanMirrorRule scans a mirror rule selected with mirrorRuleColumns
+func scanMirrorRule(row rowScanner) (models.MirrorRule, error) {
+	var rule models.MirrorRule
+	err := row.Scan(
+		&rule.ID, &rule.SourceChatID, &rule.SourceTitle, &rule.GroupID,
+		&rule.IncludeKeywords, &rule.ExcludeKeywords, &rule.IncludeTypes, &rule.ExcludeTypes,
+		&rule.DelaySeconds, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt,
+	)
+	return rule, err
+}
+
+// CreateMirrorRule creates a new mirror rule
+func (r *Repository) CreateMirrorRule(rule *models.MirrorRule) error {
+	query := `
+		INSERT INTO mirror_rules (source_chat_id, source_title, group_id, include_keywords, exclude_keywords, include_types, exclude_types, delay_seconds, is_active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query, rule.SourceChatID, rule.SourceTitle, rule.GroupID,
+		rule.IncludeKeywords, rule.ExcludeKeywords, rule.IncludeTypes, rule.ExcludeTypes, rule.DelaySeconds, rule.IsActive)
+	if err != nil {
+		return fmt.Errorf("failed to create mirror rule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	rule.ID = id
+	return nil
+}
+
+// GetMirrorRule gets a mirror rule by ID
+func (r *Repository) GetMirrorRule(id int64) (*models.MirrorRule, error) {
+	query := `
+		SELECT ` + mirrorRuleColumns + `
+		FROM mirror_rules
+		WHERE id = ?
+	`
+	rule, err := scanMirrorRule(r.db.QueryRow(query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirror rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// GetMirrorRules gets all mirror rules
+func (r *Repository) GetMirrorRules() ([]models.MirrorRule, error) {
+	query := `
+		SELECT ` + mirrorRuleColumns + `
+		FROM mirror_rules
+		ORDER BY created_at ASC
+	`
+	return r.queryMirrorRules(query)
+}
+
+// GetActiveMirrorRulesBySource gets active mirror rules watching a source chat
+func (r *Repository) GetActiveMirrorRulesBySource(sourceChatID int64) ([]models.MirrorRule, error) {
+	query := `
+		SELECT ` + mirrorRuleColumns + `
+		FROM mirror_rules
+		WHERE source_chat_id = ? AND is_active = 1
+		ORDER BY created_at ASC
+	`
+	return r.queryMirrorRules(query, sourceChatID)
+}
+
+// queryMirrorRules runs a mirror rule query and scans all rows
+func (r *Repository) queryMirrorRules(query string, args ...interface{}) ([]models.MirrorRule, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirror rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.MirrorRule
+	for rows.Next() {
+		rule, err := scanMirrorRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan mirror rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// UpdateMirrorRuleFilters updates the filters and delay of a mirror rule
+func (r *Repository) UpdateMirrorRuleFilters(rule *models.MirrorRule) error {
+	query := `
+		UPDATE mirror_rules
+		SET include_keywords = ?, exclude_keywords = ?, include_types = ?, exclude_types = ?, delay_seconds = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, rule.IncludeKeywords, rule.ExcludeKeywords, rule.IncludeTypes, rule.ExcludeTypes, rule.DelaySeconds, rule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update mirror rule filters: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMirrorRuleStatus updates the active status of a mirror rule
+func (r *Repository) UpdateMirrorRuleStatus(id int64, isActive bool) error {
+	query := `
+		UPDATE mirror_rules
+		SET is_active = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := r.db.Exec(query, isActive, id)
+	if err != nil {
+		return fmt.Errorf("failed to update mirror rule status: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteMirrorRule deletes a mirror rule
+func (r *Repository) DeleteMirrorRule(id int64) error {
+	query := `DELETE FROM mirror_rules WHERE id = ?`
+	_, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete mirror rule: %w", err)
+	}
+
+	return nil
+}
+
+// CreateMirrorRecord records a mirrored post copy
+func (r *Repository) CreateMirrorRecord(record *models.MirrorRecord) error {
+	query := `
+		INSERT INTO mirror_records (rule_id, source_chat_id, source_message_id, channel_id, message_id)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query, record.RuleID, record.SourceChatID, record.SourceMessageID, record.ChannelID, record.MessageID)
+	if err != nil {
+		return fmt.Errorf("failed to create mirror record: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	record.ID = id
+	return nil
+}
+
+// CountMirrorRecordsByRule counts the post copies recorded for a mirror rule
+func (r *Repository) CountMirrorRecordsByRule(ruleID int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM mirror_records WHERE rule_id = ?`, ruleID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count mirror records: %w", err)
+	}
+
+	return count, nil
+}
+
+// RewriteRule operations
+
+// CreateRewriteRule creates a new rewrite rule
+func (r *Repository) CreateRewriteRule(rule *models.RewriteRule) error {
+	query := `
+		INSERT INTO rewrite_rules (group_id, rule_type, pattern, replacement)
+		VALUES (?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query, rule.GroupID, rule.RuleType, rule.Pattern, rule.Replacement)
+	if err != nil {
+		return fmt.Errorf("failed to create rewrite rule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	rule.ID = id
+	return nil
+}
+
+// GetRewriteRulesByGroupID gets the rewrite rules of a group in the order they are applied
+func (r *Repository) GetRewriteRulesByGroupID(groupID int64) ([]models.RewriteRule, error) {
+	query := `
+		SELECT id, group_id, rule_type, pattern, replacement, created_at
+		FROM rewrite_rules
+		WHERE group_id = ?
+		ORDER BY id ASC
+	`
+	rows, err := r.db.Query(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rewrite rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.RewriteRule
+	for rows.Next() {
+		var rule models.RewriteRule
+		err := rows.Scan(&rule.ID, &rule.GroupID, &rule.RuleType, &rule.Pattern, &rule.Replacement, &rule.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rewrite rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// DeleteRewriteRule deletes a rewrite rule of a group
+func (r *Repository) DeleteRewriteRule(groupID, id int64) error {
+	query := `DELETE FROM rewrite_rules WHERE id = ? AND group_id = ?`
+	_, err := r.db.Exec(query, id, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete rewrite rule: %w", err)
+	}
+
+	return nil
+}
+
+// Vote operations
+
+// SaveVoteMessage records the keyboard of a message carrying vote buttons, replacing the
+// keyboard recorded earlier when the message is edited
+func (r *Repository) SaveVoteMessage(message *models.VoteMessage) error {
+	query := `
+		INSERT INTO vote_messages (chat_id, message_id, chat_title, template_id, buttons)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(chat_id, message_id) DO UPDATE SET chat_title = excluded.chat_title, template_id = excluded.template_id, buttons = excluded.buttons
+	`
+	_, err := r.db.Exec(query, message.ChatID, message.MessageID, message.ChatTitle, message.TemplateID, message.Buttons)
+	if err != nil {
+		return fmt.Errorf("failed to save vote message: %w", err)
+	}
+
+	return nil
+}
+
+// GetVoteMessage gets the recorded keyboard of a message; it returns nil when none is recorded
+func (r *Repository) GetVoteMessage(chatID int64, messageID int) (*models.VoteMessage, error) {
+	query := `
+		SELECT chat_id, message_id, chat_title, template_id, buttons, created_at
+		FROM vote_messages
+		WHERE chat_id = ? AND message_id = ?
+	`
+	var message models.VoteMessage
+	err := r.db.QueryRow(query, chatID, messageID).Scan(&message.ChatID, &message.MessageID, &message.ChatTitle, &message.TemplateID, &message.Buttons, &message.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get vote message: %w", err)
+	}
+
+	return &message, nil
+}
+
+// GetVoteChoice gets the choice a user voted for on a message, or "" when the user has not voted
+func (r *Repository) GetVoteChoice(chatID int64, messageID int, userID int64) (string, error) {
+	query := `SELECT choice FROM votes WHERE chat_id = ? AND message_id = ? AND user_id = ?`
+	var choice string
+	err := r.db.QueryRow(query, chatID, messageID, userID).Scan(&choice)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get vote: %w", err)
+	}
+
+	return choice, nil
+}
+
+// SetVote records a user's vote on a message, replacing the user's earlier vote
+func (r *Repository) SetVote(chatID int64, messageID int, userID int64, choice string) error {
+	query := `
+		INSERT INTO votes (chat_id, message_id, user_id, choice)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(chat_id, message_id, user_id) DO UPDATE SET choice = excluded.choice, updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := r.db.Exec(query, chatID, messageID, userID, choice)
+	if err != nil {
+		return fmt.Errorf("failed to save vote: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteVote withdraws a user's vote on a message
+func (r *Repository) DeleteVote(chatID int64, messageID int, userID int64) error {
+	query := `DELETE FROM votes WHERE chat_id = ? AND message_id = ? AND user_id = ?`
+	_, err := r.db.Exec(query, chatID, messageID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete vote: %w", err)
+	}
+
+	return nil
+}
+
+// CountVotes counts the votes on a message per choice
+func (r *Repository) CountVotes(chatID int64, messageID int) (map[string]int, error) {
+	query := `
+		SELECT choice, COUNT(*)
+		FROM votes
+		WHERE chat_id = ? AND message_id = ?
+		GROUP BY choice
+	`
+	rows, err := r.db.Query(query, chatID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count votes: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var choice string
+		var count int
+		if err := rows.Scan(&choice, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan vote count: %w", err)
+		}
+		counts[choice] = count
+	}
+
+	return counts, nil
+}
+
+// GetRecentVoteSummaries gets the most recently published vote messages with their vote counts
+func (r *Repository) GetRecentVoteSummaries(limit int) ([]models.VoteSummary, error) {
+	query := `
+		SELECT chat_id, message_id, chat_title, template_id, buttons, created_at
+		FROM vote_messages
+		ORDER BY created_at DESC
+		LIMIT ?
+	`
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vote messages: %w", err)
+	}
+
+	var summaries []models.VoteSummary
+	for rows.Next() {
+		var summary models.VoteSummary
+		err := rows.Scan(&summary.ChatID, &summary.MessageID, &summary.ChatTitle, &summary.TemplateID, &summary.Buttons, &summary.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan vote message: %w", err)
+		}
+		summaries = append(summaries, summary)
+	}
+	rows.Close()
+
+	for i := range summaries {
+		counts, err := r.CountVotes(summaries[i].ChatID, summaries[i].MessageID)
+		if err != nil {
+			return nil, err
+		}
+		summaries[i].Counts = counts
+		for _, count := range counts {
+			summaries[i].Total += count
+		}
+	}
+
+	return summaries, nil
+}
+
+// Click tracking operations
+
+// GetOrCreateTrackedLink gets the tracked link of a button URL sent by a group's template to a
+// channel, creating it with the given code when the button has none yet. Reusing links keeps
+// the buttons of edited reposts unchanged.
+func (r *Repository) GetOrCreateTrackedLink(link *models.TrackedLink) error {
+	query := `
+		SELECT id, code, created_at
+		FROM tracked_links
+		WHERE group_id = ? AND channel_id = ? AND template_id = ? AND button_text = ? AND url = ?
+	`
+	err := r.db.QueryRow(query, link.GroupID, link.ChannelID, link.TemplateID, link.ButtonText, link.URL).Scan(&link.ID, &link.Code, &link.CreatedAt)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get tracked link: %w", err)
+	}
+
+	insert := `
+		INSERT INTO tracked_links (code, group_id, channel_id, template_id, button_text, url)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(insert, link.Code, link.GroupID, link.ChannelID, link.TemplateID, link.ButtonText, link.URL)
 	if err != nil {
-		return fmt.Errorf("failed to cleanup pending records: %w", err)
+		return fmt.Errorf("failed to create tracked link: %w", err)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
-		fmt.Printf("Cleaned up %d pending repost records\n", rowsAffected)
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	link.ID = id
+	link.CreatedAt = time.Now()
+	return nil
+}
+
+// GetTrackedLinkByCode gets a tracked link by its short code
+func (r *Repository) GetTrackedLinkByCode(code string) (*models.TrackedLink, error) {
+	query := `
+		SELECT id, code, group_id, channel_id, template_id, button_text, url, created_at
+		FROM tracked_links
+		WHERE code = ?
+	`
+	var link models.TrackedLink
+	err := r.db.QueryRow(query, code).Scan(&link.ID, &link.Code, &link.GroupID, &link.ChannelID, &link.TemplateID, &link.ButtonText, &link.URL, &link.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tracked link not found")
+		}
+		return nil, fmt.Errorf("failed to get tracked link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// CreateLinkClick records a click on a tracked link
+func (r *Repository) CreateLinkClick(linkID int64) error {
+	_, err := r.db.Exec(`INSERT INTO link_clicks (link_id) VALUES (?)`, linkID)
+	if err != nil {
+		return fmt.Errorf("failed to record link click: %w", err)
+	}
+
+	return nil
+}
+
+// GetButtonClickStats counts the clicks per button of each group, most clicked first
+func (r *Repository) GetButtonClickStats(limit int) ([]models.ButtonClickStats, error) {
+	query := `
+		SELECT l.group_id, COALESCE(g.name, ''), l.button_text, l.url,
+		       COUNT(DISTINCT l.channel_id), COUNT(c.id)
+		FROM tracked_links l
+		LEFT JOIN channel_groups g ON g.id = l.group_id
+		LEFT JOIN link_clicks c ON c.link_id = l.id
+		GROUP BY l.group_id, l.button_text, l.url
+		ORDER BY COUNT(c.id) DESC, l.group_id ASC
+		LIMIT ?
+	`
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get button click stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []models.ButtonClickStats
+	for rows.Next() {
+		var stat models.ButtonClickStats
+		err := rows.Scan(&stat.GroupID, &stat.GroupName, &stat.ButtonText, &stat.URL, &stat.Channels, &stat.Clicks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan button click stats: %w", err)
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// GetVariantStats measures a template variant of a group's running A/B test: its sends recorded
+// for the group as that variant, the clicks on its tracked buttons and the votes on its vote
+// messages, all since the test started
+func (r *Repository) GetVariantStats(groupID int64, variant string, templateID int64) (models.VariantStats, error) {
+	stats := models.VariantStats{Variant: variant, TemplateID: templateID}
+
+	// Timestamps are compared through datetime() as they are stored in different formats
+	const testStart = `(SELECT datetime(variant_started_at) FROM channel_groups WHERE id = ?)`
+
+	query := `
+		SELECT
+			COALESCE(SUM(CASE WHEN status = 'sent' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0)
+		FROM send_records
+		WHERE group_id = ? AND template_id = ? AND variant = ?
+		AND datetime(created_at) >= ` + testStart
+	if err := r.db.QueryRow(query, groupID, templateID, variant, groupID).Scan(&stats.Sent, &stats.Failed); err != nil {
+		return stats, fmt.Errorf("failed to count variant sends: %w", err)
+	}
+
+	query = `
+		SELECT COUNT(c.id)
+		FROM tracked_links l
+		JOIN link_clicks c ON c.link_id = l.id
+		WHERE l.group_id = ? AND l.template_id = ?
+		AND datetime(c.clicked_at) >= ` + testStart
+	if err := r.db.QueryRow(query, groupID, templateID, groupID).Scan(&stats.Clicks); err != nil {
+		return stats, fmt.Errorf("failed to count variant clicks: %w", err)
+	}
+
+	query = `
+		SELECT COUNT(v.id)
+		FROM vote_messages m
+		JOIN votes v ON v.chat_id = m.chat_id AND v.message_id = m.message_id
+		WHERE m.template_id = ?
+		AND datetime(m.created_at) >= ` + testStart
+	if err := r.db.QueryRow(query, templateID, groupID).Scan(&stats.Votes); err != nil {
+		return stats, fmt.Errorf("failed to count variant votes: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Poll operations
+
+// SavePollMessage records a poll published to a channel
+func (r *Repository) SavePollMessage(message *models.PollMessage) error {
+	query := `
+		INSERT INTO poll_messages (poll_id, channel_id, message_id, results)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(poll_id) DO UPDATE SET results = excluded.results, updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := r.db.Exec(query, message.PollID, message.ChannelID, message.MessageID, message.Results)
+	if err != nil {
+		return fmt.Errorf("failed to save poll message: %w", err)
+	}
+
+	return nil
+}
+
+// GetPollMessage gets the poll published as a message of a channel; it returns nil when the
+// message is not a recorded poll
+func (r *Repository) GetPollMessage(channelID, messageID string) (*models.PollMessage, error) {
+	query := `
+		SELECT poll_id, channel_id, message_id, results, created_at, updated_at
+		FROM poll_messages
+		WHERE channel_id = ? AND message_id = ?
+	`
+	var message models.PollMessage
+	err := r.db.QueryRow(query, channelID, messageID).Scan(
+		&message.PollID, &message.ChannelID, &message.MessageID, &message.Results, &message.CreatedAt, &message.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get poll message: %w", err)
+	}
+
+	return &message, nil
+}
+
+// UpdatePollResults stores the latest results of a recorded poll, both with the poll and with the
+// send records of its message. Closed results are final and are not replaced by later updates.
+func (r *Repository) UpdatePollResults(pollID string, results models.PollResults) error {
+	query := `
+		UPDATE poll_messages
+		SET results = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE poll_id = ? AND (results IS NULL OR json_extract(results, '$.closed') IS NOT 1)
+	`
+	result, err := r.db.Exec(query, results, pollID)
+	if err != nil {
+		return fmt.Errorf("failed to update poll results: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if updated == 0 {
+		// Not a recorded poll, or its final results are already stored
+		return nil
+	}
+
+	query = `
+		UPDATE send_records
+		SET poll_results = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE EXISTS (
+			SELECT 1 FROM poll_messages p
+			WHERE p.poll_id = ? AND p.channel_id = send_records.channel_id AND p.message_id = send_records.message_id
+		)
+	`
+	if _, err := r.db.Exec(query, results, pollID); err != nil {
+		return fmt.Errorf("failed to update send record poll results: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecentPollRecords gets the most recent send records that carry poll results
+func (r *Repository) GetRecentPollRecords(limit int) ([]models.SendRecord, error) {
+	query := `
+		SELECT ` + sendRecordColumns + `
+		FROM send_records
+		WHERE poll_results IS NOT NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get poll records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []models.SendRecord
+	for rows.Next() {
+		record, err := scanSendRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan poll record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Known channel operations
+
+// knownChannelColumns lists the columns selected for a known channel, in scanKnownChannel order
+const knownChannelColumns = `chat_id, title, chat_type, health, added_by, is_active, created_at, updated_at`
+
+// scanKnownChannel scans a known channel selected with knownChannelColumns
+func scanKnownChannel(row rowScanner) (models.KnownChannel, error) {
+	var channel models.KnownChannel
+	err := row.Scan(
+		&channel.ChatID, &channel.Title, &channel.ChatType, &channel.Health, &channel.AddedBy, &channel.IsActive,
+		&channel.CreatedAt, &channel.UpdatedAt,
+	)
+	return channel, err
+}
+
+// SaveKnownChannel records a chat the bot's membership changed in, replacing what was known of it
+func (r *Repository) SaveKnownChannel(channel *models.KnownChannel) error {
+	query := `
+		INSERT INTO known_channels (chat_id, title, chat_type, health, added_by, is_active)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			title = excluded.title, chat_type = excluded.chat_type, health = excluded.health,
+			added_by = excluded.added_by, is_active = excluded.is_active, updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := r.db.Exec(query, channel.ChatID, channel.Title, channel.ChatType, channel.Health, channel.AddedBy, channel.IsActive)
+	if err != nil {
+		return fmt.Errorf("failed to save known channel: %w", err)
+	}
+
+	return nil
+}
+
+// GetKnownChannel gets a known channel by chat ID; it returns nil when the chat is not known
+func (r *Repository) GetKnownChannel(chatID string) (*models.KnownChannel, error) {
+	query := `SELECT ` + knownChannelColumns + ` FROM known_channels WHERE chat_id = ?`
+	channel, err := scanKnownChannel(r.db.QueryRow(query, chatID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get known channel: %w", err)
+	}
+
+	return &channel, nil
+}
+
+// Published message operations
+
+// sqliteTimeFormat is the format of CURRENT_TIMESTAMP, in which the ledger keeps times (UTC)
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// publishedMessageColumns lists the columns selected for a published message, in
+// scanPublishedMessage order
+const publishedMessageColumns = `id, group_id, channel_id, message_id, kind, deleted, created_at, deleted_at`
+
+// scanPublishedMessage scans a published message selected with publishedMessageColumns
+func scanPublishedMessage(row rowScanner) (models.PublishedMessage, error) {
+	var message models.PublishedMessage
+	err := row.Scan(
+		&message.ID, &message.GroupID, &message.ChannelID, &message.MessageID, &message.Kind, &message.Deleted,
+		&message.CreatedAt, &message.DeletedAt,
+	)
+	return message, err
+}
+
+// CreatePublishedMessages adds messages published to a channel for a group to the ledger; messages
+// already in it (such as edited reposts) are kept as they are
+func (r *Repository) CreatePublishedMessages(groupID int64, channelID string, kind models.PublishKind, messageIDs []string) error {
+	query := `
+		INSERT OR IGNORE INTO published_messages (group_id, channel_id, message_id, kind)
+		VALUES (?, ?, ?, ?)
+	`
+	for _, messageID := range messageIDs {
+		if _, err := r.db.Exec(query, groupID, channelID, messageID, kind); err != nil {
+			return fmt.Errorf("failed to create published message: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MarkPublishedMessageDeleted marks a message of the ledger as deleted
+func (r *Repository) MarkPublishedMessageDeleted(channelID, messageID string) error {
+	query := `
+		UPDATE published_messages
+		SET deleted = 1, deleted_at = CURRENT_TIMESTAMP
+		WHERE channel_id = ? AND message_id = ? AND deleted = 0
+	`
+	_, err := r.db.Exec(query, channelID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to mark published message deleted: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeletedPublishedMessageIDs gets the IDs of the messages of a channel the ledger marks deleted
+func (r *Repository) GetDeletedPublishedMessageIDs(channelID string) (map[string]bool, error) {
+	query := `
+		SELECT message_id
+		FROM published_messages
+		WHERE channel_id = ? AND deleted = 1
+	`
+	rows, err := r.db.Query(query, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted published messages: %w", err)
+	}
+	defer rows.Close()
+
+	deleted := make(map[string]bool)
+	for rows.Next() {
+		var messageID string
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, fmt.Errorf("failed to scan deleted published message: %w", err)
+		}
+		deleted[messageID] = true
+	}
+
+	return deleted, nil
+}
+
+// GetPublishedMessages gets the messages of a group that have not been deleted, published from
+// from (inclusive) to to (exclusive), oldest first; a zero time leaves that end open
+func (r *Repository) GetPublishedMessages(groupID int64, from, to time.Time) ([]models.PublishedMessage, error) {
+	query := `
+		SELECT ` + publishedMessageColumns + `
+		FROM published_messages
+		WHERE group_id = ? AND deleted = 0
+	`
+	args := []interface{}{groupID}
+	if !from.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, from.UTC().Format(sqliteTimeFormat))
+	}
+	if !to.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, to.UTC().Format(sqliteTimeFormat))
+	}
+	query += ` ORDER BY created_at ASC, id ASC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get published messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.PublishedMessage
+	for rows.Next() {
+		message, err := scanPublishedMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan published message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// GetPublishedStats summarizes the ledger of a group
+func (r *Repository) GetPublishedStats(groupID int64) (models.PublishedStats, error) {
+	var stats models.PublishedStats
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(deleted), 0)
+		FROM published_messages
+		WHERE group_id = ?
+	`
+	if err := r.db.QueryRow(query, groupID).Scan(&stats.Total, &stats.Deleted); err != nil {
+		return stats, fmt.Errorf("failed to count published messages: %w", err)
+	}
+
+	query = `
+		SELECT created_at
+		FROM published_messages
+		WHERE group_id = ? AND deleted = 0
+		ORDER BY created_at ASC
+		LIMIT 1
+	`
+	var oldest time.Time
+	err := r.db.QueryRow(query, groupID).Scan(&oldest)
+	if err != nil && err != sql.ErrNoRows {
+		return stats, fmt.Errorf("failed to get oldest published message: %w", err)
+	}
+	if err == nil {
+		stats.Oldest = &oldest
+	}
+
+	return stats, nil
+}
+
+// ClearDeletedLastMessages clears the last message of a group's channels once it was deleted
+func (r *Repository) ClearDeletedLastMessages(groupID int64) error {
+	query := `
+		UPDATE channels
+		SET last_message_id = '', last_message_parts = '[]', updated_at = CURRENT_TIMESTAMP
+		WHERE group_id = ? AND last_message_id != '' AND EXISTS (
+			SELECT 1 FROM published_messages p
+			WHERE p.channel_id = channels.channel_id AND p.message_id = channels.last_message_id AND p.deleted = 1
+		)
+	`
+	_, err := r.db.Exec(query, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to clear deleted last messages: %w", err)
+	}
+
+	return nil
+}
+
+// Channel tag operations
+
+// SetChannelTags replaces the tags of a Telegram channel
+func (r *Repository) SetChannelTags(channelID string, tags []string) error {
+	if _, err := r.db.Exec(`DELETE FROM channel_tags WHERE channel_id = ?`, channelID); err != nil {
+		return fmt.Errorf("failed to clear channel tags: %w", err)
+	}
+
+	query := `INSERT OR IGNORE INTO channel_tags (channel_id, tag) VALUES (?, ?)`
+	for _, tag := range tags {
+		if _, err := r.db.Exec(query, channelID, tag); err != nil {
+			return fmt.Errorf("failed to add channel tag: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// GetTaggedChannelIDs gets the channels having all of the included tags and none of the excluded
+func (r *Repository) GetTaggedChannelIDs(include, exclude []string) ([]string, error) {
+	if len(include) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT channel_id FROM channel_tags
+		WHERE tag IN (SELECT value FROM json_each(?))
+		AND channel_id NOT IN (
+			SELECT channel_id FROM channel_tags WHERE tag IN (SELECT value FROM json_each(?))
+		)
+		GROUP BY channel_id
+		HAVING COUNT(DISTINCT tag) = ?
+	`
+	includeJSON, err := models.StringList(include).Value()
+	if err != nil {
+		return nil, err
+	}
+	excludeJSON, err := models.StringList(exclude).Value()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(query, includeJSON, excludeJSON, len(include))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tagged channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channelIDs []string
+	for rows.Next() {
+		var channelID string
+		if err := rows.Scan(&channelID); err != nil {
+			return nil, fmt.Errorf("failed to scan channel ID: %w", err)
+		}
+		channelIDs = append(channelIDs, channelID)
+	}
+
+	return channelIDs, nil
+}
+
+// GetTagCounts gets every tag in use with the number of channels having it
+func (r *Repository) GetTagCounts() ([]models.TagCount, error) {
+	query := `
+		SELECT tag, COUNT(*) FROM channel_tags
+		GROUP BY tag
+		ORDER BY tag
+	`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tag counts: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []models.TagCount
+	for rows.Next() {
+		var count models.TagCount
+		if err := rows.Scan(&count.Tag, &count.Channels); err != nil {
+			return nil, fmt.Errorf("failed to scan tag count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
+
+// GetTagMatchedChannels gets the channels of a group that joined it by its tag rule
+func (r *Repository) GetTagMatchedChannels(groupID int64) ([]models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE group_id = ? AND tag_matched = 1`
+	rows, err := r.db.Query(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tag matched channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []models.Channel
+	for rows.Next() {
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, nil
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -15,6 +17,82 @@ const (
 	ScheduleModeTimepoints ScheduleMode = "timepoints" // At specific times
 )
 
+// RepostMode represents how a channel group replaces its previous repost
+type RepostMode string
+
+const (
+	RepostModeDelete RepostMode = "delete" // Delete the previous message and send a new one
+	RepostModeEdit   RepostMode = "edit"   // Edit the previous message in place
+)
+
+// VariantMode represents how a channel group's A/B test assigns its template variants
+type VariantMode string
+
+const (
+	VariantModeSplit     VariantMode = "split"     // Channels are split between the variants
+	VariantModeAlternate VariantMode = "alternate" // All channels switch variant every repost cycle
+)
+
+// Template variants of an A/B test: A is the group's template, B its variant template
+const (
+	VariantA = "A"
+	VariantB = "B"
+)
+
+// LinkPreview represents how link previews are shown in text messages
+type LinkPreview string
+
+const (
+	LinkPreviewOff   LinkPreview = "off"   // No link preview
+	LinkPreviewBelow LinkPreview = "below" // Preview below the text
+	LinkPreviewAbove LinkPreview = "above" // Preview above the text
+)
+
+// SendOptions represents how the messages of a channel group are sent
+type SendOptions struct {
+	Silent         bool        `json:"silent,omitempty"`          // Send without notification
+	ProtectContent bool        `json:"protect_content,omitempty"` // Forbid forwarding and saving
+	LinkPreview    LinkPreview `json:"link_preview,omitempty"`    // Link preview of text messages (empty = off)
+	MediaSpoiler   bool        `json:"media_spoiler,omitempty"`   // Cover media with a spoiler animation
+}
+
+// ShowsLinkPreview reports whether text messages show a link preview
+func (o SendOptions) ShowsLinkPreview() bool {
+	return o.LinkPreview == LinkPreviewBelow || o.LinkPreview == LinkPreviewAbove
+}
+
+// Value implements driver.Valuer interface for database storage
+func (o SendOptions) Value() (driver.Value, error) {
+	bytes, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner interface for database retrieval
+func (o *SendOptions) Scan(value interface{}) error {
+	*o = SendOptions{}
+	if value == nil {
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into SendOptions", value)
+	}
+
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, o)
+}
+
 // TimePoint represents a specific time point for scheduling
 type TimePoint struct {
 	Hour   int `json:"hour"`   // 0-23
@@ -54,58 +132,364 @@ func (tp *TimePoints) Scan(value interface{}) error {
 
 // ChannelGroup represents a group of channels
 type ChannelGroup struct {
-	ID                 int64        `json:"id" db:"id"`
-	Name               string       `json:"name" db:"name"`
-	Description        string       `json:"description" db:"description"`
-	MessageID          int64        `json:"message_id" db:"message_id"`
-	Frequency          int          `json:"frequency" db:"frequency"`                     // in minutes (for frequency mode)
-	ScheduleMode       ScheduleMode `json:"schedule_mode" db:"schedule_mode"`             // scheduling mode
-	ScheduleTimepoints TimePoints   `json:"schedule_timepoints" db:"schedule_timepoints"` // time points for timepoints mode
-	IsActive           bool         `json:"is_active" db:"is_active"`
-	AutoPin            bool         `json:"auto_pin" db:"auto_pin"` // Auto pin messages after sending
-	CreatedAt          time.Time    `json:"created_at" db:"created_at"`
-	UpdatedAt          time.Time    `json:"updated_at" db:"updated_at"`
+	ID                 int64          `json:"id" db:"id"`
+	Name               string         `json:"name" db:"name"`
+	Description        string         `json:"description" db:"description"`
+	MessageID          int64          `json:"message_id" db:"message_id"`
+	Frequency          int            `json:"frequency" db:"frequency"`                     // in minutes (for frequency mode)
+	ScheduleMode       ScheduleMode   `json:"schedule_mode" db:"schedule_mode"`             // scheduling mode
+	ScheduleTimepoints TimePoints     `json:"schedule_timepoints" db:"schedule_timepoints"` // time points for timepoints mode
+	IsActive           bool           `json:"is_active" db:"is_active"`
+	AutoPin            bool           `json:"auto_pin" db:"auto_pin"`                       // Auto pin messages after sending
+	RepostMode         RepostMode     `json:"repost_mode" db:"repost_mode"`                 // How previous reposts are replaced
+	FooterText         string         `json:"footer_text" db:"footer_text"`                 // Appended to every push and repost
+	FooterEntities     string         `json:"footer_entities" db:"footer_entities"`         // JSON序列化的页脚entities
+	FooterButtons      InlineKeyboard `json:"footer_buttons" db:"footer_buttons"`           // Extra button row appended to the keyboard
+	SendOptions        SendOptions    `json:"send_options" db:"send_options"`               // How messages are sent
+	VariantTemplateID  int64          `json:"variant_template_id" db:"variant_template_id"` // Template of variant B, 0 = no A/B test
+	VariantMode        VariantMode    `json:"variant_mode" db:"variant_mode"`               // How the variants are assigned
+	VariantCycle       int            `json:"variant_cycle" db:"variant_cycle"`             // Repost cycles started, for alternating variants
+	TagInclude         StringList     `json:"tag_include" db:"tag_include"`                 // Channels with all of these tags join the group (empty = no tag rule)
+	TagExclude         StringList     `json:"tag_exclude" db:"tag_exclude"`                 // Channels with any of these tags never join by the tag rule
+	CreatedAt          time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// HasVariants reports whether the group runs an A/B test of two template variants
+func (g ChannelGroup) HasVariants() bool {
+	return g.VariantTemplateID != 0
+}
+
+// HasTagRule reports whether channels join the group by their tags
+func (g ChannelGroup) HasTagRule() bool {
+	return len(g.TagInclude) > 0
+}
+
+// VariantFor returns the variant a channel of the group is sent: split tests send variant B to
+// channels with an odd ID, alternating tests send variant B on every other repost cycle
+func (g ChannelGroup) VariantFor(channel *Channel) string {
+	if !g.HasVariants() {
+		return VariantA
+	}
+
+	if g.VariantMode == VariantModeAlternate {
+		if g.VariantCycle%2 == 1 {
+			return VariantB
+		}
+		return VariantA
+	}
+
+	if channel != nil && channel.ID%2 == 1 {
+		return VariantB
+	}
+	return VariantA
 }
 
 // Channel represents a Telegram channel
 type Channel struct {
-	ID            int64     `json:"id" db:"id"`
-	ChannelID     string    `json:"channel_id" db:"channel_id"`     // Telegram channel ID
-	ChannelName   string    `json:"channel_name" db:"channel_name"` // Channel name/username
-	GroupID       int64     `json:"group_id" db:"group_id"`
-	LastMessageID string    `json:"last_message_id" db:"last_message_id"` // Last repost message ID
-	IsActive      bool      `json:"is_active" db:"is_active"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+	ID               int64          `json:"id" db:"id"`
+	ChannelID        string         `json:"channel_id" db:"channel_id"`     // Telegram channel ID
+	ChannelName      string         `json:"channel_name" db:"channel_name"` // Channel name/username
+	GroupID          int64          `json:"group_id" db:"group_id"`
+	LastMessageID    string         `json:"last_message_id" db:"last_message_id"`       // Last repost message ID
+	LastMessageParts StringList     `json:"last_message_parts" db:"last_message_parts"` // Follow-up parts of the last repost when it was split
+	TemplateID       int64          `json:"template_id" db:"template_id"`               // Override template (0 = use group template)
+	Buttons          InlineKeyboard `json:"buttons" db:"buttons"`                       // Override buttons (empty = use template buttons)
+	Language         string         `json:"language" db:"language"`                     // Language code picking template translations (empty = default)
+	Health           ChannelHealth  `json:"health" db:"health"`                         // Result of the last health check
+	Tags             StringList     `json:"tags" db:"-"`                                // Tags of the Telegram channel, shared by all its groups
+	TagMatched       bool           `json:"tag_matched" db:"tag_matched"`               // Joined the group by the group's tag rule
+	IsActive         bool           `json:"is_active" db:"is_active"`
+	CreatedAt        time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// LastMessage returns the messages of the channel's last repost
+func (c Channel) LastMessage() SentMessage {
+	return SentMessage{MessageID: c.LastMessageID, PartIDs: c.LastMessageParts}
+}
+
+// HasOverrides reports whether the channel overrides the group's template or buttons
+func (c Channel) HasOverrides() bool {
+	return c.TemplateID != 0 || len(c.Buttons) > 0
+}
+
+// ChannelHealth is the chat info and bot rights found by the last health check of a channel
+type ChannelHealth struct {
+	Title     string    `json:"title,omitempty"`      // Chat title reported by Telegram
+	Type      string    `json:"type,omitempty"`       // Chat type (channel, supergroup, ...)
+	Status    string    `json:"status,omitempty"`     // Bot membership status (administrator, member, left, ...)
+	CanPost   bool      `json:"can_post,omitempty"`   // Bot can send messages
+	CanEdit   bool      `json:"can_edit,omitempty"`   // Bot can edit messages
+	CanDelete bool      `json:"can_delete,omitempty"` // Bot can delete messages
+	CanPin    bool      `json:"can_pin,omitempty"`    // Bot can pin messages
+	Error     string    `json:"error,omitempty"`      // Error of the last check (empty = chat reachable)
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Checked reports whether the channel has been health checked
+func (h ChannelHealth) Checked() bool {
+	return !h.CheckedAt.IsZero()
+}
+
+// Problems lists the missing access and rights of the bot in the channel; it is empty for
+// healthy or unchecked channels
+func (h ChannelHealth) Problems() []string {
+	if !h.Checked() {
+		return nil
+	}
+	if h.Error != "" {
+		return []string{"无法访问：" + h.Error}
+	}
+	if h.Status == "left" || h.Status == "kicked" {
+		return []string{"机器人不在频道中"}
+	}
+
+	var problems []string
+	if !h.CanPost {
+		problems = append(problems, "无发布权限")
+	}
+	if !h.CanEdit {
+		problems = append(problems, "无编辑权限")
+	}
+	if !h.CanDelete {
+		problems = append(problems, "无删除权限")
+	}
+	if !h.CanPin {
+		problems = append(problems, "无置顶权限")
+	}
+	return problems
+}
+
+// Value implements driver.Valuer interface for database storage
+func (h ChannelHealth) Value() (driver.Value, error) {
+	if !h.Checked() {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner interface for database retrieval
+func (h *ChannelHealth) Scan(value interface{}) error {
+	*h = ChannelHealth{}
+	if value == nil {
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into ChannelHealth", value)
+	}
+
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, h)
+}
+
+// KnownChannel is a chat the bot was made administrator of, recorded from its my_chat_member
+// updates so that it can be added to groups without typing its ID
+type KnownChannel struct {
+	ChatID    string        `json:"chat_id" db:"chat_id"`
+	Title     string        `json:"title" db:"title"`
+	ChatType  string        `json:"chat_type" db:"chat_type"`
+	Health    ChannelHealth `json:"health" db:"health"`     // Bot status and rights from the last update
+	AddedBy   int64         `json:"added_by" db:"added_by"` // User who last changed the bot's membership
+	IsActive  bool          `json:"is_active" db:"is_active"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
 }
 
 // MessageTemplate represents a message template
 type MessageTemplate struct {
-	ID          int64          `json:"id" db:"id"`
-	Title       string         `json:"title" db:"title"`
-	Content     string         `json:"content" db:"content"`
-	MessageType MessageType    `json:"message_type" db:"message_type"`
-	MediaURL    string         `json:"media_url" db:"media_url"`
-	Buttons     InlineKeyboard `json:"buttons" db:"buttons"`
-	Entities    string         `json:"entities" db:"entities"` // JSON序列化的entities
-	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at" db:"updated_at"`
+	ID           int64          `json:"id" db:"id"`
+	Title        string         `json:"title" db:"title"`
+	Content      string         `json:"content" db:"content"`
+	MessageType  MessageType    `json:"message_type" db:"message_type"`
+	MediaURL     string         `json:"media_url" db:"media_url"`
+	Buttons      InlineKeyboard `json:"buttons" db:"buttons"`
+	Entities     string         `json:"entities" db:"entities"`         // JSON序列化的entities
+	Poll         Poll           `json:"poll" db:"poll"`                 // Poll settings of poll templates; Content is the question
+	Translations Translations   `json:"translations" db:"translations"` // Content in other languages, keyed by language code
+	Options      SendOptions    `json:"-" db:"-"`                       // Send options of the group the template is sent for
+	Variant      string         `json:"-" db:"-"`                       // A/B test variant the template is sent as, empty outside tests
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// Localize returns the template as sent to a channel of the given language: the matching
+// translation replaces the content, and its photo and buttons when set. The template itself is
+// returned when there is no matching translation; poll templates are not translated.
+func (t *MessageTemplate) Localize(language string) *MessageTemplate {
+	code := t.Translations.Match(language)
+	if code == "" || t.MessageType == MessageTypePoll {
+		return t
+	}
+
+	translation := t.Translations[code]
+	localized := *t
+	localized.Content = translation.Content
+	localized.Entities = translation.Entities
+	if translation.MediaURL != "" {
+		localized.MediaURL = translation.MediaURL
+	}
+	if len(translation.Buttons) > 0 {
+		localized.Buttons = translation.Buttons
+	}
+	return &localized
+}
+
+// Translation is the content of a template in another language
+type Translation struct {
+	Content  string         `json:"content"`
+	Entities string         `json:"entities,omitempty"`  // JSON序列化的entities
+	MediaURL string         `json:"media_url,omitempty"` // Replaces the photo of photo templates when set
+	Buttons  InlineKeyboard `json:"buttons,omitempty"`   // Replaces the template buttons when set
+}
+
+// Translations maps language codes to the translations of a template
+type Translations map[string]Translation
+
+// Languages returns the language codes of the translations in order
+func (t Translations) Languages() []string {
+	languages := make([]string, 0, len(t))
+	for language := range t {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Match returns the code of the translation to use for a language: the language itself, or its
+// base language ("en" for "en-us"); "" when there is none and the default content is used
+func (t Translations) Match(language string) string {
+	if language == "" || len(t) == 0 {
+		return ""
+	}
+	if _, ok := t[language]; ok {
+		return language
+	}
+	if base, _, found := strings.Cut(language, "-"); found {
+		if _, ok := t[base]; ok {
+			return base
+		}
+	}
+	return ""
+}
+
+// Value implements driver.Valuer interface for database storage
+func (t Translations) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner interface for database retrieval
+func (t *Translations) Scan(value interface{}) error {
+	*t = nil
+	if value == nil {
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Translations", value)
+	}
+
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, t)
 }
 
 // SendRecord represents a message send record
 type SendRecord struct {
-	ID           int64      `json:"id" db:"id"`
-	GroupID      int64      `json:"group_id" db:"group_id"`
-	ChannelID    string     `json:"channel_id" db:"channel_id"`
-	MessageID    string     `json:"message_id" db:"message_id"` // Telegram message ID
-	MessageType  SendType   `json:"message_type" db:"message_type"`
-	Status       SendStatus `json:"status" db:"status"`
-	ErrorMessage *string    `json:"error_message" db:"error_message"`
-	RetryCount   int        `json:"retry_count" db:"retry_count"`
-	ScheduledAt  time.Time  `json:"scheduled_at" db:"scheduled_at"`
-	SentAt       *time.Time `json:"sent_at" db:"sent_at"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	ID             int64       `json:"id" db:"id"`
+	GroupID        int64       `json:"group_id" db:"group_id"`
+	ChannelID      string      `json:"channel_id" db:"channel_id"`
+	MessageID      string      `json:"message_id" db:"message_id"`             // Telegram message ID
+	PartMessageIDs StringList  `json:"part_message_ids" db:"part_message_ids"` // Follow-up parts when the message was split
+	TemplateID     int64       `json:"template_id" db:"template_id"`           // Template sent, 0 when unknown
+	Variant        string      `json:"variant" db:"variant"`                   // A/B test variant sent, empty outside tests
+	PollResults    PollResults `json:"poll_results" db:"poll_results"`         // Latest results when a poll was sent
+	MessageType    SendType    `json:"message_type" db:"message_type"`
+	Status         SendStatus  `json:"status" db:"status"`
+	ErrorMessage   *string     `json:"error_message" db:"error_message"`
+	RetryCount     int         `json:"retry_count" db:"retry_count"`
+	ScheduledAt    time.Time   `json:"scheduled_at" db:"scheduled_at"`
+	SentAt         *time.Time  `json:"sent_at" db:"sent_at"`
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// SentMessage identifies the Telegram messages produced by sending one template. Content over
+// Telegram's length limits is split: MessageID is the first message, PartIDs the follow-up parts.
+type SentMessage struct {
+	MessageID string
+	PartIDs   StringList
+}
+
+// IDs returns the IDs of all messages, first message first
+func (m SentMessage) IDs() []string {
+	if m.MessageID == "" {
+		return nil
+	}
+	return append([]string{m.MessageID}, m.PartIDs...)
+}
+
+// PublishKind is how a published message was sent
+type PublishKind string
+
+const (
+	PublishKindRepost  PublishKind = "repost"  // 重发
+	PublishKindPush    PublishKind = "push"    // 推送
+	PublishKindForward PublishKind = "forward" // 无引用转发
+	PublishKindMirror  PublishKind = "mirror"  // 频道镜像
+)
+
+// PublishedMessage is an entry of the ledger of every message the bot published to a channel for
+// a group; the parts of split messages and albums are entries of their own
+type PublishedMessage struct {
+	ID        int64       `json:"id" db:"id"`
+	GroupID   int64       `json:"group_id" db:"group_id"`
+	ChannelID string      `json:"channel_id" db:"channel_id"`
+	MessageID string      `json:"message_id" db:"message_id"`
+	Kind      PublishKind `json:"kind" db:"kind"`
+	Deleted   bool        `json:"deleted" db:"deleted"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
+	DeletedAt *time.Time  `json:"deleted_at" db:"deleted_at"`
+}
+
+// PublishedStats summarizes the ledger of a group
+type PublishedStats struct {
+	Total   int        // Messages published
+	Deleted int        // Messages deleted since
+	Oldest  *time.Time // Publication time of the oldest message not deleted
+}
+
+// TagCount is a channel tag with the number of channels having it
+type TagCount struct {
+	Tag      string
+	Channels int
 }
 
 // RetryConfig represents retry configuration for a channel group
@@ -129,8 +513,113 @@ const (
 	MessageTypeVideo    MessageType = "video"
 	MessageTypeDocument MessageType = "document"
 	MessageTypeAudio    MessageType = "audio"
+	MessageTypePoll     MessageType = "poll"
 )
 
+// Poll represents the settings of a poll or quiz template
+type Poll struct {
+	Options               []string `json:"options"`
+	Quiz                  bool     `json:"quiz,omitempty"`                    // Quiz with one correct option
+	AllowsMultipleAnswers bool     `json:"allows_multiple_answers,omitempty"` // Regular polls only
+	CorrectOptionID       int      `json:"correct_option_id,omitempty"`       // Index of the correct option of a quiz
+	Explanation           string   `json:"explanation,omitempty"`             // Shown after answering a quiz
+	OpenPeriod            int      `json:"open_period,omitempty"`             // Seconds until the poll closes, 0 = stays open
+}
+
+// Value implements driver.Valuer interface for database storage
+func (p Poll) Value() (driver.Value, error) {
+	if len(p.Options) == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner interface for database retrieval
+func (p *Poll) Scan(value interface{}) error {
+	*p = Poll{}
+	if value == nil {
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Poll", value)
+	}
+
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, p)
+}
+
+// PollOptionResult is the number of voters of a poll option
+type PollOptionResult struct {
+	Text       string `json:"text"`
+	VoterCount int    `json:"voter_count"`
+}
+
+// PollResults represents the results of a sent poll
+type PollResults struct {
+	Question        string             `json:"question"`
+	Options         []PollOptionResult `json:"options"`
+	TotalVoterCount int                `json:"total_voter_count"`
+	Closed          bool               `json:"closed"` // Final results of a closed poll
+}
+
+// Value implements driver.Valuer interface for database storage
+func (r PollResults) Value() (driver.Value, error) {
+	if len(r.Options) == 0 {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner interface for database retrieval
+func (r *PollResults) Scan(value interface{}) error {
+	*r = PollResults{}
+	if value == nil {
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into PollResults", value)
+	}
+
+	if len(bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+// PollMessage is a poll published to a channel, kept so that its results can be collected
+type PollMessage struct {
+	PollID    string      `json:"poll_id" db:"poll_id"`
+	ChannelID string      `json:"channel_id" db:"channel_id"` // Channel ID as the message was sent to
+	MessageID string      `json:"message_id" db:"message_id"`
+	Results   PollResults `json:"results" db:"results"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
+}
+
 // SendType represents the type of send operation
 type SendType string
 
@@ -152,10 +641,72 @@ const (
 // InlineKeyboard represents Telegram inline keyboard
 type InlineKeyboard [][]InlineKeyboardButton
 
-// InlineKeyboardButton represents a button in inline keyboard
+// ButtonCallbackPrefix prefixes the callback data of buttons whose text the bot shows when pressed
+const ButtonCallbackPrefix = "btn:"
+
+// VoteCallbackPrefix prefixes the callback data of vote buttons; the rest is the choice voted for
+const VoteCallbackPrefix = "vote:"
+
+// InlineKeyboardButton represents a button in inline keyboard, stored in the Bot API format so
+// exactly one of the action fields is set
 type InlineKeyboardButton struct {
+	Text              string          `json:"text"`
+	URL               string          `json:"url,omitempty"`                 // http(s), tg:// or t.me link
+	CallbackData      string          `json:"callback_data,omitempty"`       // Answered by the bot
+	SwitchInlineQuery *string         `json:"switch_inline_query,omitempty"` // May be empty to only insert the bot's username
+	CopyText          *CopyTextButton `json:"copy_text,omitempty"`
+}
+
+// CopyTextButton is the text a copy button copies to the clipboard
+type CopyTextButton struct {
 	Text string `json:"text"`
-	URL  string `json:"url,omitempty"`
+}
+
+// InlineKeyboardMarkup is an inline keyboard in the Bot API format. Unlike the bot library's
+// markup it supports every button type stored in InlineKeyboard.
+type InlineKeyboardMarkup struct {
+	InlineKeyboard InlineKeyboard `json:"inline_keyboard"`
+}
+
+// Markup returns the keyboard as reply markup
+func (ik InlineKeyboard) Markup() InlineKeyboardMarkup {
+	return InlineKeyboardMarkup{InlineKeyboard: ik}
+}
+
+// VoteChoice returns the choice a vote button counts, or "" when the button is not a vote button
+func (b InlineKeyboardButton) VoteChoice() string {
+	if !strings.HasPrefix(b.CallbackData, VoteCallbackPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(b.CallbackData, VoteCallbackPrefix)
+}
+
+// VoteChoices returns the choices of the keyboard's vote buttons in keyboard order
+func (ik InlineKeyboard) VoteChoices() []string {
+	var choices []string
+	for _, row := range ik {
+		for _, button := range row {
+			if choice := button.VoteChoice(); choice != "" {
+				choices = append(choices, choice)
+			}
+		}
+	}
+	return choices
+}
+
+// WithVoteCounts returns a copy of the keyboard whose vote buttons show their vote counts
+func (ik InlineKeyboard) WithVoteCounts(counts map[string]int) InlineKeyboard {
+	keyboard := make(InlineKeyboard, len(ik))
+	for i, row := range ik {
+		keyboard[i] = make([]InlineKeyboardButton, len(row))
+		for j, button := range row {
+			if count := counts[button.VoteChoice()]; count > 0 {
+				button.Text = fmt.Sprintf("%s %d", button.Text, count)
+			}
+			keyboard[i][j] = button
+		}
+	}
+	return keyboard
 }
 
 // Value implements driver.Valuer interface for database storage
@@ -186,6 +737,180 @@ func (ik *InlineKeyboard) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, ik)
 }
 
+// StringList represents a list of strings stored as JSON
+type StringList []string
+
+// Value implements driver.Valuer interface for database storage
+func (sl StringList) Value() (driver.Value, error) {
+	if len(sl) == 0 {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal(sl)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan implements sql.Scanner interface for database retrieval
+func (sl *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*sl = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", value)
+	}
+
+	if len(bytes) == 0 {
+		*sl = nil
+		return nil
+	}
+	return json.Unmarshal(bytes, sl)
+}
+
+// MirrorRule relays new posts of a source channel to a channel group
+type MirrorRule struct {
+	ID              int64      `json:"id" db:"id"`
+	SourceChatID    int64      `json:"source_chat_id" db:"source_chat_id"`
+	SourceTitle     string     `json:"source_title" db:"source_title"`
+	GroupID         int64      `json:"group_id" db:"group_id"`
+	IncludeKeywords StringList `json:"include_keywords" db:"include_keywords"` // Post must contain one of these (empty = any)
+	ExcludeKeywords StringList `json:"exclude_keywords" db:"exclude_keywords"` // Posts containing any of these are skipped
+	IncludeTypes    StringList `json:"include_types" db:"include_types"`       // Message types to relay (empty = all)
+	ExcludeTypes    StringList `json:"exclude_types" db:"exclude_types"`       // Message types never relayed
+	DelaySeconds    int        `json:"delay_seconds" db:"delay_seconds"`       // Delay before relaying
+	IsActive        bool       `json:"is_active" db:"is_active"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Matches reports whether a post with the given text and message type passes the rule's filters
+func (r MirrorRule) Matches(text, messageType string) bool {
+	if len(r.IncludeTypes) > 0 && !containsFold(r.IncludeTypes, messageType) {
+		return false
+	}
+	if containsFold(r.ExcludeTypes, messageType) {
+		return false
+	}
+
+	lowerText := strings.ToLower(text)
+	for _, keyword := range r.ExcludeKeywords {
+		if strings.Contains(lowerText, strings.ToLower(keyword)) {
+			return false
+		}
+	}
+	if len(r.IncludeKeywords) == 0 {
+		return true
+	}
+	for _, keyword := range r.IncludeKeywords {
+		if strings.Contains(lowerText, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list contains value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// MirrorRecord links a mirrored source post to its copy in a destination channel
+type MirrorRecord struct {
+	ID              int64     `json:"id" db:"id"`
+	RuleID          int64     `json:"rule_id" db:"rule_id"`
+	SourceChatID    int64     `json:"source_chat_id" db:"source_chat_id"`
+	SourceMessageID int       `json:"source_message_id" db:"source_message_id"`
+	ChannelID       string    `json:"channel_id" db:"channel_id"`
+	MessageID       string    `json:"message_id" db:"message_id"` // Telegram message ID in the destination channel
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// VoteMessage is a published message carrying vote buttons; Buttons is its keyboard without counts
+type VoteMessage struct {
+	ChatID     int64          `json:"chat_id" db:"chat_id"`
+	MessageID  int            `json:"message_id" db:"message_id"`
+	ChatTitle  string         `json:"chat_title" db:"chat_title"`
+	TemplateID int64          `json:"template_id" db:"template_id"` // Template sent, 0 when unknown
+	Buttons    InlineKeyboard `json:"buttons" db:"buttons"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
+
+// VoteSummary is a vote message with the votes counted per choice
+type VoteSummary struct {
+	VoteMessage
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+// VariantStats measures one template variant of a group's A/B test
+type VariantStats struct {
+	Variant    string `json:"variant"`
+	TemplateID int64  `json:"template_id"`
+	Sent       int    `json:"sent"`
+	Failed     int    `json:"failed"`
+	Clicks     int    `json:"clicks"` // Clicks on tracked buttons
+	Votes      int    `json:"votes"`  // Votes on vote buttons
+}
+
+// TrackedLink is a short redirect link standing in for a button URL of a group's message in a
+// channel, so that clicks on the button can be counted
+type TrackedLink struct {
+	ID         int64     `json:"id" db:"id"`
+	Code       string    `json:"code" db:"code"`
+	GroupID    int64     `json:"group_id" db:"group_id"`
+	ChannelID  string    `json:"channel_id" db:"channel_id"`
+	TemplateID int64     `json:"template_id" db:"template_id"` // 0 for one-off pushes
+	ButtonText string    `json:"button_text" db:"button_text"`
+	URL        string    `json:"url" db:"url"` // Destination of the redirect
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// ButtonClickStats counts the clicks on a button of a group across its channels
+type ButtonClickStats struct {
+	GroupID    int64  `json:"group_id"`
+	GroupName  string `json:"group_name"`
+	ButtonText string `json:"button_text"`
+	URL        string `json:"url"`
+	Channels   int    `json:"channels"` // Channels the button was sent to
+	Clicks     int    `json:"clicks"`
+}
+
+// RewriteRuleType represents the kind of a content rewrite rule
+type RewriteRuleType string
+
+const (
+	RewriteRuleRegex          RewriteRuleType = "regex"           // Replace regex matches (Pattern → Replacement)
+	RewriteRuleRemoveMentions RewriteRuleType = "remove_mentions" // Remove @mentions
+	RewriteRuleReplaceURLs    RewriteRuleType = "replace_urls"    // Replace all links with Replacement (empty removes them)
+	RewriteRuleDomainMap      RewriteRuleType = "domain_map"      // Replace domain Pattern with Replacement in text and links
+	RewriteRuleStripButtons   RewriteRuleType = "strip_buttons"   // Remove the original inline keyboard
+	RewriteRuleAppendFooter   RewriteRuleType = "append_footer"   // Append Replacement as a footer
+)
+
+// RewriteRule rewrites the content of posts forwarded or mirrored to a channel group
+type RewriteRule struct {
+	ID          int64           `json:"id" db:"id"`
+	GroupID     int64           `json:"group_id" db:"group_id"`
+	RuleType    RewriteRuleType `json:"rule_type" db:"rule_type"`
+	Pattern     string          `json:"pattern" db:"pattern"`
+	Replacement string          `json:"replacement" db:"replacement"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
 // ChannelGroupWithDetails represents a channel group with its related data
 type ChannelGroupWithDetails struct {
 	ChannelGroup
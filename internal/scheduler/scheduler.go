@@ -2,7 +2,6 @@ package scheduler
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"sync"
 	"time"
@@ -11,8 +10,6 @@ import (
 	"tg-channel-repost-bot/internal/models"
 	"tg-channel-repost-bot/internal/services"
 	"tg-channel-repost-bot/pkg/config"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // Scheduler handles scheduled message sending
@@ -49,10 +46,18 @@ func (s *Scheduler) Start() {
 		log.Printf("Failed to cleanup duplicate pending records: %v", err)
 	}
 
+	// Channels added by @username before they were resolved on add
+	s.messageService.ResolveUsernameChannels()
+
 	s.wg.Add(2)
 	go s.scheduleRepostTasks()
 	go s.processPendingTasks()
 
+	if s.config.HealthCheckInterval > 0 {
+		s.wg.Add(1)
+		go s.checkChannelHealth()
+	}
+
 	log.Printf("Scheduler started with %d workers", s.config.MaxWorkers)
 }
 
@@ -98,6 +103,25 @@ func (s *Scheduler) processPendingTasks() {
 	}
 }
 
+// checkChannelHealth checks the bot's access to every channel on startup and then periodically
+func (s *Scheduler) checkChannelHealth() {
+	defer s.wg.Done()
+
+	s.messageService.CheckAllChannelHealth()
+
+	ticker := time.NewTicker(time.Duration(s.config.HealthCheckInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.messageService.CheckAllChannelHealth()
+		}
+	}
+}
+
 // createRepostTasks creates repost tasks for channel groups that need to send
 func (s *Scheduler) createRepostTasks() {
 	groups, err := s.repo.GetChannelGroups()
@@ -231,12 +255,15 @@ func abs(x int) int {
 
 // createRepostTask creates a repost task for a channel group
 func (s *Scheduler) createRepostTask(group models.ChannelGroup) {
+	s.messageService.RefreshTaggedChannels(&group)
 	channels, err := s.repo.GetChannelsByGroupID(group.ID)
 	if err != nil {
 		log.Printf("Failed to get channels for group %d: %v", group.ID, err)
 		return
 	}
 
+	s.messageService.StartRepostCycle(&group)
+
 	// Create send records for each channel
 	for _, channel := range channels {
 		if !channel.IsActive {
@@ -344,13 +371,6 @@ func (s *Scheduler) processRepostRecord(record models.SendRecord) error {
 		return nil
 	}
 
-	// Get message template
-	template, err := s.repo.GetMessageTemplate(group.MessageID)
-	if err != nil {
-		return err
-	}
-	log.Printf("DEBUG: Loaded template %d for group %d, has %d button rows", template.ID, group.ID, len(template.Buttons))
-
 	// Get channel info
 	channels, err := s.repo.GetChannelsByGroupID(record.GroupID)
 	if err != nil {
@@ -372,47 +392,33 @@ func (s *Scheduler) processRepostRecord(record models.SendRecord) error {
 		return nil
 	}
 
-	// Delete previous message if exists
-	if targetChannel.LastMessageID != "" {
-		log.Printf("Deleting previous message %s from channel %s", targetChannel.LastMessageID, targetChannel.ChannelID)
-		if err := s.messageService.DeleteMessage(targetChannel.ChannelID, targetChannel.LastMessageID); err != nil {
-			log.Printf("Failed to delete previous message: %v", err)
-		} else {
-			log.Printf("Successfully deleted previous message %s", targetChannel.LastMessageID)
-		}
-	} else {
-		log.Printf("No previous message to delete for channel %s", targetChannel.ChannelID)
-	}
-
-	// Send new message using complete template (with entities and buttons)
-	var entities []tgbotapi.MessageEntity
-	if template.Entities != "" {
-		// Deserialize entities from JSON
-		if err := json.Unmarshal([]byte(template.Entities), &entities); err != nil {
-			log.Printf("Failed to deserialize entities for template %d: %v", template.ID, err)
-			entities = nil
-		} else {
-			log.Printf("Using %d entities for repost message", len(entities))
-		}
+	// Get message template, applying any channel overrides
+	template, err := s.messageService.ResolveTemplate(group, targetChannel)
+	if err != nil {
+		return err
 	}
+	log.Printf("DEBUG: Loaded template %d for group %d, has %d button rows", template.ID, group.ID, len(template.Buttons))
 
 	// Log button information
 	if len(template.Buttons) > 0 {
 		log.Printf("Using %d button rows for repost message", len(template.Buttons))
 	}
 
-	// Create a copy of template with entities for sending
-	templateForSending := *template
-
-	messageID, err := s.messageService.SendMessageWithTemplate(targetChannel.ChannelID, &templateForSending, entities)
+	// Replace previous message (edit in place or delete and send, depending on repost mode)
+	sent, edited, err := s.messageService.ReplaceRepost(group, targetChannel, template)
 	if err != nil {
 		return err
 	}
+	messageID := sent.MessageID
 
-	log.Printf("Successfully sent new message %s to channel %s", messageID, targetChannel.ChannelID)
+	if edited {
+		log.Printf("Successfully edited message %s in channel %s", messageID, targetChannel.ChannelID)
+	} else {
+		log.Printf("Successfully sent new message %s to channel %s", messageID, targetChannel.ChannelID)
+	}
 
-	// Pin message if auto pin is enabled
-	if group.AutoPin {
+	// Pin message if auto pin is enabled (an edited message keeps its pinned state)
+	if group.AutoPin && !edited {
 		log.Printf("Auto pin is enabled for group %s, attempting to pin message %s", group.Name, messageID)
 		if err := s.messageService.PinMessage(targetChannel.ChannelID, messageID); err != nil {
 			log.Printf("Failed to pin message %s in channel %s: %v", messageID, targetChannel.ChannelID, err)
@@ -423,15 +429,20 @@ func (s *Scheduler) processRepostRecord(record models.SendRecord) error {
 	}
 
 	// Update channel last message ID in database
-	if err := s.repo.UpdateChannelLastMessageID(targetChannel.ChannelID, messageID); err != nil {
+	if err := s.repo.UpdateChannelLastMessageID(targetChannel.ID, messageID, sent.PartIDs); err != nil {
 		log.Printf("Failed to update last message ID in database: %v", err)
 	} else {
 		log.Printf("Successfully updated last message ID to %s for channel %s", messageID, targetChannel.ChannelID)
 	}
 
+	s.messageService.RecordPublished(record.GroupID, record.ChannelID, models.PublishKindRepost, sent.IDs())
+
 	// Update record
 	now := time.Now()
 	record.MessageID = messageID
+	record.PartMessageIDs = sent.PartIDs
+	record.TemplateID = template.ID
+	record.Variant = template.Variant
 	record.Status = models.SendStatusSent
 	record.SentAt = &now
 	record.ErrorMessage = nil
@@ -455,21 +466,38 @@ func (s *Scheduler) processPushRecord(record models.SendRecord) error {
 		return nil
 	}
 
-	// Get message template
-	template, err := s.repo.GetMessageTemplate(group.MessageID)
+	// Get message template, applying any channel overrides
+	var targetChannel *models.Channel
+	channels, err := s.repo.GetChannelsByGroupID(record.GroupID)
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		if channel.ChannelID == record.ChannelID {
+			targetChannel = &channel
+			break
+		}
+	}
+
+	template, err := s.messageService.ResolveTemplate(group, targetChannel)
 	if err != nil {
 		return err
 	}
 
 	// Send message (don't delete previous)
-	messageID, err := s.messageService.SendMessage(record.ChannelID, template)
+	sent, err := s.messageService.SendMessage(record.ChannelID, template)
 	if err != nil {
 		return err
 	}
 
+	s.messageService.RecordPublished(record.GroupID, record.ChannelID, models.PublishKindPush, sent.IDs())
+
 	// Update record
 	now := time.Now()
-	record.MessageID = messageID
+	record.MessageID = sent.MessageID
+	record.PartMessageIDs = sent.PartIDs
+	record.TemplateID = template.ID
+	record.Variant = template.Variant
 	record.Status = models.SendStatusSent
 	record.SentAt = &now
 	record.ErrorMessage = nil
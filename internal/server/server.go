@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tg-channel-repost-bot/internal/database"
+	"tg-channel-repost-bot/internal/services"
+	"tg-channel-repost-bot/pkg/config"
+)
+
+// Server serves the tracked redirect links of buttons and counts their clicks
+type Server struct {
+	repo   *database.Repository
+	config *config.ServerConfig
+	http   *http.Server
+}
+
+// New creates a new redirect server
+func New(repo *database.Repository, config *config.ServerConfig) *Server {
+	s := &Server{
+		repo:   repo,
+		config: config,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(services.TrackedLinkPath, s.handleRedirect)
+	s.http = &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// Start starts listening in the background
+func (s *Server) Start() {
+	log.Printf("Starting redirect server on %s (public URL %s)", s.http.Addr, s.config.PublicURL)
+
+	go func() {
+		if err := s.http.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Redirect server stopped: %v", err)
+		}
+	}()
+}
+
+// Stop shuts the server down, letting requests in progress finish
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.http.Shutdown(ctx); err != nil {
+		log.Printf("Failed to stop redirect server: %v", err)
+	}
+}
+
+// handleRedirect counts a click on a tracked link and redirects to the button's URL
+func (s *Server) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, services.TrackedLinkPath)
+	if code == "" || strings.Contains(code, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	link, err := s.repo.GetTrackedLinkByCode(code)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Link previews fetch the URL without a reader clicking; HEAD requests are not counted either
+	if r.Method == http.MethodGet && !isPreviewBot(r.UserAgent()) {
+		if err := s.repo.CreateLinkClick(link.ID); err != nil {
+			log.Printf("Failed to record click on link %s: %v", code, err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, link.URL, http.StatusFound)
+}
+
+// isPreviewBot reports whether a request comes from a link preview crawler
+func isPreviewBot(userAgent string) bool {
+	return strings.Contains(strings.ToLower(userAgent), "telegrambot")
+}
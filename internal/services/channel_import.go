@@ -0,0 +1,477 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+)
+
+// ChannelImportAction is what a line of a channel import does
+type ChannelImportAction string
+
+const (
+	ChannelImportAdd    ChannelImportAction = "add"
+	ChannelImportUpdate ChannelImportAction = "update"
+	ChannelImportRemove ChannelImportAction = "remove"
+	ChannelImportNone   ChannelImportAction = "none" // The channel already matches the line
+)
+
+// maxChannelImportRows is the most lines a channel import may have
+const maxChannelImportRows = 1000
+
+// channelCSVHeader lists the columns of channel CSV files. An empty action adds the channel or
+// updates it when it is in the group already; group_name is only informational.
+var channelCSVHeader = []string{"action", "group", "group_name", "channel_id", "channel_name", "tags", "active"}
+
+// ChannelImportRow is a line of a channel import with what it changes
+type ChannelImportRow struct {
+	Line        int
+	Action      ChannelImportAction
+	Group       *models.ChannelGroup
+	ChannelID   string
+	ChannelName string          // Name of an added channel, or new name of an updated one (empty = unchanged)
+	Tags        []string        // Tags of the channel when TagsSet
+	TagsSet     bool            // Whether the line sets the tags
+	Active      *bool           // Whether the channel is active (nil = unchanged, added channels are active)
+	Existing    *models.Channel // The channel in the group, for updates and removals
+	Changes     []string        // Changes of an update, for display
+	Error       string          // Why the line cannot be imported
+}
+
+// ChannelImportPlan is the dry run of a channel import
+type ChannelImportPlan struct {
+	Rows []ChannelImportRow
+}
+
+// Count returns the number of valid lines with the given action
+func (p *ChannelImportPlan) Count(action ChannelImportAction) int {
+	count := 0
+	for _, row := range p.Rows {
+		if row.Error == "" && row.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Errors returns the number of lines that cannot be imported
+func (p *ChannelImportPlan) Errors() int {
+	count := 0
+	for _, row := range p.Rows {
+		if row.Error != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// HasChanges reports whether applying the plan changes anything
+func (p *ChannelImportPlan) HasChanges() bool {
+	return p.Count(ChannelImportAdd)+p.Count(ChannelImportUpdate)+p.Count(ChannelImportRemove) > 0
+}
+
+// ChannelImportResult counts what applying a channel import did
+type ChannelImportResult struct {
+	Added   int
+	Updated int
+	Removed int
+	Failed  int
+	Errors  []string
+}
+
+// channelImportRecord is a parsed line of an import file, by column
+type channelImportRecord struct {
+	line   int
+	fields map[string]string
+}
+
+// PlanChannelImport parses a CSV or TXT channel file and works out what importing it would change,
+// without changing anything. Lines without a group go to the default group. Invalid lines are
+// reported in the plan and do not stop the other lines.
+func (s *MessageService) PlanChannelImport(fileName string, content []byte, defaultGroupID int64) (*ChannelImportPlan, error) {
+	records, err := parseChannelImport(fileName, content)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("文件中没有频道")
+	}
+	if len(records) > maxChannelImportRows {
+		return nil, fmt.Errorf("一次最多导入 %d 行", maxChannelImportRows)
+	}
+
+	groups, err := s.repo.GetChannelGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ChannelImportPlan{}
+	seen := make(map[string]int)
+	for _, record := range records {
+		row := s.planChannelImportRow(record, groups, defaultGroupID)
+		if row.Error == "" {
+			key := fmt.Sprintf("%d/%s", row.Group.ID, row.ChannelID)
+			if line, ok := seen[key]; ok {
+				row.Error = fmt.Sprintf("与第 %d 行重复", line)
+			} else {
+				seen[key] = row.Line
+			}
+		}
+		plan.Rows = append(plan.Rows, row)
+	}
+
+	return plan, nil
+}
+
+// planChannelImportRow validates a line and compares it with the channel in the group
+func (s *MessageService) planChannelImportRow(record channelImportRecord, groups []models.ChannelGroup, defaultGroupID int64) ChannelImportRow {
+	row := ChannelImportRow{Line: record.line}
+	field := func(name string) string {
+		return strings.TrimSpace(record.fields[name])
+	}
+
+	action := ChannelImportAction(strings.ToLower(field("action")))
+	switch action {
+	case "", ChannelImportAdd, ChannelImportUpdate, ChannelImportRemove:
+	default:
+		row.Error = fmt.Sprintf("未知操作 %s（可用 add、update、remove）", action)
+		return row
+	}
+
+	group, err := findImportGroup(groups, field("group"), defaultGroupID)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Group = group
+
+	channelID := field("channel_id")
+	if channelID == "" {
+		row.Error = "缺少频道ID"
+		return row
+	}
+	if !strings.HasPrefix(channelID, "@") && !strings.HasPrefix(channelID, "-100") {
+		row.Error = fmt.Sprintf("无效的频道ID：%s", channelID)
+		return row
+	}
+	channelID, title, err := s.ResolveChannel(channelID)
+	if err != nil {
+		row.Error = "无法获取频道信息：" + err.Error()
+		return row
+	}
+	row.ChannelID = channelID
+	row.ChannelName = field("channel_name")
+
+	if tags := field("tags"); tags != "" {
+		row.TagsSet = true
+		if tags != "无" && tags != "-" {
+			row.Tags = ParseTags(tags)
+		}
+	}
+	if active := field("active"); active != "" {
+		value, err := parseImportBool(active)
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		row.Active = &value
+	}
+
+	existing, err := s.repo.GetGroupChannel(group.ID, channelID)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Existing = existing
+
+	switch {
+	case action == ChannelImportRemove:
+		if existing == nil {
+			row.Error = "频道不在该组中"
+			return row
+		}
+		row.Action = ChannelImportRemove
+	case existing == nil && action == ChannelImportUpdate:
+		row.Error = "频道不在该组中"
+	case existing == nil:
+		row.Action = ChannelImportAdd
+		if row.ChannelName == "" {
+			row.ChannelName = title
+		}
+		if row.ChannelName == "" {
+			row.ChannelName = channelID
+		}
+	case action == ChannelImportAdd:
+		row.Error = "频道已在该组中"
+	default:
+		row.Changes = channelImportChanges(row, existing)
+		row.Action = ChannelImportUpdate
+		if len(row.Changes) == 0 {
+			row.Action = ChannelImportNone
+		}
+	}
+
+	return row
+}
+
+// channelImportChanges describes how a line changes the channel in the group
+func channelImportChanges(row ChannelImportRow, existing *models.Channel) []string {
+	var changes []string
+	if row.ChannelName != "" && row.ChannelName != existing.ChannelName {
+		changes = append(changes, fmt.Sprintf("名称 %s → %s", existing.ChannelName, row.ChannelName))
+	}
+	if row.TagsSet && !sameTags(row.Tags, existing.Tags) {
+		changes = append(changes, fmt.Sprintf("标签 [%s] → [%s]", strings.Join(existing.Tags, " "), strings.Join(row.Tags, " ")))
+	}
+	if row.Active != nil && *row.Active != existing.IsActive {
+		if *row.Active {
+			changes = append(changes, "启用")
+		} else {
+			changes = append(changes, "停用")
+		}
+	}
+	return changes
+}
+
+// sameTags reports whether two lists hold the same tags in any order
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := func(tags []string) string {
+		tags = append([]string(nil), tags...)
+		sort.Strings(tags)
+		return strings.Join(tags, " ")
+	}
+	return sorted(a) == sorted(b)
+}
+
+// findImportGroup finds the group of a line by ID or by name
+func findImportGroup(groups []models.ChannelGroup, value string, defaultGroupID int64) (*models.ChannelGroup, error) {
+	if value == "" {
+		if defaultGroupID == 0 {
+			return nil, fmt.Errorf("未指定频道组")
+		}
+		value = strconv.FormatInt(defaultGroupID, 10)
+	}
+
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		for i := range groups {
+			if groups[i].ID == id {
+				return &groups[i], nil
+			}
+		}
+		return nil, fmt.Errorf("未找到ID为 %d 的频道组", id)
+	}
+
+	var found *models.ChannelGroup
+	for i := range groups {
+		if groups[i].Name != value {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("有多个名为 %s 的频道组，请使用组ID", value)
+		}
+		found = &groups[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("未找到频道组 %s", value)
+	}
+	return found, nil
+}
+
+// parseImportBool parses the active column
+func parseImportBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "y", "是", "启用":
+		return true, nil
+	case "0", "false", "no", "n", "否", "停用":
+		return false, nil
+	}
+	return false, fmt.Errorf("无效的 active 值：%s（可用 true 或 false）", value)
+}
+
+// parseChannelImport reads the lines of an import file. CSV files need a header with at least a
+// channel_id column; other files take a channel per line as "name|id" or "id", like adding
+// channels by message.
+func parseChannelImport(fileName string, content []byte) ([]channelImportRecord, error) {
+	content = bytes.TrimPrefix(content, []byte("\uFEFF"))
+
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(string(content)), "\n")
+	if strings.ToLower(path.Ext(fileName)) == ".csv" || strings.Contains(strings.ToLower(firstLine), "channel_id") {
+		return parseChannelCSV(content)
+	}
+
+	var records []channelImportRecord
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := map[string]string{"channel_id": line}
+		if name, id, ok := strings.Cut(line, "|"); ok {
+			fields = map[string]string{"channel_name": name, "channel_id": id}
+		}
+		records = append(records, channelImportRecord{line: i + 1, fields: fields})
+	}
+	return records, nil
+}
+
+// parseChannelCSV reads the lines of a CSV import file by the columns of its header
+func parseChannelCSV(content []byte) ([]channelImportRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误：%v", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	hasChannelID := false
+	for _, column := range header {
+		hasChannelID = hasChannelID || column == "channel_id"
+	}
+	if !hasChannelID {
+		return nil, fmt.Errorf("CSV 第一行需为表头，至少包含 channel_id 列")
+	}
+
+	var records []channelImportRecord
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV 格式错误：%v", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		fields := make(map[string]string)
+		empty := true
+		for i, value := range values {
+			if i < len(header) {
+				fields[header[i]] = value
+			}
+			empty = empty && strings.TrimSpace(value) == ""
+		}
+		if empty {
+			continue
+		}
+		records = append(records, channelImportRecord{line: line, fields: fields})
+	}
+	return records, nil
+}
+
+// ApplyChannelImport makes the changes of a planned import. Lines that fail are counted and the
+// others still applied; groups with a tag rule are synced when tags changed.
+func (s *MessageService) ApplyChannelImport(plan *ChannelImportPlan) ChannelImportResult {
+	var result ChannelImportResult
+	tagsChanged := false
+
+	for _, row := range plan.Rows {
+		if row.Error != "" || row.Action == ChannelImportNone {
+			continue
+		}
+		if err := s.applyChannelImportRow(row); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("第 %d 行 %s：%v", row.Line, row.ChannelID, err))
+			continue
+		}
+
+		switch row.Action {
+		case ChannelImportAdd:
+			result.Added++
+		case ChannelImportUpdate:
+			result.Updated++
+		case ChannelImportRemove:
+			result.Removed++
+		}
+		tagsChanged = tagsChanged || row.TagsSet
+	}
+
+	if tagsChanged {
+		s.SyncAllTaggedChannels()
+	}
+	return result
+}
+
+// applyChannelImportRow adds, updates or removes the channel of a line
+func (s *MessageService) applyChannelImportRow(row ChannelImportRow) error {
+	switch row.Action {
+	case ChannelImportAdd:
+		channel := &models.Channel{
+			ChannelID:   row.ChannelID,
+			ChannelName: row.ChannelName,
+			GroupID:     row.Group.ID,
+			IsActive:    row.Active == nil || *row.Active,
+		}
+		if err := s.repo.CreateChannel(channel); err != nil {
+			return err
+		}
+	case ChannelImportUpdate:
+		if row.ChannelName != "" && row.ChannelName != row.Existing.ChannelName {
+			if err := s.repo.UpdateChannelName(row.Existing.ID, row.ChannelName); err != nil {
+				return err
+			}
+		}
+		if row.Active != nil && *row.Active != row.Existing.IsActive {
+			if err := s.repo.UpdateChannelStatus(row.Existing.ID, *row.Active); err != nil {
+				return err
+			}
+		}
+	case ChannelImportRemove:
+		return s.repo.DeleteChannel(row.Existing.ID)
+	}
+
+	if row.TagsSet {
+		return s.repo.SetChannelTags(row.ChannelID, row.Tags)
+	}
+	return nil
+}
+
+// ExportChannelsCSV writes the channels of a group, including inactive ones, in the CSV format
+// that PlanChannelImport reads
+func (s *MessageService) ExportChannelsCSV(group *models.ChannelGroup) ([]byte, error) {
+	channels, err := s.repo.GetAllChannelsByGroupID(group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	// The byte order mark lets spreadsheet apps detect UTF-8
+	buf.WriteString("\uFEFF")
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(channelCSVHeader); err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		record := []string{
+			"",
+			strconv.FormatInt(group.ID, 10),
+			group.Name,
+			channel.ChannelID,
+			channel.ChannelName,
+			strings.Join(channel.Tags, " "),
+			strconv.FormatBool(channel.IsActive),
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write channels CSV: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+
+	"tg-channel-repost-bot/internal/models"
+)
+
+// ChannelTransferResult counts the channels moved or copied to another group
+type ChannelTransferResult struct {
+	Done    int
+	Skipped []string // Channels already in the target group
+	Failed  []string // Channels that could not be moved or copied, with the error
+}
+
+// MoveChannels moves channels to another group. Their last message stays theirs, so the target
+// group replaces it on its next repost, and their template, buttons and language stay as well.
+// The messages published in them move to the target group's ledger. Channels the target group
+// already has are skipped.
+func (s *MessageService) MoveChannels(ids []int64, targetGroupID int64) ChannelTransferResult {
+	return s.transferChannels(ids, targetGroupID, func(channel *models.Channel) error {
+		return s.repo.MoveChannel(channel.ID, targetGroupID)
+	})
+}
+
+// CopyChannels adds channels to another group as well, with copies of their template, buttons
+// and language. The last message belongs to the group that published it, so the copies start
+// without one. Channels the target group already has are skipped.
+func (s *MessageService) CopyChannels(ids []int64, targetGroupID int64) ChannelTransferResult {
+	return s.transferChannels(ids, targetGroupID, func(channel *models.Channel) error {
+		return s.copyChannel(channel, targetGroupID)
+	})
+}
+
+// transferChannels applies transfer to each channel the target group does not have yet
+func (s *MessageService) transferChannels(ids []int64, targetGroupID int64, transfer func(channel *models.Channel) error) ChannelTransferResult {
+	var result ChannelTransferResult
+	for _, id := range ids {
+		channel, err := s.repo.GetChannel(id)
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("#%d：%v", id, err))
+			continue
+		}
+		if channel.GroupID == targetGroupID {
+			result.Skipped = append(result.Skipped, channel.ChannelName)
+			continue
+		}
+
+		existing, err := s.repo.GetGroupChannel(targetGroupID, channel.ChannelID)
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s：%v", channel.ChannelName, err))
+			continue
+		}
+		if existing != nil {
+			result.Skipped = append(result.Skipped, channel.ChannelName)
+			continue
+		}
+
+		if err := transfer(channel); err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s：%v", channel.ChannelName, err))
+			continue
+		}
+		result.Done++
+	}
+	return result
+}
+
+// copyChannel adds a channel to a group with its settings. Override templates belong to a single
+// channel, so the copy gets its own.
+func (s *MessageService) copyChannel(channel *models.Channel, groupID int64) error {
+	templateID := channel.TemplateID
+	if templateID != 0 {
+		template, err := s.repo.GetMessageTemplate(templateID)
+		if err != nil {
+			return err
+		}
+		copied := *template
+		if err := s.repo.CreateMessageTemplate(&copied); err != nil {
+			return err
+		}
+		templateID = copied.ID
+	}
+
+	copied := &models.Channel{
+		ChannelID:   channel.ChannelID,
+		ChannelName: channel.ChannelName,
+		GroupID:     groupID,
+		TemplateID:  templateID,
+		Buttons:     channel.Buttons,
+		Language:    channel.Language,
+		IsActive:    channel.IsActive,
+	}
+	if err := s.repo.CreateChannel(copied); err != nil {
+		return err
+	}
+	return s.repo.UpdateChannelHealth(copied.ID, channel.Health)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CheckChannelHealth looks up a channel's chat and the bot's membership in it and stores the
+// result with the channel. A chat that cannot be reached is recorded as an error of the check.
+func (s *MessageService) CheckChannelHealth(channel *models.Channel) (models.ChannelHealth, error) {
+	health := s.channelHealth(channel.ChannelID)
+	if err := s.repo.UpdateChannelHealth(channel.ID, health); err != nil {
+		return health, err
+	}
+	channel.Health = health
+	return health, nil
+}
+
+// CheckAllChannelHealth health checks every active channel; a Telegram channel in several groups
+// is looked up once
+func (s *MessageService) CheckAllChannelHealth() {
+	channels, err := s.repo.GetActiveChannels()
+	if err != nil {
+		log.Printf("Failed to get channels for health check: %v", err)
+		return
+	}
+
+	checked := make(map[string]models.ChannelHealth)
+	problems := 0
+	for _, channel := range channels {
+		health, ok := checked[channel.ChannelID]
+		if !ok {
+			health = s.channelHealth(channel.ChannelID)
+			checked[channel.ChannelID] = health
+			if len(health.Problems()) > 0 {
+				problems++
+				log.Printf("Channel %s is unhealthy: %v", channel.ChannelID, health.Problems())
+			}
+		}
+		if err := s.repo.UpdateChannelHealth(channel.ID, health); err != nil {
+			log.Printf("Failed to store health of channel %s: %v", channel.ChannelID, err)
+		}
+	}
+
+	log.Printf("Health checked %d channels, %d with problems", len(checked), problems)
+}
+
+// getChat looks up a chat by numeric ID or @username
+func (s *MessageService) getChat(channelID string) (*tgbotapi.Chat, error) {
+	params := make(tgbotapi.Params)
+	addChatParam(params, channelID)
+	resp, err := s.api.MakeRequest("getChat", params)
+	if err != nil {
+		return nil, err
+	}
+	var chat tgbotapi.Chat
+	if err := json.Unmarshal(resp.Result, &chat); err != nil {
+		return nil, fmt.Errorf("failed to decode chat: %w", err)
+	}
+	return &chat, nil
+}
+
+// ResolveChannel looks up a channel given by @username and returns its numeric ID and title.
+// Numeric IDs are kept, since deleting and pinning messages only work with them.
+func (s *MessageService) ResolveChannel(channelID string) (string, string, error) {
+	if !strings.HasPrefix(channelID, "@") {
+		return channelID, "", nil
+	}
+
+	chat, err := s.getChat(channelID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve channel %s: %w", channelID, err)
+	}
+	return strconv.FormatInt(chat.ID, 10), chat.Title, nil
+}
+
+// ResolveUsernameChannels replaces the @username of channels added before usernames were
+// resolved with their numeric ID, together with the send records, ledger and messages kept for
+// them
+func (s *MessageService) ResolveUsernameChannels() {
+	usernames, err := s.repo.GetUsernameChannelIDs()
+	if err != nil {
+		log.Printf("Failed to get username channels: %v", err)
+		return
+	}
+
+	for _, username := range usernames {
+		channelID, title, err := s.ResolveChannel(username)
+		if err != nil {
+			log.Printf("Failed to resolve username channel: %v", err)
+			continue
+		}
+		if err := s.repo.UpdateChannelChatID(username, channelID, title); err != nil {
+			log.Printf("Failed to migrate channel %s to %s: %v", username, channelID, err)
+			continue
+		}
+		log.Printf("Resolved channel %s to %s", username, channelID)
+	}
+}
+
+// channelHealth calls getChat and getChatMember for the bot in a channel
+func (s *MessageService) channelHealth(channelID string) models.ChannelHealth {
+	health := models.ChannelHealth{CheckedAt: time.Now()}
+
+	chat, err := s.getChat(channelID)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Title = chat.Title
+	health.Type = chat.Type
+
+	params := make(tgbotapi.Params)
+	addChatParam(params, channelID)
+	params.AddNonZero64("user_id", s.api.Self.ID)
+	resp, err := s.api.MakeRequest("getChatMember", params)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	var member tgbotapi.ChatMember
+	if err := json.Unmarshal(resp.Result, &member); err != nil {
+		health.Error = fmt.Sprintf("failed to decode chat member: %v", err)
+		return health
+	}
+	health.Status = member.Status
+	applyMemberRights(&health, chat.Type, member)
+
+	return health
+}
+
+// applyMemberRights sets the rights of the bot from its membership. Channels only allow
+// administrators to post and pinning there needs the edit right; in groups the bot can always
+// edit its own messages.
+func applyMemberRights(health *models.ChannelHealth, chatType string, member tgbotapi.ChatMember) {
+	isChannel := chatType == "channel"
+	switch member.Status {
+	case "creator":
+		health.CanPost, health.CanEdit, health.CanDelete, health.CanPin = true, true, true, true
+	case "administrator":
+		if isChannel {
+			health.CanPost = member.CanPostMessages
+			health.CanEdit = member.CanEditMessages
+			health.CanPin = member.CanEditMessages
+		} else {
+			health.CanPost = true
+			health.CanEdit = true
+			health.CanPin = member.CanPinMessages
+		}
+		health.CanDelete = member.CanDeleteMessages
+	case "member":
+		health.CanPost = !isChannel
+		health.CanEdit = !isChannel
+	case "restricted":
+		health.CanPost = member.CanSendMessages
+		health.CanEdit = true
+	}
+}
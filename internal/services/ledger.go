@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tg-channel-repost-bot/internal/models"
+)
+
+// CleanupResult counts what a cleanup of published messages did
+type CleanupResult struct {
+	Total   int // Messages to delete
+	Deleted int // Messages deleted
+	Gone    int // Messages already deleted in the channel
+	Failed  int // Messages that could not be deleted
+}
+
+// CleanupProgress is called after each message a cleanup handled
+type CleanupProgress func(done int, result CleanupResult)
+
+// RecordPublished adds messages published to a channel for a group to the ledger
+func (s *MessageService) RecordPublished(groupID int64, channelID string, kind models.PublishKind, messageIDs []string) {
+	if err := s.repo.CreatePublishedMessages(groupID, channelID, kind, messageIDs); err != nil {
+		log.Printf("Failed to record published messages %v in channel %s: %v", messageIDs, channelID, err)
+	}
+}
+
+// CleanupPublished deletes the messages a group published from from (inclusive) to to
+// (exclusive) that are not deleted yet; a zero time leaves that end open. Messages that are
+// already gone from the channel are marked deleted as well.
+func (s *MessageService) CleanupPublished(groupID int64, from, to time.Time, progress CleanupProgress) (CleanupResult, error) {
+	var result CleanupResult
+	messages, err := s.repo.GetPublishedMessages(groupID, from, to)
+	if err != nil {
+		return result, err
+	}
+	result.Total = len(messages)
+
+	for i, message := range messages {
+		// Rate limiting: delay between deletions to avoid API limits
+		if i > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		s.ClosePoll(message.ChannelID, message.MessageID)
+		err := s.deleteMessage(message.ChannelID, message.MessageID)
+		switch {
+		case err == nil:
+			result.Deleted++
+		case isMessageGone(err):
+			result.Gone++
+			if err := s.repo.MarkPublishedMessageDeleted(message.ChannelID, message.MessageID); err != nil {
+				log.Printf("Failed to mark message %s in channel %s deleted: %v", message.MessageID, message.ChannelID, err)
+			}
+		default:
+			result.Failed++
+			log.Printf("Failed to delete published message %s in channel %s: %v", message.MessageID, message.ChannelID, err)
+		}
+
+		if progress != nil {
+			progress(i+1, result)
+		}
+	}
+
+	if err := s.repo.ClearDeletedLastMessages(groupID); err != nil {
+		return result, fmt.Errorf("failed to clear last messages: %w", err)
+	}
+
+	return result, nil
+}
+
+// isMessageGone reports whether deleting a message failed because it no longer exists
+func isMessageGone(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "message to delete not found") || strings.Contains(message, "MESSAGE_ID_INVALID")
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RecordMembership records a change of the bot's membership in a channel or supergroup as a known
+// channel and stores its health in the groups it is in. Removing the bot deactivates the channel
+// in those groups and making it an administrator again reactivates the ones the removal
+// deactivated. The number of groups deactivated or reactivated is returned with the known channel.
+func (s *MessageService) RecordMembership(update *tgbotapi.ChatMemberUpdated) (*models.KnownChannel, int64, error) {
+	member := update.NewChatMember
+	health := models.ChannelHealth{
+		Title:     update.Chat.Title,
+		Type:      update.Chat.Type,
+		Status:    member.Status,
+		CheckedAt: time.Now(),
+	}
+	applyMemberRights(&health, update.Chat.Type, member)
+
+	channel := &models.KnownChannel{
+		ChatID:   strconv.FormatInt(update.Chat.ID, 10),
+		Title:    update.Chat.Title,
+		ChatType: update.Chat.Type,
+		Health:   health,
+		AddedBy:  update.From.ID,
+		IsActive: !IsRemoved(member),
+	}
+	if err := s.repo.SaveKnownChannel(channel); err != nil {
+		return channel, 0, err
+	}
+
+	if !channel.IsActive {
+		groups, err := s.repo.DeactivateRemovedChannel(channel.ChatID, health)
+		return channel, groups, err
+	}
+
+	// Other changes, such as new rights, leave the status chosen by the operator alone
+	if err := s.repo.UpdateChannelHealthByChatID(channel.ChatID, health); err != nil {
+		return channel, 0, err
+	}
+	if !IsAdministrator(member) {
+		return channel, 0, nil
+	}
+	groups, err := s.repo.ReactivateRemovedChannel(channel.ChatID)
+	return channel, groups, err
+}
+
+// IsAdministrator reports whether a chat member is an administrator or the creator of the chat
+func IsAdministrator(member tgbotapi.ChatMember) bool {
+	return member.Status == "administrator" || member.Status == "creator"
+}
+
+// IsRemoved reports whether a chat member left or was removed from the chat
+func IsRemoved(member tgbotapi.ChatMember) bool {
+	return member.Status == "left" || member.Status == "kicked"
+}
@@ -1,746 +1,1421 @@
-package services
-
-import (
-	"encoding/json"
-	"fmt"
-	"log"
-	"strconv"
-	"time"
-
-	"tg-channel-repost-bot/internal/database"
-	"tg-channel-repost-bot/internal/models"
-	"tg-channel-repost-bot/pkg/config"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-)
-
-// MessageService handles message operations
-type MessageService struct {
-	api    *tgbotapi.BotAPI
-	repo   *database.Repository
-	config *config.Config
-}
-
-// NewMessageService creates a new message service
-func NewMessageService(api *tgbotapi.BotAPI, repo *database.Repository, config *config.Config) *MessageService {
-	return &MessageService{
-		api:    api,
-		repo:   repo,
-		config: config,
-	}
-}
-
-// SendRepost sends a repost message to all channels in a group
-func (s *MessageService) SendRepost(groupID int64) error {
-	// Get channel group
-	group, err := s.repo.GetChannelGroup(groupID)
-	if err != nil {
-		return fmt.Errorf("failed to get channel group: %w", err)
-	}
-
-	if !group.IsActive {
-		return fmt.Errorf("channel group is not active")
-	}
-
-	// Get message template
-	template, err := s.repo.GetMessageTemplate(group.MessageID)
-	if err != nil {
-		return fmt.Errorf("failed to get message template: %w", err)
-	}
-
-	// Get channels
-	channels, err := s.repo.GetChannelsByGroupID(groupID)
-	if err != nil {
-		return fmt.Errorf("failed to get channels: %w", err)
-	}
-
-	// Send to each channel
-	for _, channel := range channels {
-		if err := s.sendRepostToChannel(channel, template); err != nil {
-			log.Printf("Failed to send repost to channel %s: %v", channel.ChannelID, err)
-			// Record failure
-			s.recordSendFailure(groupID, channel.ChannelID, models.SendTypeRepost, err.Error())
-		}
-	}
-
-	return nil
-}
-
-// SendPush sends a push message to all channels in a group
-func (s *MessageService) SendPush(groupID int64) error {
-	// Get channel group
-	group, err := s.repo.GetChannelGroup(groupID)
-	if err != nil {
-		return fmt.Errorf("failed to get channel group: %w", err)
-	}
-
-	if !group.IsActive {
-		return fmt.Errorf("channel group is not active")
-	}
-
-	// Get message template
-	template, err := s.repo.GetMessageTemplate(group.MessageID)
-	if err != nil {
-		return fmt.Errorf("failed to get message template: %w", err)
-	}
-
-	// Get channels
-	channels, err := s.repo.GetChannelsByGroupID(groupID)
-	if err != nil {
-		return fmt.Errorf("failed to get channels: %w", err)
-	}
-
-	// Send to each channel
-	for _, channel := range channels {
-		if err := s.sendPushToChannel(channel, template); err != nil {
-			log.Printf("Failed to send push to channel %s: %v", channel.ChannelID, err)
-			// Record failure
-			s.recordSendFailure(groupID, channel.ChannelID, models.SendTypePush, err.Error())
-		}
-	}
-
-	return nil
-}
-
-// DeleteGroupMessages deletes all messages for a channel group
-func (s *MessageService) DeleteGroupMessages(groupID int64) error {
-	// Get channels
-	channels, err := s.repo.GetChannelsByGroupID(groupID)
-	if err != nil {
-		return fmt.Errorf("failed to get channels: %w", err)
-	}
-
-	// Delete messages from each channel
-	for _, channel := range channels {
-		if err := s.deleteChannelMessages(channel); err != nil {
-			log.Printf("Failed to delete messages from channel %s: %v", channel.ChannelID, err)
-		}
-	}
-
-	return nil
-}
-
-// SendMessage sends a message to a channel (exported wrapper)
-func (s *MessageService) SendMessage(channelID string, template *models.MessageTemplate) (string, error) {
-	return s.sendMessage(channelID, template)
-}
-
-// DeleteMessage deletes a message from a channel (exported wrapper)
-func (s *MessageService) DeleteMessage(channelID, messageID string) error {
-	return s.deleteMessage(channelID, messageID)
-}
-
-// SendMessageWithEntities sends a message with entities to a channel
-func (s *MessageService) SendMessageWithEntities(channelID, content string, entities []tgbotapi.MessageEntity) (string, error) {
-	log.Printf("SendMessageWithEntities called for channel %s with %d entities", channelID, len(entities))
-
-	chatID, err := strconv.ParseInt(channelID, 10, 64)
-	if err != nil {
-		// Try as username
-		chatID = 0
-	}
-
-	var msg tgbotapi.Chattable
-
-	if chatID != 0 {
-		textMsg := tgbotapi.NewMessage(chatID, content)
-		if entities != nil && len(entities) > 0 {
-			log.Printf("Setting %d entities for numeric chat ID %d", len(entities), chatID)
-			textMsg.Entities = entities
-		}
-		textMsg.DisableWebPagePreview = true // 关闭URL预览
-		msg = textMsg
-	} else {
-		textMsg := tgbotapi.NewMessageToChannel(channelID, content)
-		if entities != nil && len(entities) > 0 {
-			log.Printf("Setting %d entities for channel username %s", len(entities), channelID)
-			textMsg.Entities = entities
-		}
-		textMsg.DisableWebPagePreview = true // 关闭URL预览
-		msg = textMsg
-	}
-
-	sentMsg, err := s.api.Send(msg)
-	if err != nil {
-		return "", fmt.Errorf("failed to send message to channel %s: %w", channelID, err)
-	}
-
-	log.Printf("Message sent successfully with ID %d", sentMsg.MessageID)
-	return strconv.Itoa(sentMsg.MessageID), nil
-}
-
-// SendMessageWithTemplate sends a message with template (including buttons) and entities to a channel
-func (s *MessageService) SendMessageWithTemplate(channelID string, template *models.MessageTemplate, entities []tgbotapi.MessageEntity) (string, error) {
-	log.Printf("SendMessageWithTemplate called for channel %s with %d entities and %d button rows, message type: %s", channelID, len(entities), len(template.Buttons), template.MessageType)
-
-	// Debug: Log content and entities details
-	log.Printf("Message content: '%s' (length: %d bytes)", template.Content, len([]byte(template.Content)))
-	if len(entities) > 0 {
-		for i, entity := range entities {
-			log.Printf("Entity %d: type=%s, offset=%d, length=%d, url=%s", i, entity.Type, entity.Offset, entity.Length, entity.URL)
-			// Check if entity offset/length is within content bounds
-			contentBytes := []byte(template.Content)
-			if entity.Offset >= 0 && entity.Offset < len(contentBytes) && entity.Offset+entity.Length <= len(contentBytes) {
-				entityText := string(contentBytes[entity.Offset : entity.Offset+entity.Length])
-				log.Printf("Entity %d text: '%s'", i, entityText)
-			} else {
-				log.Printf("WARNING: Entity %d has invalid offset/length for content", i)
-			}
-		}
-	}
-
-	chatID, err := strconv.ParseInt(channelID, 10, 64)
-	if err != nil {
-		// Try as username
-		chatID = 0
-	}
-
-	var msg tgbotapi.Chattable
-
-	// Handle different message types
-	switch template.MessageType {
-	case models.MessageTypePhoto:
-		if chatID != 0 {
-			photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(template.MediaURL))
-			photoMsg.Caption = template.Content
-			// Use entities for formatting, no ParseMode needed
-			if entities != nil && len(entities) > 0 {
-				log.Printf("Setting %d caption entities for photo message to chat ID %d", len(entities), chatID)
-				photoMsg.CaptionEntities = entities
-			}
-			if len(template.Buttons) > 0 {
-				photoMsg.ReplyMarkup = s.createInlineKeyboard(template.Buttons)
-				log.Printf("Added %d button rows to photo message", len(template.Buttons))
-			}
-			msg = photoMsg
-		} else {
-			photoMsg := tgbotapi.NewPhotoToChannel(channelID, tgbotapi.FileID(template.MediaURL))
-			photoMsg.Caption = template.Content
-			// Use entities for formatting, no ParseMode needed
-			if entities != nil && len(entities) > 0 {
-				log.Printf("Setting %d caption entities for photo message to channel %s", len(entities), channelID)
-				photoMsg.CaptionEntities = entities
-			}
-			if len(template.Buttons) > 0 {
-				photoMsg.ReplyMarkup = s.createInlineKeyboard(template.Buttons)
-				log.Printf("Added %d button rows to photo message", len(template.Buttons))
-			}
-			msg = photoMsg
-		}
-
-	default: // MessageTypeText
-		if chatID != 0 {
-			textMsg := tgbotapi.NewMessage(chatID, template.Content)
-			// Use entities for formatting, no ParseMode needed
-			if entities != nil && len(entities) > 0 {
-				log.Printf("Setting %d entities for text message to chat ID %d", len(entities), chatID)
-				textMsg.Entities = entities
-			}
-			textMsg.DisableWebPagePreview = true // 关闭URL预览
-			if len(template.Buttons) > 0 {
-				textMsg.ReplyMarkup = s.createInlineKeyboard(template.Buttons)
-				log.Printf("Added %d button rows to text message", len(template.Buttons))
-			}
-			msg = textMsg
-		} else {
-			textMsg := tgbotapi.NewMessageToChannel(channelID, template.Content)
-			// Use entities for formatting, no ParseMode needed
-			if entities != nil && len(entities) > 0 {
-				log.Printf("Setting %d entities for text message to channel %s", len(entities), channelID)
-				textMsg.Entities = entities
-			}
-			textMsg.DisableWebPagePreview = true // 关闭URL预览
-			if len(template.Buttons) > 0 {
-				textMsg.ReplyMarkup = s.createInlineKeyboard(template.Buttons)
-				log.Printf("Added %d button rows to text message", len(template.Buttons))
-			}
-			msg = textMsg
-		}
-	}
-
-	sentMsg, err := s.api.Send(msg)
-	if err != nil {
-		return "", fmt.Errorf("failed to send message to channel %s: %w", channelID, err)
-	}
-
-	log.Printf("Message sent successfully with ID %d", sentMsg.MessageID)
-	return strconv.Itoa(sentMsg.MessageID), nil
-}
-
-// SendMediaGroup sends a media group to a channel
-func (s *MessageService) SendMediaGroup(channelID string, mediaURLs []string, mediaTypes []string, caption string) error {
-	if len(mediaURLs) == 0 {
-		return fmt.Errorf("no media URLs provided")
-	}
-
-	if len(mediaURLs) != len(mediaTypes) {
-		return fmt.Errorf("media URLs and types count mismatch")
-	}
-
-	chatID, err := strconv.ParseInt(channelID, 10, 64)
-	if err != nil {
-		// Try as username
-		chatID = 0
-	}
-
-	// Create media group
-	var mediaGroup []interface{}
-
-	for i, mediaURL := range mediaURLs {
-		mediaType := mediaTypes[i]
-
-		switch mediaType {
-		case "photo":
-			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				// Add caption to first media item
-				media.Caption = caption
-				media.ParseMode = "Markdown"
-			}
-			mediaGroup = append(mediaGroup, media)
-
-		case "video":
-			media := tgbotapi.NewInputMediaVideo(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				// Add caption to first media item
-				media.Caption = caption
-				media.ParseMode = "Markdown"
-			}
-			mediaGroup = append(mediaGroup, media)
-
-		case "document":
-			media := tgbotapi.NewInputMediaDocument(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				// Add caption to first media item
-				media.Caption = caption
-				media.ParseMode = "Markdown"
-			}
-			mediaGroup = append(mediaGroup, media)
-
-		default:
-			// Default to photo for unknown types
-			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				media.Caption = caption
-				media.ParseMode = "Markdown"
-			}
-			mediaGroup = append(mediaGroup, media)
-		}
-	}
-
-	// Send media group
-	var mediaGroupConfig tgbotapi.MediaGroupConfig
-	if chatID != 0 {
-		mediaGroupConfig = tgbotapi.NewMediaGroup(chatID, mediaGroup)
-	} else {
-		mediaGroupConfig = tgbotapi.MediaGroupConfig{
-			ChannelUsername: channelID,
-			Media:           mediaGroup,
-		}
-	}
-
-	_, err = s.api.SendMediaGroup(mediaGroupConfig)
-	if err != nil {
-		return fmt.Errorf("failed to send media group to channel %s: %w", channelID, err)
-	}
-
-	log.Printf("Successfully sent media group with %d items to channel %s", len(mediaURLs), channelID)
-	return nil
-}
-
-// SendMediaGroupWithEntities sends a media group to a channel with entities
-func (s *MessageService) SendMediaGroupWithEntities(channelID string, mediaURLs []string, mediaTypes []string, caption string, entities []tgbotapi.MessageEntity) error {
-	if len(mediaURLs) == 0 {
-		return fmt.Errorf("no media URLs provided")
-	}
-
-	if len(mediaURLs) != len(mediaTypes) {
-		return fmt.Errorf("media URLs and types count mismatch")
-	}
-
-	log.Printf("SendMediaGroupWithEntities: caption='%s', entities count=%d", caption, len(entities))
-	if len(entities) > 0 {
-		for i, entity := range entities {
-			log.Printf("Entity %d: type=%s, offset=%d, length=%d, url=%s", i, entity.Type, entity.Offset, entity.Length, entity.URL)
-		}
-	}
-
-	chatID, err := strconv.ParseInt(channelID, 10, 64)
-	if err != nil {
-		// Try as username
-		chatID = 0
-	}
-
-	// Create media group
-	var mediaGroup []interface{}
-
-	// Only add caption and entities to the first media item
-	for i, mediaURL := range mediaURLs {
-		mediaType := mediaTypes[i]
-
-		switch mediaType {
-		case "photo":
-			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				// Add caption to first media item with entities
-				media.Caption = caption
-				// IMPORTANT: Don't set ParseMode when using entities
-				if len(entities) > 0 {
-					media.CaptionEntities = entities
-					log.Printf("Set %d entities to first photo media item", len(entities))
-				}
-			}
-			mediaGroup = append(mediaGroup, media)
-
-		case "video":
-			media := tgbotapi.NewInputMediaVideo(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				// Add caption to first media item with entities
-				media.Caption = caption
-				// IMPORTANT: Don't set ParseMode when using entities
-				if len(entities) > 0 {
-					media.CaptionEntities = entities
-					log.Printf("Set %d entities to first video media item", len(entities))
-				}
-			}
-			mediaGroup = append(mediaGroup, media)
-
-		case "document":
-			media := tgbotapi.NewInputMediaDocument(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				// Add caption to first media item with entities
-				media.Caption = caption
-				// IMPORTANT: Don't set ParseMode when using entities
-				if len(entities) > 0 {
-					media.CaptionEntities = entities
-					log.Printf("Set %d entities to first document media item", len(entities))
-				}
-			}
-			mediaGroup = append(mediaGroup, media)
-
-		default:
-			// Default to photo for unknown types
-			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
-			if i == 0 && caption != "" {
-				media.Caption = caption
-				// IMPORTANT: Don't set ParseMode when using entities
-				if len(entities) > 0 {
-					media.CaptionEntities = entities
-					log.Printf("Set %d entities to first default media item", len(entities))
-				}
-			}
-			mediaGroup = append(mediaGroup, media)
-		}
-	}
-
-	// Send media group
-	var mediaGroupConfig tgbotapi.MediaGroupConfig
-	if chatID != 0 {
-		mediaGroupConfig = tgbotapi.NewMediaGroup(chatID, mediaGroup)
-	} else {
-		mediaGroupConfig = tgbotapi.MediaGroupConfig{
-			ChannelUsername: channelID,
-			Media:           mediaGroup,
-		}
-	}
-
-	log.Printf("Sending media group with %d items to channel %s", len(mediaGroup), channelID)
-	_, err = s.api.SendMediaGroup(mediaGroupConfig)
-	if err != nil {
-		return fmt.Errorf("failed to send media group with entities to channel %s: %w", channelID, err)
-	}
-
-	log.Printf("Successfully sent media group with %d items and entities to channel %s", len(mediaURLs), channelID)
-	return nil
-}
-
-// sendRepostToChannel sends a repost message to a specific channel
-func (s *MessageService) sendRepostToChannel(channel models.Channel, template *models.MessageTemplate) error {
-	// Delete previous message if exists
-	if channel.LastMessageID != "" {
-		if err := s.deleteMessage(channel.ChannelID, channel.LastMessageID); err != nil {
-			log.Printf("Failed to delete previous message in channel %s: %v", channel.ChannelID, err)
-		}
-	}
-
-	// Send new message
-	messageID, err := s.sendMessage(channel.ChannelID, template)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
-	}
-
-	// Update last message ID
-	if err := s.repo.UpdateChannelLastMessageID(channel.ChannelID, messageID); err != nil {
-		log.Printf("Failed to update last message ID for channel %s: %v", channel.ChannelID, err)
-	}
-
-	// Record success
-	s.recordSendSuccess(channel.GroupID, channel.ChannelID, messageID, models.SendTypeRepost)
-
-	return nil
-}
-
-// sendPushToChannel sends a push message to a specific channel
-func (s *MessageService) sendPushToChannel(channel models.Channel, template *models.MessageTemplate) error {
-	// Send message (don't delete previous)
-	messageID, err := s.sendMessage(channel.ChannelID, template)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
-	}
-
-	// Record success
-	s.recordSendSuccess(channel.GroupID, channel.ChannelID, messageID, models.SendTypePush)
-
-	return nil
-}
-
-// sendMessage sends a message to a channel based on template
-func (s *MessageService) sendMessage(channelID string, template *models.MessageTemplate) (string, error) {
-	// Parse entities from template if they exist
-	var entities []tgbotapi.MessageEntity
-	if template.Entities != "" {
-		log.Printf("Deserializing entities from template %d: %s", template.ID, template.Entities)
-		if err := json.Unmarshal([]byte(template.Entities), &entities); err != nil {
-			log.Printf("Failed to deserialize entities for template %d: %v", template.ID, err)
-			entities = nil
-		} else {
-			log.Printf("Successfully deserialized %d entities for template %d", len(entities), template.ID)
-			for i, entity := range entities {
-				log.Printf("Deserialized entity %d: type=%s, offset=%d, length=%d, url=%s", i, entity.Type, entity.Offset, entity.Length, entity.URL)
-			}
-		}
-	} else {
-		log.Printf("No entities found in template %d", template.ID)
-	}
-
-	// Use the enhanced SendMessageWithTemplate method that properly handles entities
-	return s.SendMessageWithTemplate(channelID, template, entities)
-}
-
-// deleteMessage deletes a message from a channel
-func (s *MessageService) deleteMessage(channelID, messageID string) error {
-	chatID, err := strconv.ParseInt(channelID, 10, 64)
-	if err != nil {
-		return fmt.Errorf("invalid channel ID: %s", channelID)
-	}
-
-	msgID, err := strconv.Atoi(messageID)
-	if err != nil {
-		return fmt.Errorf("invalid message ID: %s", messageID)
-	}
-
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, msgID)
-	_, err = s.api.Request(deleteMsg)
-	if err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
-	}
-
-	return nil
-}
-
-// PinMessage pins a message in a channel and deletes the pin notification
-func (s *MessageService) PinMessage(channelID string, messageID string) error {
-	chatID, err := strconv.ParseInt(channelID, 10, 64)
-	if err != nil {
-		// Try as username
-		chatID = 0
-	}
-
-	msgID, err := strconv.Atoi(messageID)
-	if err != nil {
-		return fmt.Errorf("invalid message ID: %w", err)
-	}
-
-	var pinConfig tgbotapi.PinChatMessageConfig
-	if chatID != 0 {
-		pinConfig = tgbotapi.PinChatMessageConfig{
-			ChatID:              chatID,
-			MessageID:           msgID,
-			DisableNotification: true, // Pin silently to avoid spam
-		}
-	} else {
-		pinConfig = tgbotapi.PinChatMessageConfig{
-			ChannelUsername:     channelID,
-			MessageID:           msgID,
-			DisableNotification: true, // Pin silently to avoid spam
-		}
-	}
-
-	// Pin the message
-	_, err = s.api.Request(pinConfig)
-	if err != nil {
-		return fmt.Errorf("failed to pin message in channel %s: %w", channelID, err)
-	}
-
-	log.Printf("Successfully pinned message %s in channel %s", messageID, channelID)
-
-	// Delete the pin notification message (next message ID after pinned message)
-	// Pin notification always gets the next sequential message ID
-	go s.deletePinNotificationPrecise(channelID, chatID, msgID+1)
-	return nil
-}
-
-// deletePinNotificationPrecise deletes the pin notification with exact message ID
-func (s *MessageService) deletePinNotificationPrecise(channelID string, chatID int64, notificationMsgID int) {
-	log.Printf("Starting pin notification deletion for channel %s, expected notification ID: %d", channelID, notificationMsgID)
-
-	// Try multiple times with increasing delays for high-concurrency scenarios
-	maxRetries := 3
-	baseDelay := 2 * time.Second
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Wait longer for high-concurrency scenarios
-		waitTime := time.Duration(attempt) * baseDelay
-		log.Printf("Attempt %d/%d: Waiting %v for pin notification to appear", attempt, maxRetries, waitTime)
-		time.Sleep(waitTime)
-
-		// Try to delete the exact notification message ID
-		if s.tryDeleteMessage(channelID, chatID, notificationMsgID) {
-			log.Printf("Successfully deleted pin notification %d in channel %s on attempt %d", notificationMsgID, channelID, attempt)
-			return
-		}
-
-		// Also try nearby message IDs in case of ID calculation errors
-		for offset := 1; offset <= 2; offset++ {
-			if s.tryDeleteMessage(channelID, chatID, notificationMsgID+offset) {
-				log.Printf("Successfully deleted pin notification %d (offset +%d) in channel %s on attempt %d",
-					notificationMsgID+offset, offset, channelID, attempt)
-				return
-			}
-			if s.tryDeleteMessage(channelID, chatID, notificationMsgID-offset) {
-				log.Printf("Successfully deleted pin notification %d (offset -%d) in channel %s on attempt %d",
-					notificationMsgID-offset, offset, channelID, attempt)
-				return
-			}
-		}
-
-		log.Printf("Attempt %d/%d failed to delete pin notification around ID %d in channel %s",
-			attempt, maxRetries, notificationMsgID, channelID)
-	}
-
-	log.Printf("Failed to delete pin notification after %d attempts for channel %s, notification ID %d",
-		maxRetries, channelID, notificationMsgID)
-}
-
-// deletePinNotification attempts to delete the "pinned a message" notification (legacy method)
-func (s *MessageService) deletePinNotification(channelID string, chatID int64, pinnedMsgID int) {
-	// Wait a moment for the pin notification to appear
-	time.Sleep(2 * time.Second)
-
-	// Try to delete potential pin notification messages
-	// Pin notifications usually appear as the next message ID after the pinned message
-	// We'll try a range of potential IDs since message IDs might not be strictly sequential
-
-	maxAttempts := 5
-	for i := 1; i <= maxAttempts; i++ {
-		potentialNotificationID := pinnedMsgID + i
-
-		if s.tryDeleteMessage(channelID, chatID, potentialNotificationID) {
-			log.Printf("Successfully deleted pin notification %d in channel %s", potentialNotificationID, channelID)
-			return // Found and deleted the notification, we're done
-		}
-	}
-
-	log.Printf("Could not find pin notification to delete in channel %s", channelID)
-}
-
-// tryDeleteMessage attempts to delete a message and returns true if successful
-func (s *MessageService) tryDeleteMessage(channelID string, chatID int64, messageID int) bool {
-	var deleteConfig tgbotapi.DeleteMessageConfig
-	if chatID != 0 {
-		deleteConfig = tgbotapi.NewDeleteMessage(chatID, messageID)
-	} else {
-		deleteConfig = tgbotapi.DeleteMessageConfig{
-			ChannelUsername: channelID,
-			MessageID:       messageID,
-		}
-	}
-
-	_, err := s.api.Request(deleteConfig)
-	if err != nil {
-		// Log at debug level to avoid spam
-		log.Printf("Debug: Could not delete message %d in channel %s: %v", messageID, channelID, err)
-		return false
-	}
-
-	return true
-}
-
-// deleteChannelMessages deletes all tracked messages from a channel
-func (s *MessageService) deleteChannelMessages(channel models.Channel) error {
-	// Delete last repost message if exists
-	if channel.LastMessageID != "" {
-		if err := s.deleteMessage(channel.ChannelID, channel.LastMessageID); err != nil {
-			log.Printf("Failed to delete last message in channel %s: %v", channel.ChannelID, err)
-		} else {
-			// Clear last message ID
-			s.repo.UpdateChannelLastMessageID(channel.ChannelID, "")
-		}
-	}
-
-	// Get recent send records for this channel
-	records, err := s.repo.GetSendRecordsByGroupID(channel.GroupID, 50)
-	if err != nil {
-		return fmt.Errorf("failed to get send records: %w", err)
-	}
-
-	// Delete messages from records
-	for _, record := range records {
-		if record.ChannelID == channel.ChannelID && record.MessageID != "" && record.Status == models.SendStatusSent {
-			if err := s.deleteMessage(channel.ChannelID, record.MessageID); err != nil {
-				log.Printf("Failed to delete message %s in channel %s: %v", record.MessageID, channel.ChannelID, err)
-			}
-		}
-	}
-
-	return nil
-}
-
-// createInlineKeyboard creates an inline keyboard from button data
-func (s *MessageService) createInlineKeyboard(buttons models.InlineKeyboard) tgbotapi.InlineKeyboardMarkup {
-	var keyboard [][]tgbotapi.InlineKeyboardButton
-
-	for _, row := range buttons {
-		var keyboardRow []tgbotapi.InlineKeyboardButton
-		for _, button := range row {
-			keyboardRow = append(keyboardRow, tgbotapi.NewInlineKeyboardButtonURL(button.Text, button.URL))
-		}
-		keyboard = append(keyboard, keyboardRow)
-	}
-
-	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
-}
-
-// recordSendSuccess records a successful send operation
-func (s *MessageService) recordSendSuccess(groupID int64, channelID, messageID string, sendType models.SendType) {
-	now := time.Now()
-	record := &models.SendRecord{
-		GroupID:     groupID,
-		ChannelID:   channelID,
-		MessageID:   messageID,
-		MessageType: sendType,
-		Status:      models.SendStatusSent,
-		ScheduledAt: now,
-		SentAt:      &now,
-	}
-
-	if err := s.repo.CreateSendRecord(record); err != nil {
-		log.Printf("Failed to record send success: %v", err)
-	}
-}
-
-// recordSendFailure records a failed send operation
-func (s *MessageService) recordSendFailure(groupID int64, channelID string, sendType models.SendType, errorMsg string) {
-	record := &models.SendRecord{
-		GroupID:      groupID,
-		ChannelID:    channelID,
-		MessageType:  sendType,
-		Status:       models.SendStatusFailed,
-		ErrorMessage: models.StringPtr(errorMsg),
-		ScheduledAt:  time.Now(),
-	}
-
-	if err := s.repo.CreateSendRecord(record); err != nil {
-		log.Printf("Failed to record send failure: %v", err)
-	}
-}
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tg-channel-repost-bot/internal/database"
+	"tg-channel-repost-bot/internal/models"
+	"tg-channel-repost-bot/pkg/config"
+	"tg-channel-repost-bot/pkg/entityutil"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram's length limits, in UTF-16 code units
+const (
+	MaxTextLength    = 4096
+	MaxCaptionLength = 1024
+)
+
+// errSplitMessage is reported for published messages that cannot be edited in place because
+// they were, or would have to be, split into several messages
+var errSplitMessage = fmt.Errorf("message is split into several parts and cannot be edited in place")
+
+// PublishedEditResult reports how applying a template to one channel's published messages went
+type PublishedEditResult struct {
+	Channel models.Channel
+	Edited  int
+	Failed  int
+	LastErr error
+}
+
+// MessageService handles message operations
+type MessageService struct {
+	api    *tgbotapi.BotAPI
+	repo   *database.Repository
+	config *config.Config
+
+	voteMutex sync.Mutex // Serializes votes so the counts shown are never older than the last vote
+}
+
+// NewMessageService creates a new message service
+func NewMessageService(api *tgbotapi.BotAPI, repo *database.Repository, config *config.Config) *MessageService {
+	return &MessageService{
+		api:    api,
+		repo:   repo,
+		config: config,
+	}
+}
+
+// SendRepost sends a repost message to all channels in a group
+func (s *MessageService) SendRepost(groupID int64) error {
+	// Get channel group
+	group, err := s.repo.GetChannelGroup(groupID)
+	if err != nil {
+		return fmt.Errorf("failed to get channel group: %w", err)
+	}
+
+	if !group.IsActive {
+		return fmt.Errorf("channel group is not active")
+	}
+
+	// Get channels, including those joining by the group's tag rule
+	s.RefreshTaggedChannels(group)
+	channels, err := s.repo.GetChannelsByGroupID(groupID)
+	if err != nil {
+		return fmt.Errorf("failed to get channels: %w", err)
+	}
+
+	s.StartRepostCycle(group)
+
+	// Send to each channel
+	for _, channel := range channels {
+		template, err := s.ResolveTemplate(group, &channel)
+		if err != nil {
+			return fmt.Errorf("failed to get message template: %w", err)
+		}
+
+		if err := s.sendRepostToChannel(group, channel, template); err != nil {
+			log.Printf("Failed to send repost to channel %s: %v", channel.ChannelID, err)
+			// Record failure
+			s.recordSendFailure(groupID, channel.ChannelID, template, models.SendTypeRepost, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// SendPush sends a push message to all channels in a group
+func (s *MessageService) SendPush(groupID int64) error {
+	// Get channel group
+	group, err := s.repo.GetChannelGroup(groupID)
+	if err != nil {
+		return fmt.Errorf("failed to get channel group: %w", err)
+	}
+
+	if !group.IsActive {
+		return fmt.Errorf("channel group is not active")
+	}
+
+	// Get channels, including those joining by the group's tag rule
+	s.RefreshTaggedChannels(group)
+	channels, err := s.repo.GetChannelsByGroupID(groupID)
+	if err != nil {
+		return fmt.Errorf("failed to get channels: %w", err)
+	}
+
+	// Send to each channel
+	for _, channel := range channels {
+		template, err := s.ResolveTemplate(group, &channel)
+		if err != nil {
+			return fmt.Errorf("failed to get message template: %w", err)
+		}
+
+		if err := s.sendPushToChannel(channel, template); err != nil {
+			log.Printf("Failed to send push to channel %s: %v", channel.ChannelID, err)
+			// Record failure
+			s.recordSendFailure(groupID, channel.ChannelID, template, models.SendTypePush, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// DeleteGroupMessages deletes every message a channel group published that is not deleted yet
+func (s *MessageService) DeleteGroupMessages(groupID int64) error {
+	result, err := s.CleanupPublished(groupID, time.Time{}, time.Time{}, nil)
+	if err != nil {
+		return err
+	}
+	if result.Failed > 0 {
+		log.Printf("Failed to delete %d of %d messages of group %d", result.Failed, result.Total, groupID)
+	}
+
+	return nil
+}
+
+// ApplyTemplateToPublished edits every currently published message of a group so that it shows
+// the current template (including channel overrides). Published messages are the channel's last
+// repost and its successfully sent pushes; earlier reposts have already been replaced, and
+// messages the ledger marks deleted are skipped.
+func (s *MessageService) ApplyTemplateToPublished(groupID int64) ([]PublishedEditResult, error) {
+	group, err := s.repo.GetChannelGroup(groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel group: %w", err)
+	}
+
+	channels, err := s.repo.GetChannelsByGroupID(groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+
+	var results []PublishedEditResult
+	for _, channel := range channels {
+		result := PublishedEditResult{Channel: channel}
+
+		template, err := s.ResolveTemplate(group, &channel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get message template: %w", err)
+		}
+		entities := s.parseTemplateEntities(template)
+		fits := MessageCount(template) == 1
+
+		// Deleted messages are skipped like messages already listed
+		seen, err := s.repo.GetDeletedPublishedMessageIDs(channel.ChannelID)
+		if err != nil {
+			log.Printf("Failed to load deleted messages for channel %s: %v", channel.ChannelID, err)
+			seen = make(map[string]bool)
+		}
+
+		var messages []models.SentMessage
+		if channel.LastMessageID != "" && !seen[channel.LastMessageID] {
+			messages = append(messages, channel.LastMessage())
+			seen[channel.LastMessageID] = true
+		}
+
+		records, err := s.repo.GetSentSendRecordsByGroupAndChannel(groupID, channel.ChannelID, models.SendTypePush)
+		if err != nil {
+			log.Printf("Failed to load push records for channel %s: %v", channel.ChannelID, err)
+		}
+		for _, record := range records {
+			if !seen[record.MessageID] {
+				messages = append(messages, models.SentMessage{MessageID: record.MessageID, PartIDs: record.PartMessageIDs})
+				seen[record.MessageID] = true
+			}
+		}
+
+		for i, message := range messages {
+			// Split messages cannot be turned into a single message or back by editing
+			if !fits || len(message.PartIDs) > 0 {
+				result.Failed++
+				result.LastErr = errSplitMessage
+				continue
+			}
+
+			// Rate limiting: delay between edits to avoid API limits
+			if i > 0 {
+				time.Sleep(200 * time.Millisecond)
+			}
+
+			messageID := message.MessageID
+			if err := s.EditMessageWithTemplate(channel.ChannelID, messageID, template, entities); err != nil {
+				log.Printf("Failed to apply template to message %s in channel %s: %v", messageID, channel.ChannelID, err)
+				result.Failed++
+				result.LastErr = err
+				continue
+			}
+			result.Edited++
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ResolveTemplate returns the template to send to a channel of a group.
+// A channel may override the group's template and/or its buttons; an override template without
+// buttons keeps those of the group's template. The group's footer is appended to whichever
+// template is used, and the group's send options are carried along.
+// With a channel, URL buttons are wrapped in tracked links when click tracking is enabled.
+// Groups running an A/B test send the channel's variant unless the channel has its own template.
+// The translation matching the channel's language is used when the template has one.
+func (s *MessageService) ResolveTemplate(group *models.ChannelGroup, channel *models.Channel) (*models.MessageTemplate, error) {
+	template, err := s.resolveVariant(group, channel)
+	if err != nil {
+		return nil, err
+	}
+	template.Options = group.SendOptions
+
+	if channel == nil {
+		return s.applyFooter(group, template), nil
+	}
+
+	if channel.TemplateID != 0 {
+		override, err := s.repo.GetMessageTemplate(channel.TemplateID)
+		if err != nil {
+			log.Printf("Failed to load override template %d for channel %s, using group template: %v", channel.TemplateID, channel.ChannelID, err)
+		} else {
+			override.Options = group.SendOptions
+			// An override without buttons of its own keeps the buttons of the group's template
+			if len(override.Buttons) == 0 {
+				override.Buttons = template.Buttons
+			}
+			template = override
+		}
+	}
+	template = template.Localize(channel.Language)
+
+	if len(channel.Buttons) > 0 {
+		resolved := *template
+		resolved.Buttons = channel.Buttons
+		template = &resolved
+	}
+
+	return s.TrackButtons(group, channel.ChannelID, s.applyFooter(group, template)), nil
+}
+
+// resolveVariant loads the group template variant a channel is sent; variant B falls back to the
+// group's template when it cannot be loaded
+func (s *MessageService) resolveVariant(group *models.ChannelGroup, channel *models.Channel) (*models.MessageTemplate, error) {
+	if !group.HasVariants() {
+		return s.repo.GetMessageTemplate(group.MessageID)
+	}
+
+	variant := group.VariantFor(channel)
+	if variant == models.VariantB {
+		template, err := s.repo.GetMessageTemplate(group.VariantTemplateID)
+		if err == nil {
+			template.Variant = models.VariantB
+			return template, nil
+		}
+		log.Printf("Failed to load variant template %d of group %d, using variant A: %v", group.VariantTemplateID, group.ID, err)
+	}
+
+	template, err := s.repo.GetMessageTemplate(group.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	template.Variant = models.VariantA
+	return template, nil
+}
+
+// StartRepostCycle counts a new repost cycle of a group, switching the variant of an alternating
+// A/B test
+func (s *MessageService) StartRepostCycle(group *models.ChannelGroup) {
+	if !group.HasVariants() || group.VariantMode != models.VariantModeAlternate {
+		return
+	}
+
+	if err := s.repo.AdvanceChannelGroupVariantCycle(group.ID); err != nil {
+		log.Printf("Failed to advance variant cycle of group %d: %v", group.ID, err)
+		return
+	}
+	group.VariantCycle++
+}
+
+// applyFooter returns a copy of a stored template with the group's footer merged in,
+// re-serializing the combined entities
+func (s *MessageService) applyFooter(group *models.ChannelGroup, template *models.MessageTemplate) *models.MessageTemplate {
+	if group.FooterText == "" && len(group.FooterButtons) == 0 {
+		return template
+	}
+
+	resolved, entities := s.ApplyFooter(group, template, s.parseTemplateEntities(template))
+	resolved.Entities = ""
+	if len(entities) > 0 {
+		entitiesBytes, err := json.Marshal(entities)
+		if err != nil {
+			log.Printf("Failed to serialize entities with footer for group %d: %v", group.ID, err)
+		} else {
+			resolved.Entities = string(entitiesBytes)
+		}
+	}
+
+	return resolved
+}
+
+// ApplyFooter returns a copy of the template with the group's footer text appended to the
+// content and the footer buttons appended to the keyboard, together with the entities of the
+// combined text. Footer entities are shifted past the template content so both keep their formatting.
+// Poll questions are too short for a footer, so polls only take the footer buttons.
+func (s *MessageService) ApplyFooter(group *models.ChannelGroup, template *models.MessageTemplate, entities []tgbotapi.MessageEntity) (*models.MessageTemplate, []tgbotapi.MessageEntity) {
+	resolved := *template
+	combined := append([]tgbotapi.MessageEntity(nil), entities...)
+
+	if group.FooterText != "" && template.MessageType != models.MessageTypePoll {
+		separator := ""
+		if template.Content != "" {
+			separator = "\n\n"
+		}
+		offset := entityutil.UTF16Len(template.Content + separator)
+
+		if group.FooterEntities != "" {
+			var footerEntities []tgbotapi.MessageEntity
+			if err := json.Unmarshal([]byte(group.FooterEntities), &footerEntities); err != nil {
+				log.Printf("Failed to deserialize footer entities for group %d: %v", group.ID, err)
+			}
+			combined = append(combined, entityutil.Shift(footerEntities, offset)...)
+		}
+
+		resolved.Content = template.Content + separator + group.FooterText
+	}
+
+	if len(group.FooterButtons) > 0 {
+		buttons := make(models.InlineKeyboard, 0, len(template.Buttons)+len(group.FooterButtons))
+		buttons = append(buttons, template.Buttons...)
+		resolved.Buttons = append(buttons, group.FooterButtons...)
+	}
+
+	return &resolved, combined
+}
+
+// SendMessage sends a message to a channel (exported wrapper)
+func (s *MessageService) SendMessage(channelID string, template *models.MessageTemplate) (models.SentMessage, error) {
+	return s.sendMessage(channelID, template)
+}
+
+// DeleteMessage deletes a message from a channel (exported wrapper)
+func (s *MessageService) DeleteMessage(channelID, messageID string) error {
+	return s.deleteMessage(channelID, messageID)
+}
+
+// SendMessageWithEntities sends a message with entities to a channel
+func (s *MessageService) SendMessageWithEntities(channelID, content string, entities []tgbotapi.MessageEntity) (string, error) {
+	log.Printf("SendMessageWithEntities called for channel %s with %d entities", channelID, len(entities))
+
+	chatID, err := strconv.ParseInt(channelID, 10, 64)
+	if err != nil {
+		// Try as username
+		chatID = 0
+	}
+
+	var msg tgbotapi.Chattable
+
+	if chatID != 0 {
+		textMsg := tgbotapi.NewMessage(chatID, content)
+		if entities != nil && len(entities) > 0 {
+			log.Printf("Setting %d entities for numeric chat ID %d", len(entities), chatID)
+			textMsg.Entities = entities
+		}
+		textMsg.DisableWebPagePreview = true // 关闭URL预览
+		msg = textMsg
+	} else {
+		textMsg := tgbotapi.NewMessageToChannel(channelID, content)
+		if entities != nil && len(entities) > 0 {
+			log.Printf("Setting %d entities for channel username %s", len(entities), channelID)
+			textMsg.Entities = entities
+		}
+		textMsg.DisableWebPagePreview = true // 关闭URL预览
+		msg = textMsg
+	}
+
+	sentMsg, err := s.api.Send(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to send message to channel %s: %w", channelID, err)
+	}
+
+	log.Printf("Message sent successfully with ID %d", sentMsg.MessageID)
+	return strconv.Itoa(sentMsg.MessageID), nil
+}
+
+// SendTemplate sends a template to a channel, splitting content over Telegram's length limits:
+// long text is sent as several messages in order, and a long photo caption keeps its first part
+// as the caption with the rest following as text messages. The keyboard is attached to the last
+// message. When a part fails, the parts already sent are deleted so that a retry starts clean.
+func (s *MessageService) SendTemplate(channelID string, template *models.MessageTemplate, entities []tgbotapi.MessageEntity) (models.SentMessage, error) {
+	if entityutil.UTF16Len(template.Content) <= maxLengthOf(template) {
+		messageID, err := s.SendMessageWithTemplate(channelID, template, entities)
+		return models.SentMessage{MessageID: messageID}, err
+	}
+
+	// Splitting needs entities that fit the text
+	if err := entityutil.Validate(template.Content, entities); err != nil {
+		log.Printf("WARNING: Repairing invalid entities for channel %s: %v", channelID, err)
+		entities = entityutil.Repair(template.Content, entities)
+	}
+	parts := splitTemplate(template, entities)
+	log.Printf("Content of %d UTF-16 units exceeds the limit, sending %d parts to channel %s", entityutil.UTF16Len(template.Content), len(parts), channelID)
+
+	var sent models.SentMessage
+	for i, part := range parts {
+		partTemplate := *template
+		partTemplate.Content = part.Text
+		if i > 0 {
+			partTemplate.MessageType = models.MessageTypeText
+			partTemplate.MediaURL = ""
+		}
+		if i < len(parts)-1 {
+			partTemplate.Buttons = nil
+		}
+
+		messageID, err := s.SendMessageWithTemplate(channelID, &partTemplate, part.Entities)
+		if err != nil {
+			s.deleteMessages(channelID, sent.IDs())
+			return models.SentMessage{}, fmt.Errorf("failed to send part %d/%d: %w", i+1, len(parts), err)
+		}
+
+		if i == 0 {
+			sent.MessageID = messageID
+		} else {
+			sent.PartIDs = append(sent.PartIDs, messageID)
+		}
+	}
+
+	return sent, nil
+}
+
+// MessageCount returns the number of messages a template is sent as
+func MessageCount(template *models.MessageTemplate) int {
+	if entityutil.UTF16Len(template.Content) <= maxLengthOf(template) {
+		return 1
+	}
+	return len(splitTemplate(template, nil))
+}
+
+// maxLengthOf returns the length limit of a template's content: the caption limit for media,
+// the question limit for polls, the text limit otherwise
+func maxLengthOf(template *models.MessageTemplate) int {
+	switch template.MessageType {
+	case models.MessageTypePhoto:
+		return MaxCaptionLength
+	case models.MessageTypePoll:
+		return MaxPollQuestionLength
+	default:
+		return MaxTextLength
+	}
+}
+
+// splitTemplate splits a template's content into the parts it is sent as; the first part is
+// limited like the template itself, follow-up parts are text messages
+func splitTemplate(template *models.MessageTemplate, entities []tgbotapi.MessageEntity) []entityutil.Part {
+	head, rest := entityutil.SplitHead(template.Content, entities, maxLengthOf(template))
+	return append([]entityutil.Part{head}, entityutil.Split(rest.Text, rest.Entities, MaxTextLength)...)
+}
+
+// SendMessageWithTemplate sends a message with template (including buttons) and entities to a
+// channel as a single message; use SendTemplate for content that may exceed Telegram's limits.
+// The template's send options are applied.
+func (s *MessageService) SendMessageWithTemplate(channelID string, template *models.MessageTemplate, entities []tgbotapi.MessageEntity) (string, error) {
+	log.Printf("SendMessageWithTemplate called for channel %s with %d entities and %d button rows, message type: %s", channelID, len(entities), len(template.Buttons), template.MessageType)
+
+	// Debug: Log content and entities details
+	log.Printf("Message content: '%s' (length: %d UTF-16 units)", template.Content, entityutil.UTF16Len(template.Content))
+	for i, entity := range entities {
+		log.Printf("Entity %d: type=%s, offset=%d, length=%d, url=%s, text='%s'", i, entity.Type, entity.Offset, entity.Length, entity.URL, entityutil.Slice(template.Content, entity))
+	}
+
+	// Telegram rejects the whole message when an entity does not fit the text
+	if err := entityutil.Validate(template.Content, entities); err != nil {
+		log.Printf("WARNING: Repairing invalid entities for channel %s: %v", channelID, err)
+		entities = entityutil.Repair(template.Content, entities)
+	}
+
+	// The send options are newer than the bot library, so the request is built directly
+	params := make(tgbotapi.Params)
+	addChatParam(params, channelID)
+	addSendOptionParams(params, template.Options)
+	if len(template.Buttons) > 0 {
+		if err := params.AddInterface("reply_markup", s.createInlineKeyboard(template.Buttons)); err != nil {
+			return "", fmt.Errorf("failed to encode buttons: %w", err)
+		}
+		log.Printf("Added %d button rows to %s message", len(template.Buttons), template.MessageType)
+	}
+
+	// Handle different message types
+	var method string
+	switch template.MessageType {
+	case models.MessageTypePhoto:
+		method = "sendPhoto"
+		params["photo"] = template.MediaURL
+		params.AddNonEmpty("caption", template.Content)
+		// Use entities for formatting, no ParseMode needed
+		if len(entities) > 0 {
+			log.Printf("Setting %d caption entities for photo message to channel %s", len(entities), channelID)
+			if err := params.AddInterface("caption_entities", entities); err != nil {
+				return "", fmt.Errorf("failed to encode caption entities: %w", err)
+			}
+		}
+		params.AddBool("has_spoiler", template.Options.MediaSpoiler)
+
+	case models.MessageTypePoll:
+		method = "sendPoll"
+		if err := AddPollParams(params, template); err != nil {
+			return "", err
+		}
+
+	default: // MessageTypeText
+		method = "sendMessage"
+		params["text"] = template.Content
+		// Use entities for formatting, no ParseMode needed
+		if len(entities) > 0 {
+			log.Printf("Setting %d entities for text message to channel %s", len(entities), channelID)
+			if err := params.AddInterface("entities", entities); err != nil {
+				return "", fmt.Errorf("failed to encode entities: %w", err)
+			}
+		}
+		if err := params.AddInterface("link_preview_options", linkPreviewOptions(template.Options)); err != nil {
+			return "", fmt.Errorf("failed to encode link preview options: %w", err)
+		}
+	}
+
+	resp, err := s.api.MakeRequest(method, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to send message to channel %s: %w", channelID, err)
+	}
+
+	var sentMsg tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &sentMsg); err != nil {
+		return "", fmt.Errorf("failed to decode sent message: %w", err)
+	}
+
+	log.Printf("Message sent successfully with ID %d", sentMsg.MessageID)
+	s.registerVoteMessage(&sentMsg, template)
+	s.registerPollMessage(channelID, &sentMsg)
+	return strconv.Itoa(sentMsg.MessageID), nil
+}
+
+// addChatParam adds the target chat, given as a numeric ID or a channel username
+func addChatParam(params tgbotapi.Params, channelID string) {
+	if chatID, err := strconv.ParseInt(channelID, 10, 64); err == nil {
+		params.AddNonZero64("chat_id", chatID)
+	} else {
+		params["chat_id"] = channelID
+	}
+}
+
+// addSendOptionParams adds the notification and content protection flags of the send options
+func addSendOptionParams(params tgbotapi.Params, options models.SendOptions) {
+	params.AddBool("disable_notification", options.Silent)
+	params.AddBool("protect_content", options.ProtectContent)
+}
+
+// linkPreviewOptions returns the Bot API link_preview_options for the send options
+func linkPreviewOptions(options models.SendOptions) map[string]bool {
+	if !options.ShowsLinkPreview() {
+		return map[string]bool{"is_disabled": true}
+	}
+	return map[string]bool{"show_above_text": options.LinkPreview == models.LinkPreviewAbove}
+}
+
+// EditMessageWithTemplate edits a previously sent message in place so that it matches the template.
+// Text templates edit the message text, photo templates replace the media and caption; the
+// inline keyboard is replaced in the same call. Link preview and spoiler options are applied;
+// notification and protection flags only apply when a message is sent. Polls cannot be edited.
+func (s *MessageService) EditMessageWithTemplate(channelID, messageID string, template *models.MessageTemplate, entities []tgbotapi.MessageEntity) error {
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %s", messageID)
+	}
+	if template.MessageType == models.MessageTypePoll {
+		return errPollNotEditable
+	}
+
+	if err := entityutil.Validate(template.Content, entities); err != nil {
+		log.Printf("WARNING: Repairing invalid entities for message %s in channel %s: %v", messageID, channelID, err)
+		entities = entityutil.Repair(template.Content, entities)
+	}
+
+	params := make(tgbotapi.Params)
+	addChatParam(params, channelID)
+	params.AddNonZero("message_id", msgID)
+	if len(template.Buttons) > 0 {
+		if err := params.AddInterface("reply_markup", s.createInlineKeyboard(template.Buttons)); err != nil {
+			return fmt.Errorf("failed to encode buttons: %w", err)
+		}
+	}
+
+	var method string
+	switch template.MessageType {
+	case models.MessageTypePhoto:
+		method = "editMessageMedia"
+		media := map[string]interface{}{
+			"type":    "photo",
+			"media":   template.MediaURL,
+			"caption": template.Content,
+		}
+		if len(entities) > 0 {
+			media["caption_entities"] = entities
+		}
+		if template.Options.MediaSpoiler {
+			media["has_spoiler"] = true
+		}
+		if err := params.AddInterface("media", media); err != nil {
+			return fmt.Errorf("failed to encode media: %w", err)
+		}
+
+	default: // MessageTypeText
+		method = "editMessageText"
+		params["text"] = template.Content
+		if len(entities) > 0 {
+			if err := params.AddInterface("entities", entities); err != nil {
+				return fmt.Errorf("failed to encode entities: %w", err)
+			}
+		}
+		if err := params.AddInterface("link_preview_options", linkPreviewOptions(template.Options)); err != nil {
+			return fmt.Errorf("failed to encode link preview options: %w", err)
+		}
+	}
+
+	resp, err := s.api.MakeRequest(method, params)
+	if err != nil {
+		// Telegram rejects edits that would leave the message unchanged; the message already matches
+		if strings.Contains(err.Error(), "message is not modified") {
+			log.Printf("Message %s in channel %s is already up to date", messageID, channelID)
+			return nil
+		}
+		return fmt.Errorf("failed to edit message %s in channel %s: %w", messageID, channelID, err)
+	}
+
+	log.Printf("Message %s in channel %s edited successfully", messageID, channelID)
+
+	// The edit resets the keyboard, so vote counts are shown again
+	var edited tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &edited); err != nil {
+		log.Printf("Failed to decode edited message %s in channel %s: %v", messageID, channelID, err)
+		return nil
+	}
+	s.registerVoteMessage(&edited, template)
+	return nil
+}
+
+// ReplaceRepost replaces the previous repost in a channel according to the group's repost mode.
+// In edit mode the previous message is edited in place, falling back to delete+send when the edit
+// fails or the message is gone; split messages and polls are always deleted and sent again, a
+// replaced poll being closed first so that its final results are recorded. It returns the
+// messages now showing the template and whether they were edited rather than newly sent.
+func (s *MessageService) ReplaceRepost(group *models.ChannelGroup, channel *models.Channel, template *models.MessageTemplate) (models.SentMessage, bool, error) {
+	entities := s.parseTemplateEntities(template)
+
+	if group.RepostMode == models.RepostModeEdit && channel.LastMessageID != "" &&
+		len(channel.LastMessageParts) == 0 && MessageCount(template) == 1 && template.MessageType != models.MessageTypePoll {
+		err := s.EditMessageWithTemplate(channel.ChannelID, channel.LastMessageID, template, entities)
+		if err == nil {
+			return channel.LastMessage(), true, nil
+		}
+		log.Printf("Failed to edit previous message in channel %s, falling back to delete and send: %v", channel.ChannelID, err)
+	}
+
+	// Delete previous message and all its parts if exists, keeping the final results of a poll
+	if channel.LastMessageID != "" {
+		s.ClosePoll(channel.ChannelID, channel.LastMessageID)
+		s.deleteMessages(channel.ChannelID, channel.LastMessage().IDs())
+	}
+
+	sent, err := s.SendTemplate(channel.ChannelID, template, entities)
+	if err != nil {
+		return models.SentMessage{}, false, err
+	}
+
+	return sent, false, nil
+}
+
+// MessageKind returns a short type name of a message, such as "text", "photo" or "poll"
+func MessageKind(message *tgbotapi.Message) string {
+	switch {
+	case message.Text != "":
+		return "text"
+	case len(message.Photo) > 0:
+		return "photo"
+	case message.Video != nil:
+		return "video"
+	case message.Animation != nil:
+		return "animation"
+	case message.Document != nil:
+		return "document"
+	case message.Audio != nil:
+		return "audio"
+	case message.Voice != nil:
+		return "voice"
+	case message.VideoNote != nil:
+		return "video_note"
+	case message.Sticker != nil:
+		return "sticker"
+	case message.Poll != nil:
+		return "poll"
+	case message.Venue != nil:
+		return "venue"
+	case message.Location != nil:
+		return "location"
+	case message.Contact != nil:
+		return "contact"
+	case message.Dice != nil:
+		return "dice"
+	default:
+		return "message"
+	}
+}
+
+// CopyOptions customizes a copied message
+type CopyOptions struct {
+	Keyboard        models.InlineKeyboard    // Replaces the message's inline keyboard when not empty
+	StripKeyboard   bool                     // Removes the message's inline keyboard
+	Caption         string                   // Replaces the caption when not empty
+	CaptionEntities []tgbotapi.MessageEntity // Entities of the replaced caption
+	Send            models.SendOptions       // Notification and content protection flags
+}
+
+// CopyMessage copies a message of any type from a chat to a channel without a forward header
+func (s *MessageService) CopyMessage(channelID string, fromChatID int64, messageID int, options CopyOptions) (string, error) {
+	params := make(tgbotapi.Params)
+	addChatParam(params, channelID)
+	params.AddNonZero64("from_chat_id", fromChatID)
+	params.AddNonZero("message_id", messageID)
+	params.AddNonEmpty("caption", options.Caption)
+	if len(options.CaptionEntities) > 0 {
+		if err := params.AddInterface("caption_entities", options.CaptionEntities); err != nil {
+			return "", fmt.Errorf("failed to encode caption entities: %w", err)
+		}
+	}
+	addSendOptionParams(params, options.Send)
+
+	var markup interface{}
+	if len(options.Keyboard) > 0 {
+		markup = s.createInlineKeyboard(options.Keyboard)
+	} else if options.StripKeyboard {
+		markup = tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	}
+	if err := params.AddInterface("reply_markup", markup); err != nil {
+		return "", fmt.Errorf("failed to encode buttons: %w", err)
+	}
+
+	resp, err := s.api.MakeRequest("copyMessage", params)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy message to channel %s: %w", channelID, err)
+	}
+
+	var copied tgbotapi.MessageID
+	if err := json.Unmarshal(resp.Result, &copied); err != nil {
+		return "", fmt.Errorf("failed to decode copied message ID: %w", err)
+	}
+
+	log.Printf("Message %d copied to channel %s as %d", messageID, channelID, copied.MessageID)
+	return strconv.Itoa(copied.MessageID), nil
+}
+
+// CopyMessages copies several messages (such as an album) from a chat to a channel in one call,
+// keeping albums grouped. Message IDs must be in ascending order.
+func (s *MessageService) CopyMessages(channelID string, fromChatID int64, messageIDs []int, options models.SendOptions) ([]string, error) {
+	if len(messageIDs) == 0 {
+		return nil, fmt.Errorf("no messages to copy")
+	}
+
+	params := make(tgbotapi.Params)
+	addChatParam(params, channelID)
+	params.AddNonZero64("from_chat_id", fromChatID)
+	if err := params.AddInterface("message_ids", messageIDs); err != nil {
+		return nil, fmt.Errorf("failed to encode message IDs: %w", err)
+	}
+	addSendOptionParams(params, options)
+
+	resp, err := s.api.MakeRequest("copyMessages", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy messages to channel %s: %w", channelID, err)
+	}
+
+	var copied []tgbotapi.MessageID
+	if err := json.Unmarshal(resp.Result, &copied); err != nil {
+		return nil, fmt.Errorf("failed to decode copied message IDs: %w", err)
+	}
+
+	ids := make([]string, len(copied))
+	for i, id := range copied {
+		ids[i] = strconv.Itoa(id.MessageID)
+	}
+
+	log.Printf("Copied %d messages to channel %s", len(ids), channelID)
+	return ids, nil
+}
+
+// CopyWithRewrite copies source messages (a single message, or all items of an album sorted by
+// message ID) to a channel, applying a group's rewrite rules. Texts that were rewritten are sent
+// as new messages since copies cannot change a message's text; captions are replaced on copy.
+// Texts and captions the rules remove entirely are copied unchanged, as Telegram rejects them.
+// A non-empty keyboard replaces the original one and the send options of the target group are
+// applied. It returns the IDs of the messages sent.
+func (s *MessageService) CopyWithRewrite(channelID string, rules []models.RewriteRule, messages []*tgbotapi.Message, keyboard models.InlineKeyboard, sendOptions models.SendOptions) ([]string, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages to copy")
+	}
+	fromChatID := messages[0].Chat.ID
+
+	if len(messages) > 1 {
+		messageIDs := make([]int, len(messages))
+		for i, message := range messages {
+			messageIDs[i] = message.MessageID
+		}
+
+		copiedIDs, err := s.CopyMessages(channelID, fromChatID, messageIDs, sendOptions)
+		if err != nil || len(rules) == 0 {
+			return copiedIDs, err
+		}
+
+		// Albums are copied as a whole, so rewrite the caption on the copy afterwards
+		for i, message := range messages {
+			if message.Caption == "" || i >= len(copiedIDs) {
+				continue
+			}
+			result := ApplyRewriteRules(rules, message.Caption, message.CaptionEntities)
+			if result.Changed {
+				if err := s.editCaption(channelID, copiedIDs[i], result.Text, result.Entities); err != nil {
+					log.Printf("Failed to rewrite album caption in channel %s: %v", channelID, err)
+				}
+			}
+		}
+		return copiedIDs, nil
+	}
+
+	message := messages[0]
+	if len(rules) == 0 {
+		messageID, err := s.CopyMessage(channelID, fromChatID, message.MessageID, CopyOptions{Keyboard: keyboard, Send: sendOptions})
+		if err != nil {
+			return nil, err
+		}
+		return []string{messageID}, nil
+	}
+
+	options := CopyOptions{Keyboard: keyboard, Send: sendOptions}
+	text, entities := message.Text, message.Entities
+	if text == "" {
+		text, entities = message.Caption, message.CaptionEntities
+	}
+	result := ApplyRewriteRules(rules, text, entities)
+
+	// Keep the original keyboard with rewritten links unless it is replaced or stripped; a copy
+	// keeps the original keyboard unless told otherwise, so strip it when no button is left
+	if len(options.Keyboard) == 0 {
+		if !result.StripButtons {
+			options.Keyboard = s.rewriteKeyboard(rules, message.ReplyMarkup)
+		}
+		options.StripKeyboard = len(options.Keyboard) == 0 && message.ReplyMarkup != nil
+	}
+
+	if message.Text != "" && result.Changed && result.Text == "" {
+		log.Printf("Rewrite rules removed the whole text of message %d, copying the original text", message.MessageID)
+	} else if message.Text != "" && result.Changed {
+		template := &models.MessageTemplate{
+			Content:     result.Text,
+			MessageType: models.MessageTypeText,
+			Buttons:     options.Keyboard,
+			Options:     sendOptions,
+		}
+		sent, err := s.SendTemplate(channelID, template, result.Entities)
+		if err != nil {
+			return nil, err
+		}
+		return sent.IDs(), nil
+	}
+
+	if message.Caption != "" && result.Changed {
+		if result.Text == "" {
+			log.Printf("Rewrite rules removed the whole caption of message %d, keeping the original caption", message.MessageID)
+		} else {
+			options.Caption = result.Text
+			options.CaptionEntities = result.Entities
+		}
+	}
+
+	messageID, err := s.CopyMessage(channelID, fromChatID, message.MessageID, options)
+	if err != nil {
+		return nil, err
+	}
+	return []string{messageID}, nil
+}
+
+// rewriteKeyboard converts the URL buttons of an original inline keyboard, applying the link rewrite rules;
+// buttons whose link the rules remove are dropped
+func (s *MessageService) rewriteKeyboard(rules []models.RewriteRule, markup *tgbotapi.InlineKeyboardMarkup) models.InlineKeyboard {
+	if markup == nil {
+		return nil
+	}
+
+	var keyboard models.InlineKeyboard
+	for _, row := range markup.InlineKeyboard {
+		var keyboardRow []models.InlineKeyboardButton
+		for _, button := range row {
+			if button.URL == nil {
+				continue
+			}
+			url := RewriteURL(rules, *button.URL)
+			if url == "" {
+				continue
+			}
+			keyboardRow = append(keyboardRow, models.InlineKeyboardButton{Text: button.Text, URL: url})
+		}
+		if len(keyboardRow) > 0 {
+			keyboard = append(keyboard, keyboardRow)
+		}
+	}
+
+	return keyboard
+}
+
+// editCaption replaces the caption of a message in a channel
+func (s *MessageService) editCaption(channelID, messageID, caption string, entities []tgbotapi.MessageEntity) error {
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %s", messageID)
+	}
+
+	edit := tgbotapi.EditMessageCaptionConfig{
+		BaseEdit:        tgbotapi.BaseEdit{MessageID: msgID},
+		Caption:         caption,
+		CaptionEntities: entities,
+	}
+	if chatID, err := strconv.ParseInt(channelID, 10, 64); err == nil {
+		edit.ChatID = chatID
+	} else {
+		edit.ChannelUsername = channelID
+	}
+
+	if _, err := s.api.Request(edit); err != nil {
+		return fmt.Errorf("failed to edit caption of message %s: %w", messageID, err)
+	}
+
+	return nil
+}
+
+// SendMediaGroup sends a media group to a channel
+func (s *MessageService) SendMediaGroup(channelID string, mediaURLs []string, mediaTypes []string, caption string) error {
+	if len(mediaURLs) == 0 {
+		return fmt.Errorf("no media URLs provided")
+	}
+
+	if len(mediaURLs) != len(mediaTypes) {
+		return fmt.Errorf("media URLs and types count mismatch")
+	}
+
+	chatID, err := strconv.ParseInt(channelID, 10, 64)
+	if err != nil {
+		// Try as username
+		chatID = 0
+	}
+
+	// Create media group
+	var mediaGroup []interface{}
+
+	for i, mediaURL := range mediaURLs {
+		mediaType := mediaTypes[i]
+
+		switch mediaType {
+		case "photo":
+			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				// Add caption to first media item
+				media.Caption = caption
+				media.ParseMode = "Markdown"
+			}
+			mediaGroup = append(mediaGroup, media)
+
+		case "video":
+			media := tgbotapi.NewInputMediaVideo(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				// Add caption to first media item
+				media.Caption = caption
+				media.ParseMode = "Markdown"
+			}
+			mediaGroup = append(mediaGroup, media)
+
+		case "document":
+			media := tgbotapi.NewInputMediaDocument(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				// Add caption to first media item
+				media.Caption = caption
+				media.ParseMode = "Markdown"
+			}
+			mediaGroup = append(mediaGroup, media)
+
+		default:
+			// Default to photo for unknown types
+			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				media.Caption = caption
+				media.ParseMode = "Markdown"
+			}
+			mediaGroup = append(mediaGroup, media)
+		}
+	}
+
+	// Send media group
+	var mediaGroupConfig tgbotapi.MediaGroupConfig
+	if chatID != 0 {
+		mediaGroupConfig = tgbotapi.NewMediaGroup(chatID, mediaGroup)
+	} else {
+		mediaGroupConfig = tgbotapi.MediaGroupConfig{
+			ChannelUsername: channelID,
+			Media:           mediaGroup,
+		}
+	}
+
+	_, err = s.api.SendMediaGroup(mediaGroupConfig)
+	if err != nil {
+		return fmt.Errorf("failed to send media group to channel %s: %w", channelID, err)
+	}
+
+	log.Printf("Successfully sent media group with %d items to channel %s", len(mediaURLs), channelID)
+	return nil
+}
+
+// SendMediaGroupWithEntities sends a media group to a channel with entities
+func (s *MessageService) SendMediaGroupWithEntities(channelID string, mediaURLs []string, mediaTypes []string, caption string, entities []tgbotapi.MessageEntity) error {
+	if len(mediaURLs) == 0 {
+		return fmt.Errorf("no media URLs provided")
+	}
+
+	if len(mediaURLs) != len(mediaTypes) {
+		return fmt.Errorf("media URLs and types count mismatch")
+	}
+
+	log.Printf("SendMediaGroupWithEntities: caption='%s', entities count=%d", caption, len(entities))
+	if len(entities) > 0 {
+		for i, entity := range entities {
+			log.Printf("Entity %d: type=%s, offset=%d, length=%d, url=%s", i, entity.Type, entity.Offset, entity.Length, entity.URL)
+		}
+	}
+
+	chatID, err := strconv.ParseInt(channelID, 10, 64)
+	if err != nil {
+		// Try as username
+		chatID = 0
+	}
+
+	// Create media group
+	var mediaGroup []interface{}
+
+	// Only add caption and entities to the first media item
+	for i, mediaURL := range mediaURLs {
+		mediaType := mediaTypes[i]
+
+		switch mediaType {
+		case "photo":
+			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				// Add caption to first media item with entities
+				media.Caption = caption
+				// IMPORTANT: Don't set ParseMode when using entities
+				if len(entities) > 0 {
+					media.CaptionEntities = entities
+					log.Printf("Set %d entities to first photo media item", len(entities))
+				}
+			}
+			mediaGroup = append(mediaGroup, media)
+
+		case "video":
+			media := tgbotapi.NewInputMediaVideo(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				// Add caption to first media item with entities
+				media.Caption = caption
+				// IMPORTANT: Don't set ParseMode when using entities
+				if len(entities) > 0 {
+					media.CaptionEntities = entities
+					log.Printf("Set %d entities to first video media item", len(entities))
+				}
+			}
+			mediaGroup = append(mediaGroup, media)
+
+		case "document":
+			media := tgbotapi.NewInputMediaDocument(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				// Add caption to first media item with entities
+				media.Caption = caption
+				// IMPORTANT: Don't set ParseMode when using entities
+				if len(entities) > 0 {
+					media.CaptionEntities = entities
+					log.Printf("Set %d entities to first document media item", len(entities))
+				}
+			}
+			mediaGroup = append(mediaGroup, media)
+
+		default:
+			// Default to photo for unknown types
+			media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(mediaURL))
+			if i == 0 && caption != "" {
+				media.Caption = caption
+				// IMPORTANT: Don't set ParseMode when using entities
+				if len(entities) > 0 {
+					media.CaptionEntities = entities
+					log.Printf("Set %d entities to first default media item", len(entities))
+				}
+			}
+			mediaGroup = append(mediaGroup, media)
+		}
+	}
+
+	// Send media group
+	var mediaGroupConfig tgbotapi.MediaGroupConfig
+	if chatID != 0 {
+		mediaGroupConfig = tgbotapi.NewMediaGroup(chatID, mediaGroup)
+	} else {
+		mediaGroupConfig = tgbotapi.MediaGroupConfig{
+			ChannelUsername: channelID,
+			Media:           mediaGroup,
+		}
+	}
+
+	log.Printf("Sending media group with %d items to channel %s", len(mediaGroup), channelID)
+	_, err = s.api.SendMediaGroup(mediaGroupConfig)
+	if err != nil {
+		return fmt.Errorf("failed to send media group with entities to channel %s: %w", channelID, err)
+	}
+
+	log.Printf("Successfully sent media group with %d items and entities to channel %s", len(mediaURLs), channelID)
+	return nil
+}
+
+// sendRepostToChannel sends a repost message to a specific channel
+func (s *MessageService) sendRepostToChannel(group *models.ChannelGroup, channel models.Channel, template *models.MessageTemplate) error {
+	// Replace previous message according to the group's repost mode
+	sent, _, err := s.ReplaceRepost(group, &channel, template)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	// Update last message ID
+	if err := s.repo.UpdateChannelLastMessageID(channel.ID, sent.MessageID, sent.PartIDs); err != nil {
+		log.Printf("Failed to update last message ID for channel %s: %v", channel.ChannelID, err)
+	}
+
+	// Record success
+	s.recordSendSuccess(channel.GroupID, channel.ChannelID, template, sent, models.SendTypeRepost)
+
+	return nil
+}
+
+// sendPushToChannel sends a push message to a specific channel
+func (s *MessageService) sendPushToChannel(channel models.Channel, template *models.MessageTemplate) error {
+	// Send message (don't delete previous)
+	sent, err := s.sendMessage(channel.ChannelID, template)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	// Record success
+	s.recordSendSuccess(channel.GroupID, channel.ChannelID, template, sent, models.SendTypePush)
+
+	return nil
+}
+
+// sendMessage sends a message to a channel based on template
+func (s *MessageService) sendMessage(channelID string, template *models.MessageTemplate) (models.SentMessage, error) {
+	entities := s.parseTemplateEntities(template)
+
+	// SendTemplate handles entities and splits content over the length limits
+	return s.SendTemplate(channelID, template, entities)
+}
+
+// parseTemplateEntities deserializes the entities stored with a template
+func (s *MessageService) parseTemplateEntities(template *models.MessageTemplate) []tgbotapi.MessageEntity {
+	var entities []tgbotapi.MessageEntity
+	if template.Entities != "" {
+		log.Printf("Deserializing entities from template %d: %s", template.ID, template.Entities)
+		if err := json.Unmarshal([]byte(template.Entities), &entities); err != nil {
+			log.Printf("Failed to deserialize entities for template %d: %v", template.ID, err)
+			entities = nil
+		} else {
+			log.Printf("Successfully deserialized %d entities for template %d", len(entities), template.ID)
+			for i, entity := range entities {
+				log.Printf("Deserialized entity %d: type=%s, offset=%d, length=%d, url=%s", i, entity.Type, entity.Offset, entity.Length, entity.URL)
+			}
+		}
+	} else {
+		log.Printf("No entities found in template %d", template.ID)
+	}
+
+	return entities
+}
+
+// deleteMessage deletes a message from a channel
+func (s *MessageService) deleteMessage(channelID, messageID string) error {
+	chatID, err := strconv.ParseInt(channelID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid channel ID: %s", channelID)
+	}
+
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %s", messageID)
+	}
+
+	deleteMsg := tgbotapi.NewDeleteMessage(chatID, msgID)
+	_, err = s.api.Request(deleteMsg)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	if err := s.repo.MarkPublishedMessageDeleted(channelID, messageID); err != nil {
+		log.Printf("Failed to mark message %s in channel %s deleted: %v", messageID, channelID, err)
+	}
+
+	return nil
+}
+
+// deleteMessages deletes messages from a channel, logging the ones that could not be deleted
+func (s *MessageService) deleteMessages(channelID string, messageIDs []string) {
+	for _, messageID := range messageIDs {
+		if err := s.deleteMessage(channelID, messageID); err != nil {
+			log.Printf("Failed to delete message %s in channel %s: %v", messageID, channelID, err)
+		} else {
+			log.Printf("Successfully deleted message %s from channel %s", messageID, channelID)
+		}
+	}
+}
+
+// PinMessage pins a message in a channel and deletes the pin notification
+func (s *MessageService) PinMessage(channelID string, messageID string) error {
+	chatID, err := strconv.ParseInt(channelID, 10, 64)
+	if err != nil {
+		// Try as username
+		chatID = 0
+	}
+
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %w", err)
+	}
+
+	var pinConfig tgbotapi.PinChatMessageConfig
+	if chatID != 0 {
+		pinConfig = tgbotapi.PinChatMessageConfig{
+			ChatID:              chatID,
+			MessageID:           msgID,
+			DisableNotification: true, // Pin silently to avoid spam
+		}
+	} else {
+		pinConfig = tgbotapi.PinChatMessageConfig{
+			ChannelUsername:     channelID,
+			MessageID:           msgID,
+			DisableNotification: true, // Pin silently to avoid spam
+		}
+	}
+
+	// Pin the message
+	_, err = s.api.Request(pinConfig)
+	if err != nil {
+		return fmt.Errorf("failed to pin message in channel %s: %w", channelID, err)
+	}
+
+	log.Printf("Successfully pinned message %s in channel %s", messageID, channelID)
+
+	// Delete the pin notification message (next message ID after pinned message)
+	// Pin notification always gets the next sequential message ID
+	go s.deletePinNotificationPrecise(channelID, chatID, msgID+1)
+	return nil
+}
+
+// deletePinNotificationPrecise deletes the pin notification with exact message ID
+func (s *MessageService) deletePinNotificationPrecise(channelID string, chatID int64, notificationMsgID int) {
+	log.Printf("Starting pin notification deletion for channel %s, expected notification ID: %d", channelID, notificationMsgID)
+
+	// Try multiple times with increasing delays for high-concurrency scenarios
+	maxRetries := 3
+	baseDelay := 2 * time.Second
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		// Wait longer for high-concurrency scenarios
+		waitTime := time.Duration(attempt) * baseDelay
+		log.Printf("Attempt %d/%d: Waiting %v for pin notification to appear", attempt, maxRetries, waitTime)
+		time.Sleep(waitTime)
+
+		// Try to delete the exact notification message ID
+		if s.tryDeleteMessage(channelID, chatID, notificationMsgID) {
+			log.Printf("Successfully deleted pin notification %d in channel %s on attempt %d", notificationMsgID, channelID, attempt)
+			return
+		}
+
+		// Also try nearby message IDs in case of ID calculation errors
+		for offset := 1; offset <= 2; offset++ {
+			if s.tryDeleteMessage(channelID, chatID, notificationMsgID+offset) {
+				log.Printf("Successfully deleted pin notification %d (offset +%d) in channel %s on attempt %d",
+					notificationMsgID+offset, offset, channelID, attempt)
+				return
+			}
+			if s.tryDeleteMessage(channelID, chatID, notificationMsgID-offset) {
+				log.Printf("Successfully deleted pin notification %d (offset -%d) in channel %s on attempt %d",
+					notificationMsgID-offset, offset, channelID, attempt)
+				return
+			}
+		}
+
+		log.Printf("Attempt %d/%d failed to delete pin notification around ID %d in channel %s",
+			attempt, maxRetries, notificationMsgID, channelID)
+	}
+
+	log.Printf("Failed to delete pin notification after %d attempts for channel %s, notification ID %d",
+		maxRetries, channelID, notificationMsgID)
+}
+
+// deletePinNotification attempts to delete the "pinned a message" notification (legacy method)
+func (s *MessageService) deletePinNotification(channelID string, chatID int64, pinnedMsgID int) {
+	// Wait a moment for the pin notification to appear
+	time.Sleep(2 * time.Second)
+
+	// Try to delete potential pin notification messages
+	// Pin notifications usually appear as the next message ID after the pinned message
+	// We'll try a range of potential IDs since message IDs might not be strictly sequential
+
+	maxAttempts := 5
+	for i := 1; i <= maxAttempts; i++ {
+		potentialNotificationID := pinnedMsgID + i
+
+		if s.tryDeleteMessage(channelID, chatID, potentialNotificationID) {
+			log.Printf("Successfully deleted pin notification %d in channel %s", potentialNotificationID, channelID)
+			return // Found and deleted the notification, we're done
+		}
+	}
+
+	log.Printf("Could not find pin notification to delete in channel %s", channelID)
+}
+
+// tryDeleteMessage attempts to delete a message and returns true if successful
+func (s *MessageService) tryDeleteMessage(channelID string, chatID int64, messageID int) bool {
+	var deleteConfig tgbotapi.DeleteMessageConfig
+	if chatID != 0 {
+		deleteConfig = tgbotapi.NewDeleteMessage(chatID, messageID)
+	} else {
+		deleteConfig = tgbotapi.DeleteMessageConfig{
+			ChannelUsername: channelID,
+			MessageID:       messageID,
+		}
+	}
+
+	_, err := s.api.Request(deleteConfig)
+	if err != nil {
+		// Log at debug level to avoid spam
+		log.Printf("Debug: Could not delete message %d in channel %s: %v", messageID, channelID, err)
+		return false
+	}
+
+	return true
+}
+
+// createInlineKeyboard creates an inline keyboard from button data
+func (s *MessageService) createInlineKeyboard(buttons models.InlineKeyboard) models.InlineKeyboardMarkup {
+	return buttons.Markup()
+}
+
+// recordSendSuccess records a successful send operation
+func (s *MessageService) recordSendSuccess(groupID int64, channelID string, template *models.MessageTemplate, sent models.SentMessage, sendType models.SendType) {
+	s.RecordPublished(groupID, channelID, models.PublishKind(sendType), sent.IDs())
+
+	now := time.Now()
+	record := &models.SendRecord{
+		GroupID:        groupID,
+		ChannelID:      channelID,
+		MessageID:      sent.MessageID,
+		PartMessageIDs: sent.PartIDs,
+		TemplateID:     template.ID,
+		Variant:        template.Variant,
+		MessageType:    sendType,
+		Status:         models.SendStatusSent,
+		ScheduledAt:    now,
+		SentAt:         &now,
+	}
+
+	if err := s.repo.CreateSendRecord(record); err != nil {
+		log.Printf("Failed to record send success: %v", err)
+	}
+}
+
+// recordSendFailure records a failed send operation
+func (s *MessageService) recordSendFailure(groupID int64, channelID string, template *models.MessageTemplate, sendType models.SendType, errorMsg string) {
+	record := &models.SendRecord{
+		GroupID:      groupID,
+		ChannelID:    channelID,
+		TemplateID:   template.ID,
+		Variant:      template.Variant,
+		MessageType:  sendType,
+		Status:       models.SendStatusFailed,
+		ErrorMessage: models.StringPtr(errorMsg),
+		ScheduledAt:  time.Now(),
+	}
+
+	if err := s.repo.CreateSendRecord(record); err != nil {
+		log.Printf("Failed to record send failure: %v", err)
+	}
+}
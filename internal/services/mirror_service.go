@@ -0,0 +1,126 @@
+package services
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"tg-channel-repost-bot/internal/database"
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MirrorService relays new posts of watched source channels to channel groups
+type MirrorService struct {
+	repo           *database.Repository
+	messageService *MessageService
+}
+
+// NewMirrorService creates a new mirror service
+func NewMirrorService(repo *database.Repository, messageService *MessageService) *MirrorService {
+	return &MirrorService{
+		repo:           repo,
+		messageService: messageService,
+	}
+}
+
+// Relay copies a source post (or all messages of an album, sorted by message ID) to every
+// channel of the rule's group without quoting the source. Posts that don't pass the rule's
+// filters are skipped; delayed rules relay in the background.
+func (m *MirrorService) Relay(rule models.MirrorRule, messages []*tgbotapi.Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	// Filter on the album caption (or post text) and the type of its first item
+	var text string
+	for _, message := range messages {
+		if message.Text != "" {
+			text = message.Text
+			break
+		}
+		if message.Caption != "" {
+			text = message.Caption
+			break
+		}
+	}
+	messageType := MessageKind(messages[0])
+	if !rule.Matches(text, messageType) {
+		log.Printf("Mirror rule %d skipped %s post %d from chat %d (filtered)", rule.ID, messageType, messages[0].MessageID, rule.SourceChatID)
+		return
+	}
+
+	if rule.DelaySeconds > 0 {
+		log.Printf("Mirror rule %d will relay post %d in %d seconds", rule.ID, messages[0].MessageID, rule.DelaySeconds)
+		// Delayed relays are kept in memory only and are lost if the bot restarts
+		time.AfterFunc(time.Duration(rule.DelaySeconds)*time.Second, func() {
+			m.relayToGroup(rule, messages)
+		})
+		return
+	}
+
+	m.relayToGroup(rule, messages)
+}
+
+// relayToGroup copies source messages to all channels of the rule's group, applying the group's
+// rewrite rules and send options, and records the copies
+func (m *MirrorService) relayToGroup(rule models.MirrorRule, messages []*tgbotapi.Message) {
+	group, err := m.repo.GetChannelGroup(rule.GroupID)
+	if err != nil {
+		log.Printf("Mirror rule %d failed to load group %d: %v", rule.ID, rule.GroupID, err)
+		return
+	}
+
+	m.messageService.RefreshTaggedChannels(group)
+	channels, err := m.repo.GetChannelsByGroupID(rule.GroupID)
+	if err != nil {
+		log.Printf("Mirror rule %d failed to load channels of group %d: %v", rule.ID, rule.GroupID, err)
+		return
+	}
+
+	rewriteRules, err := m.repo.GetRewriteRulesByGroupID(rule.GroupID)
+	if err != nil {
+		log.Printf("Mirror rule %d failed to load rewrite rules of group %d: %v", rule.ID, rule.GroupID, err)
+	}
+
+	sourceMessageID := messages[0].MessageID
+	sourceChannelID := strconv.FormatInt(rule.SourceChatID, 10)
+	for i, channel := range channels {
+		// Never relay a channel's posts back into itself
+		if channel.ChannelID == sourceChannelID {
+			continue
+		}
+
+		// Rate limiting: delay between channels to avoid API limits
+		if i > 0 {
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		copiedIDs, err := m.messageService.CopyWithRewrite(channel.ChannelID, rewriteRules, messages, nil, group.SendOptions)
+		if err != nil {
+			log.Printf("Mirror rule %d failed to relay post %d to channel %s: %v", rule.ID, sourceMessageID, channel.ChannelID, err)
+			continue
+		}
+
+		m.messageService.RecordPublished(rule.GroupID, channel.ChannelID, models.PublishKindMirror, copiedIDs)
+
+		for j, copiedID := range copiedIDs {
+			if j >= len(messages) {
+				break
+			}
+			record := &models.MirrorRecord{
+				RuleID:          rule.ID,
+				SourceChatID:    rule.SourceChatID,
+				SourceMessageID: messages[j].MessageID,
+				ChannelID:       channel.ChannelID,
+				MessageID:       copiedID,
+			}
+			if err := m.repo.CreateMirrorRecord(record); err != nil {
+				log.Printf("Failed to record mirrored post %d in channel %s: %v", messages[j].MessageID, channel.ChannelID, err)
+			}
+		}
+
+		log.Printf("Mirror rule %d relayed post %d to channel %s", rule.ID, sourceMessageID, channel.ChannelID)
+	}
+}
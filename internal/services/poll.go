@@ -0,0 +1,134 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram's limits of polls; lengths are in characters
+const (
+	MaxPollQuestionLength    = 300
+	MaxPollOptionLength      = 100
+	MinPollOptions           = 2
+	MaxPollOptions           = 10
+	MaxPollExplanationLength = 200
+	MinPollOpenPeriod        = 5
+	MaxPollOpenPeriod        = 600
+)
+
+// errPollNotEditable is reported when a poll template would have to be applied by editing a message
+var errPollNotEditable = fmt.Errorf("polls cannot be edited in place")
+
+// AddPollParams adds the question and settings of a poll template to a sendPoll request
+func AddPollParams(params tgbotapi.Params, template *models.MessageTemplate) error {
+	poll := template.Poll
+	if len(poll.Options) < MinPollOptions {
+		return fmt.Errorf("poll template %d has %d options, at least %d are needed", template.ID, len(poll.Options), MinPollOptions)
+	}
+
+	params["question"] = template.Content
+	options := make([]map[string]string, len(poll.Options))
+	for i, option := range poll.Options {
+		options[i] = map[string]string{"text": option}
+	}
+	if err := params.AddInterface("options", options); err != nil {
+		return fmt.Errorf("failed to encode poll options: %w", err)
+	}
+
+	if poll.Quiz {
+		params["type"] = "quiz"
+		// Quizzes always need the correct option, which may be the first (0)
+		params["correct_option_id"] = strconv.Itoa(poll.CorrectOptionID)
+		params.AddNonEmpty("explanation", poll.Explanation)
+	} else {
+		params.AddBool("allows_multiple_answers", poll.AllowsMultipleAnswers)
+	}
+	params.AddNonZero("open_period", poll.OpenPeriod)
+
+	return nil
+}
+
+// registerPollMessage records a poll sent to a channel, so that its results can be collected
+// while it runs and when it is replaced
+func (s *MessageService) registerPollMessage(channelID string, message *tgbotapi.Message) {
+	if message == nil || message.Poll == nil {
+		return
+	}
+
+	pollMessage := &models.PollMessage{
+		PollID:    message.Poll.ID,
+		ChannelID: channelID,
+		MessageID: strconv.Itoa(message.MessageID),
+		Results:   pollResults(message.Poll),
+	}
+	if err := s.repo.SavePollMessage(pollMessage); err != nil {
+		log.Printf("Failed to record poll message %d in channel %s: %v", message.MessageID, channelID, err)
+	}
+}
+
+// RecordPollUpdate stores the results of a poll sent by the bot; Telegram reports them while the
+// poll runs and once more when it closes
+func (s *MessageService) RecordPollUpdate(poll *tgbotapi.Poll) {
+	if err := s.repo.UpdatePollResults(poll.ID, pollResults(poll)); err != nil {
+		log.Printf("Failed to record results of poll %s: %v", poll.ID, err)
+	}
+}
+
+// ClosePoll stops a recorded poll published as a message of a channel and stores its final
+// results in the send records of the message. Messages that are not polls are left alone.
+func (s *MessageService) ClosePoll(channelID, messageID string) {
+	pollMessage, err := s.repo.GetPollMessage(channelID, messageID)
+	if err != nil {
+		log.Printf("Failed to look up poll of message %s in channel %s: %v", messageID, channelID, err)
+		return
+	}
+	if pollMessage == nil || pollMessage.Results.Closed {
+		return
+	}
+
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		log.Printf("Invalid poll message ID: %s", messageID)
+		return
+	}
+
+	params := make(tgbotapi.Params)
+	addChatParam(params, channelID)
+	params.AddNonZero("message_id", msgID)
+	resp, err := s.api.MakeRequest("stopPoll", params)
+	if err != nil {
+		// A poll closed by its open period was reported by Telegram when it closed
+		if !strings.Contains(err.Error(), "poll has already been closed") {
+			log.Printf("Failed to stop poll %s in channel %s: %v", messageID, channelID, err)
+		}
+		return
+	}
+
+	var poll tgbotapi.Poll
+	if err := json.Unmarshal(resp.Result, &poll); err != nil {
+		log.Printf("Failed to decode stopped poll %s in channel %s: %v", messageID, channelID, err)
+		return
+	}
+	s.RecordPollUpdate(&poll)
+	log.Printf("Closed poll %s in channel %s with %d voters", messageID, channelID, poll.TotalVoterCount)
+}
+
+// pollResults converts the state of a poll reported by Telegram
+func pollResults(poll *tgbotapi.Poll) models.PollResults {
+	results := models.PollResults{
+		Question:        poll.Question,
+		TotalVoterCount: poll.TotalVoterCount,
+		Closed:          poll.IsClosed,
+	}
+	for _, option := range poll.Options {
+		results.Options = append(results.Options, models.PollOptionResult{Text: option.Text, VoterCount: option.VoterCount})
+	}
+	return results
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"log"
+	"regexp"
+
+	"tg-channel-repost-bot/internal/models"
+	"tg-channel-repost-bot/pkg/entityutil"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	// mentionPattern matches @username mentions that are not part of an e-mail address
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@])(@[A-Za-z][A-Za-z0-9_]{3,31})\b`)
+	// urlPattern matches links written in plain text
+	urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.|t\.me/)[^\s]+`)
+)
+
+// RewriteResult is the outcome of applying rewrite rules to a text and its entities
+type RewriteResult struct {
+	Text         string
+	Entities     []tgbotapi.MessageEntity
+	StripButtons bool
+	Changed      bool // Whether text or entities differ from the input
+}
+
+// ApplyRewriteRules applies rewrite rules in order to a text. Entity offsets, which Telegram
+// measures in UTF-16 code units, are moved along with the rewritten text; entities whose text
+// is removed entirely are dropped.
+func ApplyRewriteRules(rules []models.RewriteRule, text string, entities []tgbotapi.MessageEntity) RewriteResult {
+	result := RewriteResult{
+		Text:     text,
+		Entities: append([]tgbotapi.MessageEntity(nil), entities...),
+	}
+
+	for _, rule := range rules {
+		switch rule.RuleType {
+		case models.RewriteRuleRegex:
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				log.Printf("Skipping invalid rewrite regex %q of rule %d: %v", rule.Pattern, rule.ID, err)
+				continue
+			}
+			source := result.Text
+			result.replaceMatches(re, 0, func(match []int) string {
+				return string(re.ExpandString(nil, rule.Replacement, source, match))
+			})
+
+		case models.RewriteRuleRemoveMentions:
+			result.replaceMatches(mentionPattern, 1, func([]int) string { return "" })
+
+		case models.RewriteRuleReplaceURLs:
+			result.replaceMatches(urlPattern, 0, func([]int) string { return rule.Replacement })
+			result.rewriteTextLinks(func(string) string { return rule.Replacement })
+
+		case models.RewriteRuleDomainMap:
+			if rule.Pattern == "" {
+				continue
+			}
+			re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(rule.Pattern))
+			result.replaceMatches(re, 0, func([]int) string { return rule.Replacement })
+			result.rewriteTextLinks(func(url string) string { return re.ReplaceAllLiteralString(url, rule.Replacement) })
+
+		case models.RewriteRuleStripButtons:
+			result.StripButtons = true
+
+		case models.RewriteRuleAppendFooter:
+			if rule.Replacement == "" {
+				continue
+			}
+			footer := rule.Replacement
+			if result.Text != "" {
+				footer = "\n\n" + footer
+			}
+			result.replaceRange(len(result.Text), len(result.Text), footer)
+		}
+	}
+
+	if result.Changed {
+		result.Entities = entityutil.Repair(result.Text, result.Entities)
+	}
+
+	return result
+}
+
+// RewriteURL applies the link rules (URL replacement and domain mapping) to a single URL,
+// such as the URL of an inline keyboard button, the same way they apply to text links. An empty
+// result means the link is removed.
+func RewriteURL(rules []models.RewriteRule, url string) string {
+	for _, rule := range rules {
+		switch rule.RuleType {
+		case models.RewriteRuleReplaceURLs:
+			url = rule.Replacement
+		case models.RewriteRuleDomainMap:
+			if rule.Pattern != "" {
+				re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(rule.Pattern))
+				url = re.ReplaceAllLiteralString(url, rule.Replacement)
+			}
+		}
+		if url == "" {
+			return ""
+		}
+	}
+	return url
+}
+
+// replaceMatches replaces every match of re (or of its capture group) with the text returned by
+// replacement. Matches are replaced from last to first so earlier byte offsets stay valid.
+func (r *RewriteResult) replaceMatches(re *regexp.Regexp, group int, replacement func(match []int) string) {
+	matches := re.FindAllStringSubmatchIndex(r.Text, -1)
+	replacements := make([]string, len(matches))
+	for i, match := range matches {
+		replacements[i] = replacement(match)
+	}
+
+	for i := len(matches) - 1; i >= 0; i-- {
+		start, end := matches[i][2*group], matches[i][2*group+1]
+		if start < 0 {
+			continue
+		}
+		r.replaceRange(start, end, replacements[i])
+	}
+}
+
+// replaceRange replaces the bytes [start, end) of the text and moves the entities accordingly.
+// Entity boundaries inside the replaced range snap to the end of the replacement.
+func (r *RewriteResult) replaceRange(start, end int, replacement string) {
+	if r.Text[start:end] == replacement {
+		return
+	}
+
+	start16 := entityutil.UTF16Len(r.Text[:start])
+	end16 := start16 + entityutil.UTF16Len(r.Text[start:end])
+	delta := entityutil.UTF16Len(replacement) - (end16 - start16)
+
+	shift := func(pos int) int {
+		switch {
+		case pos <= start16:
+			return pos
+		case pos >= end16:
+			return pos + delta
+		default:
+			return end16 + delta
+		}
+	}
+
+	entities := r.Entities[:0]
+	for _, entity := range r.Entities {
+		entityStart := shift(entity.Offset)
+		entityEnd := shift(entity.Offset + entity.Length)
+		if entityEnd <= entityStart {
+			continue
+		}
+		entity.Offset = entityStart
+		entity.Length = entityEnd - entityStart
+		entities = append(entities, entity)
+	}
+
+	r.Entities = entities
+	r.Text = r.Text[:start] + replacement + r.Text[end:]
+	r.Changed = true
+}
+
+// rewriteTextLinks rewrites the URLs of text_link entities; an empty URL turns the link into plain text
+func (r *RewriteResult) rewriteTextLinks(rewrite func(url string) string) {
+	entities := r.Entities[:0]
+	for _, entity := range r.Entities {
+		if entity.Type == "text_link" {
+			url := rewrite(entity.URL)
+			if url != entity.URL {
+				r.Changed = true
+			}
+			if url == "" {
+				continue
+			}
+			entity.URL = url
+		}
+		entities = append(entities, entity)
+	}
+	r.Entities = entities
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+)
+
+// TagSyncResult counts the channels a tag rule sync added to and removed from a group
+type TagSyncResult struct {
+	Added   int
+	Removed int
+}
+
+// isTagSeparator reports whether a rune separates tags in user input
+func isTagSeparator(r rune) bool {
+	return r == ' ' || r == ',' || r == '，' || r == '\n' || r == '\t'
+}
+
+// ParseTags splits user input into tags: separated by spaces or commas, a leading # or - is
+// dropped and tags are lower-cased. Duplicates are removed.
+func ParseTags(input string) []string {
+	fields := strings.FieldsFunc(input, isTagSeparator)
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		tag := strings.ToLower(strings.TrimLeft(field, "#-"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// ParseTagRule parses a tag rule such as "crypto asia -spam": channels must have every plain tag
+// and none of the tags prefixed with -
+func ParseTagRule(input string) (include, exclude []string) {
+	var included, excluded []string
+	for _, field := range strings.FieldsFunc(input, isTagSeparator) {
+		if strings.HasPrefix(field, "-") {
+			excluded = append(excluded, field)
+		} else {
+			included = append(included, field)
+		}
+	}
+	return ParseTags(strings.Join(included, " ")), ParseTags(strings.Join(excluded, " "))
+}
+
+// SyncTaggedChannels brings the channels a group has by its tag rule in line with the current
+// tags: matching channels that are not in the group yet are added, channels added by the rule
+// that no longer match are removed. Channels added explicitly are never touched.
+func (s *MessageService) SyncTaggedChannels(group *models.ChannelGroup) (TagSyncResult, error) {
+	var result TagSyncResult
+
+	var matching []string
+	if group.HasTagRule() {
+		var err error
+		matching, err = s.repo.GetTaggedChannelIDs(group.TagInclude, group.TagExclude)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	matched := make(map[string]bool)
+	for _, channelID := range matching {
+		matched[channelID] = true
+
+		existing, err := s.repo.GetGroupChannel(group.ID, channelID)
+		if err != nil {
+			return result, err
+		}
+		if existing != nil {
+			continue
+		}
+
+		channel := &models.Channel{
+			ChannelID:   channelID,
+			ChannelName: channelID,
+			GroupID:     group.ID,
+			TagMatched:  true,
+			IsActive:    true,
+		}
+		known, err := s.repo.GetKnownChannel(channelID)
+		if err != nil {
+			return result, err
+		}
+		if known != nil {
+			channel.ChannelName = known.Title
+			channel.IsActive = known.IsActive
+		}
+		if err := s.repo.CreateChannel(channel); err != nil {
+			return result, fmt.Errorf("failed to add tagged channel %s: %w", channelID, err)
+		}
+		result.Added++
+	}
+
+	channels, err := s.repo.GetTagMatchedChannels(group.ID)
+	if err != nil {
+		return result, err
+	}
+	for _, channel := range channels {
+		if matched[channel.ChannelID] {
+			continue
+		}
+		if err := s.repo.DeleteChannel(channel.ID); err != nil {
+			return result, err
+		}
+		result.Removed++
+	}
+
+	if result.Added > 0 || result.Removed > 0 {
+		log.Printf("Tag rule of group %d added %d and removed %d channels", group.ID, result.Added, result.Removed)
+	}
+	return result, nil
+}
+
+// SyncAllTaggedChannels syncs the tagged channels of every group, after the tags of a channel
+// changed
+func (s *MessageService) SyncAllTaggedChannels() {
+	groups, err := s.repo.GetChannelGroups()
+	if err != nil {
+		log.Printf("Failed to get channel groups for tag sync: %v", err)
+		return
+	}
+
+	for i := range groups {
+		if _, err := s.SyncTaggedChannels(&groups[i]); err != nil {
+			log.Printf("Failed to sync tagged channels of group %d: %v", groups[i].ID, err)
+		}
+	}
+}
+
+// RefreshTaggedChannels syncs a group's tagged channels before it is sent to, logging failures
+// so that sending goes on with the channels the group already has
+func (s *MessageService) RefreshTaggedChannels(group *models.ChannelGroup) {
+	if _, err := s.SyncTaggedChannels(group); err != nil {
+		log.Printf("Failed to sync tagged channels of group %d: %v", group.ID, err)
+	}
+}
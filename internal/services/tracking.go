@@ -0,0 +1,83 @@
+package services
+
+import (
+	"crypto/rand"
+	"log"
+	"math/big"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+)
+
+// linkCodeAlphabet and linkCodeLength define the short codes of tracked links
+const (
+	linkCodeAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	linkCodeLength   = 8
+)
+
+// TrackedLinkPath is the path prefix the redirect server serves tracked links under
+const TrackedLinkPath = "/r/"
+
+// TrackButtons returns a copy of the template whose http(s) URL buttons point at tracked
+// redirect links of the group and channel. The template is returned unchanged when click
+// tracking is disabled; buttons whose link cannot be created keep their URL.
+func (s *MessageService) TrackButtons(group *models.ChannelGroup, channelID string, template *models.MessageTemplate) *models.MessageTemplate {
+	if !s.config.Server.TracksClicks() || len(template.Buttons) == 0 {
+		return template
+	}
+
+	tracked := *template
+	tracked.Buttons = make(models.InlineKeyboard, len(template.Buttons))
+	for i, row := range template.Buttons {
+		tracked.Buttons[i] = make([]models.InlineKeyboardButton, len(row))
+		for j, button := range row {
+			if s.isTrackable(button.URL) {
+				code, err := newLinkCode()
+				if err != nil {
+					log.Printf("Failed to generate tracked link code: %v", err)
+					tracked.Buttons[i][j] = button
+					continue
+				}
+				link := &models.TrackedLink{
+					Code:       code,
+					GroupID:    group.ID,
+					ChannelID:  channelID,
+					TemplateID: template.ID,
+					ButtonText: button.Text,
+					URL:        button.URL,
+				}
+				if err := s.repo.GetOrCreateTrackedLink(link); err != nil {
+					log.Printf("Failed to track button %q of group %d in channel %s: %v", button.Text, group.ID, channelID, err)
+				} else {
+					button.URL = s.config.Server.PublicURL + TrackedLinkPath + link.Code
+				}
+			}
+			tracked.Buttons[i][j] = button
+		}
+	}
+
+	return &tracked
+}
+
+// isTrackable reports whether a button URL can be wrapped in a redirect: web links that are not
+// tracked links already
+func (s *MessageService) isTrackable(url string) bool {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return false
+	}
+	return !strings.HasPrefix(url, s.config.Server.PublicURL+TrackedLinkPath)
+}
+
+// newLinkCode returns a random short code for a tracked link
+func newLinkCode() (string, error) {
+	code := make([]byte, linkCodeLength)
+	max := big.NewInt(int64(len(linkCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = linkCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"tg-channel-repost-bot/internal/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// voteCountSuffix matches the vote count shown after the text of a vote button
+var voteCountSuffix = regexp.MustCompile(` \d+$`)
+
+// registerVoteMessage records the keyboard of a sent or edited message carrying vote buttons, so
+// that presses can show the counts without losing buttons the bot library cannot read back. The
+// counts are shown right away when the message already has votes.
+func (s *MessageService) registerVoteMessage(message *tgbotapi.Message, template *models.MessageTemplate) {
+	if message == nil || message.Chat == nil || len(template.Buttons.VoteChoices()) == 0 {
+		return
+	}
+
+	voteMessage := &models.VoteMessage{
+		ChatID:     message.Chat.ID,
+		MessageID:  message.MessageID,
+		ChatTitle:  message.Chat.Title,
+		TemplateID: template.ID,
+		Buttons:    template.Buttons,
+	}
+	if err := s.repo.SaveVoteMessage(voteMessage); err != nil {
+		log.Printf("Failed to record vote message %d in chat %d: %v", message.MessageID, message.Chat.ID, err)
+		return
+	}
+
+	counts, err := s.repo.CountVotes(voteMessage.ChatID, voteMessage.MessageID)
+	if err != nil {
+		log.Printf("Failed to count votes of message %d in chat %d: %v", message.MessageID, message.Chat.ID, err)
+		return
+	}
+	if len(counts) > 0 {
+		if err := s.editVoteKeyboard(voteMessage, counts); err != nil {
+			log.Printf("Failed to show vote counts: %v", err)
+		}
+	}
+}
+
+// Vote records a reader's press on a vote button of a message. Pressing the choice the reader
+// already voted for withdraws the vote, any other choice replaces it, so each reader has at most
+// one vote per message. Choices the message's keyboard does not have are rejected. The counts on the message are updated and the answer to show the reader
+// is returned.
+func (s *MessageService) Vote(message *tgbotapi.Message, userID int64, choice string) (string, error) {
+	s.voteMutex.Lock()
+	defer s.voteMutex.Unlock()
+
+	voteMessage, err := s.repo.GetVoteMessage(message.Chat.ID, message.MessageID)
+	if err != nil {
+		return "", err
+	}
+	if voteMessage == nil {
+		// Messages whose keyboard was not recorded when sent, such as forwarded copies, are
+		// recorded from the keyboard the press came from
+		voteMessage = &models.VoteMessage{
+			ChatID:    message.Chat.ID,
+			MessageID: message.MessageID,
+			ChatTitle: message.Chat.Title,
+			Buttons:   voteKeyboardFromMarkup(message.ReplyMarkup),
+		}
+		if err := s.repo.SaveVoteMessage(voteMessage); err != nil {
+			return "", err
+		}
+	}
+
+	// Callback data can be forged, so only the choices of the message's keyboard are counted
+	known := false
+	for _, keyboardChoice := range voteMessage.Buttons.VoteChoices() {
+		if keyboardChoice == choice {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return "该选项不存在", nil
+	}
+
+	previous, err := s.repo.GetVoteChoice(message.Chat.ID, message.MessageID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var answer string
+	if previous == choice {
+		if err := s.repo.DeleteVote(message.Chat.ID, message.MessageID, userID); err != nil {
+			return "", err
+		}
+		answer = "已取消投票"
+	} else {
+		if err := s.repo.SetVote(message.Chat.ID, message.MessageID, userID, choice); err != nil {
+			return "", err
+		}
+		answer = "已投票：" + choice
+	}
+
+	counts, err := s.repo.CountVotes(message.Chat.ID, message.MessageID)
+	if err != nil {
+		return "", err
+	}
+	// The vote is recorded even when the counts cannot be shown, e.g. while the message is rate limited
+	if err := s.editVoteKeyboard(voteMessage, counts); err != nil {
+		log.Printf("Failed to show vote counts: %v", err)
+	}
+
+	return answer, nil
+}
+
+// editVoteKeyboard replaces the keyboard of a vote message with one showing the vote counts
+func (s *MessageService) editVoteKeyboard(message *models.VoteMessage, counts map[string]int) error {
+	params := make(tgbotapi.Params)
+	params.AddNonZero64("chat_id", message.ChatID)
+	params.AddNonZero("message_id", message.MessageID)
+	if err := params.AddInterface("reply_markup", message.Buttons.WithVoteCounts(counts).Markup()); err != nil {
+		return fmt.Errorf("failed to encode buttons: %w", err)
+	}
+
+	if _, err := s.api.MakeRequest("editMessageReplyMarkup", params); err != nil {
+		if strings.Contains(err.Error(), "message is not modified") {
+			return nil
+		}
+		return fmt.Errorf("failed to edit buttons of message %d in chat %d: %w", message.MessageID, message.ChatID, err)
+	}
+
+	return nil
+}
+
+// voteKeyboardFromMarkup converts a keyboard received from Telegram, removing the counts shown on
+// vote buttons. Buttons the bot library cannot read, such as copy buttons, are dropped.
+func voteKeyboardFromMarkup(markup *tgbotapi.InlineKeyboardMarkup) models.InlineKeyboard {
+	if markup == nil {
+		return nil
+	}
+
+	var keyboard models.InlineKeyboard
+	for _, row := range markup.InlineKeyboard {
+		var keyboardRow []models.InlineKeyboardButton
+		for _, button := range row {
+			converted := models.InlineKeyboardButton{Text: button.Text, SwitchInlineQuery: button.SwitchInlineQuery}
+			switch {
+			case button.URL != nil:
+				converted.URL = *button.URL
+			case button.CallbackData != nil:
+				converted.CallbackData = *button.CallbackData
+				if converted.VoteChoice() != "" {
+					converted.Text = voteCountSuffix.ReplaceAllString(button.Text, "")
+				}
+			case button.SwitchInlineQuery == nil:
+				continue
+			}
+			keyboardRow = append(keyboardRow, converted)
+		}
+		if len(keyboardRow) > 0 {
+			keyboard = append(keyboard, keyboardRow)
+		}
+	}
+
+	return keyboard
+}
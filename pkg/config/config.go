@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -35,9 +36,15 @@ type DatabaseConfig struct {
 
 // ServerConfig represents server configuration
 type ServerConfig struct {
-	Port  int    `yaml:"port"`
-	Host  string `yaml:"host"`
-	Debug bool   `yaml:"debug"`
+	Port      int    `yaml:"port"`
+	Host      string `yaml:"host"`
+	Debug     bool   `yaml:"debug"`
+	PublicURL string `yaml:"public_url"` // Base URL readers reach the server at; enables button click tracking
+}
+
+// TracksClicks reports whether button links are wrapped in tracked redirects
+func (c ServerConfig) TracksClicks() bool {
+	return c.PublicURL != ""
 }
 
 // SchedulerConfig represents scheduler configuration
@@ -46,6 +53,8 @@ type SchedulerConfig struct {
 	MaxWorkers    int `yaml:"max_workers"`
 	RetryAttempts int `yaml:"retry_attempts"`
 	RetryInterval int `yaml:"retry_interval"`
+	// HealthCheckInterval is the interval in seconds of channel health checks (0 = only on demand)
+	HealthCheckInterval int `yaml:"health_check_interval"`
 }
 
 // LoggingConfig represents logging configuration
@@ -107,6 +116,13 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
 
+	if c.Server.PublicURL != "" {
+		if !strings.HasPrefix(c.Server.PublicURL, "http://") && !strings.HasPrefix(c.Server.PublicURL, "https://") {
+			return fmt.Errorf("invalid server public URL: %s", c.Server.PublicURL)
+		}
+		c.Server.PublicURL = strings.TrimSuffix(c.Server.PublicURL, "/")
+	}
+
 	return nil
 }
 
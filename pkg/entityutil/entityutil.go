@@ -0,0 +1,264 @@
+// Package entityutil keeps Telegram message entities consistent with their text.
+//
+// Telegram measures entity offsets and lengths in UTF-16 code units, while Go strings are
+// indexed by bytes; characters outside the Basic Multilingual Plane (most emoji) take two
+// UTF-16 code units and Chinese characters take three bytes. Every change to a formatted text
+// (prefixing, trimming, truncating, rewriting) must convert between these units.
+package entityutil
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UTF16Len returns the length of s in UTF-16 code units
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeUTF16Len(r)
+	}
+	return n
+}
+
+// ByteToUTF16 converts a byte offset of s to a UTF-16 offset. Offsets beyond the end of s are
+// clamped to its length.
+func ByteToUTF16(s string, byteOffset int) int {
+	if byteOffset > len(s) {
+		byteOffset = len(s)
+	}
+	if byteOffset < 0 {
+		return 0
+	}
+	return UTF16Len(s[:byteOffset])
+}
+
+// UTF16ToByte converts a UTF-16 offset of s to a byte offset. An offset in the middle of a
+// surrogate pair rounds down to the start of the character; offsets beyond the end of s are
+// clamped to its length.
+func UTF16ToByte(s string, offset int) int {
+	n := 0
+	for i, r := range s {
+		next := n + runeUTF16Len(r)
+		if next > offset {
+			return i
+		}
+		n = next
+	}
+	return len(s)
+}
+
+// RuneToUTF16 converts a rune (character) offset of s to a UTF-16 offset
+func RuneToUTF16(s string, runeOffset int) int {
+	n, count := 0, 0
+	for _, r := range s {
+		if count >= runeOffset {
+			break
+		}
+		n += runeUTF16Len(r)
+		count++
+	}
+	return n
+}
+
+// UTF16ToRune converts a UTF-16 offset of s to a rune (character) offset, rounding down inside
+// a surrogate pair
+func UTF16ToRune(s string, offset int) int {
+	return utf8.RuneCountInString(s[:UTF16ToByte(s, offset)])
+}
+
+// Slice returns the part of text covered by an entity
+func Slice(text string, entity tgbotapi.MessageEntity) string {
+	start := UTF16ToByte(text, entity.Offset)
+	end := UTF16ToByte(text, entity.Offset+entity.Length)
+	if end < start {
+		return ""
+	}
+	return text[start:end]
+}
+
+// Shift returns a copy of entities with their offsets moved by delta UTF-16 code units, as
+// needed when text is prefixed
+func Shift(entities []tgbotapi.MessageEntity, delta int) []tgbotapi.MessageEntity {
+	if len(entities) == 0 {
+		return nil
+	}
+
+	shifted := make([]tgbotapi.MessageEntity, len(entities))
+	for i, entity := range entities {
+		entity.Offset += delta
+		shifted[i] = entity
+	}
+	return shifted
+}
+
+// Validate checks that every entity lies within text, is not empty and does not start or end in
+// the middle of a surrogate pair
+func Validate(text string, entities []tgbotapi.MessageEntity) error {
+	length := UTF16Len(text)
+	for i, entity := range entities {
+		switch {
+		case entity.Offset < 0:
+			return fmt.Errorf("entity %d (%s) has negative offset %d", i, entity.Type, entity.Offset)
+		case entity.Length <= 0:
+			return fmt.Errorf("entity %d (%s) has non-positive length %d", i, entity.Type, entity.Length)
+		case entity.Offset+entity.Length > length:
+			return fmt.Errorf("entity %d (%s) ends at %d beyond text length %d", i, entity.Type, entity.Offset+entity.Length, length)
+		case !isBoundary(text, entity.Offset) || !isBoundary(text, entity.Offset+entity.Length):
+			return fmt.Errorf("entity %d (%s) splits a surrogate pair", i, entity.Type)
+		}
+	}
+	return nil
+}
+
+// Repair returns entities adjusted to fit text: entities are clipped to the text, boundaries
+// inside a surrogate pair are widened to cover the whole character, and entities left empty
+// are dropped
+func Repair(text string, entities []tgbotapi.MessageEntity) []tgbotapi.MessageEntity {
+	length := UTF16Len(text)
+
+	var repaired []tgbotapi.MessageEntity
+	for _, entity := range entities {
+		start := clamp(entity.Offset, 0, length)
+		end := clamp(entity.Offset+entity.Length, 0, length)
+		if !isBoundary(text, start) {
+			start--
+		}
+		if !isBoundary(text, end) {
+			end++
+		}
+		if end <= start {
+			continue
+		}
+
+		entity.Offset = start
+		entity.Length = end - start
+		repaired = append(repaired, entity)
+	}
+	return repaired
+}
+
+// TrimSpace removes leading and trailing white space from text and moves the entities along
+func TrimSpace(text string, entities []tgbotapi.MessageEntity) (string, []tgbotapi.MessageEntity) {
+	start := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
+	end := start + len(strings.TrimRightFunc(text[start:], unicode.IsSpace))
+	return Cut(text, entities, start, end)
+}
+
+// Truncate shortens text to at most maxLength UTF-16 code units without splitting a character,
+// clipping the entities that extend past the cut
+func Truncate(text string, entities []tgbotapi.MessageEntity, maxLength int) (string, []tgbotapi.MessageEntity) {
+	if UTF16Len(text) <= maxLength {
+		return text, entities
+	}
+	return Cut(text, entities, 0, UTF16ToByte(text, maxLength))
+}
+
+// Part is one piece of a formatted text that was split to fit a length limit
+type Part struct {
+	Text     string
+	Entities []tgbotapi.MessageEntity
+}
+
+// splitSeparators lists the places text is preferably split at, best first
+var splitSeparators = []string{"\n\n", "\n", " "}
+
+// SplitHead splits off the head of text that fits in maxLength UTF-16 code units and returns it
+// together with the rest. The cut is made at the last paragraph break, line break or space
+// in the second half of the head, or at maxLength when there is none; white space around the
+// cut is dropped. The rest is empty when the whole text fits.
+func SplitHead(text string, entities []tgbotapi.MessageEntity, maxLength int) (Part, Part) {
+	if UTF16Len(text) <= maxLength {
+		return Part{Text: text, Entities: entities}, Part{}
+	}
+
+	limit := UTF16ToByte(text, maxLength)
+	cut := limit
+	for _, separator := range splitSeparators {
+		if i := strings.LastIndex(text[:limit], separator); i > 0 && i >= limit/2 {
+			cut = i
+			break
+		}
+	}
+	if cut == 0 {
+		// A single character longer than maxLength; keep it whole rather than loop forever
+		_, size := utf8.DecodeRuneInString(text)
+		cut = size
+	}
+
+	headText, headEntities := Cut(text, entities, 0, cut)
+	restText, restEntities := Cut(text, entities, cut, len(text))
+	headText, headEntities = TrimSpace(headText, headEntities)
+	restText, restEntities = TrimSpace(restText, restEntities)
+	return Part{Text: headText, Entities: headEntities}, Part{Text: restText, Entities: restEntities}
+}
+
+// Split splits text into parts of at most maxLength UTF-16 code units each, keeping every
+// entity with the part it falls in; entities crossing a cut are divided between the parts
+func Split(text string, entities []tgbotapi.MessageEntity, maxLength int) []Part {
+	var parts []Part
+	rest := Part{Text: text, Entities: entities}
+	for rest.Text != "" {
+		var head Part
+		head, rest = SplitHead(rest.Text, rest.Entities, maxLength)
+		if head.Text != "" {
+			parts = append(parts, head)
+		}
+	}
+	return parts
+}
+
+// Cut returns the bytes [start, end) of text with the entities clipped to that range and
+// shifted to its start
+func Cut(text string, entities []tgbotapi.MessageEntity, start, end int) (string, []tgbotapi.MessageEntity) {
+	start16 := ByteToUTF16(text, start)
+	end16 := ByteToUTF16(text, end)
+
+	var kept []tgbotapi.MessageEntity
+	for _, entity := range entities {
+		entityStart := clamp(entity.Offset, start16, end16)
+		entityEnd := clamp(entity.Offset+entity.Length, start16, end16)
+		if entityEnd <= entityStart {
+			continue
+		}
+
+		entity.Offset = entityStart - start16
+		entity.Length = entityEnd - entityStart
+		kept = append(kept, entity)
+	}
+	return text[start:end], kept
+}
+
+// isBoundary reports whether a UTF-16 offset falls between characters of text
+func isBoundary(text string, offset int) bool {
+	n := 0
+	for _, r := range text {
+		if n >= offset {
+			return n == offset
+		}
+		n += runeUTF16Len(r)
+	}
+	return n >= offset
+}
+
+// runeUTF16Len returns the number of UTF-16 code units of a character
+func runeUTF16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// clamp limits value to the range [low, high]
+func clamp(value, low, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
@@ -0,0 +1,292 @@
+package entityutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram's length limits of message texts and media captions, in UTF-16 code units
+const (
+	textLimit    = 4096
+	captionLimit = 1024
+)
+
+func entity(entityType string, offset, length int) tgbotapi.MessageEntity {
+	return tgbotapi.MessageEntity{Type: entityType, Offset: offset, Length: length}
+}
+
+func TestUTF16Len(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"中文", 2},
+		{"😀", 2},
+		{"a😀中", 4},
+		{"👍🏻", 4}, // emoji with a skin tone modifier are two surrogate pairs
+	}
+	for _, tt := range tests {
+		if got := UTF16Len(tt.text); got != tt.want {
+			t.Errorf("UTF16Len(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestOffsetConversions(t *testing.T) {
+	const text = "a😀中b" // bytes: a=0, 😀=1..4, 中=5..7, b=8; UTF-16: a=0, 😀=1..2, 中=3, b=4
+
+	byteTests := []struct {
+		utf16, byteOffset int
+	}{
+		{0, 0},
+		{1, 1},
+		{2, 1}, // inside the surrogate pair of 😀, rounds down
+		{3, 5},
+		{4, 8},
+		{5, 9},
+		{99, 9}, // beyond the end, clamped
+	}
+	for _, tt := range byteTests {
+		if got := UTF16ToByte(text, tt.utf16); got != tt.byteOffset {
+			t.Errorf("UTF16ToByte(%q, %d) = %d, want %d", text, tt.utf16, got, tt.byteOffset)
+		}
+	}
+
+	utf16Tests := []struct {
+		byteOffset, utf16 int
+	}{
+		{0, 0},
+		{1, 1},
+		{5, 3},
+		{8, 4},
+		{99, 5},
+		{-1, 0},
+	}
+	for _, tt := range utf16Tests {
+		if got := ByteToUTF16(text, tt.byteOffset); got != tt.utf16 {
+			t.Errorf("ByteToUTF16(%q, %d) = %d, want %d", text, tt.byteOffset, got, tt.utf16)
+		}
+	}
+
+	runeTests := []struct {
+		runeOffset, utf16 int
+	}{
+		{0, 0},
+		{1, 1},
+		{2, 3},
+		{3, 4},
+		{4, 5},
+	}
+	for _, tt := range runeTests {
+		if got := RuneToUTF16(text, tt.runeOffset); got != tt.utf16 {
+			t.Errorf("RuneToUTF16(%q, %d) = %d, want %d", text, tt.runeOffset, got, tt.utf16)
+		}
+		if got := UTF16ToRune(text, tt.utf16); got != tt.runeOffset {
+			t.Errorf("UTF16ToRune(%q, %d) = %d, want %d", text, tt.utf16, got, tt.runeOffset)
+		}
+	}
+	if got := UTF16ToRune(text, 2); got != 1 {
+		t.Errorf("UTF16ToRune(%q, 2) = %d, want 1 (rounded down inside a surrogate pair)", text, got)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	const text = "你好😀世界"
+	tests := []struct {
+		entity tgbotapi.MessageEntity
+		want   string
+	}{
+		{entity("bold", 0, 2), "你好"},
+		{entity("bold", 2, 2), "😀"},
+		{entity("bold", 4, 2), "世界"},
+		{entity("bold", 1, 4), "好😀世"},
+		{entity("bold", 5, 10), "界"},
+	}
+	for _, tt := range tests {
+		if got := Slice(text, tt.entity); got != tt.want {
+			t.Errorf("Slice(%q, %+v) = %q, want %q", text, tt.entity, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const text = "a😀b"
+	tests := []struct {
+		name     string
+		entities []tgbotapi.MessageEntity
+		wantErr  bool
+	}{
+		{"none", nil, false},
+		{"whole text", []tgbotapi.MessageEntity{entity("bold", 0, 4)}, false},
+		{"emoji", []tgbotapi.MessageEntity{entity("bold", 1, 2)}, false},
+		{"negative offset", []tgbotapi.MessageEntity{entity("bold", -1, 2)}, true},
+		{"empty", []tgbotapi.MessageEntity{entity("bold", 1, 0)}, true},
+		{"beyond the end", []tgbotapi.MessageEntity{entity("bold", 3, 2)}, true},
+		{"starts inside a surrogate pair", []tgbotapi.MessageEntity{entity("bold", 2, 2)}, true},
+		{"ends inside a surrogate pair", []tgbotapi.MessageEntity{entity("bold", 0, 2)}, true},
+	}
+	for _, tt := range tests {
+		err := Validate(text, tt.entities)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	const text = "a😀b中"
+	tests := []struct {
+		name     string
+		entities []tgbotapi.MessageEntity
+		want     []tgbotapi.MessageEntity
+	}{
+		{"valid", []tgbotapi.MessageEntity{entity("bold", 0, 5)}, []tgbotapi.MessageEntity{entity("bold", 0, 5)}},
+		{"start widened", []tgbotapi.MessageEntity{entity("bold", 2, 2)}, []tgbotapi.MessageEntity{entity("bold", 1, 3)}},
+		{"end widened", []tgbotapi.MessageEntity{entity("bold", 0, 2)}, []tgbotapi.MessageEntity{entity("bold", 0, 3)}},
+		{"clipped", []tgbotapi.MessageEntity{entity("italic", 3, 10)}, []tgbotapi.MessageEntity{entity("italic", 3, 2)}},
+		{"negative offset clipped", []tgbotapi.MessageEntity{entity("italic", -2, 3)}, []tgbotapi.MessageEntity{entity("italic", 0, 1)}},
+		{"beyond the end dropped", []tgbotapi.MessageEntity{entity("bold", 5, 3)}, nil},
+		{"empty dropped", []tgbotapi.MessageEntity{entity("bold", 1, 0), entity("code", 3, 1)}, []tgbotapi.MessageEntity{entity("code", 3, 1)}},
+	}
+	for _, tt := range tests {
+		got := Repair(text, tt.entities)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Repair() = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if err := Validate(text, got); err != nil {
+			t.Errorf("%s: repaired entities are invalid: %v", tt.name, err)
+		}
+	}
+}
+
+func TestTrimSpace(t *testing.T) {
+	text, entities := TrimSpace(" \n😀 粗体 \n", []tgbotapi.MessageEntity{entity("bold", 2, 5), entity("italic", 0, 1)})
+	if text != "😀 粗体" {
+		t.Errorf("TrimSpace() text = %q, want %q", text, "😀 粗体")
+	}
+	want := []tgbotapi.MessageEntity{entity("bold", 0, 5)}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("TrimSpace() entities = %+v, want %+v", entities, want)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	text, entities := Truncate("ab😀cd", []tgbotapi.MessageEntity{entity("bold", 1, 4)}, 3)
+	if text != "ab" {
+		t.Errorf("Truncate() text = %q, want %q (the emoji must not be split)", text, "ab")
+	}
+	want := []tgbotapi.MessageEntity{entity("bold", 1, 1)}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("Truncate() entities = %+v, want %+v", entities, want)
+	}
+}
+
+func TestSplitHead(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		entities  []tgbotapi.MessageEntity
+		maxLength int
+		head      Part
+		rest      Part
+	}{
+		{
+			name:      "fits",
+			text:      "短文本",
+			maxLength: 10,
+			head:      Part{Text: "短文本"},
+		},
+		{
+			name:      "paragraph break preferred",
+			text:      "第一段 文字\n\n第二段",
+			maxLength: 10,
+			head:      Part{Text: "第一段 文字"},
+			rest:      Part{Text: "第二段"},
+		},
+		{
+			name:      "line break",
+			text:      "一二三四\n五六七八九十",
+			maxLength: 6,
+			head:      Part{Text: "一二三四"},
+			rest:      Part{Text: "五六七八九十"},
+		},
+		{
+			name:      "no separator cuts at the limit",
+			text:      "一二三四五六",
+			maxLength: 4,
+			head:      Part{Text: "一二三四"},
+			rest:      Part{Text: "五六"},
+		},
+		{
+			name:      "surrogate pair kept whole",
+			text:      "ab😀cd",
+			maxLength: 3,
+			head:      Part{Text: "ab"},
+			rest:      Part{Text: "😀cd"},
+		},
+		{
+			name:      "character longer than the limit",
+			text:      "😀a",
+			maxLength: 1,
+			head:      Part{Text: "😀"},
+			rest:      Part{Text: "a"},
+		},
+		{
+			name:      "entity divided at the cut",
+			text:      "粗体 😀 文字",
+			entities:  []tgbotapi.MessageEntity{entity("bold", 0, 8)},
+			maxLength: 5,
+			head:      Part{Text: "粗体", Entities: []tgbotapi.MessageEntity{entity("bold", 0, 2)}},
+			rest:      Part{Text: "😀 文字", Entities: []tgbotapi.MessageEntity{entity("bold", 0, 5)}},
+		},
+	}
+	for _, tt := range tests {
+		head, rest := SplitHead(tt.text, tt.entities, tt.maxLength)
+		if !reflect.DeepEqual(head, tt.head) || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("%s: SplitHead() = %+v, %+v, want %+v, %+v", tt.name, head, rest, tt.head, tt.rest)
+		}
+	}
+}
+
+func TestSplitAtTelegramLimits(t *testing.T) {
+	// Words mixing CJK, emoji and ASCII so that cuts land next to surrogate pairs
+	words := make([]string, 1500)
+	for i := range words {
+		words[i] = []string{"中文😀", "text", "汉字", "👍🏻ok"}[i%4]
+	}
+	text := strings.Join(words, " ")
+	length := UTF16Len(text)
+	entities := []tgbotapi.MessageEntity{entity("bold", 0, length), entity("spoiler", 4, length-6)}
+
+	for _, limit := range []int{textLimit, captionLimit} {
+		parts := Split(text, entities, limit)
+		if len(parts) < 2 {
+			t.Fatalf("limit %d: Split() returned %d parts for %d code units", limit, len(parts), length)
+		}
+
+		texts := make([]string, len(parts))
+		for i, part := range parts {
+			texts[i] = part.Text
+			partLength := UTF16Len(part.Text)
+			if partLength > limit {
+				t.Errorf("limit %d: part %d has %d code units", limit, i, partLength)
+			}
+			if err := Validate(part.Text, part.Entities); err != nil {
+				t.Errorf("limit %d: part %d: %v", limit, i, err)
+			}
+			if len(part.Entities) == 0 || part.Entities[0] != entity("bold", 0, partLength) {
+				t.Errorf("limit %d: part %d does not keep the bold entity over its whole text: %+v", limit, i, part.Entities)
+			}
+		}
+
+		// Parts are cut at the single spaces between words, which are dropped
+		if joined := strings.Join(texts, " "); joined != text {
+			t.Errorf("limit %d: joined parts differ from the text", limit)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package markup
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// htmlTags maps the HTML tags supported by Telegram to entity types
+var htmlTags = map[string]string{
+	"b":          "bold",
+	"strong":     "bold",
+	"i":          "italic",
+	"em":         "italic",
+	"u":          "underline",
+	"ins":        "underline",
+	"s":          "strikethrough",
+	"strike":     "strikethrough",
+	"del":        "strikethrough",
+	"tg-spoiler": "spoiler",
+	"code":       "code",
+	"pre":        "pre",
+	"a":          "text_link",
+	"span":       "spoiler", // only <span class="tg-spoiler">
+	"blockquote": "blockquote",
+}
+
+// htmlEscapes lists the named character references supported by Telegram
+var htmlEscapes = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"quot": "\"",
+}
+
+// htmlOpen is a tag opened but not yet closed
+type htmlOpen struct {
+	name   string
+	entity tgbotapi.MessageEntity
+	start  int // UTF-16 offset in the output text
+	pos    int // rune index in the source
+}
+
+// ParseHTML parses Telegram HTML text into plain text and entities
+func ParseHTML(text string) (string, []tgbotapi.MessageEntity, error) {
+	src := &source{runes: []rune(text)}
+	out := &builder{}
+	var stack []htmlOpen
+
+	for !src.eof() {
+		switch r := src.peek(0); r {
+		case '<':
+			start := src.pos
+			end := start + 1
+			for end < len(src.runes) && src.runes[end] != '>' {
+				if src.runes[end] == '<' {
+					return "", nil, src.errorAt(start, "character '<' must be written as &lt;")
+				}
+				end++
+			}
+			if end >= len(src.runes) {
+				return "", nil, src.errorAt(start, "character '<' must be written as &lt;")
+			}
+			tag := string(src.runes[start+1 : end])
+			src.pos = end + 1
+
+			if strings.HasPrefix(tag, "/") {
+				name := strings.ToLower(strings.TrimSpace(tag[1:]))
+				if len(stack) == 0 {
+					return "", nil, src.errorAt(start, "closing tag </%s> has no matching opening tag", name)
+				}
+				open := stack[len(stack)-1]
+				if open.name != name {
+					line, column := src.position(open.pos)
+					return "", nil, src.errorAt(start, "closing tag </%s> does not match <%s> opened at line %d, column %d", name, open.name, line, column)
+				}
+				stack = stack[:len(stack)-1]
+
+				// <pre><code> is a single pre block; class="language-x" sets its language
+				if open.name == "code" && len(stack) > 0 && stack[len(stack)-1].name == "pre" {
+					if open.entity.Language != "" {
+						stack[len(stack)-1].entity.Language = open.entity.Language
+					}
+					continue
+				}
+				open.entity.Language = languageOf(open)
+				out.addEntity(open.entity, open.start)
+				continue
+			}
+
+			open, err := parseHTMLTag(src, start, tag)
+			if err != nil {
+				return "", nil, err
+			}
+			if open.name == "blockquote" {
+				for _, outer := range stack {
+					if outer.name == "blockquote" {
+						return "", nil, src.errorAt(start, "tag <blockquote> cannot be nested in another <blockquote>")
+					}
+				}
+			}
+			open.start = out.length
+			stack = append(stack, open)
+
+		case '&':
+			end := src.pos + 1
+			for end < len(src.runes) && end-src.pos <= 10 && src.runes[end] != ';' {
+				end++
+			}
+			if end >= len(src.runes) || src.runes[end] != ';' {
+				return "", nil, src.errorAt(src.pos, "character '&' must be written as &amp;")
+			}
+			name := string(src.runes[src.pos+1 : end])
+			decoded, ok := decodeHTMLEscape(name)
+			if !ok {
+				return "", nil, src.errorAt(src.pos, "unsupported character reference &%s;", name)
+			}
+			out.writeString(decoded)
+			src.pos = end + 1
+
+		case '>':
+			return "", nil, src.errorAt(src.pos, "character '>' must be written as &gt;")
+
+		default:
+			out.writeRune(r)
+			src.pos++
+		}
+	}
+
+	if len(stack) > 0 {
+		open := stack[len(stack)-1]
+		return "", nil, src.errorAt(open.pos, "tag <%s> opened here is never closed", open.name)
+	}
+
+	plain, entities := out.result()
+	return plain, entities, nil
+}
+
+// parseHTMLTag parses the name and attributes of an opening tag
+func parseHTMLTag(src *source, pos int, tag string) (htmlOpen, error) {
+	tag = strings.TrimSpace(tag)
+	name := tag
+	attributes := ""
+	if i := strings.IndexFunc(tag, unicode.IsSpace); i >= 0 {
+		name, attributes = tag[:i], tag[i+1:]
+	}
+	name = strings.ToLower(name)
+
+	entityType, ok := htmlTags[name]
+	if name == "tg-emoji" {
+		return htmlOpen{}, src.errorAt(pos, "custom emoji <tg-emoji> are not supported, write the emoji itself instead")
+	}
+	if !ok {
+		return htmlOpen{}, src.errorAt(pos, "unsupported tag <%s>", name)
+	}
+
+	attrs, err := parseHTMLAttributes(attributes)
+	if err != "" {
+		return htmlOpen{}, src.errorAt(pos, "tag <%s>: %s", name, err)
+	}
+
+	open := htmlOpen{name: name, entity: tgbotapi.MessageEntity{Type: entityType}, pos: pos}
+	switch name {
+	case "a":
+		href := strings.TrimSpace(attrs["href"])
+		if href == "" {
+			return htmlOpen{}, src.errorAt(pos, "tag <a> must have an href attribute")
+		}
+		open.entity.URL = href
+	case "span":
+		if attrs["class"] != "tg-spoiler" {
+			return htmlOpen{}, src.errorAt(pos, "tag <span> is only supported with class=\"tg-spoiler\"")
+		}
+	case "code":
+		open.entity.Language = strings.TrimPrefix(attrs["class"], "language-")
+	case "blockquote":
+		if _, ok := attrs["expandable"]; ok {
+			open.entity.Type = "expandable_blockquote"
+		}
+	}
+
+	return open, nil
+}
+
+// parseHTMLAttributes parses name="value" pairs and bare names such as expandable, which get an
+// empty value; it returns a description of the problem on failure
+func parseHTMLAttributes(s string) (map[string]string, string) {
+	attrs := make(map[string]string)
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return attrs, ""
+		}
+
+		nameEnd := strings.IndexFunc(s, func(r rune) bool { return r == '=' || unicode.IsSpace(r) })
+		if nameEnd < 0 {
+			nameEnd = len(s)
+		}
+		if nameEnd == 0 {
+			return nil, "attributes must be written as name=\"value\""
+		}
+		name := strings.ToLower(s[:nameEnd])
+		s = strings.TrimSpace(s[nameEnd:])
+		if !strings.HasPrefix(s, "=") {
+			attrs[name] = ""
+			continue
+		}
+		s = strings.TrimSpace(s[1:])
+
+		var value string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			end := strings.IndexByte(s[1:], s[0])
+			if end < 0 {
+				return nil, "attribute " + name + " has an unterminated quoted value"
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+
+		decoded, ok := decodeHTMLText(value)
+		if !ok {
+			return nil, "attribute " + name + " contains an unsupported character reference"
+		}
+		attrs[name] = decoded
+	}
+}
+
+// decodeHTMLEscape decodes a character reference name such as "amp" or "#39"
+func decodeHTMLEscape(name string) (string, bool) {
+	if decoded, ok := htmlEscapes[name]; ok {
+		return decoded, true
+	}
+	if !strings.HasPrefix(name, "#") {
+		return "", false
+	}
+
+	number := name[1:]
+	base := 10
+	if strings.HasPrefix(number, "x") || strings.HasPrefix(number, "X") {
+		number, base = number[1:], 16
+	}
+	code, err := strconv.ParseUint(number, base, 32)
+	if err != nil || code == 0 || code > unicode.MaxRune {
+		return "", false
+	}
+	return string(rune(code)), true
+}
+
+// decodeHTMLText decodes the character references of an attribute value
+func decodeHTMLText(s string) (string, bool) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '&')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), true
+		}
+		end := strings.IndexByte(s[i:], ';')
+		if end < 0 {
+			return "", false
+		}
+		decoded, ok := decodeHTMLEscape(s[i+1 : i+end])
+		if !ok {
+			return "", false
+		}
+		b.WriteString(s[:i])
+		b.WriteString(decoded)
+		s = s[i+end+1:]
+	}
+}
+
+// languageOf returns the language kept on a closed entity; only pre blocks carry one
+func languageOf(open htmlOpen) string {
+	if open.entity.Type == "pre" {
+		return open.entity.Language
+	}
+	return ""
+}
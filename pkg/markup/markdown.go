@@ -0,0 +1,278 @@
+package markup
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// markdownReserved lists the characters that must be escaped with '\' outside of code
+const markdownReserved = "_*[]()~`>#+-=|{}.!"
+
+// markdownStyles maps MarkdownV2 style markers to entity types
+var markdownStyles = map[string]string{
+	"*":  "bold",
+	"_":  "italic",
+	"__": "underline",
+	"~":  "strikethrough",
+	"||": "spoiler",
+}
+
+// markdownOpen is a style or link opened but not yet closed
+type markdownOpen struct {
+	marker string // style marker, or "[" for a link
+	start  int    // UTF-16 offset in the output text
+	pos    int    // rune index in the source
+}
+
+// ParseMarkdownV2 parses Telegram MarkdownV2 text into plain text and entities
+func ParseMarkdownV2(text string) (string, []tgbotapi.MessageEntity, error) {
+	src := &source{runes: []rune(text)}
+	out := &builder{}
+	var stack []markdownOpen
+	var quote *markdownOpen // block quote being read, opened by ">" or by "**>" when expandable
+
+	for !src.eof() {
+		r := src.peek(0)
+
+		switch {
+		case src.atLineStart() && (r == '>' || src.hasPrefix("**>")):
+			// Consecutive lines starting with '>' form a single quote
+			if quote == nil {
+				marker := ">"
+				if r == '*' {
+					marker = "**>"
+				}
+				quote = &markdownOpen{marker: marker, start: out.length, pos: src.pos}
+				src.pos += len(marker)
+			} else {
+				src.pos++
+			}
+
+		case r == '\n' && quote != nil && src.peek(1) != '>':
+			if err := closeMarkdownQuote(src, out, stack, quote); err != nil {
+				return "", nil, err
+			}
+			quote = nil
+			out.writeRune(r)
+			src.pos++
+
+		case r == '|' && src.hasPrefix("||") && quote != nil && quote.marker == "**>" &&
+			(src.peek(2) == '\n' || src.peek(2) == 0) && (len(stack) == 0 || stack[len(stack)-1].marker != "||"):
+			// "||" at the end of a line closes an expandable quote unless it closes a spoiler
+			if err := closeMarkdownQuote(src, out, stack, quote); err != nil {
+				return "", nil, err
+			}
+			quote = nil
+			src.pos += 2
+
+		case r == '!' && src.peek(1) == '[':
+			return "", nil, src.errorAt(src.pos, "custom emoji ![...](tg://emoji?id=...) are not supported, write the emoji itself instead")
+
+		case r == '\\':
+			next := src.peek(1)
+			if next == 0 || next > 126 {
+				return "", nil, src.errorAt(src.pos, "'\\' must be followed by an ASCII character to escape")
+			}
+			out.writeRune(next)
+			src.pos += 2
+
+		case r == '`':
+			if err := parseMarkdownCode(src, out); err != nil {
+				return "", nil, err
+			}
+
+		case r == '[':
+			stack = append(stack, markdownOpen{marker: "[", start: out.length, pos: src.pos})
+			src.pos++
+
+		case r == ']':
+			if findMarkdownOpen(stack, "[") < 0 {
+				return "", nil, src.errorAt(src.pos, "character ']' is reserved and must be escaped with '\\'")
+			}
+			if top := stack[len(stack)-1]; top.marker != "[" {
+				return "", nil, src.errorAt(top.pos, "'%s' opened here must be closed before the link text ends", top.marker)
+			}
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			src.pos++
+
+			url, err := parseMarkdownURL(src)
+			if err != nil {
+				return "", nil, err
+			}
+			out.addEntity(tgbotapi.MessageEntity{Type: "text_link", URL: url}, open.start)
+
+		case r == '*' || r == '_' || r == '~' || (r == '|' && src.peek(1) == '|'):
+			marker := string(r)
+			if (r == '_' || r == '|') && src.peek(1) == r {
+				marker += string(r)
+			}
+
+			if len(stack) > 0 && stack[len(stack)-1].marker == marker {
+				open := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				out.addEntity(tgbotapi.MessageEntity{Type: markdownStyles[marker]}, open.start)
+			} else if findMarkdownOpen(stack, marker) >= 0 {
+				top := stack[len(stack)-1]
+				line, column := src.position(top.pos)
+				return "", nil, src.errorAt(src.pos, "'%s' closes before '%s' opened at line %d, column %d is closed",
+					marker, top.marker, line, column)
+			} else {
+				stack = append(stack, markdownOpen{marker: marker, start: out.length, pos: src.pos})
+			}
+			src.pos += len(marker)
+
+		case strings.ContainsRune(markdownReserved, r):
+			return "", nil, src.errorAt(src.pos, "character '%c' is reserved and must be escaped with '\\'", r)
+
+		default:
+			out.writeRune(r)
+			src.pos++
+		}
+	}
+
+	if quote != nil {
+		if err := closeMarkdownQuote(src, out, stack, quote); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if len(stack) > 0 {
+		open := stack[len(stack)-1]
+		if open.marker == "[" {
+			return "", nil, src.errorAt(open.pos, "link text opened here is never closed with ']'")
+		}
+		return "", nil, src.errorAt(open.pos, "'%s' opened here is never closed", open.marker)
+	}
+
+	plain, entities := out.result()
+	return plain, entities, nil
+}
+
+// closeMarkdownQuote ends a block quote at the current position. Styles opened inside the quote
+// must be closed first, and expandable quotes must end with "||".
+func closeMarkdownQuote(src *source, out *builder, stack []markdownOpen, quote *markdownOpen) error {
+	if len(stack) > 0 && stack[len(stack)-1].pos > quote.pos {
+		top := stack[len(stack)-1]
+		return src.errorAt(top.pos, "'%s' opened here must be closed before the quote ends", top.marker)
+	}
+
+	entityType := "blockquote"
+	if quote.marker == "**>" {
+		if !src.hasPrefix("||") {
+			return src.errorAt(quote.pos, "expandable quote opened here must end with '||' at the end of its last line")
+		}
+		entityType = "expandable_blockquote"
+	}
+	out.addEntity(tgbotapi.MessageEntity{Type: entityType}, quote.start)
+	return nil
+}
+
+// findMarkdownOpen returns the stack index of an open marker, or -1
+func findMarkdownOpen(stack []markdownOpen, marker string) int {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].marker == marker {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseMarkdownCode parses inline code `...` or a pre block ```language ...```
+func parseMarkdownCode(src *source, out *builder) error {
+	start := src.pos
+	entity := tgbotapi.MessageEntity{Type: "code"}
+	fence := "`"
+
+	if src.hasPrefix("```") {
+		entity.Type = "pre"
+		fence = "```"
+		src.pos += 3
+
+		// An optional language follows the opening fence on the same line
+		lineEnd := src.pos
+		for lineEnd < len(src.runes) && src.runes[lineEnd] != '\n' && src.runes[lineEnd] != '`' {
+			lineEnd++
+		}
+		if lineEnd < len(src.runes) && src.runes[lineEnd] == '\n' {
+			language := strings.TrimSpace(string(src.runes[src.pos:lineEnd]))
+			if language != "" && !strings.ContainsAny(language, " \t") {
+				entity.Language = language
+				src.pos = lineEnd + 1
+			}
+		}
+	} else {
+		src.pos++
+	}
+
+	entityStart := out.length
+	for {
+		if src.eof() {
+			return src.errorAt(start, "'%s' opened here is never closed", fence)
+		}
+		if src.hasPrefix(fence) {
+			src.pos += len(fence)
+			break
+		}
+
+		r := src.peek(0)
+		if r == '\\' {
+			next := src.peek(1)
+			if next != '\\' && next != '`' {
+				return src.errorAt(src.pos, "only '\\' and '`' can be escaped inside code")
+			}
+			out.writeRune(next)
+			src.pos += 2
+			continue
+		}
+		if r == '`' {
+			return src.errorAt(src.pos, "character '`' inside code must be escaped with '\\'")
+		}
+
+		out.writeRune(r)
+		src.pos++
+	}
+
+	out.addEntity(entity, entityStart)
+	return nil
+}
+
+// parseMarkdownURL parses the (url) part of a link
+func parseMarkdownURL(src *source) (string, error) {
+	if src.peek(0) != '(' {
+		return "", src.errorAt(src.pos, "link text must be followed by '(url)'")
+	}
+	start := src.pos
+	src.pos++
+
+	var url strings.Builder
+	for {
+		if src.eof() {
+			return "", src.errorAt(start, "link URL opened here is never closed with ')'")
+		}
+
+		r := src.peek(0)
+		if r == ')' {
+			src.pos++
+			break
+		}
+		if r == '\\' {
+			next := src.peek(1)
+			if next != '\\' && next != ')' {
+				return "", src.errorAt(src.pos, "only '\\' and ')' can be escaped inside a link URL")
+			}
+			url.WriteRune(next)
+			src.pos += 2
+			continue
+		}
+
+		url.WriteRune(r)
+		src.pos++
+	}
+
+	if strings.TrimSpace(url.String()) == "" {
+		return "", src.errorAt(start, "link URL is empty")
+	}
+	return url.String(), nil
+}
@@ -0,0 +1,138 @@
+// Package markup parses Telegram MarkdownV2 and HTML formatted text into plain text and
+// message entities, so that formatted templates can be stored the same way as templates
+// captured from a formatted message.
+//
+// The parsers follow the Telegram Bot API formatting rules and reject markup that Telegram
+// would reject, reporting the line and column of the offending character. Custom emoji are
+// rejected as well since their entities cannot be stored.
+package markup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tg-channel-repost-bot/pkg/entityutil"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Format is a markup language a template can be authored in
+type Format string
+
+const (
+	FormatMarkdownV2 Format = "markdownv2"
+	FormatHTML       Format = "html"
+)
+
+// Error is a markup syntax error at a position of the source text
+type Error struct {
+	Line    int // 1-based line number
+	Column  int // 1-based column, counted in characters
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Parse parses source in the given format into plain text and entities
+func Parse(format Format, source string) (string, []tgbotapi.MessageEntity, error) {
+	switch format {
+	case FormatMarkdownV2:
+		return ParseMarkdownV2(source)
+	case FormatHTML:
+		return ParseHTML(source)
+	default:
+		return "", nil, fmt.Errorf("unsupported markup format: %s", format)
+	}
+}
+
+// builder accumulates the plain text and entities produced by a parser
+type builder struct {
+	text     strings.Builder
+	length   int // UTF-16 length of text
+	entities []tgbotapi.MessageEntity
+}
+
+func (b *builder) writeRune(r rune) {
+	b.text.WriteRune(r)
+	b.length += entityutil.UTF16Len(string(r))
+}
+
+func (b *builder) writeString(s string) {
+	b.text.WriteString(s)
+	b.length += entityutil.UTF16Len(s)
+}
+
+// addEntity adds an entity from start to the current end of the text; empty entities are dropped
+func (b *builder) addEntity(entity tgbotapi.MessageEntity, start int) {
+	if b.length <= start {
+		return
+	}
+	entity.Offset = start
+	entity.Length = b.length - start
+	b.entities = append(b.entities, entity)
+}
+
+// result returns the text and the entities ordered by offset, outer entities first
+func (b *builder) result() (string, []tgbotapi.MessageEntity) {
+	sort.SliceStable(b.entities, func(i, j int) bool {
+		if b.entities[i].Offset != b.entities[j].Offset {
+			return b.entities[i].Offset < b.entities[j].Offset
+		}
+		return b.entities[i].Length > b.entities[j].Length
+	})
+	return b.text.String(), b.entities
+}
+
+// source is the text being parsed, with position reporting
+type source struct {
+	runes []rune
+	pos   int
+}
+
+func (s *source) eof() bool {
+	return s.pos >= len(s.runes)
+}
+
+func (s *source) peek(offset int) rune {
+	if s.pos+offset >= len(s.runes) {
+		return 0
+	}
+	return s.runes[s.pos+offset]
+}
+
+func (s *source) hasPrefix(prefix string) bool {
+	for i, r := range []rune(prefix) {
+		if s.peek(i) != r {
+			return false
+		}
+	}
+	return true
+}
+
+// atLineStart reports whether the current position is at the start of a line
+func (s *source) atLineStart() bool {
+	return s.pos == 0 || s.runes[s.pos-1] == '\n'
+}
+
+// position returns the 1-based line and column of rune index pos
+func (s *source) position(pos int) (int, int) {
+	line, column := 1, 1
+	for i := 0; i < pos && i < len(s.runes); i++ {
+		if s.runes[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// errorAt returns an error positioned at rune index pos
+func (s *source) errorAt(pos int, format string, args ...interface{}) *Error {
+	line, column := s.position(pos)
+	return &Error{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,146 @@
+package markup
+
+import (
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func entity(entityType string, offset, length int) tgbotapi.MessageEntity {
+	return tgbotapi.MessageEntity{Type: entityType, Offset: offset, Length: length}
+}
+
+type parseTest struct {
+	name     string
+	source   string
+	text     string
+	entities []tgbotapi.MessageEntity
+}
+
+type errorTest struct {
+	name   string
+	source string
+	line   int
+	column int
+}
+
+func runParseTests(t *testing.T, format Format, tests []parseTest) {
+	t.Helper()
+	for _, tt := range tests {
+		text, entities, err := Parse(format, tt.source)
+		if err != nil {
+			t.Errorf("%s: Parse(%q) error: %v", tt.name, tt.source, err)
+			continue
+		}
+		if text != tt.text {
+			t.Errorf("%s: Parse(%q) text = %q, want %q", tt.name, tt.source, text, tt.text)
+		}
+		if !reflect.DeepEqual(entities, tt.entities) {
+			t.Errorf("%s: Parse(%q) entities = %+v, want %+v", tt.name, tt.source, entities, tt.entities)
+		}
+	}
+}
+
+func runErrorTests(t *testing.T, format Format, tests []errorTest) {
+	t.Helper()
+	for _, tt := range tests {
+		_, _, err := Parse(format, tt.source)
+		markupErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: Parse(%q) error = %v, want a markup error", tt.name, tt.source, err)
+			continue
+		}
+		if markupErr.Line != tt.line || markupErr.Column != tt.column {
+			t.Errorf("%s: Parse(%q) error at line %d, column %d, want line %d, column %d (%s)",
+				tt.name, tt.source, markupErr.Line, markupErr.Column, tt.line, tt.column, markupErr.Message)
+		}
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	link := entity("text_link", 0, 2)
+	link.URL = "https://t.me/a?b=1&c=2"
+
+	runParseTests(t, FormatHTML, []parseTest{
+		{"plain", "纯文本", "纯文本", nil},
+		{"styles", "<b>粗</b><i>斜</i><u>下</u><s>删</s>", "粗斜下删",
+			[]tgbotapi.MessageEntity{entity("bold", 0, 1), entity("italic", 1, 1), entity("underline", 2, 1), entity("strikethrough", 3, 1)}},
+		{"nested, outer first", "<b>a<i>b</i></b>", "ab", []tgbotapi.MessageEntity{entity("bold", 0, 2), entity("italic", 1, 1)}},
+		{"offsets after surrogate pairs", "😀<b>中文</b>👍🏻<i>x</i>", "😀中文👍🏻x",
+			[]tgbotapi.MessageEntity{entity("bold", 2, 2), entity("italic", 8, 1)}},
+		{"spoiler", "<tg-spoiler>秘密</tg-spoiler><span class=\"tg-spoiler\">😀</span>", "秘密😀",
+			[]tgbotapi.MessageEntity{entity("spoiler", 0, 2), entity("spoiler", 2, 2)}},
+		{"link with escaped href", "<a href=\"https://t.me/a?b=1&amp;c=2\">链接</a>", "链接", []tgbotapi.MessageEntity{link}},
+		{"character references", "&lt;&gt;&amp;&quot;&#39;&#x1F600;", "<>&\"'😀", nil},
+		{"pre with language", "<pre><code class=\"language-go\">x:=1</code></pre>", "x:=1",
+			[]tgbotapi.MessageEntity{{Type: "pre", Offset: 0, Length: 4, Language: "go"}}},
+		{"pre code without language is one pre block", "<pre><code>abc</code></pre>", "abc", []tgbotapi.MessageEntity{entity("pre", 0, 3)}},
+		{"inline code", "a <code>b</code>", "a b", []tgbotapi.MessageEntity{entity("code", 2, 1)}},
+		{"blockquote", "<blockquote>第一行\n第二行</blockquote>", "第一行\n第二行", []tgbotapi.MessageEntity{entity("blockquote", 0, 7)}},
+		{"expandable blockquote", "<blockquote expandable>长<b>引用</b></blockquote>", "长引用",
+			[]tgbotapi.MessageEntity{entity("expandable_blockquote", 0, 3), entity("bold", 1, 2)}},
+		{"empty tag dropped", "a<b></b>b", "ab", nil},
+	})
+}
+
+func TestParseHTMLErrors(t *testing.T) {
+	runErrorTests(t, FormatHTML, []errorTest{
+		{"unsupported tag", "a<div>b</div>", 1, 2},
+		{"unclosed tag", "第一行\n<b>粗体", 2, 1},
+		{"mismatched closing tag", "<b><i>x</b></i>", 1, 8},
+		{"closing tag without opening", "x</b>", 1, 2},
+		{"bare <", "1 < 2", 1, 3},
+		{"bare >", "1 > 2", 1, 3},
+		{"bare &", "a & b", 1, 3},
+		{"unknown character reference", "&nbsp;", 1, 1},
+		{"link without href", "<a>x</a>", 1, 1},
+		{"span without spoiler class", "<span>x</span>", 1, 1},
+		{"nested blockquote", "<blockquote>a<blockquote>b</blockquote></blockquote>", 1, 14},
+		{"custom emoji", "😀<tg-emoji emoji-id=\"1\">👍</tg-emoji>", 1, 2},
+		{"column counted in characters", "中文😀<x>", 1, 4},
+	})
+}
+
+func TestParseMarkdownV2(t *testing.T) {
+	link := entity("text_link", 0, 2)
+	link.URL = "https://t.me/a_(b)"
+
+	runParseTests(t, FormatMarkdownV2, []parseTest{
+		{"plain", "纯文本", "纯文本", nil},
+		{"styles", "*粗* _斜_ __下__ ~删~", "粗 斜 下 删",
+			[]tgbotapi.MessageEntity{entity("bold", 0, 1), entity("italic", 2, 1), entity("underline", 4, 1), entity("strikethrough", 6, 1)}},
+		{"nested", "*a _b_*", "a b", []tgbotapi.MessageEntity{entity("bold", 0, 3), entity("italic", 2, 1)}},
+		{"offsets after surrogate pairs", "😀*中文*👍🏻_x_", "😀中文👍🏻x",
+			[]tgbotapi.MessageEntity{entity("bold", 2, 2), entity("italic", 8, 1)}},
+		{"spoiler", "||秘密||", "秘密", []tgbotapi.MessageEntity{entity("spoiler", 0, 2)}},
+		{"escapes", "1\\. a\\-b \\!", "1. a-b !", nil},
+		{"link with escaped parenthesis", "[链接](https://t.me/a_(b\\))", "链接", []tgbotapi.MessageEntity{link}},
+		{"inline code keeps reserved characters", "`a.b*c`", "a.b*c", []tgbotapi.MessageEntity{entity("code", 0, 5)}},
+		{"pre with language", "```go\nx := 1\n```", "x := 1\n",
+			[]tgbotapi.MessageEntity{{Type: "pre", Offset: 0, Length: 7, Language: "go"}}},
+		{"blockquote", ">第一行\n>第二行\n正文", "第一行\n第二行\n正文", []tgbotapi.MessageEntity{entity("blockquote", 0, 7)}},
+		{"blockquote with styles", ">*粗体* 引用", "粗体 引用", []tgbotapi.MessageEntity{entity("blockquote", 0, 5), entity("bold", 0, 2)}},
+		{"expandable blockquote", "正文\n**>第一行\n>第二行||\n结尾", "正文\n第一行\n第二行\n结尾",
+			[]tgbotapi.MessageEntity{entity("expandable_blockquote", 3, 7)}},
+		{"spoiler at the end of an expandable blockquote", "**>a ||b||||", "a b",
+			[]tgbotapi.MessageEntity{entity("expandable_blockquote", 0, 3), entity("spoiler", 2, 1)}},
+		{"escaped > is not a quote", "\\>a", ">a", nil},
+	})
+}
+
+func TestParseMarkdownV2Errors(t *testing.T) {
+	runErrorTests(t, FormatMarkdownV2, []errorTest{
+		{"unescaped reserved character", "价格 1.5", 1, 5},
+		{"unclosed style", "第一行\n*粗体", 2, 1},
+		{"crossed styles", "*a _b* c_", 1, 6},
+		{"unclosed code", "a `b", 1, 3},
+		{"link without url", "[a] b", 1, 4},
+		{"unclosed link text", "[a", 1, 1},
+		{"> inside a line", "a > b", 1, 3},
+		{"style left open at the end of a quote", ">*a\nb*", 1, 2},
+		{"expandable blockquote without ||", "**>a\nb", 1, 1},
+		{"custom emoji", "😀![👍](tg://emoji?id=1)", 1, 2},
+		{"column counted in characters", "中文😀.", 1, 4},
+	})
+}